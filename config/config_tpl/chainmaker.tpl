@@ -180,11 +180,28 @@ rpc:
     # -1: unlimited, by default is 10000.
     token_bucket_size: -1
 
+    # Per method overrides, each has its own token bucket.
+    # SendRequest can be split by tx type, e.g. SendRequest/QUERY_CONTRACT, SendRequest/INVOKE_CONTRACT
+    methods:
+      # - method: SendRequest/QUERY_CONTRACT
+      #   token_per_second: 5000
+      #   token_bucket_size: 5000
+
   # Rate limit settings for subscriber
   subscriber:
     ratelimit:
       token_per_second: 100
       token_bucket_size: 100
+    # Limits of the Subscribe streams, 0 means unlimited, reloaded with the policy, see policy_reload_interval.
+    stream_limit:
+      # Max concurrent subscriptions of one client ip
+      max_per_ip: 0
+      # Max concurrent subscriptions of the node
+      max_global: 0
+      # Messages per second sent to one subscription
+      msg_per_second: 0
+      # Message token bucket size of one subscription, default is msg_per_second
+      msg_bucket_size: 0
 
   # RPC TLS settings
   tls:
@@ -197,15 +214,55 @@ rpc:
     # RPC TLS public key file path
     cert_file:      ../config/{org_path}/certs/{rpc_cert_path}.crt
 
-  # RPC blacklisted ip addresses
+  # RPC blacklisted ip addresses or CIDR ranges
   blacklist:
     addresses:
       # - "127.0.0.1"
+      # - "10.0.0.0/8"
+
+  # Interval of checking this file for blacklist, ratelimit and subscribe stream limit changes, in seconds.
+  # The blacklist and ratelimit settings are reloaded without restart when this file is modified.
+  # The minium value is 5.
+  policy_reload_interval: 10
+
+  # Queries at a past block height, by the __block_height__ parameter of QUERY_CONTRACT and by the tx trace.
+  # A query loads the read/write sets of all the blocks after its height.
+  history_query:
+    # Max blocks between the query height and the current height.
+    # 0: disabled, -1: unlimited, by default is 1000.
+    max_block_distance: 1000
 
   # RPC server max send/receive message size in MB
   max_send_msg_size: 10
   max_recv_msg_size: 10
 
+  # JSON/HTTP gateway of the RPC service, shares blacklist, ratelimit, logging and monitor with gRPC.
+  # Routes: POST /v1/send_request, POST /v1/subscribe (Server-Sent Events),
+  #         GET /v1/get_chainmaker_version, GET /v1/check_new_block_chain_config
+  gateway:
+    # Gateway switch. Default is false.
+    enabled: false
+    # Gateway port, uses the rpc TLS cert/key if tls mode is not disable,
+    # the client certs are verified against the chain trust roots in twoway mode.
+    # Only the standard x509 certs are supported by the gateway TLS.
+    port: 12401
+    # Max request body size in bytes
+    max_req_body_size: 16777216
+    # Chain admin apis, stop/restart/remove one chain of the node at runtime, the other chains are untouched.
+    # Routes: POST /v1/admin/list_chains, /v1/admin/stop_chain, /v1/admin/restart_chain, /v1/admin/remove_chain,
+    #         with body {"chain_id": "chain1", "timestamp": <unix seconds>, "sender": <endorsement entry>}.
+    # The sender is an admin of the chain, or of any chain of the node for list_chains and the removed chains,
+    # signing "<full method>|<chain_id>|<timestamp>" such as "/admin.ChainAdmin/StopChain|chain1|1650000000".
+    # The request is rejected 5 minutes before or after its timestamp.
+    admin:
+      # Admin apis switch. Default is false.
+      enabled: false
+      # Client ips allowed to call the admin apis, the requests from them are signed as well. Default is the
+      # loopback addresses.
+      allowed_ips:
+        - 127.0.0.1
+        - ::1
+
 # Transaction filter settings
 tx_filter:
   # default(store) 0; bird's nest 1; map 2; 3 sharding bird's nest
@@ -301,6 +358,44 @@ tx_filter:
       # 1 TableTypePacked packed table, use semi-sort to save 1 bit per item
       # 0 is recommended
       table_type: 0
+  # map config
+  # Evicted tx ids are checked against the store, so eviction never lets a duplicate tx pass.
+  map:
+    # Tx ids of blocks older than this number of blocks are evicted, 0 means never
+    expire_blocks: 0
+    # Tx ids of blocks whose timestamp is older than this number of seconds are evicted, 0 means never
+    expire_time: 0
+    # Oldest blocks are evicted when the filter holds more tx ids than this, 0 means unlimited
+    max_keys: 0
+    snapshot:
+      # Write a snapshot every this number of blocks
+      interval: 1000
+      # file path, snapshot is disabled if empty
+      path: ../data/{org_id}/tx_filter_map
+  # Chasing blocks into the filter on start
+  chase:
+    # Number of goroutines reading blocks, default is the number of CPUs
+    workers: 0
+    # Max number of blocks read ahead of the filter height, default is 64 per worker
+    window: 0
+    # Persist the filter every this number of blocks during the chase, so an interrupted start resumes from it,
+    # only effective for filters which support it, e.g. map with snapshot
+    checkpoint_interval: 100000
+    # Progress log interval in seconds
+    log_interval: 10
+
+# Block sync related settings
+sync:
+  # Block sync responses
+  response:
+    # Blocks of a response are packed into batches of at most this size in bytes, default is 4MB,
+    # a larger block is sent in a batch alone
+    max_batch_bytes: 4194304
+    # Compression of the batches, none or gzip, default is gzip.
+    # Only used for the nodes which accept it, so nodes of older versions still get uncompressed batches
+    compression: gzip
+    # Batches smaller than this size in bytes are not compressed
+    compress_threshold: 1024
 
 # Monitor related settings
 monitor:
@@ -310,6 +405,15 @@ monitor:
   # Monitor service port
   port: {monitor_port}
 
+  # Probes served with the metrics: /healthz (process alive and rpc listening),
+  # /readyz (every chain running, not behind the median height of the peers, recent block) and /status (json status of each chain)
+  health:
+    # A chain is not ready if its last block is older than it, in seconds.
+    # Blocks are only produced when there are txs, 0 disables the check, default is 0.
+    max_block_interval: 0
+    # Timeout of connecting the rpc port in /healthz, in seconds, default is 1.
+    rpc_dial_timeout: 1
+
 # PProf Settings
 pprof:
   # If pprof is enabled or not
@@ -336,6 +440,19 @@ scheduler:
   # whether log the txRWSet map in debug mode
   rwset_log: false
 
+  # Adaptive scheduling, learns the contract methods and keys which caused re-executions in the recent
+  # proposed blocks, and schedules the txs of the hot methods serially from the start instead of retrying
+  adaptive:
+    enabled: false
+    # The conflict statistics are multiplied by it after each block
+    decay: 0.9
+    # A method is hot if this rate of its executions conflicted
+    hot_conflict_rate: 0.2
+    # and it has conflicted at least this times recently
+    hot_min_conflicts: 2
+    # Max contract methods remembered
+    max_methods: 1024
+
 # Storage config settings
 # Contains blockDb, stateDb, historyDb, resultDb, contractEventDb
 #
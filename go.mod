@@ -71,6 +71,7 @@ require (
 	google.golang.org/genproto v0.0.0-20210828152312-66f60bf46e71 // indirect
 	google.golang.org/grpc v1.41.0
 	gorm.io/driver/mysql v1.2.0
+	gorm.io/driver/sqlite v1.2.6
 	gorm.io/gorm v1.22.3
 
 )
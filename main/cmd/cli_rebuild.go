@@ -22,25 +22,49 @@ import (
 	"github.com/spf13/cobra"
 )
 
+const (
+	flagNameOfResume          = "resume"
+	flagNameOfContinueOnError = "continue-on-error"
+	flagNameOfReport          = "report"
+)
+
 func RebuildDbsCMD() *cobra.Command {
+	var (
+		resume          string
+		continueOnError bool
+		reportPath      string
+	)
 	rebuildDbsCmd := &cobra.Command{
 		Use:   "rebuild-dbs",
 		Short: "RebuildDbs ChainMaker",
 		Long:  "RebuildDbs ChainMaker",
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			initLocalConfig(cmd)
-			backupDbs(rebuildChainId)
+			timeS := resume
+			if timeS == "" {
+				timeS = strconv.FormatInt(time.Now().UnixNano(), 10)
+			}
+			localconf.ChainMakerConfig.StorageConfig["rebuild_continue_on_error"] = continueOnError
+			localconf.ChainMakerConfig.StorageConfig["rebuild_report_path"] = reportPath
+			backupDbs(rebuildChainId, timeS, resume != "")
 			rebuildDbsStart()
 			fmt.Println("ChainMaker exit")
 			return nil
 		},
 	}
 	attachFlags(rebuildDbsCmd, []string{flagNameOfConfigFilepath, flagNameOfChainId})
+	rebuildDbsCmd.Flags().StringVar(&resume, flagNameOfResume, "",
+		"resume an interrupted rebuild, specify the suffix of the backup dbs made by it")
+	rebuildDbsCmd.Flags().BoolVar(&continueOnError, flagNameOfContinueOnError, false,
+		"keep rebuilding with the original read-write sets when a block fails to verify")
+	rebuildDbsCmd.Flags().StringVar(&reportPath, flagNameOfReport, "",
+		"specify the report file path, default <store_path>/<chain-id>/rebuild_report.json of the rebuilt dbs")
 	return rebuildDbsCmd
 }
 
-func backupDbs(chainId string) {
-	timeS := strconv.FormatInt(time.Now().UnixNano(), 10)
+// backupDbs move the dbs of the chain aside with the suffix timeS, the rebuild reads the blocks from them.
+// When resuming, the backup made by the interrupted rebuild is reused and the rebuilt dbs are kept
+func backupDbs(chainId, timeS string, resume bool) {
 	localconf.ChainMakerConfig.StorageConfig["back_path"] = timeS
 	localconf.ChainMakerConfig.StorageConfig["rebuild_chainId"] = chainId
 	config := &conf.StorageConfig{}
@@ -57,6 +81,14 @@ func backupDbs(chainId string) {
 		fmt.Println(s)
 		os.Exit(0)
 	}
+	if resume {
+		if !isExists {
+			fmt.Printf("back file(%s) is not exists, can not resume!\n", oldStorePath)
+			os.Exit(0)
+		}
+		fmt.Printf("resume rebuild-dbs from the backup with suffix %s\n", timeS)
+		return
+	}
 	if isExists {
 		fmt.Printf(
 			"back file(%s) is exists!\n",
@@ -75,6 +107,8 @@ func backupDbs(chainId string) {
 	}
 
 	backupDir(config.StorePath, timeS, chainId)
+	fmt.Printf("dbs are backed up with suffix %s, resume an interrupted rebuild with --%s %s\n",
+		timeS, flagNameOfResume, timeS)
 }
 
 func backupDir(oldPath, timeS, chainId string) {
@@ -129,7 +163,7 @@ func rebuildDbsStart() {
 	//}
 
 	// init monitor server
-	//monitorServer := monitor.NewMonitorServer()
+	//monitorServer, err := monitor.NewMonitorServer(chainMakerServer)
 
 	//// p2p callback to validate
 	//txpool.RegisterCallback(rpcServer.Gateway().Invoke)
@@ -0,0 +1,57 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"chainmaker.org/chainmaker-go/module/blockchain"
+	"github.com/spf13/cobra"
+)
+
+const flagNameOfHeight = "height"
+
+// ReplayBlockCMD re-execute the txs of a committed block and diff the results against the stored block
+func ReplayBlockCMD() *cobra.Command {
+	var height uint64
+	replayBlockCmd := &cobra.Command{
+		Use:   "replay-block",
+		Short: "Replay a committed block of ChainMaker",
+		Long: "Re-execute the txs of the block on the state of the previous block without writing anything, " +
+			"and diff the read-write sets, results, RwSetRoot and DagHash against the stored block",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			initLocalConfig(cmd)
+			report, err := blockchain.NewChainMakerServer().ReplayBlock(rebuildChainId, height)
+			if err != nil {
+				return err
+			}
+			printReplayReport(report)
+			if !report.Consistent() {
+				return errors.New("the replayed block differs from the stored block")
+			}
+			return nil
+		},
+	}
+	attachFlags(replayBlockCmd, []string{flagNameOfConfigFilepath, flagNameOfChainId})
+	replayBlockCmd.Flags().Uint64Var(&height, flagNameOfHeight, 0, "specify the height of the block to replay")
+	_ = replayBlockCmd.MarkFlagRequired(flagNameOfHeight)
+	return replayBlockCmd
+}
+
+func printReplayReport(report *blockchain.BlockReplayReport) {
+	fmt.Printf("replay block %d, %d txs, %d diffs\n", report.BlockHeight, report.TxCount, len(report.Diffs))
+	for _, diff := range report.Diffs {
+		fmt.Printf("tx[%d] %s %s differs\n  stored:   %s\n  replayed: %s\n",
+			diff.TxIndex, diff.TxId, diff.Field, diff.Stored, diff.Replayed)
+	}
+	fmt.Printf("RwSetRoot stored: %x, replayed: %x\n", report.RwSetRoot, report.ReplayedRwSetRoot)
+	fmt.Printf("DagHash   stored: %x, replayed: %x\n", report.DagHash, report.ReplayedDagHash)
+	if report.Consistent() {
+		fmt.Println("the replayed block is consistent with the stored block")
+	}
+}
@@ -66,7 +66,11 @@ func mainStart() {
 	}
 
 	// init monitor server
-	monitorServer := monitor.NewMonitorServer()
+	monitorServer, err := monitor.NewMonitorServer(chainMakerServer)
+	if err != nil {
+		log.Errorf("monitor server init failed, %s", err.Error())
+		return
+	}
 
 	//// p2p callback to validate
 	//txpool.RegisterCallback(rpcServer.Gateway().Invoke)
@@ -35,7 +35,7 @@ func initFlagSet() *pflag.FlagSet {
 	flags.StringVarP(&localconf.ConfigFilepath, flagNameOfConfigFilepath, flagNameShortHandOFConfigFilepath,
 		localconf.ConfigFilepath, "specify config file path, if not set, default use ./chainmaker.yml")
 	flags.StringVarP(&rebuildChainId, flagNameOfChainId, "",
-		"chain1", "specify chain-id, this flag only used by rebuild-dbs module")
+		"chain1", "specify chain-id, this flag only used by rebuild-dbs and replay-block modules")
 	return flags
 }
 
@@ -166,6 +166,28 @@ func (bc *Blockchain) InitForRebuildDbs() (err error) {
 	bc.log.Debug("start to init blockchain ...")
 	return bc.initExtModules(extModules)
 }
+
+// InitForReplayBlock init the modules needed to execute the txs of the committed blocks, nothing is written
+func (bc *Blockchain) InitForReplayBlock() (err error) {
+	baseModules := []map[string]func() error{
+		// init store module
+		{moduleNameStore: bc.initStore},
+		// init chain config , must latter than store module
+		{moduleNameChainConf: bc.initChainConf},
+	}
+	if err := bc.initBaseModules(baseModules); err != nil {
+		return err
+	}
+	extModules := []map[string]func() error{
+		// init access control
+		{moduleNameAccessControl: bc.initAC},
+		// init vm instances and module, the solo nodes provider is used without the net service
+		{moduleNameVM: bc.initVM},
+	}
+	bc.log.Debug("start to init blockchain for replay-block ...")
+	return bc.initExtModules(extModules)
+}
+
 func (bc *Blockchain) initBaseModules(baseModules []map[string]func() error) (err error) {
 	moduleNum := len(baseModules)
 	for idx, baseModule := range baseModules {
@@ -800,6 +822,7 @@ func (bc *Blockchain) initTxFilter() error {
 		return err
 	}
 	bc.txFilter = txFilter
+	filtercommon.RegisterStats(bc.chainId, txFilter)
 	bc.initModules[moduleNameTxFilter] = struct{}{}
 	return nil
 }
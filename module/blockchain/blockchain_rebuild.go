@@ -7,15 +7,64 @@ SPDX-License-Identifier: Apache-2.0
 package blockchain
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	"chainmaker.org/chainmaker/localconf/v2"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/utils/v2"
 
 	commonErrors "chainmaker.org/chainmaker/common/v2/errors"
 )
 
-// Start all the modules.
+// the keys of the storage config set by the rebuild-dbs command
+const (
+	rebuildBlockHeightKey     = "rebuild_block_height"
+	rebuildContinueOnErrorKey = "rebuild_continue_on_error"
+	rebuildReportPathKey      = "rebuild_report_path"
+)
+
+// rebuildReportFile the report file in the chain directory of the new dbs, used if rebuild_report_path is not set
+const rebuildReportFile = "rebuild_report.json"
+
+// RebuildReport the result of rebuilding the dbs, written as json when the rebuild ends
+type RebuildReport struct {
+	ChainId       string             `json:"chain_id"`
+	StartHeight   uint64             `json:"start_height"` // resumed from the last height of the rebuilt dbs
+	TargetHeight  uint64             `json:"target_height"`
+	RebuiltHeight uint64             `json:"rebuilt_height"`
+	Finished      bool               `json:"finished"`
+	Error         string             `json:"error,omitempty"`
+	Mismatches    []*RebuildMismatch `json:"mismatches"`
+	Timings       RebuildTimings     `json:"timings"`
+	rebuiltBlocks uint64
+}
+
+// RebuildMismatch a block of the old dbs which failed to verify, TxDiffs are the txs whose re-execution differs
+// from the original
+type RebuildMismatch struct {
+	BlockHeight uint64          `json:"block_height"`
+	Reason      string          `json:"reason"`
+	TxDiffs     []*TxReplayDiff `json:"tx_diffs,omitempty"`
+}
+
+// RebuildTimings the time used by each stage of the rebuild, in milliseconds
+type RebuildTimings struct {
+	Total       int64 `json:"total_ms"`
+	Read        int64 `json:"read_ms"`
+	Verify      int64 `json:"verify_ms"`
+	Commit      int64 `json:"commit_ms"`
+	AvgPerBlock int64 `json:"avg_per_block_ms"`
+}
+
+// RebuildDbs re-verify and re-commit the blocks of the old dbs into the new dbs. The rebuild resumes from the
+// last height of the new dbs, stops on the first verification failure unless rebuild_continue_on_error is set,
+// and writes a report to rebuild_report_path, or to rebuild_report.json of the new dbs, when it ends
 func (bc *Blockchain) RebuildDbs() {
 	fmt.Printf("###########################")
 	fmt.Printf("###start rebuild-dbs....###")
@@ -23,74 +72,166 @@ func (bc *Blockchain) RebuildDbs() {
 	bc.log.Infof("###########################")
 	bc.log.Infof("###start rebuild-dbs....###")
 	bc.log.Infof("###########################")
-	lastBlock, err := bc.oldStore.GetLastBlock()
+
+	report := &RebuildReport{ChainId: bc.chainId}
+	startTick := utils.CurrentTimeMillisSeconds()
+	err := bc.rebuildDbs(report)
+	report.Timings.Total = utils.CurrentTimeMillisSeconds() - startTick
+	if report.rebuiltBlocks > 0 {
+		report.Timings.AvgPerBlock = report.Timings.Total / int64(report.rebuiltBlocks)
+	}
+	exitCode := 0
 	if err != nil {
-		bc.log.Errorf("get lastblockerr(%s)", err.Error())
+		exitCode = 1
+		report.Error = err.Error()
+		bc.log.Errorf("rebuild-dbs stopped at block[%d], %s", report.RebuiltHeight+1, err.Error())
 	} else {
-		bc.log.Infof("lastBlock=%d", lastBlock.Header.BlockHeight)
+		report.Finished = true
 	}
-	var i, height uint64
-	var preHash []byte
-	bHeight, _ := localconf.ChainMakerConfig.StorageConfig["rebuild_block_height"].(int)
-	if bHeight <= 0 {
-		bc.log.Warnf("error block_height!")
-		height = lastBlock.GetHeader().BlockHeight
+	if reportPath, err := writeRebuildReport(report); err != nil {
+		bc.log.Errorf("write rebuild-dbs report failed, %s", err.Error())
 	} else {
-		if uint64(bHeight) <= lastBlock.GetHeader().BlockHeight {
-			height = uint64(bHeight)
-		} else {
-			height = lastBlock.GetHeader().BlockHeight
-		}
+		bc.log.Infof("rebuild-dbs report is written to %s", reportPath)
+	}
+
+	fmt.Printf("###########################")
+	fmt.Printf("###rebuild-dbs finished!###")
+	fmt.Printf("###########################")
+	bc.log.Infof("###########################")
+	bc.log.Infof("###rebuild-dbs finished!###")
+	bc.log.Infof("###########################")
+	bc.Stop()
+	os.Exit(exitCode)
+}
+
+func (bc *Blockchain) rebuildDbs(report *RebuildReport) error {
+	lastBlock, err := bc.oldStore.GetLastBlock()
+	if err != nil {
+		return fmt.Errorf("get last block of the old dbs failed, %s", err.Error())
+	}
+	bc.log.Infof("lastBlock=%d", lastBlock.Header.BlockHeight)
+	report.TargetHeight = lastBlock.Header.BlockHeight
+	if bHeight, _ := localconf.ChainMakerConfig.StorageConfig[rebuildBlockHeightKey].(int); bHeight <= 0 {
+		bc.log.Warnf("error block_height!")
+	} else if uint64(bHeight) < report.TargetHeight {
+		report.TargetHeight = uint64(bHeight)
+	}
+	continueOnError, _ := localconf.ChainMakerConfig.StorageConfig[rebuildContinueOnErrorKey].(bool)
+
+	// resume from the last block of the new dbs, which must be the same block in the old dbs
+	rebuiltBlock, err := bc.store.GetLastBlock()
+	if err != nil {
+		return fmt.Errorf("get last block of the new dbs failed, %s", err.Error())
+	}
+	report.RebuiltHeight = rebuiltBlock.Header.BlockHeight
+	report.StartHeight = report.RebuiltHeight + 1
+	oldBlock, err := bc.oldStore.GetBlock(report.RebuiltHeight)
+	if err != nil || oldBlock == nil {
+		return fmt.Errorf("get block[%d] of the old dbs failed, %v", report.RebuiltHeight, err)
+	}
+	if !bytes.Equal(oldBlock.Header.BlockHash, rebuiltBlock.Header.BlockHash) {
+		return fmt.Errorf("block[%d] of the new dbs is not the one of the old dbs, can not resume",
+			report.RebuiltHeight)
+	}
+	if report.StartHeight > 1 {
+		bc.log.Infof("resume rebuild-dbs from block[%d]", report.StartHeight)
 	}
-	for i = 1; i <= height; i++ {
+
+	preHash := rebuiltBlock.Header.BlockHash
+	for i := report.StartHeight; i <= report.TargetHeight; i++ {
+		readTick := utils.CurrentTimeMillisSeconds()
 		block, err := bc.oldStore.GetBlock(i)
 		if err != nil {
-			bc.log.Errorf("get block %d err(%s)", i, err.Error())
+			return fmt.Errorf("get block err(%s)", err.Error())
 		}
-		bc.log.Debugf("block %d hash is %x", i, block.GetHeader().BlockHash)
-		bc.log.Debugf("block %d prehash is %x", i, block.GetHeader().PreBlockHash)
-		if preHash != nil && string(preHash) != string(block.GetHeader().PreBlockHash) {
-			bc.log.Errorf("\npreHash=%x\nprehash=%x", []byte(preHash), block.GetHeader().PreBlockHash)
-			bc.log.Errorf("\nError!!!!\n")
-		} else {
-			bc.log.Debugf("\npreHash=%x\nprehash=%x", []byte(preHash), block.GetHeader().PreBlockHash)
+		if block == nil {
+			return errors.New("block is nil")
 		}
-		preHash = block.GetHeader().BlockHash
-
-		if err := bc.coreEngine.GetBlockVerifier().VerifyBlock(block, -1); err != nil {
-			if err == commonErrors.ErrBlockHadBeenCommited {
-				bc.log.Errorf("the block: %d has been committed in the blockChainStore ", block.Header.BlockHeight)
-			} else {
-				fmt.Printf("block[%d] verify success.", block.Header.BlockHeight)
-				bc.log.Infof("block[%d] verify success.", block.Header.BlockHeight)
+		verifyTick := utils.CurrentTimeMillisSeconds()
+		report.Timings.Read += verifyTick - readTick
+
+		if !bytes.Equal(preHash, block.Header.PreBlockHash) {
+			err = fmt.Errorf("pre block hash expect %x, got %x", preHash, block.Header.PreBlockHash)
+			report.Mismatches = append(report.Mismatches, &RebuildMismatch{BlockHeight: i, Reason: err.Error()})
+			if !continueOnError {
+				return err
 			}
-		} else {
-			fmt.Printf("block[%d] verify success.", block.Header.BlockHeight)
-			bc.log.Infof("block[%d] verify success.", block.Header.BlockHeight)
 		}
+		if err = bc.rebuildVerifyBlock(block, report, continueOnError); err != nil {
+			return err
+		}
+		commitTick := utils.CurrentTimeMillisSeconds()
+		report.Timings.Verify += commitTick - verifyTick
 
-		//time.Sleep(500*time.Millisecond)
-		if err := bc.coreEngine.GetBlockCommitter().AddBlock(block); err != nil {
-			if err == commonErrors.ErrBlockHadBeenCommited {
-				bc.log.Errorf("the block: %d has been committed in the blockChainStore ", block.Header.BlockHeight)
-			} else {
-				fmt.Printf("block[%d] rebuild success.", block.Header.BlockHeight)
-				bc.log.Infof("block[%d] rebuild success.", block.Header.BlockHeight)
+		if err = bc.coreEngine.GetBlockCommitter().AddBlock(block); err != nil {
+			if err != commonErrors.ErrBlockHadBeenCommited {
+				return fmt.Errorf("commit block failed, %s", err.Error())
 			}
-
-		} else {
-			bc.log.Infof("block[%d] rebuild success.", block.Header.BlockHeight)
-			fmt.Printf("block[%d] rebuild success.", block.Header.BlockHeight)
+			bc.log.Warnf("the block: %d has been committed in the blockChainStore ", block.Header.BlockHeight)
 		}
-		//time.Sleep(500 * time.Millisecond)
+		report.Timings.Commit += utils.CurrentTimeMillisSeconds() - commitTick
+		report.RebuiltHeight = i
+		report.rebuiltBlocks++
+		preHash = block.Header.BlockHash
+		bc.log.Infof("block[%d] rebuild success.", block.Header.BlockHeight)
+	}
+	return nil
+}
 
+// rebuildVerifyBlock verify the block by re-executing its txs. If it fails, the txs differing from the original
+// are recorded, and the block is verified with its original read-write sets if continueOnError
+func (bc *Blockchain) rebuildVerifyBlock(block *common.Block, report *RebuildReport, continueOnError bool) error {
+	verifier := bc.coreEngine.GetBlockVerifier()
+	err := verifier.VerifyBlock(block, -1)
+	if err == nil || err == commonErrors.ErrBlockHadBeenCommited {
+		return nil
 	}
-	fmt.Printf("###########################")
-	fmt.Printf("###rebuild-dbs finished!###")
-	fmt.Printf("###########################")
-	bc.log.Infof("###########################")
-	bc.log.Infof("###rebuild-dbs finished!###")
-	bc.log.Infof("###########################")
-	bc.Stop()
-	os.Exit(0)
+	bc.log.Errorf("block[%d] verify failed, %s", block.Header.BlockHeight, err.Error())
+	mismatch := &RebuildMismatch{BlockHeight: block.Header.BlockHeight, Reason: err.Error()}
+	report.Mismatches = append(report.Mismatches, mismatch)
+
+	rwSets, err := bc.oldStore.GetTxRWSetsByHeight(block.Header.BlockHeight)
+	if err != nil {
+		return fmt.Errorf("get rwsets of the old dbs failed, %s", err.Error())
+	}
+	// the new dbs hold the state before the block, so the txs are replayed on it to find the differences.
+	// The replay runs the txs with the store helper of the kv state, the sql txs can not be replayed
+	if bc.chainConf.ChainConfig().Contract.EnableSqlSupport {
+		bc.log.Warnf("the txs of block[%d] are not replayed, replaying the blocks of the sql enabled chain "+
+			"is not supported", block.Header.BlockHeight)
+	} else if replayReport, replayErr := bc.replayTxs(block, rwSets, bc.store); replayErr != nil {
+		bc.log.Warnf("replay block[%d] failed, %s", block.Header.BlockHeight, replayErr.Error())
+	} else {
+		mismatch.TxDiffs = replayReport.Diffs
+	}
+	if !continueOnError {
+		return errors.New(mismatch.Reason)
+	}
+	if err = verifier.VerifyBlockWithRwSets(block, rwSets, -1); err != nil &&
+		err != commonErrors.ErrBlockHadBeenCommited {
+		return fmt.Errorf("verify block with the original rwsets failed, %s", err.Error())
+	}
+	return nil
+}
+
+// writeRebuildReport write the report to rebuild_report_path, or to <store_path>/<chain id>/rebuild_report.json
+// of the new dbs if it is not set, return the path written
+func writeRebuildReport(report *RebuildReport) (string, error) {
+	storageConfig := localconf.ChainMakerConfig.StorageConfig
+	reportPath, _ := storageConfig[rebuildReportPathKey].(string)
+	if reportPath == "" {
+		storePath, _ := storageConfig["store_path"].(string)
+		reportPath = filepath.Join(storePath, report.ChainId, rebuildReportFile)
+	}
+	if report.Mismatches == nil {
+		report.Mismatches = make([]*RebuildMismatch, 0)
+	}
+	reportJ, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(filepath.Dir(reportPath), 0755); err != nil {
+		return "", err
+	}
+	return reportPath, ioutil.WriteFile(reportPath, reportJ, 0600)
 }
@@ -0,0 +1,170 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"chainmaker.org/chainmaker/common/v2/msgbus"
+	"chainmaker.org/chainmaker/localconf/v2"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+)
+
+// rebuildTestChain the old dbs hold the blocks 0 to 4, the new dbs hold the blocks up to rebuiltHeight.
+// The verification of the block at badHeight fails, the heights of the committed blocks are recorded
+type rebuildTestChain struct {
+	bc        *Blockchain
+	committed []uint64
+}
+
+func newRebuildTestChain(ctrl *gomock.Controller, rebuiltHeight, badHeight uint64,
+	rebuiltHash string) *rebuildTestChain {
+	blocks := make([]*common.Block, 5)
+	for i := range blocks {
+		blocks[i] = &common.Block{Header: &common.BlockHeader{BlockHeight: uint64(i),
+			BlockHash: []byte(fmt.Sprintf("hash%d", i))}}
+		if i > 0 {
+			blocks[i].Header.PreBlockHash = blocks[i-1].Header.BlockHash
+		}
+	}
+	oldStore := mock.NewMockBlockchainStore(ctrl)
+	oldStore.EXPECT().GetLastBlock().Return(blocks[4], nil).AnyTimes()
+	oldStore.EXPECT().GetBlock(gomock.Any()).DoAndReturn(func(height uint64) (*common.Block, error) {
+		return blocks[height], nil
+	}).AnyTimes()
+	oldStore.EXPECT().GetTxRWSetsByHeight(gomock.Any()).Return([]*common.TxRWSet{}, nil).AnyTimes()
+
+	store := mock.NewMockBlockchainStore(ctrl)
+	store.EXPECT().GetLastBlock().Return(&common.Block{Header: &common.BlockHeader{BlockHeight: rebuiltHeight,
+		BlockHash: []byte(rebuiltHash)}}, nil).AnyTimes()
+
+	// the txs of the sql enabled chain are not replayed to find the differences
+	chainConf := mock.NewMockChainConf(ctrl)
+	chainConf.EXPECT().ChainConfig().Return(&configPb.ChainConfig{
+		Contract: &configPb.ContractConfig{EnableSqlSupport: true}}).AnyTimes()
+
+	chain := &rebuildTestChain{}
+	verifier := mock.NewMockBlockVerifier(ctrl)
+	verifier.EXPECT().VerifyBlock(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(block *common.Block, mode protocol.VerifyMode) error {
+			if block.Header.BlockHeight == badHeight {
+				return errors.New("rwset root mismatch")
+			}
+			return nil
+		}).AnyTimes()
+	verifier.EXPECT().VerifyBlockWithRwSets(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	committer := mock.NewMockBlockCommitter(ctrl)
+	committer.EXPECT().AddBlock(gomock.Any()).DoAndReturn(func(block *common.Block) error {
+		chain.committed = append(chain.committed, block.Header.BlockHeight)
+		return nil
+	}).AnyTimes()
+	coreEngine := mock.NewMockCoreEngine(ctrl)
+	coreEngine.EXPECT().GetBlockVerifier().Return(verifier).AnyTimes()
+	coreEngine.EXPECT().GetBlockCommitter().Return(committer).AnyTimes()
+
+	chain.bc = NewBlockchain("", "chain1", msgbus.NewMessageBus(), nil)
+	chain.bc.oldStore = oldStore
+	chain.bc.store = store
+	chain.bc.chainConf = chainConf
+	chain.bc.coreEngine = coreEngine
+	return chain
+}
+
+// setRebuildTestConfig set the storage config of the rebuild, it is restored when the test ends
+func setRebuildTestConfig(t *testing.T, continueOnError bool) {
+	storageConfig := localconf.ChainMakerConfig.StorageConfig
+	t.Cleanup(func() {
+		localconf.ChainMakerConfig.StorageConfig = storageConfig
+	})
+	localconf.ChainMakerConfig.StorageConfig = map[string]interface{}{
+		rebuildBlockHeightKey:     10,
+		rebuildContinueOnErrorKey: continueOnError,
+	}
+}
+
+func TestRebuildDbs_Resume(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	setRebuildTestConfig(t, false)
+
+	// the new dbs hold the blocks up to 2, the rebuild resumes from 3
+	chain := newRebuildTestChain(ctrl, 2, 100, "hash2")
+	report := &RebuildReport{ChainId: "chain1"}
+	require.NoError(t, chain.bc.rebuildDbs(report))
+	require.Equal(t, []uint64{3, 4}, chain.committed)
+	require.Equal(t, uint64(3), report.StartHeight)
+	require.Equal(t, uint64(4), report.TargetHeight)
+	require.Equal(t, uint64(4), report.RebuiltHeight)
+	require.Equal(t, uint64(2), report.rebuiltBlocks)
+	require.Empty(t, report.Mismatches)
+
+	// the last block of the new dbs is not the one of the old dbs
+	chain = newRebuildTestChain(ctrl, 2, 100, "other hash")
+	report = &RebuildReport{ChainId: "chain1"}
+	require.Error(t, chain.bc.rebuildDbs(report))
+	require.Empty(t, chain.committed)
+}
+
+func TestRebuildDbs_StopOnMismatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	setRebuildTestConfig(t, false)
+
+	// the rebuild stops at the block failing to verify, the blocks before it are committed
+	chain := newRebuildTestChain(ctrl, 0, 3, "hash0")
+	report := &RebuildReport{ChainId: "chain1"}
+	require.Error(t, chain.bc.rebuildDbs(report))
+	require.Equal(t, []uint64{1, 2}, chain.committed)
+	require.Equal(t, uint64(2), report.RebuiltHeight)
+	require.Len(t, report.Mismatches, 1)
+	require.Equal(t, uint64(3), report.Mismatches[0].BlockHeight)
+	require.Empty(t, report.Mismatches[0].TxDiffs)
+
+	// with rebuild_continue_on_error, the block is verified with the original read-write sets and committed
+	setRebuildTestConfig(t, true)
+	chain = newRebuildTestChain(ctrl, 0, 3, "hash0")
+	report = &RebuildReport{ChainId: "chain1"}
+	require.NoError(t, chain.bc.rebuildDbs(report))
+	require.Equal(t, []uint64{1, 2, 3, 4}, chain.committed)
+	require.Equal(t, uint64(4), report.RebuiltHeight)
+	require.Len(t, report.Mismatches, 1)
+}
+
+func TestWriteRebuildReport(t *testing.T) {
+	setRebuildTestConfig(t, false)
+	storePath := t.TempDir()
+	localconf.ChainMakerConfig.StorageConfig["store_path"] = storePath
+
+	// written to the chain directory of the new dbs by default
+	reportPath, err := writeRebuildReport(&RebuildReport{ChainId: "chain1", RebuiltHeight: 3})
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(storePath, "chain1", rebuildReportFile), reportPath)
+	reportJ, err := ioutil.ReadFile(reportPath)
+	require.NoError(t, err)
+	report := &RebuildReport{}
+	require.NoError(t, json.Unmarshal(reportJ, report))
+	require.Equal(t, uint64(3), report.RebuiltHeight)
+	require.NotNil(t, report.Mismatches)
+
+	// rebuild_report_path is used if set
+	localconf.ChainMakerConfig.StorageConfig[rebuildReportPathKey] = filepath.Join(storePath, "report.json")
+	reportPath, err = writeRebuildReport(&RebuildReport{ChainId: "chain1"})
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(storePath, "report.json"), reportPath)
+	require.FileExists(t, reportPath)
+}
@@ -0,0 +1,238 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	coreCommon "chainmaker.org/chainmaker-go/module/core/common"
+	"chainmaker.org/chainmaker-go/module/core/common/scheduler"
+	"chainmaker.org/chainmaker-go/module/snapshot"
+	"chainmaker.org/chainmaker/common/v2/msgbus"
+	"chainmaker.org/chainmaker/localconf/v2"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/utils/v2"
+	"github.com/gogo/protobuf/proto"
+)
+
+// the fields of the replay diffs
+const (
+	ReplayDiffFieldRWSet  = "rwset"
+	ReplayDiffFieldResult = "result"
+)
+
+// BlockReplayReport the differences between a committed block and the re-execution of its txs
+type BlockReplayReport struct {
+	BlockHeight       uint64
+	TxCount           int
+	Diffs             []*TxReplayDiff
+	RwSetRoot         []byte // stored in the block header
+	ReplayedRwSetRoot []byte
+	DagHash           []byte // stored in the block header
+	ReplayedDagHash   []byte // calculated from the dag rebuilt from the replayed read-write sets
+}
+
+// TxReplayDiff a field of a tx which differs between the stored block and the replay, the values are json
+type TxReplayDiff struct {
+	TxIndex  int    `json:"tx_index"`
+	TxId     string `json:"tx_id"`
+	Field    string `json:"field"`
+	Stored   string `json:"stored"`
+	Replayed string `json:"replayed"`
+}
+
+// Consistent returns true if the replay reproduced the stored block
+func (r *BlockReplayReport) Consistent() bool {
+	return len(r.Diffs) == 0 && bytes.Equal(r.RwSetRoot, r.ReplayedRwSetRoot) &&
+		bytes.Equal(r.DagHash, r.ReplayedDagHash)
+}
+
+// ReplayBlock init the blockchain of chainId for replaying and re-execute the txs of the block at height
+func (server *ChainMakerServer) ReplayBlock(chainId string, height uint64) (*BlockReplayReport, error) {
+	for _, chain := range localconf.ChainMakerConfig.GetBlockChains() {
+		if chain.ChainId != chainId {
+			continue
+		}
+		genesis, err := filepath.Abs(chain.Genesis)
+		if err != nil {
+			return nil, err
+		}
+		blockchain := NewBlockchain(genesis, chainId, msgbus.NewMessageBus(), nil)
+		if err = blockchain.InitForReplayBlock(); err != nil {
+			return nil, fmt.Errorf("init blockchain[%s] failed, %s", chainId, err.Error())
+		}
+		if err = blockchain.startVM(); err != nil {
+			return nil, err
+		}
+		defer blockchain.Stop()
+		return blockchain.ReplayBlock(height)
+	}
+	return nil, fmt.Errorf(chainIdNotFoundErrorTemplate, chainId)
+}
+
+// ReplayBlock re-execute the txs of the committed block at height on the state at height-1 following the dag
+// of the block, and diff the read-write sets, results and roots against the stored ones. Nothing is written
+func (bc *Blockchain) ReplayBlock(height uint64) (*BlockReplayReport, error) {
+	// the history state is rebuilt from the key history, which the sql state does not have
+	if bc.chainConf.ChainConfig().Contract.EnableSqlSupport {
+		return nil, errors.New("replaying the blocks of the sql enabled chain is not supported")
+	}
+	if height == 0 {
+		return nil, errors.New("the genesis block can not be replayed")
+	}
+
+	block, err := bc.store.GetBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block is nil, height:%d", height)
+	}
+	storedRWSets, err := bc.store.GetTxRWSetsByHeight(height)
+	if err != nil {
+		return nil, err
+	}
+
+	// the replay is an admin command, the distance to the current height is not limited
+	reader, err := snapshot.NewHistoryStateReader(bc.store, height-1, 0)
+	if err != nil {
+		return nil, err
+	}
+	reader.SetExecBlock(block)
+	return bc.replayTxs(block, storedRWSets, snapshot.NewHistoryStore(bc.store, reader))
+}
+
+// replayTxs re-execute the txs of the block on the state of store, which must be the state before the block,
+// and diff the read-write sets and results against the stored ones
+func (bc *Blockchain) replayTxs(block *common.Block, storedRWSets []*common.TxRWSet,
+	store protocol.BlockchainStore) (*BlockReplayReport, error) {
+	storedRWSetMap := make(map[string]*common.TxRWSet, len(storedRWSets))
+	for _, rwSet := range storedRWSets {
+		if rwSet != nil {
+			storedRWSetMap[rwSet.TxId] = rwSet
+		}
+	}
+
+	// the txs are executed on a copy, the results of the stored block are compared with
+	replayBlock, ok := proto.Clone(block).(*common.Block)
+	if !ok {
+		return nil, errors.New("clone block failed")
+	}
+	snap := snapshot.NewDryRunSnapshot(store, bc.log, replayBlock)
+	txScheduler := scheduler.TxSchedulerFactory{}.NewTxScheduler(bc.vmMgr, bc.chainConf,
+		coreCommon.NewKVStoreHelper(bc.chainId))
+	txRWSetMap, txResultMap, err := txScheduler.SimulateWithDag(replayBlock, snap)
+	if err != nil {
+		return nil, fmt.Errorf("simulate block[%d] failed, %s", block.Header.BlockHeight, err.Error())
+	}
+
+	hashType := bc.chainConf.ChainConfig().Crypto.Hash
+	report := &BlockReplayReport{
+		BlockHeight: block.Header.BlockHeight,
+		TxCount:     len(block.Txs),
+		RwSetRoot:   block.Header.RwSetRoot,
+		DagHash:     block.Header.DagHash,
+	}
+	for i, tx := range block.Txs {
+		replayTx := replayBlock.Txs[i]
+		rwSet, result := txRWSetMap[tx.Payload.TxId], txResultMap[tx.Payload.TxId]
+		if rwSet == nil || result == nil {
+			report.addDiff(i, tx.Payload.TxId, ReplayDiffFieldResult, tx.Result, nil)
+			replayTx.Result = &common.Result{}
+			continue
+		}
+		if result.RwSetHash, err = utils.CalcRWSetHash(hashType, rwSet); err != nil {
+			return nil, err
+		}
+		replayTx.Result = result
+
+		if storedRWSet, exist := storedRWSetMap[tx.Payload.TxId]; !exist {
+			report.addDiff(i, tx.Payload.TxId, ReplayDiffFieldRWSet, nil, rwSet)
+		} else {
+			storedRWSetHash, err := utils.CalcRWSetHash(hashType, storedRWSet)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(storedRWSetHash, result.RwSetHash) {
+				report.addDiff(i, tx.Payload.TxId, ReplayDiffFieldRWSet, storedRWSet, rwSet)
+			}
+		}
+		if err = coreCommon.VerifyTxResult(tx, result, hashType); err != nil {
+			report.addDiff(i, tx.Payload.TxId, ReplayDiffFieldResult, tx.Result, result)
+		}
+	}
+
+	if report.ReplayedRwSetRoot, err = utils.CalcRWSetRoot(hashType, replayBlock.Txs); err != nil {
+		return nil, err
+	}
+	replayedDag, err := rebuildDag(snap, block, bc.chainConf.ChainConfig().Contract.EnableSqlSupport)
+	if err != nil {
+		return nil, err
+	}
+	if report.ReplayedDagHash, err = utils.CalcDagHash(hashType, replayedDag); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// rebuildDag build the dag from the read-write sets of the txs applied to the snapshot, indexed by the order of
+// the txs in the block. The snapshot holds the txs in the order they were applied, which follows the dag of the
+// block but may differ from the order of the block
+func rebuildDag(snap protocol.Snapshot, block *common.Block, isSql bool) (*common.DAG, error) {
+	txIndexes := make(map[string]uint32, len(block.Txs))
+	for i, tx := range block.Txs {
+		txIndexes[tx.Payload.TxId] = uint32(i)
+	}
+	dag := &common.DAG{Vertexes: make([]*common.DAG_Neighbor, len(block.Txs))}
+	for i := range dag.Vertexes {
+		dag.Vertexes[i] = &common.DAG_Neighbor{Neighbors: make([]uint32, 0)}
+	}
+
+	txTable := snap.GetTxTable()
+	snapDag := snap.BuildDAG(isSql)
+	if len(snapDag.Vertexes) != len(txTable) {
+		return nil, fmt.Errorf("dag of %d vertexes built for %d txs", len(snapDag.Vertexes), len(txTable))
+	}
+	// the index in the block of the txs in the snapshot
+	blockIndexes := make([]uint32, len(txTable))
+	for i, tx := range txTable {
+		index, ok := txIndexes[tx.Payload.TxId]
+		if !ok {
+			return nil, fmt.Errorf("tx %s is not in block %d", tx.Payload.TxId, block.Header.BlockHeight)
+		}
+		blockIndexes[i] = index
+	}
+	for i, vertex := range snapDag.Vertexes {
+		neighbors := make([]uint32, 0, len(vertex.Neighbors))
+		for _, neighbor := range vertex.Neighbors {
+			neighbors = append(neighbors, blockIndexes[neighbor])
+		}
+		sort.Slice(neighbors, func(a, b int) bool {
+			return neighbors[a] < neighbors[b]
+		})
+		dag.Vertexes[blockIndexes[i]].Neighbors = neighbors
+	}
+	return dag, nil
+}
+
+func (r *BlockReplayReport) addDiff(txIndex int, txId, field string, stored, replayed interface{}) {
+	storedJ, _ := json.Marshal(stored)
+	replayedJ, _ := json.Marshal(replayed)
+	r.Diffs = append(r.Diffs, &TxReplayDiff{
+		TxIndex:  txIndex,
+		TxId:     txId,
+		Field:    field,
+		Stored:   string(storedJ),
+		Replayed: string(replayedJ),
+	})
+}
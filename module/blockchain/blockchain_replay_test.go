@@ -0,0 +1,53 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+)
+
+func newReplayTestTx(txId string) *common.Transaction {
+	return &common.Transaction{Payload: &common.Payload{TxId: txId}}
+}
+
+func TestRebuildDag(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	block := &common.Block{
+		Header: &common.BlockHeader{BlockHeight: 3},
+		Txs:    []*common.Transaction{newReplayTestTx("a"), newReplayTestTx("b"), newReplayTestTx("c")},
+	}
+
+	// a and b are independent and c depends on both, the txs were applied in the order b, a, c
+	snap := mock.NewMockSnapshot(ctrl)
+	snap.EXPECT().GetTxTable().Return([]*common.Transaction{block.Txs[1], block.Txs[0], block.Txs[2]})
+	snap.EXPECT().BuildDAG(false).Return(&common.DAG{Vertexes: []*common.DAG_Neighbor{
+		{Neighbors: []uint32{}},
+		{Neighbors: []uint32{}},
+		{Neighbors: []uint32{1, 0}},
+	}})
+	dag, err := rebuildDag(snap, block, false)
+	require.NoError(t, err)
+	require.Equal(t, &common.DAG{Vertexes: []*common.DAG_Neighbor{
+		{Neighbors: []uint32{}},
+		{Neighbors: []uint32{}},
+		{Neighbors: []uint32{0, 1}},
+	}}, dag)
+
+	// a tx not in the block
+	snap = mock.NewMockSnapshot(ctrl)
+	snap.EXPECT().GetTxTable().Return([]*common.Transaction{newReplayTestTx("d")})
+	snap.EXPECT().BuildDAG(false).Return(&common.DAG{Vertexes: []*common.DAG_Neighbor{{}}})
+	_, err = rebuildDag(snap, block, false)
+	require.Error(t, err)
+}
@@ -41,6 +41,11 @@ type ChainMakerServer struct {
 	// blockchains known by this node
 	blockchains sync.Map // map[string]*Blockchain
 
+	// chains stopped at runtime, and the listeners of their lifecycle
+	stoppedChains  sync.Map // map[string]struct{}
+	chainListeners sync.Map // map[string]ChainListener
+	lifecycleLock  sync.Mutex
+
 	readyC chan struct{}
 }
 
@@ -367,6 +372,9 @@ func (server *ChainMakerServer) Stop() {
 
 // AddTx add a transaction.
 func (server *ChainMakerServer) AddTx(chainId string, tx *common.Transaction, source protocol.TxSource) error {
+	if server.IsChainStopped(chainId) {
+		return fmt.Errorf("chain %s is stopped", chainId)
+	}
 	if blockchain, ok := server.blockchains.Load(chainId); ok {
 		return blockchain.(*Blockchain).txPool.AddTx(tx, source)
 	}
@@ -434,6 +442,47 @@ func (server *ChainMakerServer) GetNetService(chainId string) (protocol.NetServi
 	return nil, fmt.Errorf(chainIdNotFoundErrorTemplate, chainId)
 }
 
+// GetTxFilter get protocol.TxFilter of chain which id is the given.
+func (server *ChainMakerServer) GetTxFilter(chainId string) (protocol.TxFilter, error) {
+	if blockchain, ok := server.blockchains.Load(chainId); ok {
+		return blockchain.(*Blockchain).txFilter, nil
+	}
+
+	return nil, fmt.Errorf(chainIdNotFoundErrorTemplate, chainId)
+}
+
+// GetTxPool get protocol.TxPool of chain which id is the given.
+func (server *ChainMakerServer) GetTxPool(chainId string) (protocol.TxPool, error) {
+	if blockchain, ok := server.blockchains.Load(chainId); ok {
+		return blockchain.(*Blockchain).txPool, nil
+	}
+
+	return nil, fmt.Errorf(chainIdNotFoundErrorTemplate, chainId)
+}
+
+// GetSyncService get protocol.SyncService of chain which id is the given.
+func (server *ChainMakerServer) GetSyncService(chainId string) (protocol.SyncService, error) {
+	if blockchain, ok := server.blockchains.Load(chainId); ok {
+		return blockchain.(*Blockchain).syncServer, nil
+	}
+
+	return nil, fmt.Errorf(chainIdNotFoundErrorTemplate, chainId)
+}
+
+// GetNodeUid get the uid of the local node in the net shared by all chains, empty if the net is not inited.
+func (server *ChainMakerServer) GetNodeUid() string {
+	if server.net == nil {
+		return ""
+	}
+	return server.net.GetNodeUid()
+}
+
+// AddBlockchain add the chain to the node, the chain added before under the same chain id is replaced.
+// The chain is neither initialized nor started
+func (server *ChainMakerServer) AddBlockchain(chain *Blockchain) {
+	server.blockchains.Store(chain.chainId, chain)
+}
+
 // GetBlockchain get Blockchain of chain which id is the given.
 func (server *ChainMakerServer) GetBlockchain(chainId string) (*Blockchain, error) {
 	if blockchain, ok := server.blockchains.Load(chainId); ok {
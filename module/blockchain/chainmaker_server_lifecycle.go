@@ -0,0 +1,207 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+
+	"chainmaker.org/chainmaker-go/module/txfilter/filtercommon"
+	"chainmaker.org/chainmaker/localconf/v2"
+)
+
+// ChainEvent the lifecycle change of a chain made at runtime
+type ChainEvent int
+
+const (
+	// ChainEventStopped the modules of the chain are stopped, its store is still readable
+	ChainEventStopped ChainEvent = iota
+	// ChainEventRemoved the chain is stopped and removed from the node, its store is closed
+	ChainEventRemoved
+	// ChainEventStarted the chain is started again
+	ChainEventStarted
+)
+
+// String returns the name of the event
+func (e ChainEvent) String() string {
+	switch e {
+	case ChainEventStopped:
+		return "stopped"
+	case ChainEventRemoved:
+		return "removed"
+	case ChainEventStarted:
+		return "started"
+	default:
+		return "unknown"
+	}
+}
+
+// ChainListener is called after the lifecycle of a chain is changed, it should not block
+type ChainListener func(chainId string, event ChainEvent)
+
+// ChainStatus the status of a chain of the node
+type ChainStatus struct {
+	ChainId     string `json:"chain_id"`
+	Running     bool   `json:"running"`
+	BlockHeight uint64 `json:"block_height"`
+}
+
+// SetChainListener set the listener of the chain lifecycle under name, the listener set before under the same
+// name is replaced, nil removes it
+func (server *ChainMakerServer) SetChainListener(name string, listener ChainListener) {
+	if listener == nil {
+		server.chainListeners.Delete(name)
+		return
+	}
+	server.chainListeners.Store(name, listener)
+}
+
+func (server *ChainMakerServer) notifyChainEvent(chainId string, event ChainEvent) {
+	log.Infof("chain[%s] is %s", chainId, event)
+	server.chainListeners.Range(func(_, value interface{}) bool {
+		value.(ChainListener)(chainId, event)
+		return true
+	})
+}
+
+// IsChainStopped returns true if the chain is stopped at runtime
+func (server *ChainMakerServer) IsChainStopped(chainId string) bool {
+	_, stopped := server.stoppedChains.Load(chainId)
+	return stopped
+}
+
+// ListBlockchains returns the status of the chains of the node ordered by chain id
+func (server *ChainMakerServer) ListBlockchains() []*ChainStatus {
+	chains := make([]*ChainStatus, 0)
+	server.blockchains.Range(func(key, value interface{}) bool {
+		chainId, _ := key.(string)
+		status := &ChainStatus{ChainId: chainId, Running: !server.IsChainStopped(chainId)}
+		if bc, ok := value.(*Blockchain); ok && bc.store != nil {
+			if lastBlock, err := bc.store.GetLastBlock(); err == nil && lastBlock != nil {
+				status.BlockHeight = lastBlock.Header.BlockHeight
+			}
+		}
+		chains = append(chains, status)
+		return true
+	})
+	sort.Slice(chains, func(i, j int) bool {
+		return chains[i].ChainId < chains[j].ChainId
+	})
+	return chains
+}
+
+// StopBlockchain stop the modules of the chain, the other chains of the node are untouched
+func (server *ChainMakerServer) StopBlockchain(chainId string) error {
+	server.lifecycleLock.Lock()
+	defer server.lifecycleLock.Unlock()
+
+	chain, err := server.GetBlockchain(chainId)
+	if err != nil {
+		return err
+	}
+	if server.IsChainStopped(chainId) {
+		return fmt.Errorf("chain %s is already stopped", chainId)
+	}
+	server.stoppedChains.Store(chainId, struct{}{})
+	chain.stopModulesForRestart()
+	filtercommon.UnregisterStats(chainId)
+	server.notifyChainEvent(chainId, ChainEventStopped)
+	return nil
+}
+
+// RemoveBlockchain stop the chain, close its store and remove it from the node. The chain is still in the
+// config, so it is loaded again when the node restarts
+func (server *ChainMakerServer) RemoveBlockchain(chainId string) error {
+	server.lifecycleLock.Lock()
+	defer server.lifecycleLock.Unlock()
+
+	chain, err := server.GetBlockchain(chainId)
+	if err != nil {
+		return err
+	}
+	if !server.IsChainStopped(chainId) {
+		server.stoppedChains.Store(chainId, struct{}{})
+		chain.Stop()
+		server.notifyChainEvent(chainId, ChainEventStopped)
+	}
+	filtercommon.UnregisterStats(chainId)
+	server.blockchains.Delete(chainId)
+	server.stoppedChains.Delete(chainId)
+	if chain.store != nil {
+		if err = chain.store.Close(); err != nil {
+			log.Warnf("close store of chain[%s] failed, %s", chainId, err.Error())
+		}
+	}
+	server.notifyChainEvent(chainId, ChainEventRemoved)
+	return nil
+}
+
+// RestartBlockchain stop the chain if it is running and start it again. The removed chain is initialized from
+// the config like a newly added chain
+func (server *ChainMakerServer) RestartBlockchain(chainId string) error {
+	server.lifecycleLock.Lock()
+	defer server.lifecycleLock.Unlock()
+
+	chain, err := server.GetBlockchain(chainId)
+	if err != nil {
+		if chain, err = server.reloadBlockchain(chainId); err != nil {
+			return err
+		}
+	} else if !server.IsChainStopped(chainId) {
+		server.stoppedChains.Store(chainId, struct{}{})
+		chain.stopModulesForRestart()
+		filtercommon.UnregisterStats(chainId)
+		server.notifyChainEvent(chainId, ChainEventStopped)
+	}
+
+	// the stopped modules are created again
+	if err = chain.Init(); err != nil {
+		server.stoppedChains.Store(chainId, struct{}{})
+		return fmt.Errorf("init blockchain[%s] failed, %s", chainId, err.Error())
+	}
+	if err = chain.Start(); err != nil {
+		server.stoppedChains.Store(chainId, struct{}{})
+		return fmt.Errorf("start blockchain[%s] failed, %s", chainId, err.Error())
+	}
+	// the tx filter is kept across the restart, its statistics are exported again
+	if chain.txFilter != nil {
+		filtercommon.RegisterStats(chainId, chain.txFilter)
+	}
+	server.stoppedChains.Delete(chainId)
+	server.notifyChainEvent(chainId, ChainEventStarted)
+	return nil
+}
+
+// reloadBlockchain init the removed chain from the config
+func (server *ChainMakerServer) reloadBlockchain(chainId string) (*Blockchain, error) {
+	for _, chain := range localconf.ChainMakerConfig.GetBlockChains() {
+		if chain.ChainId != chainId {
+			continue
+		}
+		if err := server.initBlockchain(chainId, chain.Genesis); err != nil {
+			return nil, err
+		}
+		return server.GetBlockchain(chainId)
+	}
+	return nil, fmt.Errorf(chainIdNotFoundErrorTemplate, chainId)
+}
+
+// stopModulesForRestart stop the started modules of the chain and mark them as not initialized. The stopped
+// modules can not be started again, the sync service for one closes its channels when it stops, so they are
+// created again by Init when the chain restarts, the same way the modules changed by the chain config are
+func (bc *Blockchain) stopModulesForRestart() {
+	started := make([]string, 0, len(bc.startModules))
+	for name := range bc.startModules {
+		started = append(started, name)
+	}
+	bc.Stop()
+	for _, name := range started {
+		if !bc.isModuleStartUp(name) {
+			delete(bc.initModules, name)
+		}
+	}
+}
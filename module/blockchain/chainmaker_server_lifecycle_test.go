@@ -0,0 +1,118 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"chainmaker.org/chainmaker/common/v2/msgbus"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	consensusPb "chainmaker.org/chainmaker/pb-go/v2/consensus"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+)
+
+// newLifecycleTestChain a chain whose modules are initialized, the sync module is the real one and is started,
+// the others are mocks
+func newLifecycleTestChain(ctrl *gomock.Controller, chainId string, store protocol.BlockchainStore) *Blockchain {
+	chainConf := mock.NewMockChainConf(ctrl)
+	chainConf.EXPECT().ChainConfig().Return(&configPb.ChainConfig{
+		Consensus: &configPb.ConsensusConfig{Type: consensusPb.ConsensusType_TBFT}}).AnyTimes()
+	netService := mock.NewMockNetService(ctrl)
+	netService.EXPECT().Start().Return(nil).AnyTimes()
+	netService.EXPECT().Stop().Return(nil).AnyTimes()
+	netService.EXPECT().Subscribe(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	netService.EXPECT().ReceiveMsg(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	netService.EXPECT().BroadcastMsg(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	netService.EXPECT().SendMsg(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	ledgerCache := mock.NewMockLedgerCache(ctrl)
+	ledgerCache.EXPECT().CurrentHeight().Return(uint64(5), nil).AnyTimes()
+	ledgerCache.EXPECT().GetLastCommittedBlock().Return(
+		&common.Block{Header: &common.BlockHeader{BlockHeight: 5}}).AnyTimes()
+	coreEngine := mock.NewMockCoreEngine(ctrl)
+	coreEngine.EXPECT().GetBlockVerifier().Return(mock.NewMockBlockVerifier(ctrl)).AnyTimes()
+	coreEngine.EXPECT().GetBlockCommitter().Return(mock.NewMockBlockCommitter(ctrl)).AnyTimes()
+	coreEngine.EXPECT().Start().AnyTimes()
+	coreEngine.EXPECT().Stop().AnyTimes()
+	txPool := mock.NewMockTxPool(ctrl)
+	txPool.EXPECT().Start().Return(nil).AnyTimes()
+	txPool.EXPECT().Stop().Return(nil).AnyTimes()
+	vmMgr := mock.NewMockVmManager(ctrl)
+	vmMgr.EXPECT().Start().Return(nil).AnyTimes()
+	vmMgr.EXPECT().Stop().Return(nil).AnyTimes()
+
+	chain := NewBlockchain("", chainId, msgbus.NewMessageBus(), nil)
+	chain.store = store
+	chain.chainConf = chainConf
+	chain.netService = netService
+	chain.ledgerCache = ledgerCache
+	chain.coreEngine = coreEngine
+	chain.txPool = txPool
+	chain.vmMgr = vmMgr
+	for _, name := range []string{moduleNameSubscriber, moduleNameStore, moduleNameLedger, moduleNameChainConf,
+		moduleNameTxFilter, moduleNameAccessControl, moduleNameNetService, moduleNameVM, moduleNameTxPool,
+		moduleNameCore, moduleNameConsensus} {
+		chain.initModules[name] = struct{}{}
+	}
+	return chain
+}
+
+func TestChainLifecycle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mock.NewMockBlockchainStore(ctrl)
+	store.EXPECT().GetLastBlock().Return(&common.Block{Header: &common.BlockHeader{BlockHeight: 5}}, nil).AnyTimes()
+	store.EXPECT().Close().Return(nil).Times(2)
+
+	store.EXPECT().GetArchivedPivot().Return(uint64(0)).AnyTimes()
+
+	server := NewChainMakerServer()
+	chain1 := newLifecycleTestChain(ctrl, "chain1", store)
+	require.NoError(t, chain1.initSync())
+	require.NoError(t, chain1.startSyncService())
+	server.blockchains.Store("chain1", chain1)
+	chain2 := NewBlockchain("", "chain2", msgbus.NewMessageBus(), nil)
+	chain2.store = store
+	server.blockchains.Store("chain2", chain2)
+	var events []string
+	server.SetChainListener("test", func(chainId string, event ChainEvent) {
+		events = append(events, chainId+" "+event.String())
+	})
+
+	require.NoError(t, server.StopBlockchain("chain1"))
+	require.Error(t, server.StopBlockchain("chain1"))
+	require.True(t, server.IsChainStopped("chain1"))
+	require.False(t, server.IsChainStopped("chain2"))
+	require.Error(t, server.AddTx("chain1", &common.Transaction{}, 0))
+	require.Equal(t, []*ChainStatus{
+		{ChainId: "chain1", Running: false, BlockHeight: 5},
+		{ChainId: "chain2", Running: true, BlockHeight: 5},
+	}, server.ListBlockchains())
+
+	// the stopped sync module can not be started again, a new one is created and started
+	syncServer := chain1.syncServer
+	require.NoError(t, server.RestartBlockchain("chain1"))
+	require.False(t, server.IsChainStopped("chain1"))
+	require.NotSame(t, syncServer, chain1.syncServer)
+	require.True(t, chain1.isModuleStartUp(moduleNameSync))
+
+	require.NoError(t, server.RemoveBlockchain("chain2"))
+	_, err := server.GetBlockchain("chain2")
+	require.Error(t, err)
+	require.Len(t, server.ListBlockchains(), 1)
+
+	// the restarted chain is stopped again
+	require.NoError(t, server.RemoveBlockchain("chain1"))
+	require.False(t, chain1.isModuleStartUp(moduleNameSync))
+
+	require.Equal(t, []string{"chain1 stopped", "chain1 started", "chain2 stopped", "chain2 removed",
+		"chain1 stopped", "chain1 removed"}, events)
+}
@@ -8,6 +8,7 @@ package common
 import (
 	"fmt"
 
+	"chainmaker.org/chainmaker-go/module/txfilter/filtercommon"
 	"chainmaker.org/chainmaker/pb-go/v2/config"
 
 	"chainmaker.org/chainmaker/common/v2/msgbus"
@@ -96,7 +97,8 @@ func (cb *CommitBlock) CommitBlock(
 	filterLasts = utils.CurrentTimeMillisSeconds()
 	// The default filter type does not run AddsAndSetHeight
 	if localconf.ChainMakerConfig.TxFilter.Type != int32(config.TxFilterType_None) {
-		err = cb.txFilter.AddsAndSetHeight(utils.GetTxIds(block.Txs), block.Header.GetBlockHeight())
+		err = filtercommon.AddsAndSetHeight(cb.txFilter, utils.GetTxIds(block.Txs), block.Header.GetBlockHeight(),
+			block.Header.GetBlockTimestamp())
 		if err != nil {
 			// if add filter error, then panic
 			cb.log.Error(err)
@@ -0,0 +1,318 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package scheduler
+
+import (
+	"crypto/sha256"
+	"sort"
+	"sync"
+
+	"chainmaker.org/chainmaker-go/module/extconf"
+	"chainmaker.org/chainmaker/common/v2/monitor"
+	"chainmaker.org/chainmaker/localconf/v2"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	adaptiveConfigKey = "scheduler.adaptive"
+
+	defaultConflictDecay        = 0.9
+	defaultHotConflictRate      = 0.2
+	defaultHotMinConflicts      = 2
+	defaultMaxConflictMethods   = 1024
+	maxConflictKeysPerMethod    = 16
+	minConflictScore            = 0.01
+	hotLaneKeyPrefix            = "hot#"
+	hotLaneConflictKeyPrefix    = "key#"
+	hotLaneConflictMethodPrefix = "method#"
+)
+
+// adaptiveConfig adaptive scheduling config, read from scheduler.adaptive of chainmaker.yml
+type adaptiveConfig struct {
+	// Learn the conflicts of the proposed blocks and schedule the hot txs serially
+	Enabled bool `mapstructure:"enabled"`
+	// The conflict statistics are multiplied by it after each block, the older blocks weigh less
+	Decay float64 `mapstructure:"decay"`
+	// A method is hot if the rate of its executions conflicted reaches it
+	HotConflictRate float64 `mapstructure:"hot_conflict_rate"`
+	// and it has conflicted at least this times in the recent blocks
+	HotMinConflicts float64 `mapstructure:"hot_min_conflicts"`
+	// The methods with the fewest conflicts are forgotten beyond this number
+	MaxMethods int `mapstructure:"max_methods"`
+}
+
+// loadAdaptiveConfig load adaptive scheduling config from chainmaker.yml
+func loadAdaptiveConfig() (*adaptiveConfig, error) {
+	config := &adaptiveConfig{}
+	if err := extconf.Unmarshal(adaptiveConfigKey, config); err != nil {
+		return nil, err
+	}
+	if config.Decay <= 0 || config.Decay >= 1 {
+		config.Decay = defaultConflictDecay
+	}
+	if config.HotConflictRate <= 0 {
+		config.HotConflictRate = defaultHotConflictRate
+	}
+	if config.HotMinConflicts <= 0 {
+		config.HotMinConflicts = defaultHotMinConflicts
+	}
+	if config.MaxMethods <= 0 {
+		config.MaxMethods = defaultMaxConflictMethods
+	}
+	return config, nil
+}
+
+// conflictStats the re-executions of the recent blocks caused by each contract method and the keys they
+// conflicted on. The txs of the hot methods are scheduled serially from the start instead of retrying,
+// the methods conflicting on the same key share a lane
+type conflictStats struct {
+	lock    sync.Mutex
+	config  *adaptiveConfig
+	methods map[string]*methodConflicts // contract#method -> conflicts
+
+	metricReexecutions        *prometheus.CounterVec
+	metricSerializedTxs       *prometheus.CounterVec
+	metricAvoidedReexecutions *prometheus.CounterVec
+	metricHotMethods          *prometheus.GaugeVec
+}
+
+// methodConflicts decayed statistics of a contract method, the txs scheduled serially are not counted
+type methodConflicts struct {
+	executions float64
+	conflicts  float64
+	keys       map[string]float64 // contract#key -> conflicts
+}
+
+func newConflictStats(config *adaptiveConfig) *conflictStats {
+	stats := &conflictStats{
+		config:  config,
+		methods: make(map[string]*methodConflicts),
+	}
+	if localconf.ChainMakerConfig.MonitorConfig.Enabled {
+		stats.metricReexecutions = monitor.NewCounterVec(monitor.SUBSYSTEM_CORE_PROPOSER_SCHEDULER,
+			"metric_tx_reexecution_counter", "tx re-executions caused by conflicts", "chainId")
+		stats.metricSerializedTxs = monitor.NewCounterVec(monitor.SUBSYSTEM_CORE_PROPOSER_SCHEDULER,
+			"metric_tx_serialized_counter", "txs of the hot methods scheduled serially", "chainId")
+		stats.metricAvoidedReexecutions = monitor.NewCounterVec(monitor.SUBSYSTEM_CORE_PROPOSER_SCHEDULER,
+			"metric_avoided_reexecution_counter",
+			"estimated tx re-executions avoided by scheduling the hot methods serially", "chainId")
+		stats.metricHotMethods = monitor.NewGaugeVec(monitor.SUBSYSTEM_CORE_PROPOSER_SCHEDULER,
+			"metric_hot_methods", "contract methods scheduled serially", "chainId")
+	}
+	return stats
+}
+
+func methodKey(tx *commonPb.Transaction) string {
+	return tx.Payload.ContractName + "#" + tx.Payload.Method
+}
+
+// observe record an execution of the tx, conflictReads are the reads conflicted if it failed to apply
+func (cs *conflictStats) observe(tx *commonPb.Transaction, serialized bool, conflicted bool,
+	conflictReads []*commonPb.TxRead) {
+	if conflicted && cs.metricReexecutions != nil {
+		cs.metricReexecutions.WithLabelValues(tx.Payload.ChainId).Inc()
+	}
+	// the serial execution says nothing about the conflicts of the method
+	if serialized {
+		return
+	}
+
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	key := methodKey(tx)
+	m, ok := cs.methods[key]
+	if !ok {
+		m = &methodConflicts{keys: make(map[string]float64)}
+		cs.methods[key] = m
+	}
+	m.executions++
+	if !conflicted {
+		return
+	}
+	m.conflicts++
+	for _, txRead := range conflictReads {
+		m.keys[txRead.ContractName+"#"+string(txRead.Key)]++
+	}
+}
+
+// endBlock decay the statistics after a block is scheduled, and forget the methods rarely conflicted
+func (cs *conflictStats) endBlock(chainId string) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	hotMethods := 0
+	for key, m := range cs.methods {
+		m.executions *= cs.config.Decay
+		m.conflicts *= cs.config.Decay
+		if m.executions < minConflictScore {
+			delete(cs.methods, key)
+			continue
+		}
+		for k, score := range m.keys {
+			if score *= cs.config.Decay; score < minConflictScore {
+				delete(m.keys, k)
+			} else {
+				m.keys[k] = score
+			}
+		}
+		if len(m.keys) > maxConflictKeysPerMethod {
+			dropLowest(m.keys, len(m.keys)-maxConflictKeysPerMethod)
+		}
+		if cs.isHot(m) {
+			hotMethods++
+		}
+	}
+	if len(cs.methods) > cs.config.MaxMethods {
+		conflicts := make(map[string]float64, len(cs.methods))
+		for key, m := range cs.methods {
+			conflicts[key] = m.conflicts
+		}
+		for _, key := range lowestKeys(conflicts, len(cs.methods)-cs.config.MaxMethods) {
+			delete(cs.methods, key)
+		}
+	}
+	if cs.metricHotMethods != nil {
+		cs.metricHotMethods.WithLabelValues(chainId).Set(float64(hotMethods))
+	}
+}
+
+func (cs *conflictStats) isHot(m *methodConflicts) bool {
+	return m.conflicts >= cs.config.HotMinConflicts && m.conflicts >= cs.config.HotConflictRate*m.executions
+}
+
+// hotLane return the lane of the hot method, the key the method conflicts on mostly, or the method itself
+// if its conflicts are all on the iterator ranges. ok is false if the method is not hot
+func (cs *conflictStats) hotLane(key string) (lane string, rate float64, ok bool) {
+	m, exist := cs.methods[key]
+	if !exist || !cs.isHot(m) {
+		return "", 0, false
+	}
+	rate = m.conflicts / m.executions
+	if rate > 1 {
+		rate = 1
+	}
+	var topKey string
+	var topScore float64
+	for k, score := range m.keys {
+		if score > topScore || (score == topScore && k < topKey) {
+			topKey, topScore = k, score
+		}
+	}
+	if topKey == "" {
+		return hotLaneConflictMethodPrefix + key, rate, true
+	}
+	return hotLaneConflictKeyPrefix + topKey, rate, true
+}
+
+// group put the txs of the hot methods into serial lanes, the other txs are in the lanes of their senders if
+// bySender, otherwise in a lane each. nil is returned if none of the txs is hot
+func (cs *conflictStats) group(txBatch []*commonPb.Transaction, bySender bool) *SenderGroup {
+	cs.lock.Lock()
+	type hotLaneInfo struct {
+		txs  int
+		rate float64
+	}
+	hotLanes := make(map[string]*hotLaneInfo)
+	txLanes := make(map[string]string, len(txBatch))
+	for _, tx := range txBatch {
+		lane, rate, ok := cs.hotLane(methodKey(tx))
+		if !ok {
+			continue
+		}
+		txLanes[tx.Payload.TxId] = lane
+		info, exist := hotLanes[lane]
+		if !exist {
+			info = &hotLaneInfo{}
+			hotLanes[lane] = info
+		}
+		info.txs++
+		if rate > info.rate {
+			info.rate = rate
+		}
+	}
+	cs.lock.Unlock()
+	if len(txLanes) == 0 {
+		return nil
+	}
+
+	group := &SenderGroup{
+		txsMap:     make(map[[32]byte][]*commonPb.Transaction),
+		doneTxKeyC: make(chan [32]byte, len(txBatch)),
+		laneKeys:   make(map[string][32]byte, len(txBatch)),
+		serialized: make(map[string]bool, len(txLanes)),
+	}
+	for _, tx := range txBatch {
+		var laneKey [32]byte
+		if lane, ok := txLanes[tx.Payload.TxId]; ok {
+			laneKey = sha256.Sum256([]byte(hotLaneKeyPrefix + lane))
+			group.serialized[tx.Payload.TxId] = true
+		} else if bySender {
+			laneKey, _ = getSenderHashKey(tx)
+		} else {
+			laneKey = sha256.Sum256([]byte(tx.Payload.TxId))
+		}
+		group.laneKeys[tx.Payload.TxId] = laneKey
+		group.txsMap[laneKey] = append(group.txsMap[laneKey], tx)
+	}
+
+	if cs.metricSerializedTxs != nil {
+		chainId := txBatch[0].Payload.ChainId
+		// the txs after the first one of a lane would have conflicted at the rate of the lane
+		var avoided float64
+		for _, info := range hotLanes {
+			avoided += float64(info.txs-1) * info.rate
+		}
+		cs.metricSerializedTxs.WithLabelValues(chainId).Add(float64(len(txLanes)))
+		cs.metricAvoidedReexecutions.WithLabelValues(chainId).Add(avoided)
+	}
+	return group
+}
+
+// conflictReadSnapshot snapshot which tells the reads a tx failed to apply conflicted on
+type conflictReadSnapshot interface {
+	GetConflictReads(txSimContext protocol.TxSimContext) []*commonPb.TxRead
+}
+
+// observeConflicts feed the result of applying the tx to the conflict statistics
+func (ts *TxScheduler) observeConflicts(s protocol.Snapshot, txSimContext protocol.TxSimContext,
+	senderGroup *SenderGroup, applyResult bool) {
+	if ts.conflictStats == nil {
+		return
+	}
+	tx := txSimContext.GetTx()
+	var conflictReads []*commonPb.TxRead
+	if cs, ok := s.(conflictReadSnapshot); ok && !applyResult {
+		conflictReads = cs.GetConflictReads(txSimContext)
+	}
+	serialized := senderGroup != nil && senderGroup.serialized[tx.Payload.TxId]
+	ts.conflictStats.observe(tx, serialized, !applyResult, conflictReads)
+}
+
+// dropLowest delete the n entries with the lowest scores
+func dropLowest(scores map[string]float64, n int) {
+	for _, key := range lowestKeys(scores, n) {
+		delete(scores, key)
+	}
+}
+
+func lowestKeys(scores map[string]float64, n int) []string {
+	keys := make([]string, 0, len(scores))
+	for key := range scores {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if scores[keys[i]] != scores[keys[j]] {
+			return scores[keys[i]] < scores[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if n > len(keys) {
+		n = len(keys)
+	}
+	return keys[:n]
+}
@@ -0,0 +1,73 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"github.com/stretchr/testify/require"
+)
+
+func newAdaptiveTestTx(txId, method string) *commonPb.Transaction {
+	return &commonPb.Transaction{Payload: &commonPb.Payload{ChainId: "chain1", TxId: txId, ContractName: "c",
+		Method: method}}
+}
+
+func TestConflictStats_Group(t *testing.T) {
+	stats := newConflictStats(&adaptiveConfig{Decay: 0.8, HotConflictRate: 0.2, HotMinConflicts: 2, MaxMethods: 8})
+	hotRead := []*commonPb.TxRead{{ContractName: "c", Key: []byte("total")}}
+	for i := 0; i < 3; i++ {
+		// conflicted on the same key
+		stats.observe(newAdaptiveTestTx("", "inc"), false, true, hotRead)
+		stats.observe(newAdaptiveTestTx("", "dec"), false, true, hotRead)
+		// conflicted on the iterator ranges
+		stats.observe(newAdaptiveTestTx("", "sum"), false, true, nil)
+		stats.observe(newAdaptiveTestTx("", "transfer"), false, false, nil)
+	}
+	// the serial executions are not counted
+	for i := 0; i < 100; i++ {
+		stats.observe(newAdaptiveTestTx("", "inc"), true, false, nil)
+	}
+
+	var txBatch []*commonPb.Transaction
+	for i, method := range []string{"inc", "transfer", "dec", "sum", "transfer", "sum", "inc"} {
+		txBatch = append(txBatch, newAdaptiveTestTx(fmt.Sprintf("tx%d", i), method))
+	}
+	group := stats.group(txBatch, false)
+	require.NotNil(t, group)
+	require.Len(t, group.serialized, 5)
+	// inc and dec share the lane of the key, sum has its own lane, and each transfer is alone
+	require.Len(t, group.txsMap, 4)
+	incLane := group.laneKey(txBatch[0])
+	require.Equal(t, []*commonPb.Transaction{txBatch[0], txBatch[2], txBatch[6]}, group.txsMap[incLane])
+	require.Equal(t, []*commonPb.Transaction{txBatch[3], txBatch[5]}, group.txsMap[group.laneKey(txBatch[3])])
+	require.Len(t, group.txsMap[group.laneKey(txBatch[1])], 1)
+
+	// the conflicts fade out
+	stats.endBlock("chain1")
+	require.NotNil(t, stats.group(txBatch, false))
+	stats.endBlock("chain1")
+	require.Nil(t, stats.group(txBatch, false))
+}
+
+func TestConflictStats_EndBlock(t *testing.T) {
+	stats := newConflictStats(&adaptiveConfig{Decay: 0.5, HotConflictRate: 0.2, HotMinConflicts: 2, MaxMethods: 2})
+	for i, method := range []string{"m1", "m2", "m3"} {
+		for j := 0; j <= i; j++ {
+			stats.observe(newAdaptiveTestTx("", method), false, true,
+				[]*commonPb.TxRead{{ContractName: "c", Key: []byte(fmt.Sprintf("k%d", j))}})
+		}
+	}
+	stats.endBlock("chain1")
+	// the method with the fewest conflicts is forgotten
+	require.Len(t, stats.methods, 2)
+	require.NotContains(t, stats.methods, "c#m1")
+	require.Len(t, stats.methods["c#m3"].keys, 3)
+	require.Equal(t, 1.5, stats.methods["c#m3"].conflicts)
+}
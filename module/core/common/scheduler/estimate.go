@@ -0,0 +1,63 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"regexp"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+// EstimateTx dry run the invoke tx in the block against the snapshot with the same gas accounting as the
+// scheduling of the blocks, the tx is not applied to the snapshot.
+// If the tx has no gas limit, the gas is neither charged nor refunded, the gas used is calculated by the vm all the same
+func EstimateTx(vmMgr protocol.VmManager, chainConf protocol.ChainConf, tx *commonPb.Transaction,
+	snapshot protocol.Snapshot, block *commonPb.Block, log protocol.Logger) (protocol.TxSimContext, bool, error) {
+	if tx.Payload.TxType != commonPb.TxType_INVOKE_CONTRACT {
+		return nil, false, fmt.Errorf("expect tx type %s, but got %s", commonPb.TxType_INVOKE_CONTRACT,
+			tx.Payload.TxType)
+	}
+	ts, err := newDryRunScheduler(vmMgr, chainConf, tx.Payload.Limit == nil || tx.Payload.Limit.GasLimit == 0, log)
+	if err != nil {
+		return nil, false, err
+	}
+	txSimContext, _, runVmSuccess := ts.executeTx(tx, snapshot, block)
+	return txSimContext, runVmSuccess, nil
+}
+
+// RunTx run the tx in the tx sim context the way the scheduling of the blocks runs it, the gas limit is charged
+// before the contract and the unused gas is refunded after it, unless skipGasCharge is set.
+// The result is set to the tx sim context, the error is the one of the vm
+func RunTx(vmMgr protocol.VmManager, chainConf protocol.ChainConf, tx *commonPb.Transaction,
+	txSimContext protocol.TxSimContext, skipGasCharge bool, log protocol.Logger) (*commonPb.Result, error) {
+	ts, err := newDryRunScheduler(vmMgr, chainConf, skipGasCharge, log)
+	if err != nil {
+		return nil, err
+	}
+	txResult, _, err := ts.runVM(tx, txSimContext)
+	txSimContext.SetTxResult(txResult)
+	return txResult, err
+}
+
+// newDryRunScheduler create a scheduler to run single txs, it schedules no block
+func newDryRunScheduler(vmMgr protocol.VmManager, chainConf protocol.ChainConf, skipGasCharge bool,
+	log protocol.Logger) (*TxScheduler, error) {
+	keyReg, err := regexp.Compile(protocol.DefaultStateRegex)
+	if err != nil {
+		return nil, err
+	}
+	return &TxScheduler{
+		VmManager:     vmMgr,
+		log:           log,
+		chainConf:     chainConf,
+		keyReg:        keyReg,
+		skipGasCharge: skipGasCharge,
+	}, nil
+}
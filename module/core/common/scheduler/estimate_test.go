@@ -0,0 +1,218 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package scheduler
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/module/snapshot"
+	"chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	"chainmaker.org/chainmaker/protocol/v2/test"
+	"chainmaker.org/chainmaker/vm-native/v2/accountmgr"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	gasTestContract = "counter"
+	gasTestMethod   = "inc"
+	gasTestGasUsed  = 300
+)
+
+// gasTestCall a contract call of the vm, with the parameters of the gas accounting
+type gasTestCall struct {
+	method string
+	pk     string
+	amount string
+}
+
+// gasTestEnv the mocks to execute an invoke tx of a docker go contract with the gas enabled,
+// the contract calls of the vm are recorded
+type gasTestEnv struct {
+	vmMgr     *mock.MockVmManager
+	chainConf *mock.MockChainConf
+	store     *mock.MockBlockchainStore
+
+	lock  sync.Mutex
+	calls []gasTestCall
+}
+
+func newGasTestEnv(t *testing.T) *gasTestEnv {
+	ctrl := gomock.NewController(t)
+	env := &gasTestEnv{
+		vmMgr:     mock.NewMockVmManager(ctrl),
+		chainConf: mock.NewMockChainConf(ctrl),
+		store:     mock.NewMockBlockchainStore(ctrl),
+	}
+	env.chainConf.EXPECT().ChainConfig().Return(&configPb.ChainConfig{
+		ChainId:       "chain1",
+		Core:          &configPb.CoreSettings{},
+		Contract:      &configPb.ContractConfig{},
+		AccountConfig: &configPb.GasAccountConfig{EnableGas: true},
+	}).AnyTimes()
+	// the contracts are read from the state of the contract manager
+	env.store.EXPECT().ReadObject(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(contractName string, key []byte) ([]byte, error) {
+			if contractName != syscontract.SystemContract_CONTRACT_MANAGE.String() {
+				return nil, nil
+			}
+			contract := &commonPb.Contract{Name: gasTestContract, RuntimeType: commonPb.RuntimeType_DOCKER_GO,
+				Status: commonPb.ContractStatus_NORMAL}
+			if accountMgr := syscontract.SystemContract_ACCOUNT_MANAGER.String(); strings.HasSuffix(string(key),
+				accountMgr) {
+				contract = &commonPb.Contract{Name: accountMgr, RuntimeType: commonPb.RuntimeType_NATIVE,
+					Status: commonPb.ContractStatus_NORMAL}
+			}
+			return proto.Marshal(contract)
+		}).AnyTimes()
+	env.vmMgr.EXPECT().RunContract(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
+		gomock.Any(), gomock.Any()).DoAndReturn(
+		func(contract *commonPb.Contract, method string, byteCode []byte, parameters map[string][]byte,
+			txContext protocol.TxSimContext, gasUsed uint64, refTxType commonPb.TxType) (
+			*commonPb.ContractResult, protocol.ExecOrderTxType, commonPb.TxStatusCode) {
+			call := gasTestCall{method: method}
+			switch method {
+			case syscontract.GasAccountFunction_CHARGE_GAS.String():
+				call.pk, call.amount = string(parameters[accountmgr.ChargePublicKey]),
+					string(parameters[accountmgr.ChargeGasAmount])
+			case syscontract.GasAccountFunction_REFUND_GAS_VM.String():
+				call.pk, call.amount = string(parameters[accountmgr.RechargeKey]),
+					string(parameters[accountmgr.RechargeAmountKey])
+			}
+			env.lock.Lock()
+			env.calls = append(env.calls, call)
+			env.lock.Unlock()
+
+			result := &commonPb.ContractResult{Code: 0}
+			if method == gasTestMethod {
+				result.GasUsed = gasTestGasUsed
+			}
+			return result, protocol.ExecOrderTxTypeNormal, commonPb.TxStatusCode_SUCCESS
+		}).AnyTimes()
+	return env
+}
+
+func (env *gasTestEnv) takeCalls() []gasTestCall {
+	env.lock.Lock()
+	defer env.lock.Unlock()
+	calls := env.calls
+	env.calls = nil
+	return calls
+}
+
+func newGasTestTx(txId string, gasLimit uint64) *commonPb.Transaction {
+	tx := &commonPb.Transaction{
+		Payload: &commonPb.Payload{ChainId: "chain1", TxType: commonPb.TxType_INVOKE_CONTRACT, TxId: txId,
+			ContractName: gasTestContract, Method: gasTestMethod},
+		Sender: &commonPb.EndorsementEntry{Signer: &accesscontrol.Member{
+			OrgId: "org1", MemberType: accesscontrol.MemberType_PUBLIC_KEY, MemberInfo: []byte("sender pk")}},
+	}
+	if gasLimit > 0 {
+		tx.Payload.Limit = &commonPb.Limit{GasLimit: gasLimit}
+	}
+	return tx
+}
+
+func newGasTestBlock() *commonPb.Block {
+	return &commonPb.Block{Header: &commonPb.BlockHeader{ChainId: "chain1", BlockHeight: 10, BlockVersion: 2030000}}
+}
+
+// gasTestStoreHelper the store helper of the kv chains
+type gasTestStoreHelper struct{}
+
+func (gasTestStoreHelper) RollBack(*commonPb.Block, protocol.BlockchainStore) error { return nil }
+
+func (gasTestStoreHelper) BeginDbTransaction(protocol.BlockchainStore, string) {}
+
+func (gasTestStoreHelper) GetPoolCapacity() int { return 4 }
+
+func newGasTestScheduler(env *gasTestEnv) *TxScheduler {
+	return &TxScheduler{
+		VmManager:       env.vmMgr,
+		scheduleFinishC: make(chan bool),
+		log:             &test.GoLogger{},
+		chainConf:       env.chainConf,
+		StoreHelper:     gasTestStoreHelper{},
+		keyReg:          regexp.MustCompile(protocol.DefaultStateRegex),
+	}
+}
+
+func TestEstimateTx_GasParityWithSchedule(t *testing.T) {
+	env := newGasTestEnv(t)
+	log := &test.GoLogger{}
+
+	// the estimation
+	block := newGasTestBlock()
+	estimateTx := newGasTestTx("tx1", 1000)
+	txSimContext, runVmSuccess, err := EstimateTx(env.vmMgr, env.chainConf, estimateTx,
+		snapshot.NewDryRunSnapshot(env.store, log, block), block, log)
+	require.NoError(t, err)
+	require.True(t, runVmSuccess)
+	estimated := txSimContext.GetTxResult()
+	estimateCalls := env.takeCalls()
+
+	// the scheduling of the same tx in a block
+	block = newGasTestBlock()
+	scheduleTx := newGasTestTx("tx1", 1000)
+	block.Txs = []*commonPb.Transaction{scheduleTx}
+	_, _, err = newGasTestScheduler(env).Schedule(block, block.Txs,
+		snapshot.NewDryRunSnapshot(env.store, log, block))
+	require.NoError(t, err)
+	scheduleCalls := env.takeCalls()
+
+	// the gas limit is charged before the contract and the unused gas is refunded after it
+	require.Equal(t, []gasTestCall{
+		{method: syscontract.GasAccountFunction_CHARGE_GAS.String(), pk: "sender pk", amount: "1000"},
+		{method: gasTestMethod},
+		{method: syscontract.GasAccountFunction_REFUND_GAS_VM.String(), pk: "sender pk", amount: "700"},
+	}, estimateCalls)
+	require.Equal(t, scheduleCalls, estimateCalls)
+	require.Equal(t, scheduleTx.Result.Code, estimated.Code)
+	require.Equal(t, scheduleTx.Result.ContractResult.GasUsed, estimated.ContractResult.GasUsed)
+	require.EqualValues(t, gasTestGasUsed, estimated.ContractResult.GasUsed)
+}
+
+func TestEstimateTx_SkipGasCharge(t *testing.T) {
+	env := newGasTestEnv(t)
+	log := &test.GoLogger{}
+
+	// without gas limit, the gas used is estimated without charging or refunding any gas
+	block := newGasTestBlock()
+	txSimContext, runVmSuccess, err := EstimateTx(env.vmMgr, env.chainConf, newGasTestTx("tx1", 0),
+		snapshot.NewDryRunSnapshot(env.store, log, block), block, log)
+	require.NoError(t, err)
+	require.True(t, runVmSuccess)
+	require.Equal(t, commonPb.TxStatusCode_SUCCESS, txSimContext.GetTxResult().Code)
+	require.EqualValues(t, gasTestGasUsed, txSimContext.GetTxResult().ContractResult.GasUsed)
+	require.Equal(t, []gasTestCall{{method: gasTestMethod}}, env.takeCalls())
+
+	// the scheduling of a block does not skip the charge, the tx without gas limit fails
+	block = newGasTestBlock()
+	scheduleTx := newGasTestTx("tx1", 0)
+	block.Txs = []*commonPb.Transaction{scheduleTx}
+	_, _, err = newGasTestScheduler(env).Schedule(block, block.Txs,
+		snapshot.NewDryRunSnapshot(env.store, log, block))
+	require.NoError(t, err)
+	require.Equal(t, commonPb.TxStatusCode_GAS_BALANCE_NOT_ENOUGH_FAILED, scheduleTx.Result.Code)
+	require.Empty(t, env.takeCalls())
+
+	// only the invoke txs are estimated
+	queryTx := newGasTestTx("tx2", 1000)
+	queryTx.Payload.TxType = commonPb.TxType_QUERY_CONTRACT
+	_, _, err = EstimateTx(env.vmMgr, env.chainConf, queryTx, snapshot.NewDryRunSnapshot(env.store, log, block),
+		block, log)
+	require.Error(t, err)
+}
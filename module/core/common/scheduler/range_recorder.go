@@ -0,0 +1,123 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package scheduler
+
+import (
+	"sync"
+
+	"chainmaker.org/chainmaker-go/module/snapshot"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+// rangeSnapshot snapshot which accepts the key ranges read by the iterators of a tx,
+// so that iterator txs are checked for conflicts and scheduled in parallel like the others
+type rangeSnapshot interface {
+	ApplyTxSimContextWithRanges(txSimContext protocol.TxSimContext, specialTxType protocol.ExecOrderTxType,
+		runVmSuccess bool, applySpecialTx bool, ranges []*snapshot.KeyRange) (bool, int)
+}
+
+// rangeRecordSnapshot the snapshot seen by the vm of a single tx,
+// records the key ranges read by the iterators of the tx through the blockchain store
+type rangeRecordSnapshot struct {
+	protocol.Snapshot
+	store *rangeRecordStore
+}
+
+func newRangeRecordSnapshot(s protocol.Snapshot) *rangeRecordSnapshot {
+	return &rangeRecordSnapshot{
+		Snapshot: s,
+		store:    &rangeRecordStore{BlockchainStore: s.GetBlockchainStore()},
+	}
+}
+
+// GetBlockchainStore return the store which records the iterator ranges
+func (s *rangeRecordSnapshot) GetBlockchainStore() protocol.BlockchainStore {
+	return s.store
+}
+
+// ranges return the key ranges read by the iterators,
+// nil if the tx uses an iterator whose reads can not be expressed as key ranges
+func (s *rangeRecordSnapshot) ranges() []*snapshot.KeyRange {
+	s.store.lock.Lock()
+	defer s.store.lock.Unlock()
+	if s.store.unsupported {
+		return nil
+	}
+	return s.store.ranges
+}
+
+// rangeRecordStore the blockchain store seen by the vm of a single tx, records the iterators created
+type rangeRecordStore struct {
+	protocol.BlockchainStore
+	lock        sync.Mutex
+	ranges      []*snapshot.KeyRange
+	unsupported bool // the tx iterates over the tx history, which is not a key range of the state
+}
+
+// SelectObject record the key range of the iterator
+func (s *rangeRecordStore) SelectObject(contractName string, startKey []byte, limit []byte) (
+	protocol.StateIterator, error) {
+	s.record(&snapshot.KeyRange{ContractName: contractName, StartKey: startKey, Limit: limit})
+	return s.BlockchainStore.SelectObject(contractName, startKey, limit)
+}
+
+// GetHistoryForKey record the key as a range containing the key only
+func (s *rangeRecordStore) GetHistoryForKey(contractName string, key []byte) (protocol.KeyHistoryIterator, error) {
+	limit := make([]byte, len(key)+1)
+	copy(limit, key)
+	s.record(&snapshot.KeyRange{ContractName: contractName, StartKey: key, Limit: limit})
+	return s.BlockchainStore.GetHistoryForKey(contractName, key)
+}
+
+// GetAccountTxHistory mark the tx unsupported
+func (s *rangeRecordStore) GetAccountTxHistory(accountId []byte) (protocol.TxHistoryIterator, error) {
+	s.markUnsupported()
+	return s.BlockchainStore.GetAccountTxHistory(accountId)
+}
+
+// GetContractTxHistory mark the tx unsupported
+func (s *rangeRecordStore) GetContractTxHistory(contractName string) (protocol.TxHistoryIterator, error) {
+	s.markUnsupported()
+	return s.BlockchainStore.GetContractTxHistory(contractName)
+}
+
+func (s *rangeRecordStore) record(r *snapshot.KeyRange) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.ranges = append(s.ranges, r)
+}
+
+func (s *rangeRecordStore) markUnsupported() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.unsupported = true
+}
+
+// executeTxRecordingRanges execute the tx and record the key ranges read by its iterators,
+// the ranges are nil if the snapshot does not accept them or the block version is below snapshot.BlockVersionRangeDag
+func (ts *TxScheduler) executeTxRecordingRanges(tx *commonPb.Transaction, s protocol.Snapshot,
+	block *commonPb.Block) (protocol.TxSimContext, protocol.ExecOrderTxType, bool, []*snapshot.KeyRange) {
+	if _, ok := s.(rangeSnapshot); !ok || block.Header.BlockVersion < snapshot.BlockVersionRangeDag {
+		txSimContext, specialTxType, runVmSuccess := ts.executeTx(tx, s, block)
+		return txSimContext, specialTxType, runVmSuccess, nil
+	}
+	recordSnapshot := newRangeRecordSnapshot(s)
+	txSimContext, specialTxType, runVmSuccess := ts.executeTx(tx, recordSnapshot, block)
+	return txSimContext, specialTxType, runVmSuccess, recordSnapshot.ranges()
+}
+
+// applyTxSimContext apply the tx to the snapshot with the key ranges read by its iterators if any,
+// an iterator tx without ranges is left to be executed sequentially after the DAG is built
+func (ts *TxScheduler) applyTxSimContext(s protocol.Snapshot, txSimContext protocol.TxSimContext,
+	specialTxType protocol.ExecOrderTxType, runVmSuccess bool, ranges []*snapshot.KeyRange) (bool, int) {
+	if rs, ok := s.(rangeSnapshot); ok && specialTxType == protocol.ExecOrderTxTypeIterator && len(ranges) > 0 {
+		return rs.ApplyTxSimContextWithRanges(txSimContext, specialTxType, runVmSuccess, false, ranges)
+	}
+	return s.ApplyTxSimContext(txSimContext, specialTxType, runVmSuccess, false)
+}
@@ -50,6 +50,10 @@ type TxScheduler struct {
 	metricVMRunTime *prometheus.HistogramVec
 	StoreHelper     conf.StoreHelper
 	keyReg          *regexp.Regexp
+	// set by the gas estimation of the txs without gas limit, the gas is neither charged nor refunded
+	skipGasCharge bool
+	// not nil if the adaptive scheduling is enabled
+	conflictStats *conflictStats
 }
 
 // Transaction dependency in adjacency table representation
@@ -80,10 +84,15 @@ func (ts *TxScheduler) Schedule(block *commonPb.Block, txBatch []*commonPb.Trans
 	runningTxC := make(chan *commonPb.Transaction, txBatchSize)
 	finishC := make(chan bool)
 	if enableSenderGroup {
+		lanes := len(senderGroup.txsMap)
+		// the lanes of the adaptive scheduling are mostly single txs, keep the configured capacity
+		if senderGroup.laneKeys != nil && lanes > poolCapacity {
+			lanes = poolCapacity
+		}
 		if enableConflictsBitWindow {
-			conflictsBitWindow.setMaxPoolCapacity(len(senderGroup.txsMap))
+			conflictsBitWindow.setMaxPoolCapacity(lanes)
 		}
-		goRoutinePool.Tune(len(senderGroup.txsMap))
+		goRoutinePool.Tune(lanes)
 		go func() {
 			ts.sendTxBySenderGroup(conflictsBitWindow, senderGroup, runningTxC, enableConflictsBitWindow)
 		}()
@@ -113,12 +122,13 @@ func (ts *TxScheduler) Schedule(block *commonPb.Block, txBatch []*commonPb.Trans
 					if localconf.ChainMakerConfig.MonitorConfig.Enabled {
 						start = time.Now()
 					}
-					txSimContext, specialTxType, runVmSuccess := ts.executeTx(tx, snapshot, block)
+					txSimContext, specialTxType, runVmSuccess, ranges := ts.executeTxRecordingRanges(tx, snapshot, block)
 					tx.Result = txSimContext.GetTxResult()
 
-					// Apply failed means this tx's read set conflict with other txs' write set
-					applyResult, applySize := snapshot.ApplyTxSimContext(txSimContext, specialTxType,
-						runVmSuccess, false)
+					// Apply failed means this tx's read set or iterator ranges conflict with other txs' write set
+					applyResult, applySize := ts.applyTxSimContext(snapshot, txSimContext, specialTxType,
+						runVmSuccess, ranges)
+					ts.observeConflicts(snapshot, txSimContext, senderGroup, applyResult)
 					if !applyResult {
 						if enableConflictsBitWindow {
 							ts.adjustPoolSize(goRoutinePool, conflictsBitWindow, ConflictTx)
@@ -165,6 +175,9 @@ func (ts *TxScheduler) Schedule(block *commonPb.Block, txBatch []*commonPb.Trans
 	snapshot.Seal()
 	timeCostA := time.Since(startTime)
 	block.Dag = snapshot.BuildDAG(ts.chainConf.ChainConfig().Contract.EnableSqlSupport)
+	if ts.conflictStats != nil {
+		ts.conflictStats.endBlock(block.Header.ChainId)
+	}
 
 	// Execute special tx sequentially, and add to dag
 	if len(snapshot.GetSpecialTxTable()) > 0 {
@@ -198,6 +211,13 @@ func (ts *TxScheduler) initOptimizeTools(txBatch []*commonPb.Transaction) (bool,
 	if enableConflictsBitWindow {
 		conflictsBitWindow = NewConflictsBitWindow(txBatchSize)
 	}
+	// the txs of the hot methods are put into serial lanes
+	if ts.conflictStats != nil {
+		if group := ts.conflictStats.group(txBatch, enableSenderGroup); group != nil {
+			ts.log.Infof("%d txs of the hot methods are scheduled serially", len(group.serialized))
+			return enableConflictsBitWindow, true, conflictsBitWindow, group
+		}
+	}
 	if enableSenderGroup {
 		senderGroup = NewSenderGroup(txBatch)
 	}
@@ -239,8 +259,7 @@ func (ts *TxScheduler) handleApplyResult(enableConflictsBitWindow bool, enableSe
 		ts.metricVMRunTime.WithLabelValues(tx.Payload.ChainId).Observe(elapsed.Seconds())
 	}
 	if enableSenderGroup {
-		hashKey, _ := getSenderHashKey(tx)
-		senderGroup.doneTxKeyC <- hashKey
+		senderGroup.doneTxKeyC <- senderGroup.laneKey(tx)
 	}
 }
 
@@ -769,6 +788,9 @@ func (ts *TxScheduler) getAccountMgrContractAndPk(txSimContext protocol.TxSimCon
 }
 
 func (ts *TxScheduler) checkGasEnable() bool {
+	if ts.skipGasCharge {
+		return false
+	}
 	if ts.chainConf.ChainConfig() != nil && ts.chainConf.ChainConfig().AccountConfig != nil {
 		ts.log.Debugf("chain config account config enable gas is:%v", ts.chainConf.ChainConfig().AccountConfig.EnableGas)
 		return ts.chainConf.ChainConfig().AccountConfig.EnableGas
@@ -857,6 +879,8 @@ func wholeCertInfo(txSimContext protocol.TxSimContext, certHash string) (*common
 type SenderGroup struct {
 	txsMap     map[[32]byte][]*commonPb.Transaction
 	doneTxKeyC chan [32]byte
+	laneKeys   map[string][32]byte // tx id -> lane, nil if the lanes are the senders
+	serialized map[string]bool     // txs of the hot methods
 }
 
 func NewSenderGroup(txBatch []*commonPb.Transaction) *SenderGroup {
@@ -866,6 +890,15 @@ func NewSenderGroup(txBatch []*commonPb.Transaction) *SenderGroup {
 	}
 }
 
+// laneKey return the key of the lane the tx is in
+func (g *SenderGroup) laneKey(tx *commonPb.Transaction) [32]byte {
+	if g.laneKeys != nil {
+		return g.laneKeys[tx.Payload.TxId]
+	}
+	hashKey, _ := getSenderHashKey(tx)
+	return hashKey
+}
+
 func getSenderTxsMap(txBatch []*commonPb.Transaction) map[[32]byte][]*commonPb.Transaction {
 	senderTxsMap := make(map[[32]byte][]*commonPb.Transaction)
 	for _, tx := range txBatch {
@@ -46,6 +46,13 @@ func newTxScheduler(vmMgr protocol.VmManager, chainConf protocol.ChainConf, stor
 	if err != nil {
 		log.Fatalf("compile default state regex error %v", err)
 	}
+	if adaptiveConf, err := loadAdaptiveConfig(); err != nil {
+		log.Warnf("load adaptive scheduling config failed, adaptive scheduling disabled, %s", err.Error())
+	} else if adaptiveConf.Enabled {
+		log.Infof("adaptive scheduling enabled, decay: %v, hot conflict rate: %v", adaptiveConf.Decay,
+			adaptiveConf.HotConflictRate)
+		txScheduler.conflictStats = newConflictStats(adaptiveConf)
+	}
 	if localconf.ChainMakerConfig.MonitorConfig.Enabled {
 		txScheduler.metricVMRunTime = monitor.NewHistogramVec(monitor.SUBSYSTEM_CORE_PROPOSER_SCHEDULER, "metric_vm_run_time",
 			"VM run time metric", []float64{0.005, 0.01, 0.015, 0.05, 0.1, 1, 10}, "chainId")
@@ -0,0 +1,65 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package extconf reads the chainmaker.yml sections which are only used by chainmaker-go modules
+// and are not part of localconf.ChainMakerConfig.
+package extconf
+
+import (
+	"fmt"
+	"sync"
+
+	"chainmaker.org/chainmaker/localconf/v2"
+	"github.com/spf13/viper"
+)
+
+var (
+	mu        sync.Mutex
+	cmViper   *viper.Viper
+	viperPath string
+)
+
+// Unmarshal decodes the config section at key (e.g. "rpc.gateway") of the current chainmaker.yml into out.
+// out keeps its values if the section does not exist, so callers should fill in defaults first.
+func Unmarshal(key string, out interface{}) error {
+	v, err := load()
+	if err != nil {
+		return err
+	}
+	if !v.IsSet(key) {
+		return nil
+	}
+	if err = v.UnmarshalKey(key, out); err != nil {
+		return fmt.Errorf("unmarshal config [%s] failed, %s", key, err.Error())
+	}
+	return nil
+}
+
+// Reload drops the cached config file, the next Unmarshal reads it from disk again
+func Reload() {
+	mu.Lock()
+	defer mu.Unlock()
+	cmViper = nil
+}
+
+func load() (*viper.Viper, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if cmViper != nil && viperPath == localconf.ConfigFilepath {
+		return cmViper, nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(localconf.ConfigFilepath)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("read config [%s] failed, %s", localconf.ConfigFilepath, err.Error())
+	}
+	cmViper = v
+	viperPath = localconf.ConfigFilepath
+	return v, nil
+}
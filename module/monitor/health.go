@@ -0,0 +1,246 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"chainmaker.org/chainmaker-go/module/blockchain"
+	"chainmaker.org/chainmaker-go/module/extconf"
+	blockSync "chainmaker.org/chainmaker-go/module/sync"
+	"chainmaker.org/chainmaker/localconf/v2"
+	"chainmaker.org/chainmaker/logger/v2"
+	txpoolpb "chainmaker.org/chainmaker/pb-go/v2/txpool"
+)
+
+const (
+	healthConfigKey = "monitor.health"
+
+	healthDefaultRpcDialTimeout = 1 // second
+
+	consensusRoleConsensus = "consensus"
+	consensusRoleCommon    = "common"
+)
+
+// HealthConfig config of the probe endpoints, read from monitor.health of chainmaker.yml
+type HealthConfig struct {
+	// A chain is not ready if its last block is older than it, in seconds, 0 disables the check
+	MaxBlockInterval int64 `mapstructure:"max_block_interval"`
+	// Timeout of connecting the rpc port in /healthz, in seconds
+	RpcDialTimeout int64 `mapstructure:"rpc_dial_timeout"`
+}
+
+func loadHealthConfig() (*HealthConfig, error) {
+	config := &HealthConfig{RpcDialTimeout: healthDefaultRpcDialTimeout}
+	if err := extconf.Unmarshal(healthConfigKey, config); err != nil {
+		return nil, err
+	}
+	if config.RpcDialTimeout <= 0 {
+		config.RpcDialTimeout = healthDefaultRpcDialTimeout
+	}
+	return config, nil
+}
+
+// NodeStatus the response of /status
+type NodeStatus struct {
+	Version string         `json:"version"`
+	NodeUid string         `json:"node_uid"`
+	Chains  []*ChainStatus `json:"chains"`
+}
+
+// ChainStatus the status of a chain of the node in /status
+type ChainStatus struct {
+	ChainId        string                 `json:"chain_id"`
+	Running        bool                   `json:"running"`
+	BlockHeight    uint64                 `json:"block_height"`
+	BlockTimestamp int64                  `json:"block_timestamp"`
+	Peers          []string               `json:"peers"`
+	ConsensusType  string                 `json:"consensus_type"`
+	ConsensusRole  string                 `json:"consensus_role"` // consensus or common
+	TxPool         *txpoolpb.TxPoolStatus `json:"tx_pool,omitempty"`
+	Sync           *blockSync.SyncState   `json:"sync,omitempty"`
+	Errors         []string               `json:"errors,omitempty"`
+}
+
+// probeResult the response of /healthz and /readyz, Reasons are why the probe failed
+type probeResult struct {
+	Ok      bool     `json:"ok"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// healthHandler serves /healthz, /readyz and /status from the state of the chainmaker server
+type healthHandler struct {
+	config           *HealthConfig
+	chainMakerServer *blockchain.ChainMakerServer
+	log              *logger.CMLogger
+}
+
+func newHealthHandler(chainMakerServer *blockchain.ChainMakerServer, log *logger.CMLogger) (*healthHandler, error) {
+	config, err := loadHealthConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &healthHandler{
+		config:           config,
+		chainMakerServer: chainMakerServer,
+		log:              log,
+	}, nil
+}
+
+func (h *healthHandler) register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", h.handleHealthz)
+	mux.HandleFunc("/readyz", h.handleReadyz)
+	mux.HandleFunc("/status", h.handleStatus)
+}
+
+// handleHealthz the process is alive if it answers, and the rpc port must accept connections
+func (h *healthHandler) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	result := &probeResult{Ok: true}
+	endPoint := fmt.Sprintf("127.0.0.1:%d", localconf.ChainMakerConfig.RpcConfig.Port)
+	conn, err := net.DialTimeout("tcp", endPoint, time.Duration(h.config.RpcDialTimeout)*time.Second)
+	if err != nil {
+		result.Ok = false
+		result.Reasons = append(result.Reasons, fmt.Sprintf("rpc is not listening, %s", err.Error()))
+	} else {
+		_ = conn.Close()
+	}
+	h.writeProbe(w, result)
+}
+
+// handleReadyz the node is ready if every chain of the config is running, not catching up with the median height
+// of the peers and has a recent block
+func (h *healthHandler) handleReadyz(w http.ResponseWriter, _ *http.Request) {
+	result := &probeResult{Ok: true}
+	now := time.Now().Unix()
+	for _, chain := range localconf.ChainMakerConfig.GetBlockChains() {
+		if reason := h.checkChainReady(chain.ChainId, now); reason != "" {
+			result.Ok = false
+			result.Reasons = append(result.Reasons, fmt.Sprintf("chain[%s] %s", chain.ChainId, reason))
+		}
+	}
+	h.writeProbe(w, result)
+}
+
+// checkChainReady returns why the chain is not ready, empty if it is ready
+func (h *healthHandler) checkChainReady(chainId string, now int64) string {
+	store, err := h.chainMakerServer.GetStore(chainId)
+	if err != nil || store == nil {
+		return "is not initialized"
+	}
+	if h.chainMakerServer.IsChainStopped(chainId) {
+		return "is stopped"
+	}
+	if syncService, _ := h.chainMakerServer.GetSyncService(chainId); syncService != nil {
+		if provider, ok := syncService.(blockSync.SyncStateProvider); ok {
+			if state := provider.GetSyncState(); state.CatchingUp {
+				return fmt.Sprintf("is catching up, height %d, peers median height %d",
+					state.LocalHeight, state.PeersMedianHeight)
+			}
+		}
+	}
+	if h.config.MaxBlockInterval > 0 {
+		lastBlock, err := store.GetLastBlock()
+		if err != nil || lastBlock == nil {
+			return fmt.Sprintf("get last block failed, %v", err)
+		}
+		if interval := now - lastBlock.Header.BlockTimestamp; interval > h.config.MaxBlockInterval {
+			return fmt.Sprintf("has no block in %d seconds, height %d", interval, lastBlock.Header.BlockHeight)
+		}
+	}
+	return ""
+}
+
+// handleStatus the status of each chain of the node
+func (h *healthHandler) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	status := &NodeStatus{
+		Version: h.chainMakerServer.Version(),
+		NodeUid: h.chainMakerServer.GetNodeUid(),
+		Chains:  make([]*ChainStatus, 0),
+	}
+	for _, chain := range h.chainMakerServer.ListBlockchains() {
+		status.Chains = append(status.Chains, h.getChainStatus(chain, status.NodeUid))
+	}
+	h.writeJSON(w, http.StatusOK, status)
+}
+
+func (h *healthHandler) getChainStatus(chain *blockchain.ChainStatus, nodeUid string) *ChainStatus {
+	status := &ChainStatus{
+		ChainId:     chain.ChainId,
+		Running:     chain.Running,
+		BlockHeight: chain.BlockHeight,
+		Peers:       make([]string, 0),
+	}
+	addError := func(format string, args ...interface{}) {
+		status.Errors = append(status.Errors, fmt.Sprintf(format, args...))
+	}
+
+	if store, err := h.chainMakerServer.GetStore(chain.ChainId); err == nil && store != nil {
+		if lastBlock, err := store.GetLastBlock(); err != nil {
+			addError("get last block failed, %s", err.Error())
+		} else if lastBlock != nil {
+			status.BlockHeight = lastBlock.Header.BlockHeight
+			status.BlockTimestamp = lastBlock.Header.BlockTimestamp
+		}
+	}
+
+	if chainConf, err := h.chainMakerServer.GetChainConf(chain.ChainId); err == nil && chainConf != nil {
+		consensus := chainConf.ChainConfig().Consensus
+		status.ConsensusType = consensus.Type.String()
+		status.ConsensusRole = consensusRoleCommon
+		for _, node := range consensus.Nodes {
+			for _, nodeId := range node.NodeId {
+				if nodeId == nodeUid {
+					status.ConsensusRole = consensusRoleConsensus
+				}
+			}
+		}
+	}
+
+	if netService, err := h.chainMakerServer.GetNetService(chain.ChainId); err == nil && netService != nil {
+		nodes, err := netService.GetChainNodesInfoProvider().GetChainNodesInfo()
+		if err != nil {
+			addError("get peers failed, %s", err.Error())
+		}
+		for _, node := range nodes {
+			if node.NodeUid != nodeUid {
+				status.Peers = append(status.Peers, node.NodeUid)
+			}
+		}
+	}
+
+	// the tx pool of a stopped chain is not running
+	if txPool, err := h.chainMakerServer.GetTxPool(chain.ChainId); err == nil && txPool != nil && chain.Running {
+		status.TxPool = txPool.GetPoolStatus()
+	}
+
+	if syncService, err := h.chainMakerServer.GetSyncService(chain.ChainId); err == nil && syncService != nil {
+		if provider, ok := syncService.(blockSync.SyncStateProvider); ok {
+			status.Sync = provider.GetSyncState()
+		}
+	}
+	return status
+}
+
+func (h *healthHandler) writeProbe(w http.ResponseWriter, result *probeResult) {
+	code := http.StatusOK
+	if !result.Ok {
+		code = http.StatusServiceUnavailable
+	}
+	h.writeJSON(w, code, result)
+}
+
+func (h *healthHandler) writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Warnf("write the response failed, %s", err.Error())
+	}
+}
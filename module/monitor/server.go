@@ -12,6 +12,7 @@ import (
 	"net"
 	"net/http"
 
+	"chainmaker.org/chainmaker-go/module/blockchain"
 	"chainmaker.org/chainmaker/localconf/v2"
 	"chainmaker.org/chainmaker/logger/v2"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -22,22 +23,29 @@ type MonitorServer struct {
 	log        *logger.CMLogger
 }
 
-func NewMonitorServer() *MonitorServer {
+// NewMonitorServer serves /metrics, and the probes /healthz, /readyz and /status built from the state of
+// chainMakerServer
+func NewMonitorServer(chainMakerServer *blockchain.ChainMakerServer) (*MonitorServer, error) {
 	var log = logger.GetLogger(logger.MODULE_MONITOR)
 
 	if localconf.ChainMakerConfig.MonitorConfig.Enabled {
 		mux := http.NewServeMux()
 		mux.Handle("/metrics", promhttp.Handler())
+		health, err := newHealthHandler(chainMakerServer, log)
+		if err != nil {
+			return nil, err
+		}
+		health.register(mux)
 		return &MonitorServer{
 			httpServer: &http.Server{
 				Handler: mux,
 			},
 			log: log,
-		}
+		}, nil
 	} else {
 		return &MonitorServer{
 			log: log,
-		}
+		}, nil
 	}
 }
 
@@ -14,6 +14,7 @@ import (
 	"fmt"
 
 	"chainmaker.org/chainmaker-go/module/blockchain"
+	"chainmaker.org/chainmaker-go/module/snapshot"
 	commonErr "chainmaker.org/chainmaker/common/v2/errors"
 	"chainmaker.org/chainmaker/common/v2/monitor"
 	"chainmaker.org/chainmaker/localconf/v2"
@@ -45,6 +46,7 @@ type ApiService struct {
 	metricQueryCounter          *prometheus.CounterVec
 	metricInvokeCounter         *prometheus.CounterVec
 	metricInvokeTxSizeHistogram *prometheus.HistogramVec
+	chainSubscriptions          *chainSubscriptions
 	ctx                         context.Context
 }
 
@@ -74,6 +76,7 @@ func NewApiService(ctx context.Context, chainMakerServer *blockchain.ChainMakerS
 		log:                   log,
 		logBrief:              logBrief,
 		subscriberRateLimiter: subscriberRateLimiter,
+		chainSubscriptions:    newChainSubscriptions(),
 		ctx:                   ctx,
 	}
 
@@ -87,6 +90,7 @@ func NewApiService(ctx context.Context, chainMakerServer *blockchain.ChainMakerS
 			"invoke tx size histogram metric", prometheus.ExponentialBuckets(1024, 2, 12),
 			"chainId", "state")
 	}
+	chainMakerServer.SetChainListener(chainListenerName, apiService.onChainEvent)
 
 	return &apiService
 }
@@ -135,6 +139,14 @@ func (s *ApiService) validate(tx *commonPb.Transaction) (errCode commonErr.ErrCo
 		return
 	}
 
+	// the store of the stopped chain is still open, but the chain does not serve any request until it restarts
+	if s.chainMakerServer.IsChainStopped(tx.Payload.ChainId) {
+		errCode = commonErr.ERR_CODE_GET_BLOCKCHAIN
+		errMsg = s.getErrMsg(errCode, fmt.Errorf("chain %s is stopped", tx.Payload.ChainId))
+		s.log.Error(errMsg)
+		return
+	}
+
 	if err = utils.VerifyTxWithoutPayload(tx, tx.Payload.ChainId, bc.GetAccessControl()); err != nil {
 		errCode = commonErr.ERR_CODE_TX_VERIFY_FAILED
 		errMsg = fmt.Sprintf("%s, %s, txId:%s, sender:%s", errCode.String(), err.Error(), tx.Payload.TxId,
@@ -220,6 +232,37 @@ func (s *ApiService) dealQuery(tx *commonPb.Transaction, source protocol.TxSourc
 		return s.dealSystemChainQuery(tx, vmMgr)
 	}
 
+	if isTxFilterStatsQuery(tx) {
+		return s.dealTxFilterStatsQuery(tx)
+	}
+
+	if isEstimateGasQuery(tx) {
+		return s.dealEstimateGasQuery(tx)
+	}
+
+	if isTraceTxQuery(tx) {
+		return s.dealTraceTxQuery(tx)
+	}
+
+	params, queryHeight, isHistoryQuery, err := popQueryBlockHeight(tx.Payload.Parameters)
+	if err != nil {
+		s.log.Warn(err)
+		resp.Code = commonPb.TxStatusCode_INVALID_PARAMETER
+		resp.Message = err.Error()
+		return resp
+	}
+
+	var historyReader *snapshot.HistoryStateReader
+	if isHistoryQuery {
+		if historyReader, err = newHistoryStateReader(store, queryHeight); err != nil {
+			errMsg = fmt.Sprintf("query at block height %d failed, %s", queryHeight, err.Error())
+			s.log.Warn(errMsg)
+			resp.Code = historyErrCode(err)
+			resp.Message = errMsg
+			return resp
+		}
+	}
+
 	ctx := &txQuerySimContextImpl{
 		tx:               tx,
 		txReadKeyMap:     map[string]*commonPb.TxRead{},
@@ -228,6 +271,7 @@ func (s *ApiService) dealQuery(tx *commonPb.Transaction, source protocol.TxSourc
 		txWriteKeyDdlSql: make([]*commonPb.TxWrite, 0),
 		rowCache:         make(map[int32]interface{}),
 		blockchainStore:  store,
+		historyReader:    historyReader,
 		vmManager:        vmMgr,
 		blockVersion:     protocol.DefaultBlockVersion,
 	}
@@ -253,7 +297,7 @@ func (s *ApiService) dealQuery(tx *commonPb.Transaction, source protocol.TxSourc
 		}
 	}
 	txResult, _, txStatusCode := vmMgr.RunContract(contract, tx.Payload.Method,
-		bytecode, s.kvPair2Map(tx.Payload.Parameters), ctx, 0, tx.Payload.TxType)
+		bytecode, s.kvPair2Map(params), ctx, 0, tx.Payload.TxType)
 	s.log.DebugDynamic(func() string {
 		contractJson, _ := json.Marshal(contract)
 		return fmt.Sprintf("vmMgr.RunContract: txStatusCode:%d, resultCode:%d, contractName[%s](%s), "+
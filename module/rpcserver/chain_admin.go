@@ -0,0 +1,189 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"chainmaker.org/chainmaker-go/module/blockchain"
+	apiPb "chainmaker.org/chainmaker/pb-go/v2/api"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+const (
+	chainListenerName = "rpcserver"
+
+	// full method names of the chain admin apis, used by the interceptors of the gateway
+	methodListChains   = "/admin.ChainAdmin/ListChains"
+	methodStopChain    = "/admin.ChainAdmin/StopChain"
+	methodRestartChain = "/admin.ChainAdmin/RestartChain"
+	methodRemoveChain  = "/admin.ChainAdmin/RemoveChain"
+
+	// chainAdminRequestExpiration - the signed request is accepted within it before and after its timestamp
+	chainAdminRequestExpiration = 5 * time.Minute
+)
+
+// ChainAdminRequest - request of the chain admin apis, signed by an admin over SignBytes
+type ChainAdminRequest struct {
+	ChainId   string                     `json:"chain_id"`
+	Timestamp int64                      `json:"timestamp"` // unix seconds when the request is signed
+	Sender    *commonPb.EndorsementEntry `json:"sender"`
+}
+
+// SignBytes - the bytes signed by the sender of the request to the admin api of fullMethod
+func (r *ChainAdminRequest) SignBytes(fullMethod string) []byte {
+	return []byte(fmt.Sprintf("%s|%s|%d", fullMethod, r.ChainId, r.Timestamp))
+}
+
+// ChainAdminResponse - response of the chain admin apis, Chains is set by ListChains
+type ChainAdminResponse struct {
+	Code    int32                     `json:"code"`
+	Message string                    `json:"message,omitempty"`
+	Chains  []*blockchain.ChainStatus `json:"chains,omitempty"`
+}
+
+func newChainAdminResponse(err error) *ChainAdminResponse {
+	if err != nil {
+		return &ChainAdminResponse{Code: int32(1), Message: err.Error()}
+	}
+	return &ChainAdminResponse{Code: int32(0)}
+}
+
+// ListChains - list the chains of the node and whether they are running
+func (s *ApiService) ListChains(context.Context, *ChainAdminRequest) (*ChainAdminResponse, error) {
+	resp := newChainAdminResponse(nil)
+	resp.Chains = s.chainMakerServer.ListBlockchains()
+	return resp, nil
+}
+
+// StopChain - stop one chain of the node, the other chains are untouched
+func (s *ApiService) StopChain(_ context.Context, req *ChainAdminRequest) (*ChainAdminResponse, error) {
+	return newChainAdminResponse(s.chainMakerServer.StopBlockchain(req.ChainId)), nil
+}
+
+// RestartChain - restart one chain of the node, the removed chain is loaded from the config again
+func (s *ApiService) RestartChain(_ context.Context, req *ChainAdminRequest) (*ChainAdminResponse, error) {
+	return newChainAdminResponse(s.chainMakerServer.RestartBlockchain(req.ChainId)), nil
+}
+
+// RemoveChain - stop one chain and remove it from the node until the node restarts
+func (s *ApiService) RemoveChain(_ context.Context, req *ChainAdminRequest) (*ChainAdminResponse, error) {
+	return newChainAdminResponse(s.chainMakerServer.RemoveBlockchain(req.ChainId)), nil
+}
+
+// chainAdminAccessControls - the access controls verifying the admin of the request, the one of the chain.
+// ListChains and the chains not on the node, which are restarted from the config, have none of their own,
+// the sender must be an admin of any chain of the node
+func (s *ApiService) chainAdminAccessControls(chainId string) ([]protocol.AccessControlProvider, error) {
+	if bc, err := s.chainMakerServer.GetBlockchain(chainId); err == nil {
+		return []protocol.AccessControlProvider{bc.GetAccessControl()}, nil
+	}
+	return s.chainMakerServer.GetAllAC()
+}
+
+// verifyChainAdmin - check the request to the admin api of fullMethod is signed by an admin in time. The sender
+// is verified by the access controls against the policy of the archive txs, which are run by an admin by default
+func verifyChainAdmin(acs []protocol.AccessControlProvider, fullMethod string, req *ChainAdminRequest) error {
+	if req.Sender == nil || req.Sender.Signer == nil || len(req.Sender.Signature) == 0 {
+		return errors.New("admin request is not signed")
+	}
+	elapsed := time.Since(time.Unix(req.Timestamp, 0))
+	if elapsed > chainAdminRequestExpiration || elapsed < -chainAdminRequestExpiration {
+		return fmt.Errorf("admin request timestamp %d is expired", req.Timestamp)
+	}
+
+	msg := req.SignBytes(fullMethod)
+	for _, ac := range acs {
+		if ac == nil {
+			continue
+		}
+		principal, err := ac.CreatePrincipal(commonPb.TxType_ARCHIVE.String(),
+			[]*commonPb.EndorsementEntry{req.Sender}, msg)
+		if err != nil {
+			continue
+		}
+		if ok, err := ac.VerifyPrincipal(principal); err == nil && ok {
+			return nil
+		}
+	}
+	return errors.New("admin request is not signed by an admin of the chain")
+}
+
+// onChainEvent - close the subscriptions and drop the metrics of the chain stopped or removed
+func (s *ApiService) onChainEvent(chainId string, event blockchain.ChainEvent) {
+	if event != blockchain.ChainEventStopped && event != blockchain.ChainEventRemoved {
+		return
+	}
+	s.chainSubscriptions.cancel(chainId)
+	if s.metricQueryCounter != nil {
+		for _, state := range []string{"true", "false"} {
+			s.metricQueryCounter.DeleteLabelValues(chainId, state)
+			s.metricInvokeCounter.DeleteLabelValues(chainId, state)
+			s.metricInvokeTxSizeHistogram.DeleteLabelValues(chainId, state)
+		}
+	}
+}
+
+// chainSubscriptions - the open subscriptions of each chain, they are closed when the chain stops
+type chainSubscriptions struct {
+	sync.Mutex
+	nextId  int64
+	byChain map[string]map[int64]context.CancelFunc
+}
+
+func newChainSubscriptions() *chainSubscriptions {
+	return &chainSubscriptions{byChain: make(map[string]map[int64]context.CancelFunc)}
+}
+
+// track - derive the context of a subscription to the chain, done must be called when the subscription ends
+func (cs *chainSubscriptions) track(chainId string, parent context.Context) (ctx context.Context, done func()) {
+	ctx, cancel := context.WithCancel(parent)
+	cs.Lock()
+	defer cs.Unlock()
+	cs.nextId++
+	id := cs.nextId
+	subs, ok := cs.byChain[chainId]
+	if !ok {
+		subs = make(map[int64]context.CancelFunc)
+		cs.byChain[chainId] = subs
+	}
+	subs[id] = cancel
+
+	return ctx, func() {
+		cancel()
+		cs.Lock()
+		defer cs.Unlock()
+		delete(cs.byChain[chainId], id)
+		if len(cs.byChain[chainId]) == 0 {
+			delete(cs.byChain, chainId)
+		}
+	}
+}
+
+// cancel - end all the subscriptions to the chain
+func (cs *chainSubscriptions) cancel(chainId string) {
+	cs.Lock()
+	defer cs.Unlock()
+	for _, cancel := range cs.byChain[chainId] {
+		cancel()
+	}
+}
+
+// chainSubscribeServer - the subscribe stream whose context is also done when the chain stops
+type chainSubscribeServer struct {
+	apiPb.RpcNode_SubscribeServer
+	ctx context.Context
+}
+
+func (x *chainSubscribeServer) Context() context.Context {
+	return x.ctx
+}
@@ -0,0 +1,44 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/module/blockchain"
+	"chainmaker.org/chainmaker/common/v2/msgbus"
+	"chainmaker.org/chainmaker/logger/v2"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoppedChainQuery(t *testing.T) {
+	server := blockchain.NewChainMakerServer()
+	server.AddBlockchain(blockchain.NewBlockchain("", "chain1", msgbus.NewMessageBus(), nil))
+	s := &ApiService{
+		chainMakerServer:   server,
+		log:                logger.GetLogger(logger.MODULE_RPC),
+		chainSubscriptions: newChainSubscriptions(),
+	}
+	resp, err := s.StopChain(context.Background(), &ChainAdminRequest{ChainId: "chain1"})
+	require.NoError(t, err)
+	require.Equal(t, int32(0), resp.Code)
+
+	// the queries to the stopped chain are rejected before the tx is verified
+	for _, method := range []string{syscontract.ChainQueryFunction_GET_BLOCK_BY_HEIGHT.String(), TraceTxMethod} {
+		resp := s.invoke(&commonPb.Transaction{Payload: &commonPb.Payload{ChainId: "chain1", TxId: "query1",
+			TxType: commonPb.TxType_QUERY_CONTRACT, ContractName: syscontract.SystemContract_CHAIN_QUERY.String(),
+			Method: method}}, protocol.RPC)
+		require.Equal(t, commonPb.TxStatusCode_INTERNAL_ERROR, resp.Code)
+		require.Equal(t, "query1", resp.TxId)
+		require.True(t, strings.Contains(resp.Message, "chain chain1 is stopped"), resp.Message)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"chainmaker.org/chainmaker-go/module/core/common/scheduler"
+	"chainmaker.org/chainmaker-go/module/snapshot"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+)
+
+const (
+	// EstimateGasMethod - CHAIN_QUERY method answered by the node itself, dry runs the invoke tx whose
+	// marshaled payload is the parameter EstimateGasPayloadKey against the current state without committing,
+	// the result is GasEstimate in JSON
+	EstimateGasMethod = "ESTIMATE_GAS"
+	// EstimateGasPayloadKey - parameter key of the payload of the invoke tx to estimate
+	EstimateGasPayloadKey = "payload"
+)
+
+// GasEstimate - result of the gas estimation, as the tx would be executed in the next block
+type GasEstimate struct {
+	GasUsed        uint64                    `json:"gas_used"`
+	Code           commonPb.TxStatusCode     `json:"code"`
+	Message        string                    `json:"message"`
+	ContractResult *commonPb.ContractResult  `json:"contract_result"`
+	RwSet          *commonPb.TxRWSet         `json:"rw_set"`
+	Events         []*commonPb.ContractEvent `json:"events"`
+}
+
+// isEstimateGasQuery - check if the query asks for the gas estimation of an invoke tx
+func isEstimateGasQuery(tx *commonPb.Transaction) bool {
+	return tx.Payload.ContractName == syscontract.SystemContract_CHAIN_QUERY.String() &&
+		tx.Payload.Method == EstimateGasMethod
+}
+
+// dealEstimateGasQuery - deal gas estimation query, the invoke tx is sent by the sender of the query
+func (s *ApiService) dealEstimateGasQuery(tx *commonPb.Transaction) *commonPb.TxResponse {
+	resp := &commonPb.TxResponse{TxId: tx.Payload.TxId}
+	fail := func(code commonPb.TxStatusCode, errMsg string) *commonPb.TxResponse {
+		s.log.Warn(errMsg)
+		resp.Code = code
+		resp.Message = errMsg
+		return resp
+	}
+
+	invokeTx, err := dryRunInvokeTx(tx)
+	if err != nil {
+		return fail(commonPb.TxStatusCode_INVALID_PARAMETER, err.Error())
+	}
+
+	chainId := tx.Payload.ChainId
+	store, err := s.chainMakerServer.GetStore(chainId)
+	if err != nil {
+		return fail(commonPb.TxStatusCode_INTERNAL_ERROR, fmt.Sprintf("get store failed, %s", err.Error()))
+	}
+	vmMgr, err := s.chainMakerServer.GetVmManager(chainId)
+	if err != nil {
+		return fail(commonPb.TxStatusCode_INTERNAL_ERROR, fmt.Sprintf("get vm manager failed, %s", err.Error()))
+	}
+	chainConf, err := s.chainMakerServer.GetChainConf(chainId)
+	if err != nil {
+		return fail(commonPb.TxStatusCode_INTERNAL_ERROR, fmt.Sprintf("get chain conf failed, %s", err.Error()))
+	}
+	// the sql statements are executed against the state database directly
+	if chainConf.ChainConfig().Contract.EnableSqlSupport {
+		return fail(commonPb.TxStatusCode_INTERNAL_ERROR, "gas estimation is not supported when sql is enabled")
+	}
+
+	lastBlock, err := store.GetLastBlock()
+	if err != nil {
+		return fail(commonPb.TxStatusCode_INTERNAL_ERROR, fmt.Sprintf("get last block failed, %s", err.Error()))
+	}
+	// the tx is executed as if it was in the next block
+	block := &commonPb.Block{
+		Header: &commonPb.BlockHeader{
+			ChainId:        chainId,
+			BlockHeight:    lastBlock.Header.BlockHeight + 1,
+			PreBlockHash:   lastBlock.Header.BlockHash,
+			BlockVersion:   lastBlock.Header.BlockVersion,
+			BlockTimestamp: time.Now().Unix(),
+		},
+	}
+	dryRunSnapshot := snapshot.NewDryRunSnapshot(store, s.log, block)
+	txSimContext, runVmSuccess, err := scheduler.EstimateTx(vmMgr, chainConf, invokeTx, dryRunSnapshot, block, s.log)
+	if err != nil {
+		return fail(commonPb.TxStatusCode_INVALID_PARAMETER, err.Error())
+	}
+
+	txResult := txSimContext.GetTxResult()
+	estimate := &GasEstimate{
+		Code:           txResult.Code,
+		Message:        txResult.Message,
+		ContractResult: txResult.ContractResult,
+		RwSet:          txSimContext.GetTxRWSet(runVmSuccess),
+	}
+	if txResult.ContractResult != nil {
+		estimate.GasUsed = txResult.ContractResult.GasUsed
+		estimate.Events = txResult.ContractResult.ContractEvent
+	}
+	result, err := json.Marshal(estimate)
+	if err != nil {
+		return fail(commonPb.TxStatusCode_INTERNAL_ERROR, fmt.Sprintf("marshal gas estimate failed, %s", err.Error()))
+	}
+
+	resp.Code = commonPb.TxStatusCode_SUCCESS
+	resp.Message = commonPb.TxStatusCode_SUCCESS.String()
+	resp.ContractResult = &commonPb.ContractResult{
+		Result:  result,
+		Message: commonPb.TxStatusCode_SUCCESS.String(),
+		GasUsed: estimate.GasUsed,
+	}
+	return resp
+}
+
+// dryRunInvokeTx - build the invoke tx to dry run from the payload parameter of the query
+func dryRunInvokeTx(tx *commonPb.Transaction) (*commonPb.Transaction, error) {
+	var payloadBytes []byte
+	for _, kv := range tx.Payload.Parameters {
+		if kv.Key == EstimateGasPayloadKey {
+			payloadBytes = kv.Value
+		}
+	}
+	if len(payloadBytes) == 0 {
+		return nil, fmt.Errorf("missing parameter %s", EstimateGasPayloadKey)
+	}
+	payload := &commonPb.Payload{}
+	if err := payload.Unmarshal(payloadBytes); err != nil {
+		return nil, fmt.Errorf("unmarshal payload failed, %s", err.Error())
+	}
+	if payload.TxType != commonPb.TxType_INVOKE_CONTRACT {
+		return nil, fmt.Errorf("expect tx type %s, but got %s", commonPb.TxType_INVOKE_CONTRACT, payload.TxType)
+	}
+	if payload.ContractName == "" {
+		return nil, errors.New("missing contract name")
+	}
+	if payload.ChainId != "" && payload.ChainId != tx.Payload.ChainId {
+		return nil, fmt.Errorf("expect chain id %s, but got %s", tx.Payload.ChainId, payload.ChainId)
+	}
+	payload.ChainId = tx.Payload.ChainId
+	if payload.TxId == "" {
+		payload.TxId = tx.Payload.TxId
+	}
+	if payload.Timestamp == 0 {
+		payload.Timestamp = tx.Payload.Timestamp
+	}
+	return &commonPb.Transaction{Payload: payload, Sender: tx.Sender}, nil
+}
@@ -0,0 +1,539 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"chainmaker.org/chainmaker-go/module/blockchain"
+	"chainmaker.org/chainmaker-go/module/extconf"
+	localconf "chainmaker.org/chainmaker/localconf/v2"
+	logger "chainmaker.org/chainmaker/logger/v2"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	gatewayConfigKey = "rpc.gateway"
+
+	gatewayDefaultPort           = 12401
+	gatewayDefaultMaxReqBodySize = 16 * 1024 * 1024
+
+	// full method names of the RpcNode service, used by the interceptors for logging, monitor and ratelimit
+	methodSendRequest              = "/api.RpcNode/SendRequest"
+	methodSubscribe                = "/api.RpcNode/Subscribe"
+	methodGetChainMakerVersion     = "/api.RpcNode/GetChainMakerVersion"
+	methodCheckNewBlockChainConfig = "/api.RpcNode/CheckNewBlockChainConfig"
+)
+
+// GatewayConfig - config of the JSON/HTTP gateway, read from rpc.gateway of chainmaker.yml
+type GatewayConfig struct {
+	Enabled        bool               `mapstructure:"enabled"`
+	Port           int                `mapstructure:"port"`
+	MaxReqBodySize int64              `mapstructure:"max_req_body_size"`
+	Admin          GatewayAdminConfig `mapstructure:"admin"`
+}
+
+// GatewayAdminConfig - config of the chain admin apis of the gateway
+type GatewayAdminConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// client ips allowed to call the admin apis, default is the loopback addresses
+	AllowedIps []string `mapstructure:"allowed_ips"`
+}
+
+func loadGatewayConfig() (*GatewayConfig, error) {
+	config := &GatewayConfig{
+		Port:           gatewayDefaultPort,
+		MaxReqBodySize: gatewayDefaultMaxReqBodySize,
+	}
+	if err := extconf.Unmarshal(gatewayConfigKey, config); err != nil {
+		return nil, err
+	}
+	if len(config.Admin.AllowedIps) == 0 {
+		config.Admin.AllowedIps = []string{"127.0.0.1", "::1"}
+	}
+	return config, nil
+}
+
+// gatewayServer - JSON/HTTP gateway of the RpcNode service
+//
+// Every request goes through the same unary/stream interceptor chain as the gRPC server, so that
+// blacklist, ratelimit, logging and monitor behave the same for both protocols.
+type gatewayServer struct {
+	config      *GatewayConfig
+	unaryChain  grpc.UnaryServerInterceptor
+	streamChain grpc.StreamServerInterceptor
+	marshaler   *jsonpb.Marshaler
+	log         *logger.CMLogger
+
+	mu         sync.Mutex
+	apiService *ApiService
+	httpServer *http.Server
+}
+
+func newGatewayServer(config *GatewayConfig, unaryInterceptors []grpc.UnaryServerInterceptor,
+	streamInterceptors []grpc.StreamServerInterceptor) *gatewayServer {
+
+	return &gatewayServer{
+		config:      config,
+		unaryChain:  grpc_middleware.ChainUnaryServer(unaryInterceptors...),
+		streamChain: grpc_middleware.ChainStreamServer(streamInterceptors...),
+		marshaler:   &jsonpb.Marshaler{OrigName: true},
+		log:         logger.GetLogger(logger.MODULE_RPC),
+	}
+}
+
+// RegisterHandler - set the api service which serves the gateway requests
+func (g *gatewayServer) RegisterHandler(apiService *ApiService) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.apiService = apiService
+}
+
+// Start - start the gateway and listen in another go routine, tlsConfig is nil if tls is disabled
+func (g *gatewayServer) Start(tlsConfig *tls.Config) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/send_request", g.handleSendRequest)
+	mux.HandleFunc("/v1/subscribe", g.handleSubscribe)
+	mux.HandleFunc("/v1/get_chainmaker_version", g.handleGetChainMakerVersion)
+	mux.HandleFunc("/v1/check_new_block_chain_config", g.handleCheckNewBlockChainConfig)
+	if g.config.Admin.Enabled {
+		mux.HandleFunc("/v1/admin/list_chains", g.handleChainAdmin(methodListChains, http.MethodPost,
+			(*ApiService).ListChains))
+		mux.HandleFunc("/v1/admin/stop_chain", g.handleChainAdmin(methodStopChain, http.MethodPost,
+			(*ApiService).StopChain))
+		mux.HandleFunc("/v1/admin/restart_chain", g.handleChainAdmin(methodRestartChain, http.MethodPost,
+			(*ApiService).RestartChain))
+		mux.HandleFunc("/v1/admin/remove_chain", g.handleChainAdmin(methodRemoveChain, http.MethodPost,
+			(*ApiService).RemoveChain))
+	}
+
+	endPoint := fmt.Sprintf(":%d", g.config.Port)
+	conn, err := net.Listen("tcp", endPoint)
+	if err != nil {
+		return fmt.Errorf("TCP listen failed, %s", err.Error())
+	}
+	if tlsConfig != nil {
+		conn = tls.NewListener(conn, tlsConfig)
+	}
+
+	httpServer := &http.Server{Handler: mux}
+	g.mu.Lock()
+	g.httpServer = httpServer
+	g.mu.Unlock()
+
+	go func() {
+		if err := httpServer.Serve(conn); err != nil && err != http.ErrServerClosed {
+			g.log.Errorf("gateway Serve failed, %s", err.Error())
+		}
+	}()
+
+	g.log.Infof("gateway server listen on %s", endPoint)
+	return nil
+}
+
+// newGatewayTLSConfig - the tls config of the gateway, nil if tls is disabled. In twoway mode the client certs
+// are verified against the trust roots of the chains and checked for revocation, the same as the gRPC server.
+func newGatewayTLSConfig(chainMakerServer *blockchain.ChainMakerServer) (*tls.Config, error) {
+	tlsConf := localconf.ChainMakerConfig.RpcConfig.TLSConfig
+	if tlsConf.Mode == TLS_MODE_DISABLE {
+		return nil, nil
+	}
+
+	var (
+		caCerts []string
+		verify  func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
+	)
+	if tlsConf.Mode == TLS_MODE_TWOWAY {
+		var err error
+		if caCerts, err = getTrustRootCerts(chainMakerServer); err != nil {
+			return nil, err
+		}
+		acs, err := chainMakerServer.GetAllAC()
+		if err != nil {
+			return nil, fmt.Errorf("get all AccessControlProvider failed, %s", err.Error())
+		}
+		verify = createVerifyPeerCertificateFunc(acs)
+	}
+	return buildGatewayTLSConfig(tlsConf.Mode, tlsConf.CertFile, tlsConf.PrivKeyFile, caCerts, verify)
+}
+
+// buildGatewayTLSConfig - build the tls config of the mode, the gateway supports the standard x509 certs only
+func buildGatewayTLSConfig(mode, certFile, keyFile string, caCerts []string,
+	verify func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error) (*tls.Config, error) {
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load gateway tls cert failed, %s", err.Error())
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"http/1.1"},
+	}
+	if mode != TLS_MODE_TWOWAY {
+		return config, nil
+	}
+
+	pool := x509.NewCertPool()
+	var loaded bool
+	for _, caCert := range caCerts {
+		if pool.AppendCertsFromPEM([]byte(caCert)) {
+			loaded = true
+		}
+	}
+	if !loaded {
+		return nil, errors.New("no x509 trust root cert to verify the gateway clients")
+	}
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	config.ClientCAs = pool
+	config.VerifyPeerCertificate = verify
+	return config, nil
+}
+
+// Stop - stop the gateway, open subscriptions are closed
+func (g *gatewayServer) Stop() {
+	g.mu.Lock()
+	httpServer := g.httpServer
+	g.httpServer = nil
+	g.mu.Unlock()
+
+	if httpServer == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		g.log.Warnf("gateway shutdown failed, %s", err.Error())
+		_ = httpServer.Close()
+	}
+}
+
+func (g *gatewayServer) getApiService() *ApiService {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.apiService
+}
+
+func (g *gatewayServer) handleSendRequest(w http.ResponseWriter, r *http.Request) {
+	req := &commonPb.TxRequest{}
+	if !g.decodeRequest(w, r, http.MethodPost, req) {
+		return
+	}
+
+	api := g.getApiService()
+	g.serveUnary(w, r, methodSendRequest, api, req, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return api.SendRequest(ctx, req.(*commonPb.TxRequest))
+	})
+}
+
+func (g *gatewayServer) handleGetChainMakerVersion(w http.ResponseWriter, r *http.Request) {
+	req := &configPb.ChainMakerVersionRequest{}
+	if r.Method != http.MethodGet && !g.decodeRequest(w, r, http.MethodPost, req) {
+		return
+	}
+
+	api := g.getApiService()
+	g.serveUnary(w, r, methodGetChainMakerVersion, api, req,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return api.GetChainMakerVersion(ctx, req.(*configPb.ChainMakerVersionRequest))
+		})
+}
+
+func (g *gatewayServer) handleCheckNewBlockChainConfig(w http.ResponseWriter, r *http.Request) {
+	req := &configPb.CheckNewBlockChainConfigRequest{}
+	if r.Method != http.MethodGet && !g.decodeRequest(w, r, http.MethodPost, req) {
+		return
+	}
+
+	api := g.getApiService()
+	g.serveUnary(w, r, methodCheckNewBlockChainConfig, api, req,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return api.CheckNewBlockChainConfig(ctx, req.(*configPb.CheckNewBlockChainConfigRequest))
+		})
+}
+
+// handleChainAdmin - serve a chain admin api, only the requests signed by an admin from the allowed client ips
+// can call it
+func (g *gatewayServer) handleChainAdmin(fullMethod string, method string,
+	adminFunc func(*ApiService, context.Context, *ChainAdminRequest) (*ChainAdminResponse, error)) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !g.isAdminAllowed(r) {
+			g.writeError(w, status.Error(codes.PermissionDenied, "admin api is not allowed from the address"))
+			return
+		}
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			g.writeError(w, status.Errorf(codes.Unimplemented, "method %s is not allowed", r.Method))
+			return
+		}
+		req := &ChainAdminRequest{}
+		body := http.MaxBytesReader(w, r.Body, g.config.MaxReqBodySize)
+		if err := json.NewDecoder(body).Decode(req); err != nil {
+			g.writeError(w, status.Errorf(codes.InvalidArgument, "decode request failed, %s", err.Error()))
+			return
+		}
+
+		api := g.getApiService()
+		if api == nil {
+			g.writeError(w, status.Error(codes.Unavailable, "rpc service is not ready"))
+			return
+		}
+		acs, err := api.chainAdminAccessControls(req.ChainId)
+		if err == nil {
+			err = verifyChainAdmin(acs, fullMethod, req)
+		}
+		if err != nil {
+			g.writeError(w, status.Error(codes.PermissionDenied, err.Error()))
+			return
+		}
+		info := &grpc.UnaryServerInfo{Server: api, FullMethod: fullMethod}
+		resp, err := g.unaryChain(g.newContext(r), req, info, func(ctx context.Context, req interface{}) (
+			interface{}, error) {
+			return adminFunc(api, ctx, req.(*ChainAdminRequest))
+		})
+		if err != nil {
+			g.writeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err = json.NewEncoder(w).Encode(resp); err != nil {
+			g.log.Warnf("gateway write response failed, %s", err.Error())
+		}
+	}
+}
+
+func (g *gatewayServer) isAdminAllowed(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	for _, ip := range g.config.Admin.AllowedIps {
+		if ip == host {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSubscribe - serve block/tx/contract event subscription as Server-Sent Events,
+// each SubscribeResult is sent as one `data:` line of JSON
+func (g *gatewayServer) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	req := &commonPb.TxRequest{}
+	if !g.decodeRequest(w, r, http.MethodPost, req) {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		g.writeError(w, status.Error(codes.Unimplemented, "streaming is not supported by the connection"))
+		return
+	}
+
+	api := g.getApiService()
+	if api == nil {
+		g.writeError(w, status.Error(codes.Unavailable, "rpc service is not ready"))
+		return
+	}
+
+	stream := &sseSubscribeServer{
+		ctx:       g.newContext(r),
+		req:       req,
+		w:         w,
+		flusher:   flusher,
+		marshaler: g.marshaler,
+	}
+	info := &grpc.StreamServerInfo{FullMethod: methodSubscribe, IsServerStream: true}
+	err := g.streamChain(api, stream, info, func(srv interface{}, ss grpc.ServerStream) error {
+		// receive the request through the stream like the generated gRPC handler does
+		m := &commonPb.TxRequest{}
+		if err := ss.RecvMsg(m); err != nil {
+			return err
+		}
+		return api.Subscribe(m, &gatewaySubscribeServer{ServerStream: ss})
+	})
+	if err != nil {
+		if stream.started {
+			_ = stream.writeEvent("error", []byte(fmt.Sprintf("%q", err.Error())))
+			return
+		}
+		g.writeError(w, err)
+	}
+}
+
+func (g *gatewayServer) serveUnary(w http.ResponseWriter, r *http.Request, fullMethod string, api *ApiService,
+	req interface{}, handler grpc.UnaryHandler) {
+
+	if api == nil {
+		g.writeError(w, status.Error(codes.Unavailable, "rpc service is not ready"))
+		return
+	}
+
+	info := &grpc.UnaryServerInfo{Server: api, FullMethod: fullMethod}
+	resp, err := g.unaryChain(g.newContext(r), req, info, handler)
+	if err != nil {
+		g.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = g.marshaler.Marshal(w, resp.(proto.Message)); err != nil {
+		g.log.Warnf("gateway write response failed, %s", err.Error())
+	}
+}
+
+// newContext - carry the client address the same way gRPC does, so GetClientAddr works in the interceptors
+func (g *gatewayServer) newContext(r *http.Request) context.Context {
+	addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if err != nil {
+		return r.Context()
+	}
+	return peer.NewContext(r.Context(), &peer.Peer{Addr: addr})
+}
+
+func (g *gatewayServer) decodeRequest(w http.ResponseWriter, r *http.Request, method string,
+	req proto.Message) bool {
+
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		g.writeError(w, status.Errorf(codes.Unimplemented, "method %s is not allowed", r.Method))
+		return false
+	}
+
+	body := http.MaxBytesReader(w, r.Body, g.config.MaxReqBodySize)
+	if err := jsonpb.Unmarshal(body, req); err != nil {
+		g.writeError(w, status.Errorf(codes.InvalidArgument, "decode request failed, %s", err.Error()))
+		return false
+	}
+	return true
+}
+
+func (g *gatewayServer) writeError(w http.ResponseWriter, err error) {
+	st, _ := status.FromError(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatusFromCode(st.Code()))
+	_, _ = fmt.Fprintf(w, "{\"code\":%d,\"message\":%q}", st.Code(), st.Message())
+}
+
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusMethodNotAllowed
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// gatewaySubscribeServer - adapt the (possibly wrapped by interceptors) stream to apiPb.RpcNode_SubscribeServer
+type gatewaySubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *gatewaySubscribeServer) Send(m *commonPb.SubscribeResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// sseSubscribeServer - implement grpc.ServerStream over Server-Sent Events
+type sseSubscribeServer struct {
+	ctx       context.Context
+	req       *commonPb.TxRequest
+	w         http.ResponseWriter
+	flusher   http.Flusher
+	marshaler *jsonpb.Marshaler
+	started   bool
+}
+
+// Send - send one subscribe result as a `message` event
+func (s *sseSubscribeServer) Send(result *commonPb.SubscribeResult) error {
+	data, err := s.marshaler.MarshalToString(result)
+	if err != nil {
+		return err
+	}
+	return s.writeEvent("message", []byte(data))
+}
+
+func (s *sseSubscribeServer) writeEvent(event string, data []byte) error {
+	if !s.started {
+		s.w.Header().Set("Content-Type", "text/event-stream")
+		s.w.Header().Set("Cache-Control", "no-cache")
+		s.w.Header().Set("Connection", "keep-alive")
+		s.w.WriteHeader(http.StatusOK)
+		s.started = true
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *sseSubscribeServer) SetHeader(metadata.MD) error {
+	return nil
+}
+
+func (s *sseSubscribeServer) SendHeader(metadata.MD) error {
+	return nil
+}
+
+func (s *sseSubscribeServer) SetTrailer(metadata.MD) {
+}
+
+func (s *sseSubscribeServer) Context() context.Context {
+	return s.ctx
+}
+
+func (s *sseSubscribeServer) SendMsg(m interface{}) error {
+	result, ok := m.(*commonPb.SubscribeResult)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", m)
+	}
+	return s.Send(result)
+}
+
+// RecvMsg - receive the decoded subscribe request, it can only be received once
+func (s *sseSubscribeServer) RecvMsg(m interface{}) error {
+	msg, ok := m.(proto.Message)
+	if !ok || s.req == nil {
+		return status.Error(codes.Unimplemented, "client stream is not supported by the gateway")
+	}
+	proto.Merge(msg, s.req)
+	s.req = nil
+	return nil
+}
@@ -0,0 +1,272 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// testCert a cert and its key, signed by parent or self-signed if parent is nil
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:         isCA,
+
+		BasicConstraintsValid: true,
+	}
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+}
+
+func (c *testCert) files(t *testing.T) (certFile, keyFile string) {
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	require.NoError(t, ioutil.WriteFile(certFile, c.certPEM, 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, c.keyPEM, 0600))
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCert(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(c.certPEM, c.keyPEM)
+	require.NoError(t, err)
+	return cert
+}
+
+// serveTLS serve an ok handler with the config, returns the url
+func serveTLS(t *testing.T, config *tls.Config) string {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = config
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func getWithCert(url string, ca *testCert, clientCert *tls.Certificate) error {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	clientConfig := &tls.Config{RootCAs: pool}
+	if clientCert != nil {
+		clientConfig.Certificates = []tls.Certificate{*clientCert}
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}, Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestBuildGatewayTLSConfig_TwoWay(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, true)
+	serverCertFile, serverKeyFile := newTestCert(t, "server", ca, false).files(t)
+	clientCert := newTestCert(t, "client", ca, false).tlsCert(t)
+	otherCA := newTestCert(t, "other-ca", nil, true)
+	untrustedCert := newTestCert(t, "untrusted", otherCA, false).tlsCert(t)
+
+	config, err := buildGatewayTLSConfig(TLS_MODE_TWOWAY, serverCertFile, serverKeyFile,
+		[]string{string(ca.certPEM)}, nil)
+	require.NoError(t, err)
+	require.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+	url := serveTLS(t, config)
+
+	require.NoError(t, getWithCert(url, ca, &clientCert))
+	require.Error(t, getWithCert(url, ca, nil), "the client without cert is rejected")
+	require.Error(t, getWithCert(url, ca, &untrustedCert), "the client cert of an untrusted ca is rejected")
+}
+
+func TestBuildGatewayTLSConfig_Revoked(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, true)
+	serverCertFile, serverKeyFile := newTestCert(t, "server", ca, false).files(t)
+	clientCert := newTestCert(t, "client", ca, false).tlsCert(t)
+
+	config, err := buildGatewayTLSConfig(TLS_MODE_TWOWAY, serverCertFile, serverKeyFile,
+		[]string{string(ca.certPEM)}, func([][]byte, [][]*x509.Certificate) error {
+			return errors.New("certificate revoked")
+		})
+	require.NoError(t, err)
+	require.Error(t, getWithCert(serveTLS(t, config), ca, &clientCert))
+}
+
+func TestBuildGatewayTLSConfig_OneWay(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, true)
+	serverCertFile, serverKeyFile := newTestCert(t, "server", ca, false).files(t)
+
+	config, err := buildGatewayTLSConfig(TLS_MODE_ONEWAY, serverCertFile, serverKeyFile, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, tls.NoClientCert, config.ClientAuth)
+	require.NoError(t, getWithCert(serveTLS(t, config), ca, nil))
+}
+
+func TestBuildGatewayTLSConfig_NoTrustRoot(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, true)
+	serverCertFile, serverKeyFile := newTestCert(t, "server", ca, false).files(t)
+
+	_, err := buildGatewayTLSConfig(TLS_MODE_TWOWAY, serverCertFile, serverKeyFile, []string{"not a pem"}, nil)
+	require.Error(t, err)
+	_, err = buildGatewayTLSConfig(TLS_MODE_ONEWAY, serverCertFile+".missing", serverKeyFile, nil, nil)
+	require.Error(t, err)
+}
+
+func newTestGateway() *gatewayServer {
+	return newGatewayServer(&GatewayConfig{
+		Port:           gatewayDefaultPort,
+		MaxReqBodySize: 1024,
+		Admin:          GatewayAdminConfig{Enabled: true, AllowedIps: []string{"127.0.0.1"}},
+	}, nil, nil)
+}
+
+func TestGatewayDecodeRequest(t *testing.T) {
+	g := newTestGateway()
+
+	w := httptest.NewRecorder()
+	g.handleSendRequest(w, httptest.NewRequest(http.MethodGet, "/v1/send_request", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	require.Equal(t, http.MethodPost, w.Header().Get("Allow"))
+
+	w = httptest.NewRecorder()
+	g.handleSendRequest(w, httptest.NewRequest(http.MethodPost, "/v1/send_request", strings.NewReader("{")))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	// the body is limited by max_req_body_size
+	w = httptest.NewRecorder()
+	body := `{"payload":{"chain_id":"` + strings.Repeat("a", 2048) + `"}}`
+	g.handleSendRequest(w, httptest.NewRequest(http.MethodPost, "/v1/send_request", strings.NewReader(body)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	// the api service is registered after the gateway is created
+	w = httptest.NewRecorder()
+	g.handleSendRequest(w, httptest.NewRequest(http.MethodPost, "/v1/send_request",
+		strings.NewReader(`{"payload":{"chain_id":"chain1"}}`)))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestGatewayChainAdminAllowedIps(t *testing.T) {
+	g := newTestGateway()
+	handler := g.handleChainAdmin(methodListChains, http.MethodPost, (*ApiService).ListChains)
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/admin/list_chains", strings.NewReader("{}"))
+	r.RemoteAddr = "10.0.0.1:5000"
+	w := httptest.NewRecorder()
+	handler(w, r)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	r = httptest.NewRequest(http.MethodGet, "/v1/admin/list_chains", nil)
+	r.RemoteAddr = "127.0.0.1:5000"
+	w = httptest.NewRecorder()
+	handler(w, r)
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	r = httptest.NewRequest(http.MethodPost, "/v1/admin/list_chains", strings.NewReader("{}"))
+	r.RemoteAddr = "127.0.0.1:5000"
+	w = httptest.NewRecorder()
+	handler(w, r)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestVerifyChainAdmin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	req := &ChainAdminRequest{ChainId: "chain1", Timestamp: time.Now().Unix(), Sender: &commonPb.EndorsementEntry{
+		Signer: &accesscontrol.Member{OrgId: "org1", MemberInfo: []byte("admin cert")}, Signature: []byte("sig")}}
+	// newAC the access control of a chain, the sender is an admin of it if isAdmin is set
+	newAC := func(isAdmin bool) protocol.AccessControlProvider {
+		ac := mock.NewMockAccessControlProvider(ctrl)
+		ac.EXPECT().CreatePrincipal(commonPb.TxType_ARCHIVE.String(), []*commonPb.EndorsementEntry{req.Sender},
+			[]byte("/admin.ChainAdmin/StopChain|chain1|"+strconv.FormatInt(req.Timestamp, 10))).
+			Return(nil, nil).AnyTimes()
+		ac.EXPECT().VerifyPrincipal(gomock.Any()).Return(isAdmin, nil).AnyTimes()
+		return ac
+	}
+
+	require.NoError(t, verifyChainAdmin([]protocol.AccessControlProvider{newAC(false), newAC(true)},
+		methodStopChain, req))
+	require.Error(t, verifyChainAdmin([]protocol.AccessControlProvider{newAC(false)}, methodStopChain, req))
+
+	// the signature is bound to the method and the chain
+	other := *req
+	other.ChainId = "chain2"
+	ac := mock.NewMockAccessControlProvider(ctrl)
+	ac.EXPECT().CreatePrincipal(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ string, _ []*commonPb.EndorsementEntry, msg []byte) (protocol.Principal, error) {
+			require.Equal(t, "/admin.ChainAdmin/RemoveChain|chain2|"+strconv.FormatInt(req.Timestamp, 10),
+				string(msg))
+			return nil, nil
+		})
+	ac.EXPECT().VerifyPrincipal(gomock.Any()).Return(true, nil)
+	require.NoError(t, verifyChainAdmin([]protocol.AccessControlProvider{ac}, methodRemoveChain, &other))
+
+	// unsigned or expired
+	unsigned := *req
+	unsigned.Sender = nil
+	require.Error(t, verifyChainAdmin([]protocol.AccessControlProvider{newAC(true)}, methodStopChain, &unsigned))
+	expired := *req
+	expired.Timestamp = time.Now().Add(-chainAdminRequestExpiration - time.Minute).Unix()
+	require.Error(t, verifyChainAdmin([]protocol.AccessControlProvider{newAC(true)}, methodStopChain, &expired))
+}
+
+func TestHttpStatusFromCode(t *testing.T) {
+	require.Equal(t, http.StatusOK, httpStatusFromCode(codes.OK))
+	require.Equal(t, http.StatusForbidden, httpStatusFromCode(codes.PermissionDenied))
+	require.Equal(t, http.StatusTooManyRequests, httpStatusFromCode(codes.ResourceExhausted))
+	require.Equal(t, http.StatusInternalServerError, httpStatusFromCode(codes.Internal))
+}
@@ -17,7 +17,6 @@ import (
 	"sync"
 	"time"
 
-	localconf "chainmaker.org/chainmaker/localconf/v2"
 	logger "chainmaker.org/chainmaker/logger/v2"
 	"golang.org/x/time/rate"
 	"google.golang.org/grpc"
@@ -108,67 +107,64 @@ func MonitorInterceptor(ctx context.Context, req interface{},
 	return resp, err
 }
 
-func getRateLimitBucket(bucketMap *sync.Map, tokenBucketSize, tokenPerSecond int, peerIpAddr string) *rate.Limiter {
-	rateLimitType := localconf.ChainMakerConfig.RpcConfig.RateLimitConfig.Type
+func getRateLimitBucket(bucketMap *sync.Map, rateLimitType int, ruleName string, tokenBucketSize, tokenPerSecond int,
+	peerIpAddr string) *rate.Limiter {
 	var (
-		bucket interface{}
-		ok     bool
+		bucket    interface{}
+		bucketKey string
+		ok        bool
 	)
 
+	// buckets of different method overrides never share tokens
 	if rateLimitType == rateLimitTypeGlobal {
-		if bucket, ok = bucketMap.Load(rateLimitTypeGlobal); ok {
-			log.Debug("get rateLimit bucket from global")
-			return bucket.(*rate.Limiter)
-		}
+		bucketKey = ruleName + "|"
 	} else {
-		if bucket, ok = bucketMap.Load(peerIpAddr); ok {
-			log.Debugf("get rateLimit bucket from peerIpAddr [%s]", peerIpAddr)
-			return bucket.(*rate.Limiter)
-		}
+		bucketKey = ruleName + "|" + peerIpAddr
 	}
 
-	if tokenBucketSize >= 0 && tokenPerSecond >= 0 {
-		if tokenBucketSize == 0 {
-			tokenBucketSize = rateLimitDefaultTokenBucketSize
-		}
-
-		if tokenPerSecond == 0 {
-			tokenPerSecond = rateLimitDefaultTokenPerSecond
-		}
+	if bucket, ok = bucketMap.Load(bucketKey); ok {
+		log.Debugf("get rateLimit bucket [%s]", bucketKey)
+		return bucket.(*rate.Limiter)
+	}
 
+	if tokenBucketSize, tokenPerSecond, ok = rateLimitBucketSetting(tokenBucketSize, tokenPerSecond); ok {
 		bucket = rate.NewLimiter(rate.Limit(tokenPerSecond), tokenBucketSize)
 	} else {
 		return nil
 	}
 
-	if rateLimitType == rateLimitTypeGlobal {
-		if bucket, ok = bucketMap.LoadOrStore(rateLimitTypeGlobal, bucket); !ok {
-			log.Debug("create rateLimit bucket from global")
-		}
-	} else {
-		if bucket, ok = bucketMap.LoadOrStore(peerIpAddr, bucket); !ok {
-			log.Debugf("create rateLimit bucket from peerIpAddr [%s]", peerIpAddr)
-		}
+	if bucket, ok = bucketMap.LoadOrStore(bucketKey, bucket); !ok {
+		log.Debugf("create rateLimit bucket [%s]", bucketKey)
 	}
 
 	return bucket.(*rate.Limiter)
 }
 
-// RateLimitInterceptor - set ratelimit interceptor
-func RateLimitInterceptor() grpc.UnaryServerInterceptor {
-
-	tokenBucketSize := localconf.ChainMakerConfig.RpcConfig.RateLimitConfig.TokenBucketSize
-	tokenPerSecond := localconf.ChainMakerConfig.RpcConfig.RateLimitConfig.TokenPerSecond
-	enabled := localconf.ChainMakerConfig.RpcConfig.RateLimitConfig.Enabled
+// rateLimitBucketSetting - the size and the rate of a token bucket with the defaults applied,
+// ok is false if it is unlimited
+func rateLimitBucketSetting(tokenBucketSize, tokenPerSecond int) (int, int, bool) {
+	if tokenBucketSize < 0 || tokenPerSecond < 0 {
+		return 0, 0, false
+	}
+	if tokenBucketSize == 0 {
+		tokenBucketSize = rateLimitDefaultTokenBucketSize
+	}
+	if tokenPerSecond == 0 {
+		tokenPerSecond = rateLimitDefaultTokenPerSecond
+	}
+	return tokenBucketSize, tokenPerSecond, true
+}
 
-	bucketMap := sync.Map{}
+// RateLimitInterceptor - set ratelimit interceptor, the policy is reloadable, see ReloadRpcPolicy
+func RateLimitInterceptor() grpc.UnaryServerInterceptor {
 
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (
 		interface{}, error) {
 
-		if enabled {
+		policy := currentRpcPolicy()
+		if policy.rateLimit.Enabled {
 			ipAddr := getClientIp(ctx)
-			bucket := getRateLimitBucket(&bucketMap, tokenBucketSize, tokenPerSecond, ipAddr)
+			bucket := policy.getBucket(info.FullMethod, req, ipAddr)
 			if bucket != nil && !bucket.Allow() {
 				errMsg := fmt.Sprintf("%s is rejected by ratelimit, try later pls", info.FullMethod)
 				log.Warn(errMsg)
@@ -180,41 +176,33 @@ func RateLimitInterceptor() grpc.UnaryServerInterceptor {
 	}
 }
 
-// BlackListInterceptor - set ip blacklist interceptor
+// BlackListInterceptor - set ip blacklist interceptor, the policy is reloadable, see ReloadRpcPolicy
 func BlackListInterceptor() grpc.UnaryServerInterceptor {
 
-	blackIps := localconf.ChainMakerConfig.RpcConfig.BlackList.Addresses
-
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (
 		interface{}, error) {
 
 		ipAddr := getClientIp(ctx)
-		for _, blackIp := range blackIps {
-			if ipAddr == blackIp {
-				errMsg := fmt.Sprintf("%s is rejected by black list [%s]", info.FullMethod, ipAddr)
-				log.Warn(errMsg)
-				return nil, status.Error(codes.ResourceExhausted, errMsg)
-			}
+		if currentRpcPolicy().isBlack(ipAddr) {
+			errMsg := fmt.Sprintf("%s is rejected by black list [%s]", info.FullMethod, ipAddr)
+			log.Warn(errMsg)
+			return nil, status.Error(codes.ResourceExhausted, errMsg)
 		}
 
 		return handler(ctx, req)
 	}
 }
 
-// BlackListStreamInterceptor - set ip blacklist interceptor
+// BlackListStreamInterceptor - set ip blacklist interceptor, the policy is reloadable, see ReloadRpcPolicy
 func BlackListStreamInterceptor() grpc.StreamServerInterceptor {
 
-	blackIps := localconf.ChainMakerConfig.RpcConfig.BlackList.Addresses
-
 	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 
 		ipAddr := getClientIp(ss.Context())
-		for _, blackIp := range blackIps {
-			if ipAddr == blackIp {
-				errMsg := fmt.Sprintf("%s is rejected by black list [%s]", info.FullMethod, ipAddr)
-				log.Warn(errMsg)
-				return status.Error(codes.ResourceExhausted, errMsg)
-			}
+		if currentRpcPolicy().isBlack(ipAddr) {
+			errMsg := fmt.Sprintf("%s is rejected by black list [%s]", info.FullMethod, ipAddr)
+			log.Warn(errMsg)
+			return status.Error(codes.ResourceExhausted, errMsg)
 		}
 
 		return handler(srv, ss)
@@ -0,0 +1,318 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"chainmaker.org/chainmaker-go/module/extconf"
+	localconf "chainmaker.org/chainmaker/localconf/v2"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"golang.org/x/time/rate"
+)
+
+const (
+	rpcPolicyConfigKey             = "rpc"
+	rpcPolicyReloadIntervalKey     = "rpc.policy_reload_interval"
+	rpcPolicyMinReloadInterval     = 5
+	rpcPolicyDefaultReloadInterval = 10
+)
+
+// RpcPolicyConfig - blacklist and ratelimit policy, read from the rpc section of chainmaker.yml
+type RpcPolicyConfig struct {
+	BlackList  BlackListPolicyConfig  `mapstructure:"blacklist"`
+	RateLimit  RateLimitPolicyConfig  `mapstructure:"ratelimit"`
+	Subscriber SubscriberPolicyConfig `mapstructure:"subscriber"`
+}
+
+// SubscriberPolicyConfig - the limits of the Subscribe streams
+type SubscriberPolicyConfig struct {
+	StreamLimit SubscribeLimitConfig `mapstructure:"stream_limit"`
+}
+
+// BlackListPolicyConfig - blacklisted ip addresses or CIDR ranges, e.g. "127.0.0.1", "10.0.0.0/8"
+type BlackListPolicyConfig struct {
+	Addresses []string `mapstructure:"addresses"`
+}
+
+// RateLimitPolicyConfig - global ratelimit settings and the per method overrides
+type RateLimitPolicyConfig struct {
+	Enabled         bool                     `mapstructure:"enabled"`
+	Type            int                      `mapstructure:"type"`
+	TokenPerSecond  int                      `mapstructure:"token_per_second"`
+	TokenBucketSize int                      `mapstructure:"token_bucket_size"`
+	Methods         []*MethodRateLimitConfig `mapstructure:"methods"`
+}
+
+// MethodRateLimitConfig - ratelimit of one gRPC method, e.g. "SendRequest",
+// SendRequest can be further split by tx type, e.g. "SendRequest/QUERY_CONTRACT"
+type MethodRateLimitConfig struct {
+	Method          string `mapstructure:"method"`
+	TokenPerSecond  int    `mapstructure:"token_per_second"`
+	TokenBucketSize int    `mapstructure:"token_bucket_size"`
+}
+
+// rpcPolicy - the compiled RpcPolicyConfig, immutable after creation except the token buckets
+type rpcPolicy struct {
+	blackIps       map[string]struct{}
+	blackNets      []*net.IPNet
+	rateLimit      RateLimitPolicyConfig
+	methodRules    map[string]*MethodRateLimitConfig
+	bucketMap      sync.Map
+	subscribeLimit SubscribeLimitConfig
+}
+
+var (
+	rpcPolicyValue    atomic.Value
+	rpcPolicyInitOnce sync.Once
+)
+
+// currentRpcPolicy - get the policy in use, the first call loads it from the local config
+func currentRpcPolicy() *rpcPolicy {
+	rpcPolicyInitOnce.Do(func() {
+		config, err := loadRpcPolicyConfig()
+		if err != nil {
+			log.Warnf("load rpc policy config failed, %s", err.Error())
+			config = defaultRpcPolicyConfig()
+		}
+
+		policy, err := newRpcPolicy(config)
+		if err != nil {
+			log.Errorf("invalid rpc policy config, blacklist is ignored, %s", err.Error())
+			policy, _ = newRpcPolicy(&RpcPolicyConfig{RateLimit: config.RateLimit, Subscriber: config.Subscriber})
+		}
+		rpcPolicyValue.Store(policy)
+	})
+
+	return rpcPolicyValue.Load().(*rpcPolicy)
+}
+
+// ReloadRpcPolicy - reload blacklist and ratelimit policy from chainmaker.yml,
+// the policy in use is kept if the new one is invalid
+func ReloadRpcPolicy() error {
+	currentRpcPolicy()
+
+	extconf.Reload()
+	config, err := loadRpcPolicyConfig()
+	if err != nil {
+		return err
+	}
+
+	policy, err := newRpcPolicy(config)
+	if err != nil {
+		return err
+	}
+	kept := policy.keepBuckets(currentRpcPolicy())
+	rpcPolicyValue.Store(policy)
+
+	log.Infof("rpc policy reloaded, blacklist: %v, ratelimit: [enabled:%v]/[type:%d]/[%d/s]/[bucket:%d], "+
+		"method overrides: %d, subscribe limit: %+v, kept token buckets: %d", config.BlackList.Addresses,
+		config.RateLimit.Enabled, config.RateLimit.Type, config.RateLimit.TokenPerSecond,
+		config.RateLimit.TokenBucketSize, len(policy.methodRules), policy.subscribeLimit, kept)
+	return nil
+}
+
+// defaultRpcPolicyConfig - the policy of localconf, the keys absent from chainmaker.yml keep these values
+func defaultRpcPolicyConfig() *RpcPolicyConfig {
+	rpcConfig := localconf.ChainMakerConfig.RpcConfig
+	return &RpcPolicyConfig{
+		BlackList: BlackListPolicyConfig{
+			Addresses: append([]string(nil), rpcConfig.BlackList.Addresses...),
+		},
+		RateLimit: RateLimitPolicyConfig{
+			Enabled:         rpcConfig.RateLimitConfig.Enabled,
+			Type:            rpcConfig.RateLimitConfig.Type,
+			TokenPerSecond:  rpcConfig.RateLimitConfig.TokenPerSecond,
+			TokenBucketSize: rpcConfig.RateLimitConfig.TokenBucketSize,
+		},
+	}
+}
+
+// loadRpcPolicyConfig - read the policy from chainmaker.yml on top of the defaults, the first load and the
+// reloads share it, so a key removed from the file restores its default
+func loadRpcPolicyConfig() (*RpcPolicyConfig, error) {
+	config := defaultRpcPolicyConfig()
+	// a list is decoded into the existing slice element by element, so the blacklist is decoded into a nil
+	// one, otherwise the default addresses after the end of the configured list would be kept
+	defaultAddresses := config.BlackList.Addresses
+	config.BlackList.Addresses = nil
+	// the method overrides are not part of localconf
+	if err := extconf.Unmarshal(rpcPolicyConfigKey, config); err != nil {
+		return nil, err
+	}
+	if config.BlackList.Addresses == nil {
+		config.BlackList.Addresses = defaultAddresses
+	}
+	return config, nil
+}
+
+func newRpcPolicy(config *RpcPolicyConfig) (*rpcPolicy, error) {
+	policy := &rpcPolicy{
+		blackIps:       make(map[string]struct{}),
+		rateLimit:      config.RateLimit,
+		methodRules:    make(map[string]*MethodRateLimitConfig),
+		subscribeLimit: config.Subscriber.StreamLimit,
+	}
+	if policy.subscribeLimit.MsgBucketSize <= 0 {
+		policy.subscribeLimit.MsgBucketSize = policy.subscribeLimit.MsgPerSecond
+	}
+
+	for _, addr := range config.BlackList.Addresses {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		if strings.Contains(addr, "/") {
+			_, ipNet, err := net.ParseCIDR(addr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid blacklist CIDR [%s], %s", addr, err.Error())
+			}
+			policy.blackNets = append(policy.blackNets, ipNet)
+			continue
+		}
+		policy.blackIps[addr] = struct{}{}
+	}
+
+	for _, rule := range config.RateLimit.Methods {
+		if rule == nil || rule.Method == "" {
+			return nil, fmt.Errorf("ratelimit method override without method name")
+		}
+		policy.methodRules[rule.Method] = rule
+	}
+
+	return policy, nil
+}
+
+// isBlack - check if ipAddr is in the blacklist
+func (p *rpcPolicy) isBlack(ipAddr string) bool {
+	if _, ok := p.blackIps[ipAddr]; ok {
+		return true
+	}
+	if len(p.blackNets) == 0 {
+		return false
+	}
+
+	ip := net.ParseIP(ipAddr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range p.blackNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// getBucket - get the token bucket of the call, nil means unlimited
+func (p *rpcPolicy) getBucket(fullMethod string, req interface{}, ipAddr string) *rate.Limiter {
+	tokenBucketSize := p.rateLimit.TokenBucketSize
+	tokenPerSecond := p.rateLimit.TokenPerSecond
+	ruleName := ""
+
+	if rule := p.getMethodRule(fullMethod, req); rule != nil {
+		tokenBucketSize = rule.TokenBucketSize
+		tokenPerSecond = rule.TokenPerSecond
+		ruleName = rule.Method
+	}
+
+	return getRateLimitBucket(&p.bucketMap, p.rateLimit.Type, ruleName, tokenBucketSize, tokenPerSecond, ipAddr)
+}
+
+// keepBuckets - take over the token buckets of the old policy whose size and rate are unchanged, so a reload
+// does not refill the buckets of the clients. Returns the number of the buckets kept
+func (p *rpcPolicy) keepBuckets(old *rpcPolicy) int {
+	if !p.rateLimit.Enabled || !old.rateLimit.Enabled || p.rateLimit.Type != old.rateLimit.Type {
+		return 0
+	}
+	kept := 0
+	old.bucketMap.Range(func(key, value interface{}) bool {
+		// the key of a bucket is the name of its method override, then the ip when limited by ip
+		ruleName := strings.SplitN(key.(string), "|", 2)[0]
+		tokenBucketSize, tokenPerSecond := p.rateLimit.TokenBucketSize, p.rateLimit.TokenPerSecond
+		if ruleName != "" {
+			rule, ok := p.methodRules[ruleName]
+			if !ok {
+				return true
+			}
+			tokenBucketSize, tokenPerSecond = rule.TokenBucketSize, rule.TokenPerSecond
+		}
+		tokenBucketSize, tokenPerSecond, ok := rateLimitBucketSetting(tokenBucketSize, tokenPerSecond)
+		bucket := value.(*rate.Limiter)
+		if ok && bucket.Burst() == tokenBucketSize && bucket.Limit() == rate.Limit(tokenPerSecond) {
+			p.bucketMap.Store(key, bucket)
+			kept++
+		}
+		return true
+	})
+	return kept
+}
+
+// getMethodRule - find the override of the method, "SendRequest/<TxType>" takes precedence over "SendRequest"
+func (p *rpcPolicy) getMethodRule(fullMethod string, req interface{}) *MethodRateLimitConfig {
+	if len(p.methodRules) == 0 {
+		return nil
+	}
+
+	_, method := splitMethodName(fullMethod)
+	if txReq, ok := req.(*commonPb.TxRequest); ok && txReq.Payload != nil {
+		if rule, ok := p.methodRules[method+"/"+txReq.Payload.TxType.String()]; ok {
+			return rule
+		}
+	}
+	return p.methodRules[method]
+}
+
+// tryReloadRpcPolicyChange - reload rpc policy when chainmaker.yml is modified
+func (s *RPCServer) tryReloadRpcPolicyChange() {
+	interval := rpcPolicyDefaultReloadInterval
+	if err := extconf.Unmarshal(rpcPolicyReloadIntervalKey, &interval); err != nil {
+		s.log.Warnf("load rpc policy reload interval failed, %s", err.Error())
+	}
+	if interval < rpcPolicyMinReloadInterval {
+		interval = rpcPolicyMinReloadInterval
+	}
+
+	go func() {
+		s.log.Debugf("check rpc policy change goroutine start...")
+
+		var lastModTime time.Time
+		if fi, err := os.Stat(localconf.ConfigFilepath); err == nil {
+			lastModTime = fi.ModTime()
+		}
+
+		for {
+			if s.isShutdown {
+				atomic.StoreInt32(&s.isWatchingRpcPolicy, 0)
+				break
+			}
+
+			time.Sleep(time.Duration(interval) * time.Second)
+
+			fi, err := os.Stat(localconf.ConfigFilepath)
+			if err != nil {
+				s.log.Warnf("stat config file failed, %s", err.Error())
+				continue
+			}
+			if !fi.ModTime().After(lastModTime) {
+				continue
+			}
+			lastModTime = fi.ModTime()
+
+			if err = ReloadRpcPolicy(); err != nil {
+				s.log.Errorf("reload rpc policy failed, keep the current one, %s", err.Error())
+			}
+		}
+	}()
+}
@@ -0,0 +1,125 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"testing"
+	"time"
+
+	localconf "chainmaker.org/chainmaker/localconf/v2"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRpcPolicyIsBlack(t *testing.T) {
+	policy, err := newRpcPolicy(&RpcPolicyConfig{BlackList: BlackListPolicyConfig{
+		Addresses: []string{"127.0.0.1", " 10.0.0.0/8 ", "", "2001:db8::/32"},
+	}})
+	require.NoError(t, err)
+
+	require.True(t, policy.isBlack("127.0.0.1"))
+	require.True(t, policy.isBlack("10.1.2.3"))
+	require.True(t, policy.isBlack("2001:db8::1"))
+	require.False(t, policy.isBlack("127.0.0.2"))
+	require.False(t, policy.isBlack("11.0.0.1"))
+	require.False(t, policy.isBlack("not an ip"))
+
+	_, err = newRpcPolicy(&RpcPolicyConfig{BlackList: BlackListPolicyConfig{Addresses: []string{"10.0.0.0/33"}}})
+	require.Error(t, err)
+}
+
+func TestRpcPolicyMethodRule(t *testing.T) {
+	policy, err := newRpcPolicy(&RpcPolicyConfig{RateLimit: RateLimitPolicyConfig{
+		Enabled:         true,
+		TokenPerSecond:  100,
+		TokenBucketSize: 100,
+		Methods: []*MethodRateLimitConfig{
+			{Method: "SendRequest", TokenPerSecond: 10, TokenBucketSize: 10},
+			{Method: "SendRequest/QUERY_CONTRACT", TokenPerSecond: 1000, TokenBucketSize: 1000},
+			{Method: "Subscribe", TokenPerSecond: -1, TokenBucketSize: -1},
+		},
+	}})
+	require.NoError(t, err)
+
+	queryReq := &commonPb.TxRequest{Payload: &commonPb.Payload{TxType: commonPb.TxType_QUERY_CONTRACT}}
+	invokeReq := &commonPb.TxRequest{Payload: &commonPb.Payload{TxType: commonPb.TxType_INVOKE_CONTRACT}}
+
+	// the tx type override takes precedence over the method override
+	require.Equal(t, "SendRequest/QUERY_CONTRACT", policy.getMethodRule(methodSendRequest, queryReq).Method)
+	require.Equal(t, "SendRequest", policy.getMethodRule(methodSendRequest, invokeReq).Method)
+	require.Nil(t, policy.getMethodRule(methodGetChainMakerVersion, nil))
+
+	// the overrides do not share tokens with each other or with the global bucket
+	queryBucket := policy.getBucket(methodSendRequest, queryReq, "127.0.0.1")
+	invokeBucket := policy.getBucket(methodSendRequest, invokeReq, "127.0.0.1")
+	globalBucket := policy.getBucket(methodGetChainMakerVersion, nil, "127.0.0.1")
+	require.Equal(t, 1000, queryBucket.Burst())
+	require.Equal(t, 10, invokeBucket.Burst())
+	require.Equal(t, 100, globalBucket.Burst())
+	// -1 is unlimited
+	require.Nil(t, policy.getBucket(methodSubscribe, nil, "127.0.0.1"))
+
+	_, err = newRpcPolicy(&RpcPolicyConfig{RateLimit: RateLimitPolicyConfig{
+		Methods: []*MethodRateLimitConfig{{TokenPerSecond: 1}},
+	}})
+	require.Error(t, err)
+}
+
+func TestDefaultRpcPolicyConfig(t *testing.T) {
+	rpcConfig := localconf.ChainMakerConfig.RpcConfig
+	defer func() { localconf.ChainMakerConfig.RpcConfig = rpcConfig }()
+	localconf.ChainMakerConfig.RpcConfig.BlackList.Addresses = []string{"127.0.0.1"}
+	localconf.ChainMakerConfig.RpcConfig.RateLimitConfig.Enabled = true
+	localconf.ChainMakerConfig.RpcConfig.RateLimitConfig.TokenPerSecond = 50
+
+	config := defaultRpcPolicyConfig()
+	require.Equal(t, []string{"127.0.0.1"}, config.BlackList.Addresses)
+	require.True(t, config.RateLimit.Enabled)
+	require.Equal(t, 50, config.RateLimit.TokenPerSecond)
+
+	// the defaults do not share the blacklist of localconf
+	config.BlackList.Addresses[0] = "10.0.0.1"
+	require.Equal(t, "127.0.0.1", localconf.ChainMakerConfig.RpcConfig.BlackList.Addresses[0])
+}
+
+func TestRpcPolicyKeepBuckets(t *testing.T) {
+	config := &RpcPolicyConfig{RateLimit: RateLimitPolicyConfig{
+		Enabled:         true,
+		Type:            1, // by ip
+		TokenPerSecond:  100,
+		TokenBucketSize: 100,
+		Methods: []*MethodRateLimitConfig{
+			{Method: "SendRequest", TokenPerSecond: 10, TokenBucketSize: 10},
+			{Method: "GetChainMakerVersion", TokenPerSecond: 10, TokenBucketSize: 10},
+		},
+	}}
+	old, err := newRpcPolicy(config)
+	require.NoError(t, err)
+	globalBucket := old.getBucket(methodCheckNewBlockChainConfig, nil, "127.0.0.1")
+	sendBucket := old.getBucket(methodSendRequest, nil, "127.0.0.1")
+	versionBucket := old.getBucket(methodGetChainMakerVersion, nil, "127.0.0.1")
+	// the client used up its tokens before the reload
+	require.True(t, sendBucket.AllowN(time.Now(), 10))
+
+	// the config is touched, only the override of GetChainMakerVersion is changed
+	config.RateLimit.Methods[1] = &MethodRateLimitConfig{Method: "GetChainMakerVersion", TokenPerSecond: 20,
+		TokenBucketSize: 20}
+	policy, err := newRpcPolicy(config)
+	require.NoError(t, err)
+	require.Equal(t, 2, policy.keepBuckets(old))
+	require.Same(t, globalBucket, policy.getBucket(methodCheckNewBlockChainConfig, nil, "127.0.0.1"))
+	require.Same(t, sendBucket, policy.getBucket(methodSendRequest, nil, "127.0.0.1"))
+	require.False(t, policy.getBucket(methodSendRequest, nil, "127.0.0.1").Allow())
+	require.NotSame(t, versionBucket, policy.getBucket(methodGetChainMakerVersion, nil, "127.0.0.1"))
+	require.Equal(t, 20, policy.getBucket(methodGetChainMakerVersion, nil, "127.0.0.1").Burst())
+
+	// the buckets are not shared when the limit type is changed
+	config.RateLimit.Type = rateLimitTypeGlobal
+	policy, err = newRpcPolicy(config)
+	require.NoError(t, err)
+	require.Equal(t, 0, policy.keepBuckets(old))
+}
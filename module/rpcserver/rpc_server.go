@@ -15,6 +15,7 @@ import (
 	"net"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"chainmaker.org/chainmaker-go/module/blockchain"
@@ -34,12 +35,16 @@ import (
 // RPCServer struct define
 type RPCServer struct {
 	grpcServer                 *grpc.Server
+	gateway                    *gatewayServer
+	unaryInterceptors          []grpc.UnaryServerInterceptor
+	streamInterceptors         []grpc.StreamServerInterceptor
 	chainMakerServer           *blockchain.ChainMakerServer
 	log                        *logger.CMLogger
 	ctx                        context.Context
 	cancel                     context.CancelFunc
 	curChainConfTrustRootsHash string
 	isShutdown                 bool
+	isWatchingRpcPolicy        int32 // 1 if the rpc policy watcher is running, accessed atomically
 }
 
 // prom monitor define
@@ -68,11 +73,17 @@ const (
 // NewRPCServer - new RPCServer object
 func NewRPCServer(chainMakerServer *blockchain.ChainMakerServer) (*RPCServer, error) {
 
-	server, err := newGrpc(chainMakerServer)
+	unaryInterceptors, streamInterceptors := newInterceptors()
+	server, err := newGrpc(chainMakerServer, unaryInterceptors, streamInterceptors)
 	if err != nil {
 		return nil, fmt.Errorf("new grpc server failed, %s", err.Error())
 	}
 
+	gatewayConfig, err := loadGatewayConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load gateway config failed, %s", err.Error())
+	}
+
 	if localconf.ChainMakerConfig.MonitorConfig.Enabled {
 		mRecv = monitor.NewCounterVec(monitor.SUBSYSTEM_GRPC, "grpc_msg_received_total",
 			"Total number of RPC messages received on the server.",
@@ -81,13 +92,24 @@ func NewRPCServer(chainMakerServer *blockchain.ChainMakerServer) (*RPCServer, er
 			"The time of RPC messages received on the server.",
 			[]float64{0.005, 0.01, 0.015, 0.05, 0.1, 1, 10},
 			"grpc_service", "grpc_method")
+		mSubscribeActive = monitor.NewGaugeVec(monitor.SUBSYSTEM_RPCSERVER, "metric_subscribe_active",
+			"The number of active subscriptions.",
+			"subscribe_type")
+	}
+
+	rpcServer := &RPCServer{
+		grpcServer:         server,
+		unaryInterceptors:  unaryInterceptors,
+		streamInterceptors: streamInterceptors,
+		chainMakerServer:   chainMakerServer,
+		log:                logger.GetLogger(logger.MODULE_RPC),
 	}
 
-	return &RPCServer{
-		grpcServer:       server,
-		chainMakerServer: chainMakerServer,
-		log:              logger.GetLogger(logger.MODULE_RPC),
-	}, nil
+	if gatewayConfig.Enabled {
+		rpcServer.gateway = newGatewayServer(gatewayConfig, unaryInterceptors, streamInterceptors)
+	}
+
+	return rpcServer, nil
 }
 
 // Start - start RPCServer
@@ -114,6 +136,10 @@ func (s *RPCServer) Start() error {
 		}
 	}
 
+	if atomic.CompareAndSwapInt32(&s.isWatchingRpcPolicy, 0, 1) {
+		s.tryReloadRpcPolicyChange()
+	}
+
 	if err = s.RegisterHandler(); err != nil {
 		return fmt.Errorf("register handler failed, %s", err.Error())
 	}
@@ -133,6 +159,16 @@ func (s *RPCServer) Start() error {
 
 	s.log.Infof("gRPC server listen on %s", endPoint)
 
+	if s.gateway != nil {
+		tlsConfig, err := newGatewayTLSConfig(s.chainMakerServer)
+		if err != nil {
+			return fmt.Errorf("start gateway failed, %s", err.Error())
+		}
+		if err = s.gateway.Start(tlsConfig); err != nil {
+			return fmt.Errorf("start gateway failed, %s", err.Error())
+		}
+	}
+
 	return nil
 }
 
@@ -140,6 +176,9 @@ func (s *RPCServer) Start() error {
 func (s *RPCServer) RegisterHandler() error {
 	apiService := NewApiService(s.ctx, s.chainMakerServer)
 	apiPb.RegisterRpcNodeServer(s.grpcServer, apiService)
+	if s.gateway != nil {
+		s.gateway.RegisterHandler(apiService)
+	}
 	return nil
 }
 
@@ -147,6 +186,9 @@ func (s *RPCServer) RegisterHandler() error {
 func (s *RPCServer) Stop() {
 	s.isShutdown = true
 	s.cancel()
+	if s.gateway != nil {
+		s.gateway.Stop()
+	}
 	s.grpcServer.GracefulStop()
 	s.log.Info("RPCServer is stopped!")
 }
@@ -160,9 +202,12 @@ func (s *RPCServer) Restart(reason string) error {
 	s.log.Info("RPCServer is beginning to restart")
 
 	s.cancel()
+	if s.gateway != nil {
+		s.gateway.Stop()
+	}
 	s.grpcServer.GracefulStop()
 
-	s.grpcServer, err = newGrpc(s.chainMakerServer)
+	s.grpcServer, err = newGrpc(s.chainMakerServer, s.unaryInterceptors, s.streamInterceptors)
 	if err != nil {
 		errMsg := fmt.Sprintf("RPCServer restart for reason [%s], new rpc server failed, %s", reason, err.Error())
 		s.log.Errorf(errMsg)
@@ -179,10 +224,11 @@ func (s *RPCServer) Restart(reason string) error {
 	return nil
 }
 
-func (s *RPCServer) getCurChainConfTrustRootsHash() (string, error) {
-	chainConfs, err := s.chainMakerServer.GetAllChainConf()
+// getTrustRootCerts - the trust root certs of all the chains
+func getTrustRootCerts(chainMakerServer *blockchain.ChainMakerServer) ([]string, error) {
+	chainConfs, err := chainMakerServer.GetAllChainConf()
 	if err != nil {
-		return "", fmt.Errorf("get all chain conf failed, %s", err)
+		return nil, fmt.Errorf("get all chain conf failed, %s", err)
 	}
 
 	var caCerts []string
@@ -191,6 +237,14 @@ func (s *RPCServer) getCurChainConfTrustRootsHash() (string, error) {
 			caCerts = append(caCerts, orgRoot.Root...)
 		}
 	}
+	return caCerts, nil
+}
+
+func (s *RPCServer) getCurChainConfTrustRootsHash() (string, error) {
+	caCerts, err := getTrustRootCerts(s.chainMakerServer)
+	if err != nil {
+		return "", err
+	}
 
 	sort.Strings(caCerts)
 
@@ -254,36 +308,42 @@ func (s *RPCServer) checkAndRestart() error {
 	return nil
 }
 
-// newGrpc - new GRPC object
-func newGrpc(chainMakerServer *blockchain.ChainMakerServer) (*grpc.Server, error) {
-	var opts []grpc.ServerOption
+// newInterceptors - new the interceptor chains shared by the gRPC server and the gateway
+func newInterceptors() ([]grpc.UnaryServerInterceptor, []grpc.StreamServerInterceptor) {
+	var unaryInterceptors []grpc.UnaryServerInterceptor
 	if localconf.ChainMakerConfig.MonitorConfig.Enabled {
-		opts = []grpc.ServerOption{
-			grpc_middleware.WithUnaryServerChain(
-				RecoveryInterceptor,
-				LoggingInterceptor,
-				MonitorInterceptor,
-				BlackListInterceptor(),
-				RateLimitInterceptor(),
-			),
-			grpc_middleware.WithStreamServerChain(
-				BlackListStreamInterceptor(),
-			),
+		unaryInterceptors = []grpc.UnaryServerInterceptor{
+			RecoveryInterceptor,
+			LoggingInterceptor,
+			MonitorInterceptor,
+			BlackListInterceptor(),
+			RateLimitInterceptor(),
 		}
 	} else {
-		opts = []grpc.ServerOption{
-			grpc_middleware.WithUnaryServerChain(
-				RecoveryInterceptor,
-				LoggingInterceptor,
-				BlackListInterceptor(),
-				RateLimitInterceptor(),
-			),
-			grpc_middleware.WithStreamServerChain(
-				BlackListStreamInterceptor(),
-			),
+		unaryInterceptors = []grpc.UnaryServerInterceptor{
+			RecoveryInterceptor,
+			LoggingInterceptor,
+			BlackListInterceptor(),
+			RateLimitInterceptor(),
 		}
 	}
 
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		BlackListStreamInterceptor(),
+		SubscribeStreamInterceptor(),
+	}
+
+	return unaryInterceptors, streamInterceptors
+}
+
+// newGrpc - new GRPC object
+func newGrpc(chainMakerServer *blockchain.ChainMakerServer, unaryInterceptors []grpc.UnaryServerInterceptor,
+	streamInterceptors []grpc.StreamServerInterceptor) (*grpc.Server, error) {
+	opts := []grpc.ServerOption{
+		grpc_middleware.WithUnaryServerChain(unaryInterceptors...),
+		grpc_middleware.WithStreamServerChain(streamInterceptors...),
+	}
+
 	if strings.ToLower(localconf.ChainMakerConfig.AuthType) == protocol.PermissionedWithKey ||
 		strings.ToLower(localconf.ChainMakerConfig.AuthType) == protocol.Public {
 		if localconf.ChainMakerConfig.RpcConfig.TLSConfig.Mode != TLS_MODE_DISABLE {
@@ -295,17 +355,9 @@ func newGrpc(chainMakerServer *blockchain.ChainMakerServer) (*grpc.Server, error
 
 	if localconf.ChainMakerConfig.RpcConfig.TLSConfig.Mode != TLS_MODE_DISABLE {
 
-		chainConfs, err := chainMakerServer.GetAllChainConf()
+		caCerts, err := getTrustRootCerts(chainMakerServer)
 		if err != nil {
-			return nil, fmt.Errorf("get all chain conf failed, %s", err)
-		}
-
-		var caCerts []string
-		for _, chainConf := range chainConfs {
-			for _, orgRoot := range chainConf.ChainConfig().TrustRoots {
-				caCerts = append(caCerts, orgRoot.Root...)
-			}
-
+			return nil, err
 		}
 
 		tlsRPCServer := ca.CAServer{
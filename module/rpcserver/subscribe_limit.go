@@ -0,0 +1,178 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"fmt"
+	"sync"
+
+	localconf "chainmaker.org/chainmaker/localconf/v2"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	subscribeTypeBlock         = "block"
+	subscribeTypeTx            = "tx"
+	subscribeTypeContractEvent = "contract_event"
+	subscribeTypeUnknown       = "unknown"
+)
+
+// prom monitor define
+var (
+	mSubscribeActive *prometheus.GaugeVec
+)
+
+// SubscribeLimitConfig - limits of the Subscribe streams, read from rpc.subscriber.stream_limit of chainmaker.yml
+// with the rpc policy, so they are reloaded with it, 0 means unlimited
+type SubscribeLimitConfig struct {
+	// max concurrent subscriptions of one client ip
+	MaxPerIp int `mapstructure:"max_per_ip"`
+	// max concurrent subscriptions of the node
+	MaxGlobal int `mapstructure:"max_global"`
+	// messages per second sent to one subscription
+	MsgPerSecond int `mapstructure:"msg_per_second"`
+	// message token bucket size of one subscription, default is MsgPerSecond
+	MsgBucketSize int `mapstructure:"msg_bucket_size"`
+}
+
+// subscribeCounter - count active subscriptions globally and by client ip
+type subscribeCounter struct {
+	sync.Mutex
+	global int
+	byIp   map[string]int
+}
+
+func newSubscribeCounter() *subscribeCounter {
+	return &subscribeCounter{
+		byIp: make(map[string]int),
+	}
+}
+
+// acquire - take one subscription slot of ipAddr, returns error if any limit is reached. The limits of the
+// policy in use are applied, the subscriptions above a lowered limit are kept until they end
+func (c *subscribeCounter) acquire(ipAddr string, limit *SubscribeLimitConfig) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if limit.MaxGlobal > 0 && c.global >= limit.MaxGlobal {
+		return fmt.Errorf("subscriptions reach global limit %d", limit.MaxGlobal)
+	}
+	if limit.MaxPerIp > 0 && c.byIp[ipAddr] >= limit.MaxPerIp {
+		return fmt.Errorf("subscriptions of [%s] reach limit %d", ipAddr, limit.MaxPerIp)
+	}
+
+	c.global++
+	c.byIp[ipAddr]++
+	return nil
+}
+
+// release - give back the subscription slot of ipAddr
+func (c *subscribeCounter) release(ipAddr string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.global--
+	if c.byIp[ipAddr] <= 1 {
+		delete(c.byIp, ipAddr)
+		return
+	}
+	c.byIp[ipAddr]--
+}
+
+// SubscribeStreamInterceptor - limit concurrent subscriptions per ip and globally,
+// and the messages per second sent to each subscription, the limits are reloadable, see ReloadRpcPolicy
+func SubscribeStreamInterceptor() grpc.StreamServerInterceptor {
+
+	counter := newSubscribeCounter()
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+		if info.FullMethod != methodSubscribe {
+			return handler(srv, ss)
+		}
+
+		limit := &currentRpcPolicy().subscribeLimit
+		ipAddr := getClientIp(ss.Context())
+		if err := counter.acquire(ipAddr, limit); err != nil {
+			errMsg := fmt.Sprintf("%s is rejected by subscribe limit, %s", info.FullMethod, err.Error())
+			log.Warn(errMsg)
+			return status.Error(codes.ResourceExhausted, errMsg)
+		}
+		defer counter.release(ipAddr)
+
+		stream := &limitedSubscribeStream{ServerStream: ss}
+		if limit.MsgPerSecond > 0 {
+			stream.limiter = rate.NewLimiter(rate.Limit(limit.MsgPerSecond), limit.MsgBucketSize)
+		}
+		defer stream.done()
+
+		return handler(srv, stream)
+	}
+}
+
+// limitedSubscribeStream - wrap the Subscribe stream to throttle sending and track the subscription type
+type limitedSubscribeStream struct {
+	grpc.ServerStream
+	limiter       *rate.Limiter
+	subscribeType string
+}
+
+// RecvMsg - the only message received is the subscribe TxRequest, which tells the subscription type
+func (s *limitedSubscribeStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	if s.subscribeType == "" {
+		s.subscribeType = getSubscribeType(m)
+		if localconf.ChainMakerConfig.MonitorConfig.Enabled {
+			mSubscribeActive.WithLabelValues(s.subscribeType).Inc()
+		}
+	}
+	return nil
+}
+
+// SendMsg - wait for a token before sending, a slow limit blocks the producer of this subscription only
+func (s *limitedSubscribeStream) SendMsg(m interface{}) error {
+	if s.limiter != nil {
+		if err := s.limiter.Wait(s.Context()); err != nil {
+			return status.Error(codes.Canceled, err.Error())
+		}
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func (s *limitedSubscribeStream) done() {
+	if s.subscribeType != "" && localconf.ChainMakerConfig.MonitorConfig.Enabled {
+		mSubscribeActive.WithLabelValues(s.subscribeType).Dec()
+	}
+}
+
+func getSubscribeType(m interface{}) string {
+	req, ok := m.(*commonPb.TxRequest)
+	if !ok || req.Payload == nil {
+		return subscribeTypeUnknown
+	}
+
+	switch req.Payload.Method {
+	case syscontract.SubscribeFunction_SUBSCRIBE_BLOCK.String():
+		return subscribeTypeBlock
+	case syscontract.SubscribeFunction_SUBSCRIBE_TX.String():
+		return subscribeTypeTx
+	case syscontract.SubscribeFunction_SUBSCRIBE_CONTRACT_EVENT.String():
+		return subscribeTypeContractEvent
+	default:
+		return subscribeTypeUnknown
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// setTestRpcPolicy use the policy of config in the test, the policy in use is restored when the test ends
+func setTestRpcPolicy(t *testing.T, config *RpcPolicyConfig) {
+	policy, err := newRpcPolicy(config)
+	require.NoError(t, err)
+	current := currentRpcPolicy()
+	rpcPolicyValue.Store(policy)
+	t.Cleanup(func() { rpcPolicyValue.Store(current) })
+}
+
+// testSubscribeStream the Subscribe stream of a client ip
+type testSubscribeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func newTestSubscribeStream(ip string) *testSubscribeStream {
+	return &testSubscribeStream{ctx: peer.NewContext(context.Background(),
+		&peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 12301}})}
+}
+
+func (s *testSubscribeStream) Context() context.Context {
+	return s.ctx
+}
+
+// testSubscriber runs a Subscribe stream through the interceptor until it is ended
+type testSubscriber struct {
+	end  chan struct{}
+	done chan error
+}
+
+// subscribe start a Subscribe stream of ip, returns the error if it is rejected
+func subscribe(t *testing.T, interceptor grpc.StreamServerInterceptor, ip string) (*testSubscriber, error) {
+	subscriber := &testSubscriber{end: make(chan struct{}), done: make(chan error, 1)}
+	started := make(chan struct{})
+	info := &grpc.StreamServerInfo{FullMethod: methodSubscribe, IsServerStream: true}
+	go func() {
+		subscriber.done <- interceptor(nil, newTestSubscribeStream(ip), info,
+			func(srv interface{}, stream grpc.ServerStream) error {
+				close(started)
+				<-subscriber.end
+				return nil
+			})
+	}()
+	select {
+	case <-started:
+		return subscriber, nil
+	case err := <-subscriber.done:
+		require.Error(t, err)
+		return nil, err
+	case <-time.After(time.Second):
+		t.Fatal("the subscription neither started nor ended")
+		return nil, nil
+	}
+}
+
+// stop end the stream and wait for the interceptor to return
+func (s *testSubscriber) stop(t *testing.T) {
+	close(s.end)
+	require.NoError(t, <-s.done)
+}
+
+func requireResourceExhausted(t *testing.T, err error) {
+	require.Error(t, err)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestSubscribeStreamInterceptor_MaxPerIp(t *testing.T) {
+	setTestRpcPolicy(t, &RpcPolicyConfig{Subscriber: SubscriberPolicyConfig{
+		StreamLimit: SubscribeLimitConfig{MaxPerIp: 2}}})
+	interceptor := SubscribeStreamInterceptor()
+
+	first, err := subscribe(t, interceptor, "10.0.0.1")
+	require.NoError(t, err)
+	second, err := subscribe(t, interceptor, "10.0.0.1")
+	require.NoError(t, err)
+	_, err = subscribe(t, interceptor, "10.0.0.1")
+	requireResourceExhausted(t, err)
+	// the other ips have their own slots
+	other, err := subscribe(t, interceptor, "10.0.0.2")
+	require.NoError(t, err)
+
+	// the slot is released when the stream ends
+	first.stop(t)
+	third, err := subscribe(t, interceptor, "10.0.0.1")
+	require.NoError(t, err)
+
+	second.stop(t)
+	third.stop(t)
+	other.stop(t)
+}
+
+func TestSubscribeStreamInterceptor_MaxGlobal(t *testing.T) {
+	setTestRpcPolicy(t, &RpcPolicyConfig{Subscriber: SubscriberPolicyConfig{
+		StreamLimit: SubscribeLimitConfig{MaxGlobal: 2}}})
+	interceptor := SubscribeStreamInterceptor()
+
+	first, err := subscribe(t, interceptor, "10.0.0.1")
+	require.NoError(t, err)
+	second, err := subscribe(t, interceptor, "10.0.0.2")
+	require.NoError(t, err)
+	_, err = subscribe(t, interceptor, "10.0.0.3")
+	requireResourceExhausted(t, err)
+
+	second.stop(t)
+	third, err := subscribe(t, interceptor, "10.0.0.3")
+	require.NoError(t, err)
+
+	// the reloaded limit applies to the next subscriptions, the active ones are kept
+	setTestRpcPolicy(t, &RpcPolicyConfig{Subscriber: SubscriberPolicyConfig{
+		StreamLimit: SubscribeLimitConfig{MaxGlobal: 1}}})
+	_, err = subscribe(t, interceptor, "10.0.0.2")
+	requireResourceExhausted(t, err)
+	first.stop(t)
+	_, err = subscribe(t, interceptor, "10.0.0.2")
+	requireResourceExhausted(t, err)
+	third.stop(t)
+	fourth, err := subscribe(t, interceptor, "10.0.0.2")
+	require.NoError(t, err)
+	fourth.stop(t)
+}
+
+func TestSubscribeStreamInterceptor_OtherMethods(t *testing.T) {
+	setTestRpcPolicy(t, &RpcPolicyConfig{Subscriber: SubscriberPolicyConfig{
+		StreamLimit: SubscribeLimitConfig{MaxGlobal: 1}}})
+	interceptor := SubscribeStreamInterceptor()
+
+	subscriber, err := subscribe(t, interceptor, "10.0.0.1")
+	require.NoError(t, err)
+	// the other streams are not counted
+	info := &grpc.StreamServerInfo{FullMethod: "/api.RpcNode/Other", IsServerStream: true}
+	called := false
+	require.NoError(t, interceptor(nil, newTestSubscribeStream("10.0.0.1"), info,
+		func(srv interface{}, stream grpc.ServerStream) error {
+			called = true
+			return nil
+		}))
+	require.True(t, called)
+	subscriber.stop(t)
+}
+
+func TestRpcPolicySubscribeLimit(t *testing.T) {
+	// the bucket size defaults to the messages per second
+	policy, err := newRpcPolicy(&RpcPolicyConfig{Subscriber: SubscriberPolicyConfig{
+		StreamLimit: SubscribeLimitConfig{MsgPerSecond: 20}}})
+	require.NoError(t, err)
+	require.Equal(t, 20, policy.subscribeLimit.MsgBucketSize)
+
+	policy, err = newRpcPolicy(&RpcPolicyConfig{Subscriber: SubscriberPolicyConfig{
+		StreamLimit: SubscribeLimitConfig{MsgPerSecond: 20, MsgBucketSize: 50}}})
+	require.NoError(t, err)
+	require.Equal(t, 50, policy.subscribeLimit.MsgBucketSize)
+}
@@ -44,6 +44,15 @@ func (s *ApiService) Subscribe(req *commonPb.TxRequest, server apiPb.RpcNode_Sub
 		return status.Error(codes.Unauthenticated, errMsg)
 	}
 
+	// track the subscription before checking, so that it can not miss the chain stopping
+	chainId := req.Payload.ChainId
+	ctx, done := s.chainSubscriptions.track(chainId, server.Context())
+	defer done()
+	if s.chainMakerServer.IsChainStopped(chainId) {
+		return status.Errorf(codes.Unavailable, "chain %s is stopped", chainId)
+	}
+	server = &chainSubscribeServer{RpcNode_SubscribeServer: server, ctx: ctx}
+
 	switch req.Payload.Method {
 	case syscontract.SubscribeFunction_SUBSCRIBE_BLOCK.String():
 		return s.dealBlockSubscription(tx, server)
@@ -0,0 +1,59 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"chainmaker.org/chainmaker-go/module/txfilter/filtercommon"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+)
+
+// QueryTxFilterStatsMethod - CHAIN_QUERY method answered by the node itself with the statistics of its tx filter,
+// the result is filtercommon.Stats in JSON
+const QueryTxFilterStatsMethod = "GET_TX_FILTER_STATS"
+
+// isTxFilterStatsQuery - check if the query asks for the tx filter statistics of the node
+func isTxFilterStatsQuery(tx *commonPb.Transaction) bool {
+	return tx.Payload.ContractName == syscontract.SystemContract_CHAIN_QUERY.String() &&
+		tx.Payload.Method == QueryTxFilterStatsMethod
+}
+
+// dealTxFilterStatsQuery - deal tx filter statistics query, the tx filter is local to the node,
+// so the query never reaches the vm
+func (s *ApiService) dealTxFilterStatsQuery(tx *commonPb.Transaction) *commonPb.TxResponse {
+	resp := &commonPb.TxResponse{TxId: tx.Payload.TxId}
+
+	txFilter, err := s.chainMakerServer.GetTxFilter(tx.Payload.ChainId)
+	if err != nil || txFilter == nil {
+		errMsg := fmt.Sprintf("get tx filter failed, %v", err)
+		s.log.Warn(errMsg)
+		resp.Code = commonPb.TxStatusCode_INTERNAL_ERROR
+		resp.Message = errMsg
+		return resp
+	}
+
+	result, err := json.Marshal(filtercommon.GetStats(txFilter))
+	if err != nil {
+		errMsg := fmt.Sprintf("marshal tx filter stats failed, %s", err.Error())
+		s.log.Error(errMsg)
+		resp.Code = commonPb.TxStatusCode_INTERNAL_ERROR
+		resp.Message = errMsg
+		return resp
+	}
+
+	resp.Code = commonPb.TxStatusCode_SUCCESS
+	resp.Message = commonPb.TxStatusCode_SUCCESS.String()
+	resp.ContractResult = &commonPb.ContractResult{
+		Result:  result,
+		Message: commonPb.TxStatusCode_SUCCESS.String(),
+	}
+	return resp
+}
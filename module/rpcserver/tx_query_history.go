@@ -0,0 +1,112 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"chainmaker.org/chainmaker-go/module/extconf"
+	"chainmaker.org/chainmaker-go/module/snapshot"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+const (
+	// QueryBlockHeightParamKey optional query parameter, run the query against the state at this block height
+	QueryBlockHeightParamKey = "__block_height__"
+
+	historyQueryConfigKey = "rpc.history_query"
+	// the default of HistoryQueryConfig.MaxBlockDistance
+	defaultHistoryMaxBlockDistance = 1000
+)
+
+// HistoryQueryConfig - limits of the queries at a past block height, read from rpc.history_query of
+// chainmaker.yml
+type HistoryQueryConfig struct {
+	// max blocks between the query height and the current height, the read/write sets of all of them are
+	// loaded by a query. 0 disables the history queries, -1 means unlimited.
+	MaxBlockDistance int64 `mapstructure:"max_block_distance"`
+}
+
+var errHistoryQueryDisabled = errors.New("query at a past block height is disabled")
+
+var (
+	historyQueryConfig     *HistoryQueryConfig
+	historyQueryConfigOnce sync.Once
+)
+
+// getHistoryQueryConfig - get the history query config, loaded at the first call
+func getHistoryQueryConfig() *HistoryQueryConfig {
+	historyQueryConfigOnce.Do(func() {
+		config := &HistoryQueryConfig{MaxBlockDistance: defaultHistoryMaxBlockDistance}
+		if err := extconf.Unmarshal(historyQueryConfigKey, config); err != nil {
+			log.Warnf("load history query config failed, use the default, %s", err.Error())
+			config = &HistoryQueryConfig{MaxBlockDistance: defaultHistoryMaxBlockDistance}
+		}
+		historyQueryConfig = config
+	})
+	return historyQueryConfig
+}
+
+// historyMaxDistance - the maxDistance of snapshot.NewHistoryStateReader, ok is false if the history
+// queries are disabled
+func (c *HistoryQueryConfig) historyMaxDistance() (maxDistance uint64, ok bool) {
+	switch {
+	case c.MaxBlockDistance == 0:
+		return 0, false
+	case c.MaxBlockDistance < 0:
+		return 0, true
+	default:
+		return uint64(c.MaxBlockDistance), true
+	}
+}
+
+// popQueryBlockHeight removes QueryBlockHeightParamKey from the query parameters and returns its value,
+// ok is false if the parameter is absent
+func popQueryBlockHeight(params []*commonPb.KeyValuePair) (
+	rest []*commonPb.KeyValuePair, height uint64, ok bool, err error) {
+
+	rest = make([]*commonPb.KeyValuePair, 0, len(params))
+	for _, kv := range params {
+		if kv.Key != QueryBlockHeightParamKey {
+			rest = append(rest, kv)
+			continue
+		}
+		height, err = strconv.ParseUint(string(kv.Value), 10, 64)
+		if err != nil {
+			return nil, 0, false, fmt.Errorf("invalid %s: %s", QueryBlockHeightParamKey, err.Error())
+		}
+		ok = true
+	}
+	return rest, height, ok, nil
+}
+
+// newHistoryStateReader - build the reader of the state at height, limited by the history query config
+func newHistoryStateReader(store protocol.BlockchainStore, height uint64) (*snapshot.HistoryStateReader, error) {
+	maxDistance, ok := getHistoryQueryConfig().historyMaxDistance()
+	if !ok {
+		return nil, errHistoryQueryDisabled
+	}
+	return snapshot.NewHistoryStateReader(store, height, maxDistance)
+}
+
+// historyErrCode - the response code of the error of newHistoryStateReader
+func historyErrCode(err error) commonPb.TxStatusCode {
+	switch {
+	case errors.Is(err, snapshot.ErrHistoryHeightArchived):
+		return commonPb.TxStatusCode_ARCHIVED_BLOCK
+	case errors.Is(err, errHistoryQueryDisabled), errors.Is(err, snapshot.ErrHistoryHeightTooFar),
+		errors.Is(err, snapshot.ErrHistoryHeightTooHigh):
+		return commonPb.TxStatusCode_INVALID_PARAMETER
+	default:
+		return commonPb.TxStatusCode_INTERNAL_ERROR
+	}
+}
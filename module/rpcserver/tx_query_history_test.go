@@ -0,0 +1,57 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"fmt"
+	"testing"
+
+	"chainmaker.org/chainmaker-go/module/snapshot"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPopQueryBlockHeight(t *testing.T) {
+	params := []*commonPb.KeyValuePair{
+		{Key: "key", Value: []byte("value")},
+		{Key: QueryBlockHeightParamKey, Value: []byte("10")},
+	}
+	rest, height, ok, err := popQueryBlockHeight(params)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(10), height)
+	require.Equal(t, []*commonPb.KeyValuePair{{Key: "key", Value: []byte("value")}}, rest)
+
+	_, _, ok, err = popQueryBlockHeight(params[:1])
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, _, _, err = popQueryBlockHeight([]*commonPb.KeyValuePair{{Key: QueryBlockHeightParamKey, Value: []byte("-1")}})
+	require.Error(t, err)
+}
+
+func TestHistoryMaxDistance(t *testing.T) {
+	_, ok := (&HistoryQueryConfig{MaxBlockDistance: 0}).historyMaxDistance()
+	require.False(t, ok)
+
+	maxDistance, ok := (&HistoryQueryConfig{MaxBlockDistance: -1}).historyMaxDistance()
+	require.True(t, ok)
+	require.Equal(t, uint64(0), maxDistance)
+
+	maxDistance, ok = (&HistoryQueryConfig{MaxBlockDistance: 1000}).historyMaxDistance()
+	require.True(t, ok)
+	require.Equal(t, uint64(1000), maxDistance)
+}
+
+func TestHistoryErrCode(t *testing.T) {
+	require.Equal(t, commonPb.TxStatusCode_ARCHIVED_BLOCK,
+		historyErrCode(fmt.Errorf("%w, height:1", snapshot.ErrHistoryHeightArchived)))
+	require.Equal(t, commonPb.TxStatusCode_INVALID_PARAMETER,
+		historyErrCode(fmt.Errorf("%w, height:1", snapshot.ErrHistoryHeightTooFar)))
+	require.Equal(t, commonPb.TxStatusCode_INVALID_PARAMETER, historyErrCode(errHistoryQueryDisabled))
+	require.Equal(t, commonPb.TxStatusCode_INTERNAL_ERROR, historyErrCode(fmt.Errorf("io error")))
+}
@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"strconv"
 
+	"chainmaker.org/chainmaker-go/module/snapshot"
 	acPb "chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/protocol/v2"
@@ -26,6 +27,8 @@ type txQuerySimContextImpl struct {
 	txWriteKeySql    []*commonPb.TxWrite
 	txWriteKeyDdlSql []*commonPb.TxWrite
 	blockchainStore  protocol.BlockchainStore
+	historyReader    *snapshot.HistoryStateReader // not nil when querying state at a historical block height
+	tracer           *txTracer                    // not nil when tracing the tx
 	vmManager        protocol.VmManager
 	gasUsed          uint64 // only for callContract
 	currentDepth     int
@@ -41,6 +44,9 @@ func (s *txQuerySimContextImpl) PutIntoReadSet(contractName string, key []byte,
 }
 
 func (s *txQuerySimContextImpl) GetBlockTimestamp() int64 {
+	if s.historyReader != nil {
+		return s.historyReader.BlockHeader().BlockTimestamp
+	}
 	if lastBlock, err := s.blockchainStore.GetLastBlock(); err == nil {
 		return lastBlock.Header.BlockTimestamp
 	}
@@ -62,6 +68,14 @@ func (s *txQuerySimContextImpl) GetBlockVersion() uint32 {
 
 // StateDB & ReadWriteSet
 func (s *txQuerySimContextImpl) Get(contractName string, key []byte) ([]byte, error) {
+	value, err := s.get(contractName, key)
+	if s.tracer != nil {
+		s.tracer.traceState(traceOpGet, s.currentDepth, contractName, key, value, err)
+	}
+	return value, err
+}
+
+func (s *txQuerySimContextImpl) get(contractName string, key []byte) ([]byte, error) {
 	// Get from write set
 	value, done := s.getFromWriteSet(contractName, key)
 	if done {
@@ -76,7 +90,7 @@ func (s *txQuerySimContextImpl) Get(contractName string, key []byte) ([]byte, er
 	}
 
 	// Get from db
-	value, err := s.blockchainStore.ReadObject(contractName, key)
+	value, err := s.readObject(contractName, key)
 	if err != nil {
 		return nil, err
 	}
@@ -91,6 +105,9 @@ func (s *txQuerySimContextImpl) GetNoRecord(contractName string, key []byte) ([]
 }
 
 func (s *txQuerySimContextImpl) Put(contractName string, key []byte, value []byte) error {
+	if s.tracer != nil {
+		s.tracer.traceState(traceOpPut, s.currentDepth, contractName, key, value, nil)
+	}
 	s.putIntoWriteSet(contractName, key, value)
 	return nil
 }
@@ -113,6 +130,9 @@ func (s *txQuerySimContextImpl) getSqlKey() string {
 }
 
 func (s *txQuerySimContextImpl) Del(contractName string, key []byte) error {
+	if s.tracer != nil {
+		s.tracer.traceState(traceOpDel, s.currentDepth, contractName, key, nil, nil)
+	}
 	s.putIntoWriteSet(contractName, key, nil)
 	return nil
 }
@@ -120,9 +140,19 @@ func (s *txQuerySimContextImpl) Del(contractName string, key []byte) error {
 func (s *txQuerySimContextImpl) Select(contractName string, startKey []byte, limit []byte) (
 	protocol.StateIterator, error) {
 
+	if s.historyReader != nil {
+		return s.historyReader.SelectObject(contractName, startKey, limit)
+	}
 	return s.blockchainStore.SelectObject(contractName, startKey, limit)
 }
 
+func (s *txQuerySimContextImpl) readObject(contractName string, key []byte) ([]byte, error) {
+	if s.historyReader != nil {
+		return s.historyReader.ReadObject(contractName, key)
+	}
+	return s.blockchainStore.ReadObject(contractName, key)
+}
+
 func (s *txQuerySimContextImpl) GetHistoryIterForKey(contractName string,
 	key []byte) (protocol.KeyHistoryIterator, error) {
 	return s.blockchainStore.GetHistoryForKey(contractName, key)
@@ -151,6 +181,9 @@ func (s *txQuerySimContextImpl) GetBlockHeight() uint64 {
 		lastBlock *commonPb.Block
 		err       error
 	)
+	if s.historyReader != nil {
+		return s.historyReader.BlockHeader().BlockHeight
+	}
 	if lastBlock, err = s.blockchainStore.GetLastBlock(); err != nil {
 		return 0
 	}
@@ -164,6 +197,9 @@ func (s *txQuerySimContextImpl) GetBlockProposer() *acPb.Member {
 		err       error
 	)
 
+	if s.historyReader != nil {
+		return s.historyReader.BlockHeader().Proposer
+	}
 	if lastBlock, err = s.blockchainStore.GetLastBlock(); err != nil {
 		return nil
 	}
@@ -273,6 +309,19 @@ func constructKey(contractName string, key []byte) string {
 }
 
 func (s *txQuerySimContextImpl) CallContract(contract *commonPb.Contract, method string, byteCode []byte,
+	parameter map[string][]byte, gasUsed uint64, refTxType commonPb.TxType) (
+	*commonPb.ContractResult, protocol.ExecOrderTxType, commonPb.TxStatusCode) {
+	if s.tracer == nil {
+		return s.callContract(contract, method, byteCode, parameter, gasUsed, refTxType)
+	}
+	depth := s.currentDepth + 1
+	s.tracer.traceCall(depth, contract.Name, method, gasUsed)
+	r, specialTxType, code := s.callContract(contract, method, byteCode, parameter, gasUsed, refTxType)
+	s.tracer.traceReturn(depth, contract.Name, method, r, code)
+	return r, specialTxType, code
+}
+
+func (s *txQuerySimContextImpl) callContract(contract *commonPb.Contract, method string, byteCode []byte,
 	parameter map[string][]byte, gasUsed uint64, refTxType commonPb.TxType) (
 	*commonPb.ContractResult, protocol.ExecOrderTxType, commonPb.TxStatusCode) {
 	s.gasUsed = gasUsed
@@ -0,0 +1,375 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"chainmaker.org/chainmaker-go/module/core/common/scheduler"
+	"chainmaker.org/chainmaker-go/module/snapshot"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+const (
+	// TraceTxMethod - CHAIN_QUERY method answered by the node itself, executes a tx with the debug trace and
+	// returns TxTrace in JSON. The tx is either a committed tx given by TraceTxIdKey, replayed against the state
+	// its block was executed on, or an invoke tx whose marshaled payload is EstimateGasPayloadKey, simulated
+	// against the current state. Nothing is committed
+	TraceTxMethod = "TRACE_TX"
+	// TraceTxIdKey - parameter key of the id of the committed tx to replay
+	TraceTxIdKey = "tx_id"
+
+	// maxTraceSteps - the steps after it are dropped, in case the contract loops over the state
+	maxTraceSteps = 100000
+)
+
+// trace step operations
+const (
+	traceOpGet    = "get"
+	traceOpPut    = "put"
+	traceOpDel    = "del"
+	traceOpCall   = "call"
+	traceOpReturn = "return"
+	traceOpEvent  = "event"
+)
+
+var errTraceTxParam = fmt.Errorf("either %s or %s is required", TraceTxIdKey, EstimateGasPayloadKey)
+
+// TxTrace - the result of the tx executed with the debug trace
+type TxTrace struct {
+	TxId           string                   `json:"tx_id"`
+	BlockHeight    uint64                   `json:"block_height"`
+	TxIndex        int                      `json:"tx_index"` // -1 for the simulated tx
+	Code           commonPb.TxStatusCode    `json:"code"`
+	Message        string                   `json:"message"`
+	ContractResult *commonPb.ContractResult `json:"contract_result"`
+	GasUsed        uint64                   `json:"gas_used"`
+	RwSet          *commonPb.TxRWSet        `json:"rw_set"`
+	RecordedResult *commonPb.Result         `json:"recorded_result,omitempty"` // the result committed in the block
+	Steps          []*TxTraceStep           `json:"steps"`
+	Truncated      bool                     `json:"truncated,omitempty"`
+}
+
+// TxTraceStep - a step of the tx execution, in execution order.
+// GasUsed is the gas used by the running call when the step is made. The vm reports it when the call starts,
+// when it calls another contract and when the call returns, so the steps between two reports have the same gas
+type TxTraceStep struct {
+	Index        int                   `json:"index"`
+	Op           string                `json:"op"`
+	Depth        int                   `json:"depth"`
+	ContractName string                `json:"contract_name"`
+	Method       string                `json:"method,omitempty"`
+	Key          string                `json:"key,omitempty"`
+	Value        []byte                `json:"value,omitempty"`
+	Topic        string                `json:"topic,omitempty"`
+	EventData    []string              `json:"event_data,omitempty"`
+	GasUsed      uint64                `json:"gas_used"`
+	Code         commonPb.TxStatusCode `json:"code,omitempty"`
+	Message      string                `json:"message,omitempty"`
+	Error        string                `json:"error,omitempty"`
+}
+
+// txTracer records the steps of a tx executed by txQuerySimContextImpl.
+// The vm reports the events in the contract results only, so the events of a call are traced before its return,
+// after the steps of the calls it made
+type txTracer struct {
+	steps     []*TxTraceStep
+	truncated bool
+	// the events traced in the calls made by each running call, the last one is the innermost call
+	callEvents [][]*commonPb.ContractEvent
+	// the gas used by each running call as last reported by the vm, the last one is the innermost call
+	callGas []uint64
+}
+
+func (t *txTracer) add(step *TxTraceStep) {
+	if len(t.steps) >= maxTraceSteps {
+		t.truncated = true
+		return
+	}
+	step.Index = len(t.steps)
+	t.steps = append(t.steps, step)
+}
+
+// gasUsed the gas used by the running call
+func (t *txTracer) gasUsed() uint64 {
+	if n := len(t.callGas); n > 0 {
+		return t.callGas[n-1]
+	}
+	return 0
+}
+
+func (t *txTracer) traceState(op string, depth int, contractName string, key []byte, value []byte, err error) {
+	step := &TxTraceStep{Op: op, Depth: depth, ContractName: contractName, Key: string(key), Value: value,
+		GasUsed: t.gasUsed()}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	t.add(step)
+}
+
+// traceCall trace the start of a call, gasUsed is the gas used by the caller so far, which the callee starts with
+func (t *txTracer) traceCall(depth int, contractName, method string, gasUsed uint64) {
+	if n := len(t.callGas); n > 0 {
+		t.callGas[n-1] = gasUsed
+	}
+	t.callEvents = append(t.callEvents, nil)
+	t.callGas = append(t.callGas, gasUsed)
+	t.add(&TxTraceStep{Op: traceOpCall, Depth: depth, ContractName: contractName, Method: method, GasUsed: gasUsed})
+}
+
+func (t *txTracer) traceReturn(depth int, contractName, method string, result *commonPb.ContractResult,
+	code commonPb.TxStatusCode) {
+	var nestedEvents []*commonPb.ContractEvent
+	if n := len(t.callEvents); n > 0 {
+		nestedEvents = t.callEvents[n-1]
+		t.callEvents = t.callEvents[:n-1]
+	}
+	gasUsed := t.gasUsed()
+	if n := len(t.callGas); n > 0 {
+		t.callGas = t.callGas[:n-1]
+	}
+	if result != nil {
+		gasUsed = result.GasUsed
+	}
+	step := &TxTraceStep{Op: traceOpReturn, Depth: depth, ContractName: contractName, Method: method, Code: code,
+		GasUsed: gasUsed}
+	callEvents := nestedEvents
+	if result != nil {
+		step.Message = result.Message
+		// the result may contain the events of the calls made, they are already traced
+		traced := make(map[string]int, len(nestedEvents))
+		for _, event := range nestedEvents {
+			traced[event.String()]++
+		}
+		for _, event := range result.ContractEvent {
+			if key := event.String(); traced[key] > 0 {
+				traced[key]--
+				continue
+			}
+			t.add(&TxTraceStep{Op: traceOpEvent, Depth: depth, ContractName: event.ContractName,
+				Topic: event.Topic, EventData: event.EventData, GasUsed: gasUsed})
+			callEvents = append(callEvents, event)
+		}
+	}
+	t.add(step)
+	if n := len(t.callEvents); n > 0 {
+		t.callEvents[n-1] = append(t.callEvents[n-1], callEvents...)
+	}
+	// the callee started with the gas used by the caller, so the caller goes on with the gas of the callee
+	if n := len(t.callGas); n > 0 && result != nil {
+		t.callGas[n-1] = gasUsed
+	}
+}
+
+// tracedVmManager traces the contracts run by the scheduler for the tx, the gas charge and refund included.
+// The calls made by the contracts are traced by txQuerySimContextImpl
+type tracedVmManager struct {
+	protocol.VmManager
+	tracer *txTracer
+}
+
+func (m *tracedVmManager) RunContract(contract *commonPb.Contract, method string, byteCode []byte,
+	parameters map[string][]byte, txContext protocol.TxSimContext, gasUsed uint64, refTxType commonPb.TxType) (
+	*commonPb.ContractResult, protocol.ExecOrderTxType, commonPb.TxStatusCode) {
+	m.tracer.traceCall(0, contract.Name, method, gasUsed)
+	result, specialTxType, code := m.VmManager.RunContract(contract, method, byteCode, parameters, txContext,
+		gasUsed, refTxType)
+	m.tracer.traceReturn(0, contract.Name, method, result, code)
+	return result, specialTxType, code
+}
+
+// isTraceTxQuery - check if the query asks for the debug trace of a tx
+func isTraceTxQuery(tx *commonPb.Transaction) bool {
+	return tx.Payload.ContractName == syscontract.SystemContract_CHAIN_QUERY.String() &&
+		tx.Payload.Method == TraceTxMethod
+}
+
+// dealTraceTxQuery - deal tx debug trace query. A committed tx is replayed against the state of the block
+// before its block, with the writes of the txs before it in its block. The tx is run by the scheduler, the gas is
+// charged and refunded as in its block, a simulated tx without gas limit is not charged as in the gas estimation
+func (s *ApiService) dealTraceTxQuery(tx *commonPb.Transaction) *commonPb.TxResponse {
+	resp := &commonPb.TxResponse{TxId: tx.Payload.TxId}
+	fail := func(code commonPb.TxStatusCode, errMsg string) *commonPb.TxResponse {
+		s.log.Warn(errMsg)
+		resp.Code = code
+		resp.Message = errMsg
+		return resp
+	}
+
+	chainId := tx.Payload.ChainId
+	store, err := s.chainMakerServer.GetStore(chainId)
+	if err != nil {
+		return fail(commonPb.TxStatusCode_INTERNAL_ERROR, fmt.Sprintf("get store failed, %s", err.Error()))
+	}
+	vmMgr, err := s.chainMakerServer.GetVmManager(chainId)
+	if err != nil {
+		return fail(commonPb.TxStatusCode_INTERNAL_ERROR, fmt.Sprintf("get vm manager failed, %s", err.Error()))
+	}
+	chainConf, err := s.chainMakerServer.GetChainConf(chainId)
+	if err != nil {
+		return fail(commonPb.TxStatusCode_INTERNAL_ERROR, fmt.Sprintf("get chain conf failed, %s", err.Error()))
+	}
+	// the sql state of the past blocks can not be rebuilt
+	if chainConf.ChainConfig().Contract.EnableSqlSupport {
+		return fail(commonPb.TxStatusCode_INTERNAL_ERROR, "tx trace is not supported when sql is enabled")
+	}
+
+	trace, code, err := s.traceTx(store, vmMgr, chainConf, tx)
+	if err != nil {
+		return fail(code, err.Error())
+	}
+
+	result, err := json.Marshal(trace)
+	if err != nil {
+		return fail(commonPb.TxStatusCode_INTERNAL_ERROR, fmt.Sprintf("marshal tx trace failed, %s", err.Error()))
+	}
+	resp.Code = commonPb.TxStatusCode_SUCCESS
+	resp.Message = commonPb.TxStatusCode_SUCCESS.String()
+	resp.ContractResult = &commonPb.ContractResult{
+		Result:  result,
+		Message: commonPb.TxStatusCode_SUCCESS.String(),
+		GasUsed: trace.GasUsed,
+	}
+	return resp
+}
+
+// traceTx - execute the tx of the trace query with the debug trace, the code is the response code of the error
+func (s *ApiService) traceTx(store protocol.BlockchainStore, vmMgr protocol.VmManager, chainConf protocol.ChainConf,
+	tx *commonPb.Transaction) (*TxTrace, commonPb.TxStatusCode, error) {
+	var txId string
+	for _, kv := range tx.Payload.Parameters {
+		if kv.Key == TraceTxIdKey {
+			txId = string(kv.Value)
+		}
+	}
+
+	trace := &TxTrace{TxIndex: -1}
+	var (
+		tracedTx      *commonPb.Transaction
+		historyReader *snapshot.HistoryStateReader
+		blockVersion  uint32
+		skipGasCharge bool
+		err           error
+	)
+	if txId != "" {
+		tracedTx, historyReader, err = s.replayTxState(store, txId, trace)
+		if err != nil {
+			return nil, historyErrCode(err), fmt.Errorf("replay tx %s failed, %s", txId, err.Error())
+		}
+		blockVersion = historyReader.BlockHeader().BlockVersion
+	} else {
+		if tracedTx, err = dryRunInvokeTx(tx); err != nil {
+			return nil, commonPb.TxStatusCode_INVALID_PARAMETER, fmt.Errorf("%s, %s", errTraceTxParam, err.Error())
+		}
+		var lastBlock *commonPb.Block
+		if lastBlock, err = store.GetLastBlock(); err != nil {
+			return nil, commonPb.TxStatusCode_INTERNAL_ERROR, fmt.Errorf("get last block failed, %s", err.Error())
+		}
+		trace.BlockHeight = lastBlock.Header.BlockHeight + 1
+		blockVersion = lastBlock.Header.BlockVersion
+		skipGasCharge = tracedTx.Payload.Limit == nil || tracedTx.Payload.Limit.GasLimit == 0
+	}
+	trace.TxId = tracedTx.Payload.TxId
+
+	tracer := &txTracer{}
+	ctx := &txQuerySimContextImpl{
+		tx:               tracedTx,
+		txReadKeyMap:     map[string]*commonPb.TxRead{},
+		txWriteKeyMap:    map[string]*commonPb.TxWrite{},
+		txWriteKeySql:    make([]*commonPb.TxWrite, 0),
+		txWriteKeyDdlSql: make([]*commonPb.TxWrite, 0),
+		rowCache:         make(map[int32]interface{}),
+		blockchainStore:  store,
+		historyReader:    historyReader,
+		tracer:           tracer,
+		vmManager:        vmMgr,
+		blockVersion:     blockVersion,
+	}
+
+	txResult, err := scheduler.RunTx(&tracedVmManager{VmManager: vmMgr, tracer: tracer}, chainConf, tracedTx, ctx,
+		skipGasCharge, s.log)
+	if txResult == nil {
+		if err == nil {
+			err = errors.New("no tx result")
+		}
+		return nil, commonPb.TxStatusCode_INTERNAL_ERROR, fmt.Errorf("run tx failed, %s", err.Error())
+	}
+
+	trace.Code = txResult.Code
+	trace.Message = txResult.Message
+	trace.ContractResult = txResult.ContractResult
+	if txResult.ContractResult != nil {
+		if trace.Message == "" {
+			trace.Message = txResult.ContractResult.Message
+		}
+		trace.GasUsed = txResult.ContractResult.GasUsed
+	}
+	trace.RwSet = ctx.GetTxRWSet(err == nil)
+	trace.Steps = tracer.steps
+	trace.Truncated = tracer.truncated
+
+	return trace, commonPb.TxStatusCode_SUCCESS, nil
+}
+
+// replayTxState - find the committed tx and build the state it was executed on
+func (s *ApiService) replayTxState(store protocol.BlockchainStore, txId string, trace *TxTrace) (
+	*commonPb.Transaction, *snapshot.HistoryStateReader, error) {
+	block, err := store.GetBlockByTx(txId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if block == nil {
+		return nil, nil, errors.New("tx not found")
+	}
+	if block.Header.BlockHeight == 0 {
+		return nil, nil, errors.New("the txs of the genesis block can not be replayed")
+	}
+
+	txIndex := -1
+	for i, blockTx := range block.Txs {
+		if blockTx.Payload.TxId == txId {
+			txIndex = i
+			break
+		}
+	}
+	if txIndex < 0 {
+		return nil, nil, fmt.Errorf("tx not found in block %d", block.Header.BlockHeight)
+	}
+
+	reader, err := newHistoryStateReader(store, block.Header.BlockHeight-1)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader.SetExecBlock(block)
+
+	rwSets, err := store.GetTxRWSetsByHeight(block.Header.BlockHeight)
+	if err != nil {
+		return nil, nil, err
+	}
+	rwSetMap := make(map[string]*commonPb.TxRWSet, len(rwSets))
+	for _, rwSet := range rwSets {
+		if rwSet != nil {
+			rwSetMap[rwSet.TxId] = rwSet
+		}
+	}
+	preRwSets := make([]*commonPb.TxRWSet, 0, txIndex)
+	for _, blockTx := range block.Txs[:txIndex] {
+		preRwSets = append(preRwSets, rwSetMap[blockTx.Payload.TxId])
+	}
+	reader.ApplyTxWrites(preRwSets)
+
+	tx := block.Txs[txIndex]
+	trace.BlockHeight = block.Header.BlockHeight
+	trace.TxIndex = txIndex
+	trace.RecordedResult = tx.Result
+	return tx, reader, nil
+}
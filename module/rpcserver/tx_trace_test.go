@@ -0,0 +1,182 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rpcserver
+
+import (
+	"testing"
+
+	"chainmaker.org/chainmaker/logger/v2"
+	"chainmaker.org/chainmaker/pb-go/v2/accesscontrol"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	configPb "chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+const traceTestBlockVersion = 2030100
+
+// newTraceTestService the mocks of a chain with the gas enabled, the contract counter calls the contract logger,
+// both emit an event. The call of logger uses 50 gas after the 100 gas used by counter, counter uses 300 in total.
+// If mergeEvents is set, the result of counter contains the event of logger as well
+func newTraceTestService(t *testing.T, mergeEvents bool) (*ApiService, protocol.BlockchainStore,
+	protocol.VmManager, protocol.ChainConf, *uint32) {
+	ctrl := gomock.NewController(t)
+	store := mock.NewMockBlockchainStore(ctrl)
+	vmMgr := mock.NewMockVmManager(ctrl)
+	chainConf := mock.NewMockChainConf(ctrl)
+
+	chainConf.EXPECT().ChainConfig().Return(&configPb.ChainConfig{
+		ChainId:       "chain1",
+		Contract:      &configPb.ContractConfig{},
+		AccountConfig: &configPb.GasAccountConfig{EnableGas: true},
+	}).AnyTimes()
+	store.EXPECT().GetLastBlock().Return(&commonPb.Block{Header: &commonPb.BlockHeader{
+		ChainId: "chain1", BlockHeight: 9, BlockVersion: traceTestBlockVersion}}, nil).AnyTimes()
+	store.EXPECT().GetContractByName(gomock.Any()).DoAndReturn(func(name string) (*commonPb.Contract, error) {
+		runtimeType := commonPb.RuntimeType_DOCKER_GO
+		if name == syscontract.SystemContract_ACCOUNT_MANAGER.String() {
+			runtimeType = commonPb.RuntimeType_NATIVE
+		}
+		return &commonPb.Contract{Name: name, RuntimeType: runtimeType, Status: commonPb.ContractStatus_NORMAL}, nil
+	}).AnyTimes()
+
+	var blockVersion uint32
+	vmMgr.EXPECT().RunContract(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
+		gomock.Any()).DoAndReturn(
+		func(contract *commonPb.Contract, method string, byteCode []byte, parameters map[string][]byte,
+			txContext protocol.TxSimContext, gasUsed uint64, refTxType commonPb.TxType) (
+			*commonPb.ContractResult, protocol.ExecOrderTxType, commonPb.TxStatusCode) {
+			result := &commonPb.ContractResult{}
+			switch contract.Name {
+			case "counter":
+				blockVersion = txContext.GetBlockVersion()
+				require.NoError(t, txContext.Put("counter", []byte("count"), []byte("1")))
+				logged, _, code := txContext.CallContract(&commonPb.Contract{Name: "logger",
+					RuntimeType: commonPb.RuntimeType_DOCKER_GO}, "log", []byte("bytecode"), nil, 100,
+					commonPb.TxType_INVOKE_CONTRACT)
+				require.Equal(t, commonPb.TxStatusCode_SUCCESS, code)
+				if mergeEvents {
+					result.ContractEvent = append(result.ContractEvent, logged.ContractEvent...)
+				}
+				result.ContractEvent = append(result.ContractEvent,
+					&commonPb.ContractEvent{ContractName: "counter", Topic: "counted", TxId: "tx1"})
+				result.GasUsed = 300
+			case "logger":
+				result.ContractEvent = []*commonPb.ContractEvent{
+					{ContractName: "logger", Topic: "logged", TxId: "tx1"}}
+				result.GasUsed = gasUsed + 50
+			}
+			return result, protocol.ExecOrderTxTypeNormal, commonPb.TxStatusCode_SUCCESS
+		}).AnyTimes()
+
+	return &ApiService{log: logger.GetLogger(logger.MODULE_RPC)}, store, vmMgr, chainConf, &blockVersion
+}
+
+// newTraceTestQuery the trace query of the invoke of counter
+func newTraceTestQuery(t *testing.T, gasLimit uint64) *commonPb.Transaction {
+	payload := &commonPb.Payload{TxType: commonPb.TxType_INVOKE_CONTRACT, TxId: "tx1", ContractName: "counter",
+		Method: "count"}
+	if gasLimit > 0 {
+		payload.Limit = &commonPb.Limit{GasLimit: gasLimit}
+	}
+	payloadBytes, err := payload.Marshal()
+	require.NoError(t, err)
+	return &commonPb.Transaction{
+		Payload: &commonPb.Payload{ChainId: "chain1", TxType: commonPb.TxType_QUERY_CONTRACT, TxId: "query1",
+			ContractName: syscontract.SystemContract_CHAIN_QUERY.String(), Method: TraceTxMethod,
+			Parameters: []*commonPb.KeyValuePair{{Key: EstimateGasPayloadKey, Value: payloadBytes}}},
+		Sender: &commonPb.EndorsementEntry{Signer: &accesscontrol.Member{
+			OrgId: "org1", MemberType: accesscontrol.MemberType_PUBLIC_KEY, MemberInfo: []byte("sender pk")}},
+	}
+}
+
+// traceTestStep the fields of a step compared by the tests
+type traceTestStep struct {
+	op    string
+	depth int
+	name  string // the contract and the method, or the contract and the topic of the events
+}
+
+func traceTestSteps(t *testing.T, trace *TxTrace) []traceTestStep {
+	steps := make([]traceTestStep, 0, len(trace.Steps))
+	for i, step := range trace.Steps {
+		name := step.ContractName + "." + step.Method
+		if step.Op == traceOpEvent {
+			name = step.ContractName + "." + step.Topic
+		}
+		require.Equal(t, i, step.Index)
+		steps = append(steps, traceTestStep{op: step.Op, depth: step.Depth, name: name})
+	}
+	return steps
+}
+
+func TestTraceTx_GasAndEventOrder(t *testing.T) {
+	for _, mergeEvents := range []bool{false, true} {
+		s, store, vmMgr, chainConf, blockVersion := newTraceTestService(t, mergeEvents)
+		trace, code, err := s.traceTx(store, vmMgr, chainConf, newTraceTestQuery(t, 1000))
+		require.NoError(t, err)
+		require.Equal(t, commonPb.TxStatusCode_SUCCESS, code)
+
+		// the tx is executed in the block after the last block, with its version
+		require.Equal(t, uint32(traceTestBlockVersion), *blockVersion)
+		require.Equal(t, uint64(10), trace.BlockHeight)
+		require.Equal(t, -1, trace.TxIndex)
+		require.Equal(t, "tx1", trace.TxId)
+		require.Equal(t, commonPb.TxStatusCode_SUCCESS, trace.Code)
+		require.Equal(t, uint64(300), trace.GasUsed)
+
+		// the gas is charged and refunded around the contract, the events precede the return of their call
+		chargeGas := syscontract.SystemContract_ACCOUNT_MANAGER.String() + "." +
+			syscontract.GasAccountFunction_CHARGE_GAS.String()
+		refundGas := syscontract.SystemContract_ACCOUNT_MANAGER.String() + "." +
+			syscontract.GasAccountFunction_REFUND_GAS_VM.String()
+		require.Equal(t, []traceTestStep{
+			{op: traceOpCall, depth: 0, name: chargeGas},
+			{op: traceOpReturn, depth: 0, name: chargeGas},
+			{op: traceOpCall, depth: 0, name: "counter.count"},
+			{op: traceOpPut, depth: 0, name: "counter."},
+			{op: traceOpCall, depth: 1, name: "logger.log"},
+			{op: traceOpEvent, depth: 1, name: "logger.logged"},
+			{op: traceOpReturn, depth: 1, name: "logger.log"},
+			{op: traceOpEvent, depth: 0, name: "counter.counted"},
+			{op: traceOpReturn, depth: 0, name: "counter.count"},
+			{op: traceOpCall, depth: 0, name: refundGas},
+			{op: traceOpReturn, depth: 0, name: refundGas},
+		}, traceTestSteps(t, trace), "merge events: %v", mergeEvents)
+
+		// the gas used by the running call at each step
+		gasUsed := make([]uint64, 0, len(trace.Steps))
+		for _, step := range trace.Steps {
+			gasUsed = append(gasUsed, step.GasUsed)
+		}
+		require.Equal(t, []uint64{0, 0, 0, 0, 100, 150, 150, 300, 300, 0, 0}, gasUsed,
+			"merge events: %v", mergeEvents)
+	}
+}
+
+func TestTraceTx_SkipGasCharge(t *testing.T) {
+	s, store, vmMgr, chainConf, _ := newTraceTestService(t, false)
+
+	// the simulated tx without gas limit is not charged, as in the gas estimation
+	trace, _, err := s.traceTx(store, vmMgr, chainConf, newTraceTestQuery(t, 0))
+	require.NoError(t, err)
+	require.Equal(t, commonPb.TxStatusCode_SUCCESS, trace.Code)
+	require.Equal(t, uint64(300), trace.GasUsed)
+	steps := traceTestSteps(t, trace)
+	require.Equal(t, traceTestStep{op: traceOpCall, depth: 0, name: "counter.count"}, steps[0])
+	require.Equal(t, traceTestStep{op: traceOpReturn, depth: 0, name: "counter.count"}, steps[len(steps)-1])
+
+	// neither a tx id nor a payload
+	query := newTraceTestQuery(t, 0)
+	query.Payload.Parameters = nil
+	_, code, err := s.traceTx(store, vmMgr, chainConf, query)
+	require.Error(t, err)
+	require.Equal(t, commonPb.TxStatusCode_INVALID_PARAMETER, code)
+}
@@ -95,6 +95,16 @@ func (s *SnapshotEvidence) ApplyTxSimContext(txSimContext protocol.TxSimContext,
 	return s.delegate.ApplyTxSimContext(txSimContext, specialTxType, runVmSuccess, withSpecialTx)
 }
 
+// ApplyTxSimContextWithRanges add TxSimContext to the snapshot together with the key ranges read by its iterators
+// return if apply successfully or not, and current applied tx num
+func (s *SnapshotEvidence) ApplyTxSimContextWithRanges(txSimContext protocol.TxSimContext,
+	specialTxType protocol.ExecOrderTxType, runVmSuccess bool, withSpecialTx bool, ranges []*KeyRange) (bool, int) {
+	if s.delegate == nil {
+		return false, -1
+	}
+	return s.delegate.ApplyTxSimContextWithRanges(txSimContext, specialTxType, runVmSuccess, withSpecialTx, ranges)
+}
+
 // check if snapshot is sealed
 func (s *SnapshotEvidence) IsSealed() bool {
 	if s.delegate == nil {
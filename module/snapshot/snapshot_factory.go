@@ -8,6 +8,7 @@ SPDX-License-Identifier: Apache-2.0
 package snapshot
 
 import (
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/protocol/v2"
 	"chainmaker.org/chainmaker/utils/v2"
 )
@@ -42,3 +43,14 @@ func (f *Factory) NewSnapshotEvidenceMgr(blockchainStore protocol.BlockchainStor
 		log: log,
 	}
 }
+
+// NewDryRunSnapshot create a snapshot of the block on top of the committed state, it is not managed by any
+// snapshot manager and is dropped after the txs are simulated
+func NewDryRunSnapshot(blockchainStore protocol.BlockchainStore, log protocol.Logger,
+	block *commonPb.Block) protocol.Snapshot {
+	delegate := &ManagerDelegate{
+		blockchainStore: blockchainStore,
+		log:             log,
+	}
+	return delegate.makeSnapshotImpl(block)
+}
@@ -0,0 +1,444 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	storePb "chainmaker.org/chainmaker/pb-go/v2/store"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+var (
+	// ErrHistoryHeightArchived the blocks needed to rebuild the state at the height have been archived
+	ErrHistoryHeightArchived = errors.New("query block height has been archived")
+	// ErrHistoryHeightTooHigh the height is higher than the current block height
+	ErrHistoryHeightTooHigh = errors.New("query block height is higher than the current block height")
+	// ErrHistoryHeightTooFar the height is further behind the current block height than allowed
+	ErrHistoryHeightTooFar = errors.New("query block height is too far behind the current block height")
+	// ErrHistoryStateMoved the blocks kept being committed while the current state was read
+	ErrHistoryStateMoved = errors.New("the current state kept changing while it was read")
+)
+
+// historyReadRetries the times a read of the current state is retried when blocks are committed meanwhile
+const historyReadRetries = 3
+
+// HistoryStateReader serves state reads as they were right after block `height` was committed.
+//
+// All keys written by blocks (height, lastHeight] are collected from the stored read/write sets,
+// and their values at `height` are resolved lazily from the key history. Keys not in this overlay
+// have not changed since `height`, so they are read from the current state. A block committed while
+// the current state is read is added to the overlay and the read is retried.
+type HistoryStateReader struct {
+	store     protocol.BlockchainStore
+	height    uint64
+	block     *commonPb.Block
+	execBlock *commonPb.Block // the block of the replayed txs, nil for the queries
+	// the txs of a replayed block read in parallel
+	lock       sync.RWMutex
+	lastHeight uint64 // the last block whose writes are in changed
+	changed    map[string]*historyKey
+	resolved   map[string]*historyValue
+}
+
+type historyKey struct {
+	contractName string
+	key          []byte
+}
+
+type historyValue struct {
+	value []byte
+}
+
+// NewHistoryStateReader build a reader for the state at height, returns ErrHistoryHeightArchived
+// if the blocks needed to rebuild that state have been archived. The read/write sets of every block
+// after height are loaded, so the height is limited to maxDistance blocks behind the current height,
+// 0 means unlimited.
+func NewHistoryStateReader(store protocol.BlockchainStore, height uint64, maxDistance uint64) (
+	*HistoryStateReader, error) {
+	lastBlock, err := store.GetLastBlock()
+	if err != nil {
+		return nil, err
+	}
+	lastHeight := lastBlock.Header.BlockHeight
+	if height > lastHeight {
+		return nil, fmt.Errorf("%w, height:%d, current:%d", ErrHistoryHeightTooHigh, height, lastHeight)
+	}
+	if maxDistance > 0 && lastHeight-height > maxDistance {
+		return nil, fmt.Errorf("%w, height:%d, current:%d, max distance:%d", ErrHistoryHeightTooFar,
+			height, lastHeight, maxDistance)
+	}
+	if archivedPivot := store.GetArchivedPivot(); archivedPivot > 0 && height <= archivedPivot {
+		return nil, fmt.Errorf("%w, height:%d, archived pivot:%d", ErrHistoryHeightArchived, height, archivedPivot)
+	}
+
+	block, err := store.GetBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block is nil, height:%d", height)
+	}
+
+	reader := &HistoryStateReader{
+		store:      store,
+		height:     height,
+		block:      block,
+		lastHeight: height,
+		changed:    make(map[string]*historyKey),
+		resolved:   make(map[string]*historyValue),
+	}
+	if err = reader.addChangedKeys(lastHeight); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// addChangedKeys add the keys written by the blocks (r.lastHeight, lastHeight] to the overlay,
+// the caller holds the write lock or owns the reader
+func (r *HistoryStateReader) addChangedKeys(lastHeight uint64) error {
+	for h := r.lastHeight + 1; h <= lastHeight; h++ {
+		rwSets, err := r.store.GetTxRWSetsByHeight(h)
+		if err != nil {
+			return err
+		}
+		for _, rwSet := range rwSets {
+			if rwSet == nil {
+				continue
+			}
+			for _, txWrite := range rwSet.TxWrites {
+				r.changed[constructKey(txWrite.ContractName, txWrite.Key)] = &historyKey{
+					contractName: txWrite.ContractName,
+					key:          txWrite.Key,
+				}
+			}
+		}
+		r.lastHeight = h
+	}
+	return nil
+}
+
+// followLastBlock add the blocks committed since the overlay was built to it, returns true if there
+// were any, in which case a value read from the current state may be newer than the reader height
+func (r *HistoryStateReader) followLastBlock() (bool, error) {
+	lastBlock, err := r.store.GetLastBlock()
+	if err != nil {
+		return false, err
+	}
+	lastHeight := lastBlock.Header.BlockHeight
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if lastHeight <= r.lastHeight {
+		return false, nil
+	}
+	return true, r.addChangedKeys(lastHeight)
+}
+
+// ApplyTxWrites puts the writes of the txs on top of the state at the reader height,
+// so that a tx of the next block is replayed against the state left by the txs before it
+func (r *HistoryStateReader) ApplyTxWrites(rwSets []*commonPb.TxRWSet) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, rwSet := range rwSets {
+		if rwSet == nil {
+			continue
+		}
+		for _, txWrite := range rwSet.TxWrites {
+			k := constructKey(txWrite.ContractName, txWrite.Key)
+			r.changed[k] = &historyKey{contractName: txWrite.ContractName, key: txWrite.Key}
+			r.resolved[k] = &historyValue{value: txWrite.Value}
+		}
+	}
+}
+
+// SetExecBlock set the block the txs replayed on the state are in, it is the block after the reader height
+func (r *HistoryStateReader) SetExecBlock(block *commonPb.Block) {
+	r.execBlock = block
+}
+
+// BlockHeader returns the header of the block the reads are made in
+func (r *HistoryStateReader) BlockHeader() *commonPb.BlockHeader {
+	if r.execBlock != nil {
+		return r.execBlock.Header
+	}
+	return r.block.Header
+}
+
+// ReadObject returns the value of key at the reader height
+func (r *HistoryStateReader) ReadObject(contractName string, key []byte) ([]byte, error) {
+	k := constructKey(contractName, key)
+	for i := 0; ; i++ {
+		r.lock.RLock()
+		_, changed := r.changed[k]
+		r.lock.RUnlock()
+		if changed {
+			return r.readChanged(k, contractName, key)
+		}
+		if i == historyReadRetries {
+			return nil, fmt.Errorf("%w, contract:%s, key:%s", ErrHistoryStateMoved, contractName, key)
+		}
+
+		value, err := r.store.ReadObject(contractName, key)
+		if err != nil {
+			return nil, err
+		}
+		// the key may have been written by a block committed during the read
+		moved, err := r.followLastBlock()
+		if err != nil {
+			return nil, err
+		}
+		if !moved {
+			return value, nil
+		}
+	}
+}
+
+// readChanged returns the value at the reader height of a key written after it
+func (r *HistoryStateReader) readChanged(k string, contractName string, key []byte) ([]byte, error) {
+	r.lock.RLock()
+	v, resolved := r.resolved[k]
+	r.lock.RUnlock()
+	if resolved {
+		return v.value, nil
+	}
+
+	value, err := r.valueAtHeight(contractName, key)
+	if err != nil {
+		return nil, err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	// resolved by another tx meanwhile, or written by ApplyTxWrites
+	if v, ok := r.resolved[k]; ok {
+		return v.value, nil
+	}
+	r.resolved[k] = &historyValue{value: value}
+	return value, nil
+}
+
+// valueAtHeight walks the key history and returns the last value written at or below the reader height
+func (r *HistoryStateReader) valueAtHeight(contractName string, key []byte) ([]byte, error) {
+	iter, err := r.store.GetHistoryForKey(contractName, key)
+	if err != nil {
+		return nil, err
+	}
+	if iter == nil {
+		return nil, fmt.Errorf("key history is not available, contract:%s, key:%s", contractName, key)
+	}
+	defer iter.Release()
+
+	var (
+		value     []byte
+		bestFound bool
+		bestH     uint64
+	)
+	for iter.Next() {
+		km, err := iter.Value()
+		if err != nil {
+			return nil, err
+		}
+		if km == nil || km.BlockHeight > r.height {
+			continue
+		}
+		if bestFound && km.BlockHeight < bestH {
+			continue
+		}
+		bestFound = true
+		bestH = km.BlockHeight
+		if km.IsDelete {
+			value = nil
+		} else {
+			value = km.Value
+		}
+	}
+	return value, nil
+}
+
+// SelectObject returns an iterator over [startKey, limit) at the reader height
+func (r *HistoryStateReader) SelectObject(contractName string, startKey []byte, limit []byte) (
+	protocol.StateIterator, error) {
+
+	current, err := r.selectCurrent(contractName, startKey, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// the changed keys of the contract, the iterator does not share the map with the writers
+	changed := make(map[string]*historyKey)
+	r.lock.RLock()
+	for k, hk := range r.changed {
+		if hk.contractName == contractName {
+			changed[k] = hk
+		}
+	}
+	r.lock.RUnlock()
+
+	overlay := make([]*storePb.KV, 0)
+	for _, hk := range changed {
+		if bytes.Compare(hk.key, startKey) < 0 || (len(limit) > 0 && bytes.Compare(hk.key, limit) >= 0) {
+			continue
+		}
+		value, err := r.ReadObject(contractName, hk.key)
+		if err != nil {
+			current.Release()
+			return nil, err
+		}
+		overlay = append(overlay, &storePb.KV{ContractName: contractName, Key: hk.key, Value: value})
+	}
+	sort.Slice(overlay, func(i, j int) bool {
+		return bytes.Compare(overlay[i].Key, overlay[j].Key) < 0
+	})
+
+	return newHistoryStateIterator(current, overlay, changed), nil
+}
+
+// selectCurrent returns an iterator over the current state, created when no block is committed
+// meanwhile, so that the overlay has all the keys changed in the state it iterates
+func (r *HistoryStateReader) selectCurrent(contractName string, startKey []byte, limit []byte) (
+	protocol.StateIterator, error) {
+	for i := 0; i < historyReadRetries; i++ {
+		current, err := r.store.SelectObject(contractName, startKey, limit)
+		if err != nil {
+			return nil, err
+		}
+		moved, err := r.followLastBlock()
+		if err != nil {
+			current.Release()
+			return nil, err
+		}
+		if !moved {
+			return current, nil
+		}
+		current.Release()
+	}
+	return nil, fmt.Errorf("%w, contract:%s", ErrHistoryStateMoved, contractName)
+}
+
+// historyStateIterator merges the current state iterator with the overlay of keys changed after the
+// reader height, keys in the overlay always win and empty overlay values are treated as deleted
+type historyStateIterator struct {
+	current    protocol.StateIterator
+	changed    map[string]*historyKey
+	overlay    []*storePb.KV
+	curKV      *storePb.KV
+	curErr     error
+	errDone    bool // curErr has been reported by a Next
+	curLoaded  bool
+	curDone    bool
+	value      *storePb.KV
+	overlayIdx int
+}
+
+func newHistoryStateIterator(current protocol.StateIterator, overlay []*storePb.KV,
+	changed map[string]*historyKey) *historyStateIterator {
+	return &historyStateIterator{
+		current: current,
+		changed: changed,
+		overlay: overlay,
+	}
+}
+
+// loadCurrent fetch the next current-state kv which is not shadowed by the overlay
+func (it *historyStateIterator) loadCurrent() {
+	if it.curLoaded || it.curDone {
+		return
+	}
+	for it.current.Next() {
+		kv, err := it.current.Value()
+		if err != nil {
+			it.curErr = err
+			it.curLoaded = true
+			return
+		}
+		if _, ok := it.changed[constructKey(kv.ContractName, kv.Key)]; ok {
+			continue
+		}
+		it.curKV = kv
+		it.curLoaded = true
+		return
+	}
+	it.curDone = true
+}
+
+// Next move to the next kv, returns false when both sides are exhausted. An error of the current state
+// is reported once by Value, the iteration stops after that.
+func (it *historyStateIterator) Next() bool {
+	if it.errDone {
+		return false
+	}
+	for {
+		it.loadCurrent()
+		if it.curErr != nil {
+			it.errDone = true
+			return true
+		}
+
+		var next *storePb.KV
+		hasOverlay := it.overlayIdx < len(it.overlay)
+		switch {
+		case it.curDone && !hasOverlay:
+			return false
+		case it.curDone:
+			next = it.overlay[it.overlayIdx]
+			it.overlayIdx++
+		case !hasOverlay || bytes.Compare(it.curKV.Key, it.overlay[it.overlayIdx].Key) < 0:
+			next = it.curKV
+			it.curLoaded = false
+		default:
+			next = it.overlay[it.overlayIdx]
+			it.overlayIdx++
+		}
+
+		if len(next.Value) == 0 {
+			continue
+		}
+		it.value = next
+		return true
+	}
+}
+
+// Value returns the current kv
+func (it *historyStateIterator) Value() (*storePb.KV, error) {
+	if it.curErr != nil {
+		return nil, it.curErr
+	}
+	return it.value, nil
+}
+
+// Release release the underlying iterator
+func (it *historyStateIterator) Release() {
+	it.current.Release()
+}
+
+// historyStore the blockchain store whose state reads are served by the reader,
+// so that the txs executed on a snapshot of it see the state at the reader height
+type historyStore struct {
+	protocol.BlockchainStore
+	reader *HistoryStateReader
+}
+
+// NewHistoryStore wrap the store to read the state at the height of the reader
+func NewHistoryStore(store protocol.BlockchainStore, reader *HistoryStateReader) protocol.BlockchainStore {
+	return &historyStore{BlockchainStore: store, reader: reader}
+}
+
+// ReadObject returns the value of key at the reader height
+func (s *historyStore) ReadObject(contractName string, key []byte) ([]byte, error) {
+	return s.reader.ReadObject(contractName, key)
+}
+
+// SelectObject returns an iterator over [startKey, limit) at the reader height
+func (s *historyStore) SelectObject(contractName string, startKey []byte, limit []byte) (
+	protocol.StateIterator, error) {
+	return s.reader.SelectObject(contractName, startKey, limit)
+}
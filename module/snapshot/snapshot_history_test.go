@@ -0,0 +1,226 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	storePb "chainmaker.org/chainmaker/pb-go/v2/store"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+// kvListIterator iterates over the kvs of the current state in the test
+type kvListIterator struct {
+	kvs []*storePb.KV
+	idx int
+}
+
+func (it *kvListIterator) Next() bool {
+	it.idx++
+	return it.idx <= len(it.kvs)
+}
+
+func (it *kvListIterator) Value() (*storePb.KV, error) {
+	return it.kvs[it.idx-1], nil
+}
+
+func (it *kvListIterator) Release() {}
+
+func newHistoryTestReader(store *mock.MockBlockchainStore) *HistoryStateReader {
+	// no block is committed during the reads
+	store.EXPECT().GetLastBlock().Return(&commonPb.Block{Header: &commonPb.BlockHeader{}}, nil).AnyTimes()
+	reader := &HistoryStateReader{
+		store:    store,
+		changed:  make(map[string]*historyKey),
+		resolved: make(map[string]*historyValue),
+	}
+	// the writes after the reader height, as they were at the height
+	reader.ApplyTxWrites([]*commonPb.TxRWSet{{
+		TxWrites: []*commonPb.TxWrite{
+			{ContractName: "c", Key: []byte("b"), Value: []byte("old")},
+			{ContractName: "c", Key: []byte("c"), Value: nil},
+			{ContractName: "c", Key: []byte("d"), Value: []byte("old")},
+		},
+	}})
+	return reader
+}
+
+func TestHistoryStateReader_ReadObject(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mock.NewMockBlockchainStore(ctrl)
+	store.EXPECT().ReadObject("c", []byte("a")).Return([]byte("cur"), nil).Times(1)
+	reader := newHistoryTestReader(store)
+
+	value, err := reader.ReadObject("c", []byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, "cur", string(value))
+	value, err = reader.ReadObject("c", []byte("b"))
+	require.NoError(t, err)
+	require.Equal(t, "old", string(value))
+	value, err = reader.ReadObject("c", []byte("c"))
+	require.NoError(t, err)
+	require.Nil(t, value)
+}
+
+func TestHistoryStateReader_ConcurrentReadObject(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mock.NewMockBlockchainStore(ctrl)
+	store.EXPECT().ReadObject("c", []byte("a")).Return([]byte("cur"), nil).AnyTimes()
+	reader := newHistoryTestReader(store)
+
+	// the txs of a replayed block read the reader in parallel
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reader.ApplyTxWrites([]*commonPb.TxRWSet{{TxWrites: []*commonPb.TxWrite{
+				{ContractName: "c", Key: []byte(fmt.Sprintf("e%d", i)), Value: []byte("old")}}}})
+			for j := 0; j < 100; j++ {
+				value, err := reader.ReadObject("c", []byte("a"))
+				require.NoError(t, err)
+				require.Equal(t, "cur", string(value))
+				value, err = reader.ReadObject("c", []byte("b"))
+				require.NoError(t, err)
+				require.Equal(t, "old", string(value))
+			}
+		}(i)
+	}
+	wg.Wait()
+	value, err := reader.ReadObject("c", []byte("e7"))
+	require.NoError(t, err)
+	require.Equal(t, "old", string(value))
+}
+
+func TestHistoryStateReader_SelectObject(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mock.NewMockBlockchainStore(ctrl)
+	store.EXPECT().SelectObject("c", []byte("a"), []byte("z")).Return(&kvListIterator{kvs: []*storePb.KV{
+		{ContractName: "c", Key: []byte("a"), Value: []byte("cur")},
+		{ContractName: "c", Key: []byte("b"), Value: []byte("cur")},
+		{ContractName: "c", Key: []byte("c"), Value: []byte("cur")},
+	}}, nil)
+	reader := newHistoryTestReader(store)
+
+	iter, err := NewHistoryStore(store, reader).SelectObject("c", []byte("a"), []byte("z"))
+	require.NoError(t, err)
+	defer iter.Release()
+	var kvs []string
+	for iter.Next() {
+		kv, err := iter.Value()
+		require.NoError(t, err)
+		kvs = append(kvs, string(kv.Key)+"="+string(kv.Value))
+	}
+	// b is shadowed by its old value, c did not exist and d has been deleted since
+	require.Equal(t, []string{"a=cur", "b=old", "d=old"}, kvs)
+}
+
+func TestNewHistoryStateReader_MaxDistance(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mock.NewMockBlockchainStore(ctrl)
+	store.EXPECT().GetLastBlock().Return(&commonPb.Block{Header: &commonPb.BlockHeader{BlockHeight: 100}}, nil).
+		AnyTimes()
+	store.EXPECT().GetArchivedPivot().Return(uint64(0)).AnyTimes()
+
+	_, err := NewHistoryStateReader(store, 101, 0)
+	require.True(t, errors.Is(err, ErrHistoryHeightTooHigh))
+	// no read/write set is loaded for a height too far behind
+	_, err = NewHistoryStateReader(store, 89, 10)
+	require.True(t, errors.Is(err, ErrHistoryHeightTooFar))
+
+	store.EXPECT().GetBlock(uint64(90)).Return(&commonPb.Block{Header: &commonPb.BlockHeader{BlockHeight: 90}}, nil)
+	for h := uint64(91); h <= 100; h++ {
+		store.EXPECT().GetTxRWSetsByHeight(h).Return(nil, nil)
+	}
+	reader, err := NewHistoryStateReader(store, 90, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(90), reader.BlockHeader().BlockHeight)
+}
+
+// kmListIterator iterates over the history of a key in the test
+type kmListIterator struct {
+	kms []*storePb.KeyModification
+	idx int
+}
+
+func (it *kmListIterator) Next() bool {
+	it.idx++
+	return it.idx <= len(it.kms)
+}
+
+func (it *kmListIterator) Value() (*storePb.KeyModification, error) {
+	return it.kms[it.idx-1], nil
+}
+
+func (it *kmListIterator) Release() {}
+
+func TestHistoryStateReader_CommitDuringRead(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mock.NewMockBlockchainStore(ctrl)
+	lastHeight := uint64(10)
+	store.EXPECT().GetLastBlock().DoAndReturn(func() (*commonPb.Block, error) {
+		return &commonPb.Block{Header: &commonPb.BlockHeader{BlockHeight: lastHeight}}, nil
+	}).AnyTimes()
+	store.EXPECT().GetArchivedPivot().Return(uint64(0)).AnyTimes()
+	store.EXPECT().GetBlock(uint64(9)).Return(&commonPb.Block{Header: &commonPb.BlockHeader{BlockHeight: 9}}, nil)
+	store.EXPECT().GetTxRWSetsByHeight(uint64(10)).Return(nil, nil)
+	reader, err := NewHistoryStateReader(store, 9, 0)
+	require.NoError(t, err)
+
+	// the block 11 writing the key is committed while the key is read from the current state
+	store.EXPECT().ReadObject("c", []byte("a")).DoAndReturn(func(contractName string, key []byte) ([]byte, error) {
+		lastHeight = 11
+		return []byte("v11"), nil
+	})
+	store.EXPECT().GetTxRWSetsByHeight(uint64(11)).Return([]*commonPb.TxRWSet{{TxWrites: []*commonPb.TxWrite{
+		{ContractName: "c", Key: []byte("a"), Value: []byte("v11")}}}}, nil)
+	store.EXPECT().GetHistoryForKey("c", []byte("a")).Return(&kmListIterator{kms: []*storePb.KeyModification{
+		{Value: []byte("v11"), BlockHeight: 11},
+		{Value: []byte("v5"), BlockHeight: 5},
+	}}, nil)
+	value, err := reader.ReadObject("c", []byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, "v5", string(value))
+
+	// a block is committed during every read of the current state
+	store.EXPECT().ReadObject("c", []byte("b")).DoAndReturn(func(contractName string, key []byte) ([]byte, error) {
+		lastHeight++
+		return []byte("new"), nil
+	}).Times(historyReadRetries)
+	store.EXPECT().GetTxRWSetsByHeight(gomock.Any()).Return(nil, nil).Times(historyReadRetries)
+	_, err = reader.ReadObject("c", []byte("b"))
+	require.True(t, errors.Is(err, ErrHistoryStateMoved))
+}
+
+// errKVIterator fails at the first kv
+type errKVIterator struct{}
+
+func (it *errKVIterator) Next() bool { return true }
+
+func (it *errKVIterator) Value() (*storePb.KV, error) { return nil, errors.New("read failed") }
+
+func (it *errKVIterator) Release() {}
+
+func TestHistoryStateIterator_Error(t *testing.T) {
+	iter := newHistoryStateIterator(&errKVIterator{}, nil, map[string]*historyKey{})
+	require.True(t, iter.Next())
+	_, err := iter.Value()
+	require.Error(t, err)
+	// the error is reported once, the iteration does not loop on it
+	require.False(t, iter.Next())
+}
@@ -43,14 +43,23 @@ type SnapshotImpl struct {
 	preBlockHash   []byte
 
 	preSnapshot protocol.Snapshot
+	// latest values of the keys in the pre snapshots
+	preIndexLock sync.Mutex
+	preIndex     map[string][]byte
 
 	// applied data, please lock it before using
 	txRWSetTable   []*commonPb.TxRWSet
 	txTable        []*commonPb.Transaction
 	specialTxTable []*commonPb.Transaction
 	txResultMap    map[string]*commonPb.Result
-	readTable      map[string]*sv
-	writeTable     map[string]*sv
+	// values read from the pre snapshots or the blockchain store, before they are written in the snapshot
+	readTable map[string]*sv
+	// latest values written
+	writeTable map[string]*sv
+	// all the values written, in ascending order of the seq, so a tx reads the value visible at its txExecSeq
+	versionTable map[string][]*sv
+	// key ranges read by the iterators of the applied txs, keyed by the tx seq
+	txRangeTable map[uint32][]*KeyRange
 
 	txRoot    []byte
 	dagHash   []byte
@@ -62,7 +71,10 @@ func (s *SnapshotImpl) GetPreSnapshot() protocol.Snapshot {
 }
 
 func (s *SnapshotImpl) SetPreSnapshot(snapshot protocol.Snapshot) {
+	s.preIndexLock.Lock()
+	defer s.preIndexLock.Unlock()
 	s.preSnapshot = snapshot
+	s.preIndex = nil
 }
 
 // GetBlockchainStore return the blockchainStore of the snapshot
@@ -138,31 +150,32 @@ func (s *SnapshotImpl) GetKey(txExecSeq int, contractName string, key []byte) ([
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 	if txExecSeq > snapshotSize || txExecSeq < 0 {
-		txExecSeq = snapshotSize //nolint: ineffassign, staticcheck
+		txExecSeq = snapshotSize
 	}
 	finalKey := constructKey(contractName, key)
-	if sv, ok := s.writeTable[finalKey]; ok {
-		return sv.value, nil
+	if value, ok := s.getVisibleKey(finalKey, txExecSeq); ok {
+		return value, nil
 	}
 
 	if sv, ok := s.readTable[finalKey]; ok {
 		return sv.value, nil
 	}
 
-	iter := s.preSnapshot
-	for iter != nil {
-		if value, err := iter.GetKey(-1, contractName, key); err == nil {
-			return value, nil
-		}
-		iter = iter.GetPreSnapshot()
-	}
-
-	return s.blockchainStore.ReadObject(contractName, key)
+	return s.getPreSnapshotKey(contractName, key)
 }
 
 // ApplyTxSimContext add TxSimContext to the snapshot, return current applied tx num whether success of not
 func (s *SnapshotImpl) ApplyTxSimContext(txSimContext protocol.TxSimContext, specialTxType protocol.ExecOrderTxType,
 	runVmSuccess bool, applySpecialTx bool) (bool, int) {
+	return s.ApplyTxSimContextWithRanges(txSimContext, specialTxType, runVmSuccess, applySpecialTx, nil)
+}
+
+// ApplyTxSimContextWithRanges add TxSimContext to the snapshot together with the key ranges read by its iterators,
+// return current applied tx num whether success of not.
+// An iterator tx with ranges is checked against the write table like the point reads and joins the DAG,
+// without ranges it is put into the special tx table and executed sequentially after the DAG is built
+func (s *SnapshotImpl) ApplyTxSimContextWithRanges(txSimContext protocol.TxSimContext,
+	specialTxType protocol.ExecOrderTxType, runVmSuccess bool, applySpecialTx bool, ranges []*KeyRange) (bool, int) {
 	tx := txSimContext.GetTx()
 	s.log.Debugf("apply tx: %s, execOrderTxType:%d, runVmSuccess:%v, applySpecialTx:%v", tx.Payload.TxId,
 		specialTxType, runVmSuccess, applySpecialTx)
@@ -181,7 +194,11 @@ func (s *SnapshotImpl) ApplyTxSimContext(txSimContext protocol.TxSimContext, spe
 	var txRWSet *commonPb.TxRWSet
 	var txResult *commonPb.Result
 
-	if !applySpecialTx && specialTxType == protocol.ExecOrderTxTypeIterator {
+	// the iterator txs of the blocks below the version are placed after the DAG, whatever ranges they read
+	if s.blockVersion < BlockVersionRangeDag {
+		ranges = nil
+	}
+	if !applySpecialTx && specialTxType == protocol.ExecOrderTxTypeIterator && len(ranges) == 0 {
 		s.specialTxTable = append(s.specialTxTable, tx)
 		return true, len(s.txTable) + len(s.specialTxTable)
 	}
@@ -190,35 +207,57 @@ func (s *SnapshotImpl) ApplyTxSimContext(txSimContext protocol.TxSimContext, spe
 	txRWSet = txSimContext.GetTxRWSet(runVmSuccess)
 	txResult = txSimContext.GetTxResult()
 
-	if specialTxType == protocol.ExecOrderTxTypeIterator || txExecSeq >= len(s.txTable) {
-		s.apply(tx, txRWSet, txResult, runVmSuccess)
+	if (specialTxType == protocol.ExecOrderTxTypeIterator && len(ranges) == 0) || txExecSeq >= len(s.txTable) {
+		s.apply(tx, txRWSet, txResult, runVmSuccess, ranges)
 		return true, len(s.txTable)
 	}
 
 	// Check whether the dependent state has been modified during the running it
 	for _, txRead := range txRWSet.TxReads {
-		finalKey := constructKey(txRead.ContractName, txRead.Key)
-		if sv, ok := s.writeTable[finalKey]; ok {
-			if sv.seq >= txExecSeq {
-				s.log.Debugf("Key Conflicted %+v-%+v, tx id:%s", sv.seq, txExecSeq, tx.Payload.TxId)
-				return false, len(s.txTable)
-			}
+		if sv, ok := s.readConflicted(txRead, txExecSeq); ok {
+			s.log.Debugf("Key Conflicted %+v-%+v, tx id:%s", sv.seq, txExecSeq, tx.Payload.TxId)
+			return false, len(s.txTable)
 		}
 	}
 
-	s.apply(tx, txRWSet, txResult, runVmSuccess)
+	// Check whether the dependent key ranges have been modified during the running it
+	if s.rangeConflicted(txExecSeq, ranges) {
+		s.log.Debugf("Range Conflicted, tx id:%s", tx.Payload.TxId)
+		return false, len(s.txTable)
+	}
+
+	s.apply(tx, txRWSet, txResult, runVmSuccess, ranges)
 	return true, len(s.txTable)
 }
 
+// GetConflictReads return the reads of the tx whose keys were written with other values by the txs applied after
+// the tx began, which make the tx fail to apply. The iterator ranges are not included
+func (s *SnapshotImpl) GetConflictReads(txSimContext protocol.TxSimContext) []*commonPb.TxRead {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	txExecSeq := txSimContext.GetTxExecSeq()
+	var reads []*commonPb.TxRead
+	for _, txRead := range txSimContext.GetTxRWSet(true).TxReads {
+		if _, ok := s.readConflicted(txRead, txExecSeq); ok {
+			reads = append(reads, txRead)
+		}
+	}
+	return reads
+}
+
 // After the read-write set is generated, add TxSimContext to the snapshot
 func (s *SnapshotImpl) apply(tx *commonPb.Transaction, txRWSet *commonPb.TxRWSet, txResult *commonPb.Result,
-	runVmSuccess bool) {
+	runVmSuccess bool, ranges []*KeyRange) {
 	// Append to read table
 	applySeq := len(s.txTable)
 	// compatible with version lower than 2201
 	if s.blockVersion < 2201 || runVmSuccess {
 		for _, txRead := range txRWSet.TxReads {
 			finalKey := constructKey(txRead.ContractName, txRead.Key)
+			// the written keys are read from the version table
+			if _, ok := s.writeTable[finalKey]; ok {
+				continue
+			}
 			s.readTable[finalKey] = &sv{
 				seq:   applySeq,
 				value: txRead.Value,
@@ -229,10 +268,20 @@ func (s *SnapshotImpl) apply(tx *commonPb.Transaction, txRWSet *commonPb.TxRWSet
 	// Append to write table
 	for _, txWrite := range txRWSet.TxWrites {
 		finalKey := constructKey(txWrite.ContractName, txWrite.Key)
-		s.writeTable[finalKey] = &sv{
+		version := &sv{
 			seq:   applySeq,
 			value: txWrite.Value,
 		}
+		s.writeTable[finalKey] = version
+		s.appendVersion(finalKey, version)
+	}
+
+	// Append to range table
+	if len(ranges) > 0 {
+		if s.txRangeTable == nil {
+			s.txRangeTable = make(map[uint32][]*KeyRange)
+		}
+		s.txRangeTable[uint32(applySeq)] = ranges
 	}
 
 	// Append to read-write-set table
@@ -284,6 +333,8 @@ func (s *SnapshotImpl) BuildDAG(isSql bool) *commonPb.DAG {
 	}
 	dag.Vertexes = make([]*commonPb.DAG_Neighbor, txCount)
 
+	// the sql txs share the db transaction of the block and the sql store executes them one by one,
+	// so they are chained in block order
 	if isSql {
 		for i := uint32(0); i < txCount; i++ {
 			dag.Vertexes[i] = &commonPb.DAG_Neighbor{
@@ -298,10 +349,11 @@ func (s *SnapshotImpl) BuildDAG(isSql bool) *commonPb.DAG {
 	// build all txs' readKeyDictionary, writeKeyDictionary, readPos(the pos in readKeyDictionary) and
 	// writePos(the pos in writeKeyDictionary)
 	readKeyDict, writeKeyDict, readPos, writePos := s.buildDictAndPos(txCount)
+	rangeIndex := s.buildRangeIndex(writeKeyDict)
 	reachMap := make([]*bitmap.Bitmap, txCount)
 	// build vertexes
 	for i := uint32(0); i < txCount; i++ {
-		directReachMap := s.buildReachMap(i, readKeyDict, writeKeyDict, readPos, writePos, reachMap)
+		directReachMap := s.buildReachMap(i, readKeyDict, writeKeyDict, readPos, writePos, rangeIndex, reachMap)
 		dag.Vertexes[i] = &commonPb.DAG_Neighbor{
 			Neighbors: make([]uint32, 0, 16),
 		}
@@ -346,7 +398,7 @@ func (s *SnapshotImpl) buildDictAndPos(txCount uint32) (map[string][]uint32, map
 }
 
 func (s *SnapshotImpl) buildReachMap(i uint32, readKeyDict, writeKeyDict map[string][]uint32,
-	readPos, writePos map[uint32]map[string]uint32, reachMap []*bitmap.Bitmap) *bitmap.Bitmap {
+	readPos, writePos map[uint32]map[string]uint32, rangeIndex *rangeIndex, reachMap []*bitmap.Bitmap) *bitmap.Bitmap {
 	readTableItemForI := s.txRWSetTable[i].TxReads
 	writeTableItemForI := s.txRWSetTable[i].TxWrites
 	allReachForI := &bitmap.Bitmap{}
@@ -392,6 +444,8 @@ func (s *SnapshotImpl) buildReachMap(i uint32, readKeyDict, writeKeyDict map[str
 			allReachForI.Or(reachMap[writeKeyTxs[j]])
 		}
 	}
+	//Range reads and WriteSet conflict
+	rangeIndex.addRangeEdges(i, s.txRWSetTable[i], writeKeyDict, reachMap, allReachForI, directReachForI)
 	reachMap[i] = allReachForI
 	return directReachForI
 }
@@ -0,0 +1,118 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package snapshot
+
+import (
+	"bytes"
+	"sort"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+// getVisibleKey get the value written by the latest tx applied before txExecSeq, please lock it before using
+func (s *SnapshotImpl) getVisibleKey(finalKey string, txExecSeq int) ([]byte, bool) {
+	versions := s.versionTable[finalKey]
+	// the first version invisible to the tx
+	pos := sort.Search(len(versions), func(i int) bool { return versions[i].seq >= txExecSeq })
+	if pos == 0 {
+		return nil, false
+	}
+	return versions[pos-1].value, true
+}
+
+// readConflicted check whether the key read by the tx began at txExecSeq was written by the txs applied after it
+// began, return the latest version of the key if so, please lock it before using.
+// The tx is applied after them and sees the latest version, so it is still valid if it read the same value
+func (s *SnapshotImpl) readConflicted(txRead *commonPb.TxRead, txExecSeq int) (*sv, bool) {
+	latest, ok := s.writeTable[constructKey(txRead.ContractName, txRead.Key)]
+	if !ok || latest.seq < txExecSeq || bytes.Equal(latest.value, txRead.Value) {
+		return nil, false
+	}
+	return latest, true
+}
+
+// appendVersion append the value written by the tx applied at seq, please lock it before using
+func (s *SnapshotImpl) appendVersion(finalKey string, version *sv) {
+	if s.versionTable == nil {
+		s.versionTable = make(map[string][]*sv)
+	}
+	s.versionTable[finalKey] = append(s.versionTable[finalKey], version)
+}
+
+// getPreSnapshotKey get the value from the pre snapshots, or from the blockchain store if none of them has it
+func (s *SnapshotImpl) getPreSnapshotKey(contractName string, key []byte) ([]byte, error) {
+	if index := s.getPreSnapshotIndex(); index != nil {
+		if value, ok := index[constructKey(contractName, key)]; ok {
+			return value, nil
+		}
+		return s.blockchainStore.ReadObject(contractName, key)
+	}
+
+	iter := s.GetPreSnapshot()
+	for iter != nil {
+		if value, err := iter.GetKey(-1, contractName, key); err == nil {
+			return value, nil
+		}
+		iter = iter.GetPreSnapshot()
+	}
+	return s.blockchainStore.ReadObject(contractName, key)
+}
+
+// getPreSnapshotIndex return the latest values of the keys in all the pre snapshots, it is built on the first
+// lookup so that a lookup does not walk all the uncommitted pre snapshots.
+// The txs of the pre snapshots are all applied before the snapshot is used, nil is returned if any of them is
+// not sealed yet, or is not a SnapshotImpl, and the lookup walks the pre snapshots
+func (s *SnapshotImpl) getPreSnapshotIndex() map[string][]byte {
+	s.preIndexLock.Lock()
+	defer s.preIndexLock.Unlock()
+	if s.preIndex != nil {
+		return s.preIndex
+	}
+
+	var preSnapshots []*SnapshotImpl
+	for iter := s.GetPreSnapshot(); iter != nil; iter = iter.GetPreSnapshot() {
+		preSnapshot := unwrapSnapshotImpl(iter)
+		if preSnapshot == nil || !preSnapshot.IsSealed() {
+			return nil
+		}
+		preSnapshots = append(preSnapshots, preSnapshot)
+	}
+	if len(preSnapshots) == 0 {
+		return nil
+	}
+
+	index := make(map[string][]byte)
+	// the nearer pre snapshot has the newer values
+	for _, preSnapshot := range preSnapshots {
+		preSnapshot.lock.RLock()
+		for finalKey, sv := range preSnapshot.writeTable {
+			if _, ok := index[finalKey]; !ok {
+				index[finalKey] = sv.value
+			}
+		}
+		for finalKey, sv := range preSnapshot.readTable {
+			if _, ok := index[finalKey]; !ok {
+				index[finalKey] = sv.value
+			}
+		}
+		preSnapshot.lock.RUnlock()
+	}
+	s.preIndex = index
+	return index
+}
+
+func unwrapSnapshotImpl(snapshot protocol.Snapshot) *SnapshotImpl {
+	switch s := snapshot.(type) {
+	case *SnapshotImpl:
+		return s
+	case *SnapshotEvidence:
+		return s.delegate
+	}
+	return nil
+}
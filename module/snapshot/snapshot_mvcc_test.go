@@ -0,0 +1,126 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package snapshot
+
+import (
+	"testing"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func newMvccTestSimContext(txId string, txExecSeq int, key string, value string) *MockSimContextImpl {
+	simContext := newRangeTestSimContext(txId, txExecSeq)
+	simContext.txRwSet.TxWrites = []*commonPb.TxWrite{{ContractName: "c", Key: []byte(key), Value: []byte(value)}}
+	return simContext
+}
+
+func TestGetKeyAtTxExecSeq(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mock.NewMockBlockchainStore(ctrl)
+	store.EXPECT().ReadObject("c", []byte("k")).Return([]byte("v0"), nil).AnyTimes()
+
+	s := newRangeTestSnapshot(BlockVersionRangeDag)
+	s.blockchainStore = store
+	for i, value := range []string{"v1", "v2", "v3"} {
+		applied, _ := s.ApplyTxSimContext(newMvccTestSimContext(value, i, "k", value),
+			protocol.ExecOrderTxTypeNormal, true, false)
+		require.True(t, applied)
+	}
+
+	for txExecSeq, want := range []string{"v0", "v1", "v2", "v3"} {
+		value, err := s.GetKey(txExecSeq, "c", []byte("k"))
+		require.NoError(t, err)
+		require.Equal(t, want, string(value))
+	}
+	// the latest value
+	value, err := s.GetKey(-1, "c", []byte("k"))
+	require.NoError(t, err)
+	require.Equal(t, "v3", string(value))
+}
+
+func TestGetKeyFromPreSnapshots(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mock.NewMockBlockchainStore(ctrl)
+	store.EXPECT().ReadObject("c", []byte("k3")).Return([]byte("store"), nil).Times(1)
+
+	// s1 <- s2 <- s3
+	var preSnapshot *SnapshotImpl
+	var snapshots []*SnapshotImpl
+	for _, writes := range [][]string{{"k1", "s1", "k2", "s1"}, {"k1", "s2"}, nil} {
+		s := newRangeTestSnapshot(BlockVersionRangeDag)
+		s.blockchainStore = store
+		if preSnapshot != nil {
+			s.SetPreSnapshot(preSnapshot)
+		}
+		for i := 0; i < len(writes); i += 2 {
+			applied, _ := s.ApplyTxSimContext(newMvccTestSimContext(writes[i], i/2, writes[i], writes[i+1]),
+				protocol.ExecOrderTxTypeNormal, true, false)
+			require.True(t, applied)
+		}
+		preSnapshot = s
+		snapshots = append(snapshots, s)
+	}
+	s3 := snapshots[2]
+
+	// s2 is not sealed, the pre snapshots are walked
+	value, err := s3.GetKey(0, "c", []byte("k1"))
+	require.NoError(t, err)
+	require.Equal(t, "s2", string(value))
+	require.Nil(t, s3.preIndex)
+
+	snapshots[0].Seal()
+	snapshots[1].Seal()
+	for key, want := range map[string]string{"k1": "s2", "k2": "s1", "k3": "store"} {
+		value, err = s3.GetKey(0, "c", []byte(key))
+		require.NoError(t, err)
+		require.Equal(t, want, string(value))
+	}
+	require.Len(t, s3.preIndex, 2)
+
+	// the index is dropped with the pre snapshots
+	s3.SetPreSnapshot(nil)
+	require.Nil(t, s3.preIndex)
+}
+
+func TestApplyTxSimContextReadSameValue(t *testing.T) {
+	s := newRangeTestSnapshot(BlockVersionRangeDag)
+	// tx0 and tx1 began together and read the flag from the store, tx0 sets it again
+	readFlag := func(simContext *MockSimContextImpl) *MockSimContextImpl {
+		simContext.txRwSet.TxReads = []*commonPb.TxRead{{ContractName: "c", Key: []byte("flag"), Value: []byte("on")}}
+		return simContext
+	}
+	applied, _ := s.ApplyTxSimContext(readFlag(newMvccTestSimContext("tx0", 0, "flag", "on")),
+		protocol.ExecOrderTxTypeNormal, true, false)
+	require.True(t, applied)
+
+	// tx1 read the value visible to it after tx0, it is applied without rerun
+	tx1 := readFlag(newMvccTestSimContext("tx1", 0, "k1", "v1"))
+	require.Empty(t, s.GetConflictReads(tx1))
+	applied, _ = s.ApplyTxSimContext(tx1, protocol.ExecOrderTxTypeNormal, true, false)
+	require.True(t, applied)
+
+	// tx2 turns the flag off, tx3 began before it and read the flag on
+	applied, _ = s.ApplyTxSimContext(readFlag(newMvccTestSimContext("tx2", 2, "flag", "off")),
+		protocol.ExecOrderTxTypeNormal, true, false)
+	require.True(t, applied)
+	tx3 := readFlag(newMvccTestSimContext("tx3", 2, "k2", "v2"))
+	require.Equal(t, tx3.txRwSet.TxReads, s.GetConflictReads(tx3))
+	applied, _ = s.ApplyTxSimContext(tx3, protocol.ExecOrderTxTypeNormal, true, false)
+	require.False(t, applied)
+
+	// tx1 is placed after tx0 whose value it read
+	dag := s.BuildDAG(false)
+	require.Len(t, dag.Vertexes, 3)
+	require.Equal(t, []uint32{0}, dag.Vertexes[1].Neighbors)
+}
@@ -0,0 +1,144 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package snapshot
+
+import (
+	"bytes"
+	"sort"
+
+	"chainmaker.org/chainmaker/common/v2/bitmap"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+)
+
+// BlockVersionRangeDag The first block version in which the iterator txs with recorded key ranges are scheduled
+// in parallel and join the DAG by their ranges. The iterator txs of the blocks below it are executed sequentially
+// after the DAG is built, so the nodes of the earlier versions build the same DAG
+const BlockVersionRangeDag = uint32(2300)
+
+// KeyRange The key range [StartKey, Limit) of a contract read by an iterator, an empty Limit means no upper bound
+type KeyRange struct {
+	ContractName string
+	StartKey     []byte
+	Limit        []byte
+}
+
+// Contains check if the key of the contract is in the range
+func (r *KeyRange) Contains(contractName string, key []byte) bool {
+	return r.ContractName == contractName && r.containsKey(key)
+}
+
+// containsKey check the key only, the contract name is ignored as the key dictionaries of the DAG do
+func (r *KeyRange) containsKey(key []byte) bool {
+	return bytes.Compare(key, r.StartKey) >= 0 && (len(r.Limit) == 0 || bytes.Compare(key, r.Limit) < 0)
+}
+
+// rangeConflicted check if any tx applied since txExecSeq writes a key in the ranges,
+// the same as a point read is conflicted with the write table
+func (s *SnapshotImpl) rangeConflicted(txExecSeq int, ranges []*KeyRange) bool {
+	for seq := txExecSeq; seq < len(s.txRWSetTable); seq++ {
+		for _, txWrite := range s.txRWSetTable[seq].TxWrites {
+			for _, r := range ranges {
+				if r.Contains(txWrite.ContractName, txWrite.Key) {
+					s.log.Debugf("Range Conflicted %+v-%+v, key: %s", seq, txExecSeq, txWrite.Key)
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// rangeIndex the ranges read by the txs, used to add the range edges of the DAG
+type rangeIndex struct {
+	txRanges map[uint32][]*KeyRange
+	rangeTxs []uint32 // txs reading ranges, in ascending order
+	keys     []string // all written keys, in ascending order
+}
+
+func (s *SnapshotImpl) buildRangeIndex(writeKeyDict map[string][]uint32) *rangeIndex {
+	if len(s.txRangeTable) == 0 || s.blockVersion < BlockVersionRangeDag {
+		return nil
+	}
+	index := &rangeIndex{
+		txRanges: s.txRangeTable,
+		rangeTxs: make([]uint32, 0, len(s.txRangeTable)),
+		keys:     make([]string, 0, len(writeKeyDict)),
+	}
+	for i := range s.txRangeTable {
+		index.rangeTxs = append(index.rangeTxs, i)
+	}
+	sort.Slice(index.rangeTxs, func(i, j int) bool { return index.rangeTxs[i] < index.rangeTxs[j] })
+	for key := range writeKeyDict {
+		index.keys = append(index.keys, key)
+	}
+	sort.Strings(index.keys)
+	return index
+}
+
+// addRangeEdges add the edges of tx i caused by the ranges:
+// the ranges read by tx i depend on the last earlier write of every key in them,
+// and the keys written by tx i depend on all earlier txs reading ranges containing them
+func (index *rangeIndex) addRangeEdges(i uint32, txRWSet *commonPb.TxRWSet, writeKeyDict map[string][]uint32,
+	reachMap []*bitmap.Bitmap, allReachForI, directReachForI *bitmap.Bitmap) {
+	if index == nil {
+		return
+	}
+	addEdge := func(j uint32) {
+		if !allReachForI.Has(int(j)) {
+			directReachForI.Set(int(j))
+			allReachForI.Or(reachMap[j])
+		}
+	}
+
+	// add the edges from the latest tx, the earlier ones are likely reached through it already
+	writers := make(map[uint32]bool)
+	for _, r := range index.txRanges[i] {
+		start := sort.SearchStrings(index.keys, string(r.StartKey))
+		for _, key := range index.keys[start:] {
+			if !r.containsKey([]byte(key)) {
+				break
+			}
+			writeKeyTxs := writeKeyDict[key]
+			// the last write before tx i
+			pos := sort.Search(len(writeKeyTxs), func(k int) bool { return writeKeyTxs[k] >= i }) - 1
+			if pos >= 0 {
+				writers[writeKeyTxs[pos]] = true
+			}
+		}
+	}
+	sortedWriters := make([]uint32, 0, len(writers))
+	for j := range writers {
+		sortedWriters = append(sortedWriters, j)
+	}
+	sort.Slice(sortedWriters, func(a, b int) bool { return sortedWriters[a] > sortedWriters[b] })
+	for _, j := range sortedWriters {
+		addEdge(j)
+	}
+
+	for k := len(index.rangeTxs) - 1; k >= 0; k-- {
+		j := index.rangeTxs[k]
+		if j >= i {
+			continue
+		}
+		for _, txWrite := range txRWSet.TxWrites {
+			if index.coveredBy(j, txWrite.Key) {
+				addEdge(j)
+				break
+			}
+		}
+	}
+}
+
+func (index *rangeIndex) coveredBy(j uint32, key []byte) bool {
+	for _, r := range index.txRanges[j] {
+		if r.containsKey(key) {
+			return true
+		}
+	}
+	return false
+}
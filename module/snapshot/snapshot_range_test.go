@@ -0,0 +1,175 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package snapshot
+
+import (
+	"testing"
+
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/protocol/v2/test"
+	"github.com/stretchr/testify/require"
+	uatomic "go.uber.org/atomic"
+)
+
+func newRangeTestSnapshot(blockVersion uint32) *SnapshotImpl {
+	return &SnapshotImpl{
+		log:          &test.GoLogger{},
+		sealed:       uatomic.NewBool(false),
+		blockVersion: blockVersion,
+		txResultMap:  make(map[string]*commonPb.Result),
+		readTable:    make(map[string]*sv),
+		writeTable:   make(map[string]*sv),
+	}
+}
+
+func newRangeTestSimContext(txId string, txExecSeq int, writeKeys ...string) *MockSimContextImpl {
+	rwSet := &commonPb.TxRWSet{TxId: txId}
+	for _, key := range writeKeys {
+		rwSet.TxWrites = append(rwSet.TxWrites, &commonPb.TxWrite{ContractName: "c", Key: []byte(key)})
+	}
+	return &MockSimContextImpl{
+		txExecSeq: int32(txExecSeq),
+		tx:        &commonPb.Transaction{Payload: &commonPb.Payload{TxId: txId}},
+		txRwSet:   rwSet,
+		txResult:  &commonPb.Result{},
+	}
+}
+
+func TestKeyRange_Contains(t *testing.T) {
+	r := &KeyRange{ContractName: "c", StartKey: []byte("a1"), Limit: []byte("a5")}
+	require.True(t, r.Contains("c", []byte("a1")))
+	require.True(t, r.Contains("c", []byte("a49")))
+	require.False(t, r.Contains("c", []byte("a5")))
+	require.False(t, r.Contains("c", []byte("a0")))
+	require.False(t, r.Contains("d", []byte("a2")))
+
+	unbounded := &KeyRange{ContractName: "c", StartKey: []byte("a1")}
+	require.True(t, unbounded.Contains("c", []byte("z")))
+}
+
+func TestApplyTxSimContextWithRanges(t *testing.T) {
+	s := newRangeTestSnapshot(BlockVersionRangeDag)
+	ranges := []*KeyRange{{ContractName: "c", StartKey: []byte("a0"), Limit: []byte("a9")}}
+
+	applied, size := s.ApplyTxSimContext(newRangeTestSimContext("tx0", 0, "a5"),
+		protocol.ExecOrderTxTypeNormal, true, false)
+	require.True(t, applied)
+	require.Equal(t, 1, size)
+
+	// the range was read before tx0 was applied, and tx0 writes into it
+	applied, _ = s.ApplyTxSimContextWithRanges(newRangeTestSimContext("tx1", 0),
+		protocol.ExecOrderTxTypeIterator, true, false, ranges)
+	require.False(t, applied)
+
+	// the range was read after tx0 was applied
+	applied, size = s.ApplyTxSimContextWithRanges(newRangeTestSimContext("tx1", 1),
+		protocol.ExecOrderTxTypeIterator, true, false, ranges)
+	require.True(t, applied)
+	require.Equal(t, 2, size)
+
+	// a write outside of the range does not conflict
+	applied, _ = s.ApplyTxSimContext(newRangeTestSimContext("tx2", 2, "b1"),
+		protocol.ExecOrderTxTypeNormal, true, false)
+	require.True(t, applied)
+	applied, _ = s.ApplyTxSimContextWithRanges(newRangeTestSimContext("tx3", 2),
+		protocol.ExecOrderTxTypeIterator, true, false, ranges)
+	require.True(t, applied)
+
+	// iterator txs without ranges are still executed after the DAG is built
+	applied, _ = s.ApplyTxSimContext(newRangeTestSimContext("tx4", 4),
+		protocol.ExecOrderTxTypeIterator, true, false)
+	require.True(t, applied)
+	require.Len(t, s.GetSpecialTxTable(), 1)
+	require.Equal(t, 4, s.GetSnapshotSize())
+}
+
+// applyRangeTestTxs apply tx0 to tx4, tx1 and tx4 are iterator txs reading the range a0 to a9
+func applyRangeTestTxs(t *testing.T, s *SnapshotImpl) {
+	ranges := []*KeyRange{{ContractName: "c", StartKey: []byte("a0"), Limit: []byte("a9")}}
+	for _, ctx := range []struct {
+		simContext *MockSimContextImpl
+		ranges     []*KeyRange
+	}{
+		{simContext: newRangeTestSimContext("tx0", 0, "a5")},
+		{simContext: newRangeTestSimContext("tx1", 1), ranges: ranges},
+		{simContext: newRangeTestSimContext("tx2", 2, "a7")},
+		{simContext: newRangeTestSimContext("tx3", 3, "b1")},
+		{simContext: newRangeTestSimContext("tx4", 4), ranges: ranges},
+	} {
+		txType := protocol.ExecOrderTxTypeNormal
+		if ctx.ranges != nil {
+			txType = protocol.ExecOrderTxTypeIterator
+		}
+		applied, _ := s.ApplyTxSimContextWithRanges(ctx.simContext, txType, true, false, ctx.ranges)
+		require.True(t, applied)
+	}
+}
+
+func TestBuildDAGWithRanges(t *testing.T) {
+	s := newRangeTestSnapshot(BlockVersionRangeDag)
+	applyRangeTestTxs(t, s)
+
+	dag := s.BuildDAG(false)
+	require.Len(t, dag.Vertexes, 5)
+	require.Empty(t, s.GetSpecialTxTable())
+	require.Empty(t, dag.Vertexes[0].Neighbors)
+	// reads the range after tx0 writes into it
+	require.Equal(t, []uint32{0}, dag.Vertexes[1].Neighbors)
+	// writes into the range read by tx1
+	require.Equal(t, []uint32{1}, dag.Vertexes[2].Neighbors)
+	// writes outside of the ranges
+	require.Empty(t, dag.Vertexes[3].Neighbors)
+	// reads the range after tx2, which already depends on tx0
+	require.Equal(t, []uint32{2}, dag.Vertexes[4].Neighbors)
+}
+
+func TestBuildDAGWithRanges_BlockVersion(t *testing.T) {
+	// below the version the iterator txs are still executed after the DAG is built
+	s := newRangeTestSnapshot(BlockVersionRangeDag - 1)
+	applyRangeTestTxs(t, s)
+
+	dag := s.BuildDAG(false)
+	require.Len(t, dag.Vertexes, 3)
+	for _, vertex := range dag.Vertexes {
+		require.Empty(t, vertex.Neighbors)
+	}
+	specialTxIds := make([]string, 0, 2)
+	for _, tx := range s.GetSpecialTxTable() {
+		specialTxIds = append(specialTxIds, tx.Payload.TxId)
+	}
+	require.Equal(t, []string{"tx1", "tx4"}, specialTxIds)
+	require.Equal(t, 5, s.GetSnapshotSize())
+
+	// from the version they join the DAG by their ranges
+	s = newRangeTestSnapshot(BlockVersionRangeDag)
+	applyRangeTestTxs(t, s)
+	require.Len(t, s.BuildDAG(false).Vertexes, 5)
+	require.Empty(t, s.GetSpecialTxTable())
+}
+
+func TestGetConflictReads(t *testing.T) {
+	s := newRangeTestSnapshot(BlockVersionRangeDag)
+	applied, _ := s.ApplyTxSimContext(newRangeTestSimContext("tx0", 0, "k1", "k2"),
+		protocol.ExecOrderTxTypeNormal, true, false)
+	require.True(t, applied)
+
+	// began before tx0 was applied
+	simContext := newRangeTestSimContext("tx1", 0)
+	simContext.txRwSet.TxReads = []*commonPb.TxRead{
+		{ContractName: "c", Key: []byte("k1"), Value: []byte("v0")},
+		{ContractName: "c", Key: []byte("k3"), Value: []byte("v0")},
+	}
+	applied, _ = s.ApplyTxSimContext(simContext, protocol.ExecOrderTxTypeNormal, true, false)
+	require.False(t, applied)
+	require.Equal(t, simContext.txRwSet.TxReads[:1], s.GetConflictReads(simContext))
+
+	// began after tx0 was applied
+	simContext.txExecSeq = 1
+	require.Empty(t, s.GetConflictReads(simContext))
+}
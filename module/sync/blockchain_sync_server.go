@@ -14,6 +14,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"chainmaker.org/chainmaker-go/module/extconf"
 	commonErrors "chainmaker.org/chainmaker/common/v2/errors"
 	"chainmaker.org/chainmaker/common/v2/msgbus"
 	"chainmaker.org/chainmaker/localconf/v2"
@@ -28,6 +29,8 @@ import (
 
 var _ protocol.SyncService = (*BlockChainSyncServer)(nil)
 
+const syncResponseConfigKey = "sync.response"
+
 type BlockChainSyncServer struct {
 	chainId string
 
@@ -46,7 +49,9 @@ type BlockChainSyncServer struct {
 	scheduler *Routine // Service that get blocks from other nodes
 	processor *Routine // Service that processes block data, adding valid blocks to the chain
 
-	requestCache sync.Map // ignore repeat block sync request when in process
+	requestCache      sync.Map // ignore repeat block sync request when in process
+	peersMaxHeight    uint64   // The max height of the connected peers, updated by the scheduler
+	peersMedianHeight uint64   // The median height of the connected peers, updated by the scheduler
 }
 
 func NewBlockChainSyncServer(
@@ -87,6 +92,12 @@ func (sync *BlockChainSyncServer) Start() error {
 	if scheduler == nil {
 		return fmt.Errorf("init scheduler failed")
 	}
+	scheduler.compression = sync.conf.compression
+	scheduler.maxBatchBytes = sync.conf.respMaxBatchBytes
+	scheduler.onPeersChanged = func(maxHeight, medianHeight uint64) {
+		atomic.StoreUint64(&sync.peersMaxHeight, maxHeight)
+		atomic.StoreUint64(&sync.peersMedianHeight, medianHeight)
+	}
 	sync.scheduler = NewRoutine("scheduler", scheduler.handler, scheduler.getServiceState, sync.log)
 	sync.processor = NewRoutine("processor", processor.handler, processor.getServiceState, sync.log)
 
@@ -151,6 +162,26 @@ func (sync *BlockChainSyncServer) initSyncConfIfRequire() {
 	if localconf.ChainMakerConfig.SyncConfig.BlockRequestTime > 0 {
 		sync.conf.SetBlockRequestTime(localconf.ChainMakerConfig.SyncConfig.BlockRequestTime)
 	}
+
+	// the response settings are not part of localconf
+	respConf := &SyncResponseConfig{}
+	if err := extconf.Unmarshal(syncResponseConfigKey, respConf); err != nil {
+		sync.log.Warnf("load sync response config failed, use default, %s", err.Error())
+		return
+	}
+	if respConf.MaxBatchBytes > 0 {
+		sync.conf.SetRespMaxBatchBytes(respConf.MaxBatchBytes)
+	}
+	if respConf.Compression != "" {
+		if respConf.Compression != compressionNone && respConf.Compression != compressionGzip {
+			sync.log.Warnf("unsupported sync response compression [%s], use none", respConf.Compression)
+			respConf.Compression = compressionNone
+		}
+		sync.conf.SetCompression(respConf.Compression, sync.conf.compressThreshold)
+	}
+	if respConf.CompressThreshold > 0 {
+		sync.conf.SetCompression(sync.conf.compression, respConf.CompressThreshold)
+	}
 }
 
 func (sync *BlockChainSyncServer) blockSyncMsgHandler(from string, msg []byte, msgType netPb.NetMsg_MsgType) error {
@@ -180,6 +211,14 @@ func (sync *BlockChainSyncServer) blockSyncMsgHandler(from string, msg []byte, m
 	case syncPb.SyncMsg_BLOCK_SYNC_RESP:
 		sync.log.Debug("receive [SyncMsg_BLOCK_SYNC_RESP] msg, put into scheduler...")
 		return sync.scheduler.addTask(&SyncedBlockMsg{msg: syncMsg.Payload, from: from})
+	case syncMsgBlockSyncRespGzip:
+		sync.log.Debug("receive [SyncMsg_BLOCK_SYNC_RESP] gzip msg, put into scheduler...")
+		payload, err := gzipDecompress(syncMsg.Payload, maxDecompressedSize(sync.conf.respMaxBatchBytes))
+		if err != nil {
+			sync.log.Errorf("fail to decompress the block sync response from node [%s]: %s", from, err.Error())
+			return err
+		}
+		return sync.scheduler.addTask(&SyncedBlockMsg{msg: payload, from: from})
 	}
 	return fmt.Errorf("not support the syncPb.SyncMsg.Type as %d", syncMsg.Type)
 }
@@ -230,17 +269,33 @@ func (sync *BlockChainSyncServer) handleBlockReq(syncMsg *syncPb.SyncMsg, from s
 	}
 	defer sync.requestCache.Store(processKey, time.Now())
 
+	accepted, err := readAcceptCompression(syncMsg.Payload)
+	if err != nil {
+		sync.log.Warnf("fail to read the accepted compressions of the request from node [%s]: %s", from, err.Error())
+	}
+	compression := negotiateCompression(sync.conf.compression, accepted)
+	requestedBatchBytes, err := readMaxBatchBytes(syncMsg.Payload)
+	if err != nil {
+		sync.log.Warnf("fail to read the max batch bytes of the request from node [%s]: %s", from, err.Error())
+	}
+	maxBatchBytes := negotiateMaxBatchBytes(sync.conf.respMaxBatchBytes, requestedBatchBytes)
+
 	sync.log.Infof("receive request to get block [height: %d, batch_size: %d] from "+
-		"node [%s]"+"WithRwset [%v]", req.BlockHeight, req.BatchSize, from, req.WithRwset)
-	return sync.sendInfos(&req, from)
+		"node [%s]"+"WithRwset [%v], compression [%s], max batch bytes [%d]", req.BlockHeight, req.BatchSize, from,
+		req.WithRwset, compression, maxBatchBytes)
+	return sync.sendInfos(&req, from, compression, maxBatchBytes)
 }
 
-func (sync *BlockChainSyncServer) sendInfos(req *syncPb.BlockSyncReq, from string) error {
+// sendInfos Send the requested blocks packed into batches of at most maxBatchBytes,
+// a block larger than that is sent in a batch alone
+func (sync *BlockChainSyncServer) sendInfos(req *syncPb.BlockSyncReq, from string, compression string,
+	maxBatchBytes int) error {
 	var (
-		bz        []byte
 		err       error
 		blk       *commonPb.Block
 		blkRwInfo *storePb.BlockWithRWSet
+		batch     []*commonPb.BlockInfo
+		batchSize int
 	)
 	for i := uint64(0); i < req.BatchSize; i++ {
 		if req.WithRwset {
@@ -262,19 +317,49 @@ func (sync *BlockChainSyncServer) sendInfos(req *syncPb.BlockSyncReq, from strin
 			}
 		}
 		info := &commonPb.BlockInfo{Block: blkRwInfo.Block, RwsetList: blkRwInfo.TxRWSets}
-		if bz, err = proto.Marshal(&syncPb.SyncBlockBatch{
-			Data: &syncPb.SyncBlockBatch_BlockinfoBatch{BlockinfoBatch: &syncPb.BlockInfoBatch{
-				Batch: []*commonPb.BlockInfo{info}}}, WithRwset: req.WithRwset,
-		}); err != nil {
-			return err
-		}
-		if err := sync.sendMsg(syncPb.SyncMsg_BLOCK_SYNC_RESP, bz, from); err != nil {
-			return err
+		infoSize := info.Size()
+		if len(batch) > 0 && batchSize+infoSize > maxBatchBytes {
+			if err = sync.sendBatch(batch, req.WithRwset, from, compression, maxBatchBytes); err != nil {
+				return err
+			}
+			batch, batchSize = nil, 0
 		}
+		batch = append(batch, info)
+		batchSize += infoSize
+	}
+	if len(batch) > 0 {
+		return sync.sendBatch(batch, req.WithRwset, from, compression, maxBatchBytes)
 	}
 	return nil
 }
 
+// sendBatch Send the batch, compressed if negotiated. A batch beyond the decompression limit of the requester,
+// i.e. a single large block, is sent uncompressed
+func (sync *BlockChainSyncServer) sendBatch(batch []*commonPb.BlockInfo, withRwset bool, to string,
+	compression string, maxBatchBytes int) error {
+	bz, err := proto.Marshal(&syncPb.SyncBlockBatch{
+		Data: &syncPb.SyncBlockBatch_BlockinfoBatch{BlockinfoBatch: &syncPb.BlockInfoBatch{
+			Batch: batch}}, WithRwset: withRwset,
+	})
+	if err != nil {
+		return err
+	}
+	if compression == compressionGzip && len(bz) >= sync.conf.compressThreshold &&
+		len(bz) <= maxDecompressedSize(maxBatchBytes) {
+		compressed, err := gzipCompress(bz)
+		if err != nil {
+			return err
+		}
+		sync.log.Debugf("send blocks [%d-%d] to node [%s], size: %d, gzip size: %d",
+			batch[0].Block.Header.BlockHeight, batch[len(batch)-1].Block.Header.BlockHeight, to, len(bz),
+			len(compressed))
+		return sync.sendMsg(syncMsgBlockSyncRespGzip, compressed, to)
+	}
+	sync.log.Debugf("send blocks [%d-%d] to node [%s], size: %d", batch[0].Block.Header.BlockHeight,
+		batch[len(batch)-1].Block.Header.BlockHeight, to, len(bz))
+	return sync.sendMsg(syncPb.SyncMsg_BLOCK_SYNC_RESP, bz, to)
+}
+
 func (sync *BlockChainSyncServer) sendMsg(msgType syncPb.SyncMsg_MsgType, msg []byte, to string) error {
 	var (
 		bs  []byte
@@ -107,6 +107,44 @@ func TestBlockChainSyncServer_Start(t *testing.T) {
 	//require.EqualValues(t, "pendingBlockHeight: 12, queue num: 0", implSync.processor.getServiceState())
 }
 
+func TestBlockChainSyncServer_GetSyncState(t *testing.T) {
+	service, fn := initTestSync(t)
+	implSync := service.(*BlockChainSyncServer)
+
+	// 1. no peers, the node is not catching up
+	state := implSync.GetSyncState()
+	require.True(t, state.Running)
+	require.EqualValues(t, 10, state.LocalHeight)
+	require.EqualValues(t, 0, state.PeersMaxHeight)
+	require.False(t, state.CatchingUp)
+
+	// 2. one block behind the peers, the block may be in consensus
+	require.NoError(t, implSync.blockSyncMsgHandler("node1", getNodeStatusResp(t, 11), netPb.NetMsg_SYNC_BLOCK_MSG))
+	require.Eventually(t, func() bool {
+		return implSync.GetSyncState().PeersMaxHeight == 11
+	}, time.Second, time.Millisecond)
+	require.False(t, implSync.GetSyncState().CatchingUp)
+
+	// 3. a single peer far ahead, the median height of the peers is still one block ahead
+	require.NoError(t, implSync.blockSyncMsgHandler("node2", getNodeStatusResp(t, 120), netPb.NetMsg_SYNC_BLOCK_MSG))
+	require.Eventually(t, func() bool {
+		return implSync.GetSyncState().PeersMaxHeight == 120
+	}, time.Second, time.Millisecond)
+	require.EqualValues(t, 11, implSync.GetSyncState().PeersMedianHeight)
+	require.False(t, implSync.GetSyncState().CatchingUp)
+
+	// 4. most of the peers far ahead
+	require.NoError(t, implSync.blockSyncMsgHandler("node3", getNodeStatusResp(t, 110), netPb.NetMsg_SYNC_BLOCK_MSG))
+	require.Eventually(t, func() bool {
+		return implSync.GetSyncState().PeersMedianHeight == 110
+	}, time.Second, time.Millisecond)
+	require.True(t, implSync.GetSyncState().CatchingUp)
+
+	// 5. stopped
+	fn()
+	require.False(t, implSync.GetSyncState().Running)
+}
+
 func TestSyncMsg_NODE_STATUS_REQ(t *testing.T) {
 	service, fn := initTestSync(t)
 	defer fn()
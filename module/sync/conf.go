@@ -26,6 +26,16 @@ type BlockSyncServerConf struct {
 	blockPoolSize        uint64 // Maximum number of blocks to be processed in scheduler
 	batchSizeFromOneNode uint64 // The number of blocks received from each node in a request
 
+	respMaxBatchBytes int    // Max size of the blocks packed into one response message, a larger block is sent alone
+	compression       string // Compression of the responses, accepted in requests and used in responses if agreed
+	compressThreshold int    // Responses smaller than this are not compressed
+}
+
+// SyncResponseConfig Block sync response settings, read from sync.response of chainmaker.yml
+type SyncResponseConfig struct {
+	MaxBatchBytes     int    `mapstructure:"max_batch_bytes"`
+	Compression       string `mapstructure:"compression"`
+	CompressThreshold int    `mapstructure:"compress_threshold"`
 }
 
 func NewBlockSyncServerConf() *BlockSyncServerConf {
@@ -40,6 +50,9 @@ func NewBlockSyncServerConf() *BlockSyncServerConf {
 		dataDetectionTick:    time.Minute,
 		reqTimeThreshold:     5 * time.Second,
 		blockRequestTime:     5 * time.Second,
+		respMaxBatchBytes:    4 * 1024 * 1024,
+		compression:          compressionGzip,
+		compressThreshold:    1024,
 	}
 }
 
@@ -83,9 +96,19 @@ func (c *BlockSyncServerConf) SetBlockRequestTime(n float64) *BlockSyncServerCon
 	c.blockRequestTime = time.Duration(n * float64(time.Second))
 	return c
 }
+func (c *BlockSyncServerConf) SetRespMaxBatchBytes(n int) *BlockSyncServerConf {
+	c.respMaxBatchBytes = n
+	return c
+}
+func (c *BlockSyncServerConf) SetCompression(compression string, threshold int) *BlockSyncServerConf {
+	c.compression = compression
+	c.compressThreshold = threshold
+	return c
+}
 func (c *BlockSyncServerConf) print() string {
 	return fmt.Sprintf("blockPoolSize: %d, request timeout: %d, batchSizeFromOneNode: %d"+
-		", processBlockTick: %v, schedulerTick: %v, livenessTick: %v, nodeStatusTick: %v\n",
+		", processBlockTick: %v, schedulerTick: %v, livenessTick: %v, nodeStatusTick: %v"+
+		", respMaxBatchBytes: %d, compression: %s, compressThreshold: %d\n",
 		c.blockPoolSize, c.timeOut, c.batchSizeFromOneNode, c.processBlockTick, c.schedulerTick, c.livenessTick,
-		c.nodeStatusTick)
+		c.nodeStatusTick, c.respMaxBatchBytes, c.compression, c.compressThreshold)
 }
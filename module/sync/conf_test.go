@@ -36,4 +36,9 @@ func TestBlockSyncServerConf(t *testing.T) {
 	require.Equal(t, conf.reqTimeThreshold, 10*time.Second)
 	conf.SetBlockRequestTime(10)
 	require.Equal(t, conf.blockRequestTime, 10*time.Second)
+	conf.SetRespMaxBatchBytes(1024)
+	require.Equal(t, conf.respMaxBatchBytes, 1024)
+	conf.SetCompression(compressionNone, 10)
+	require.Equal(t, conf.compression, compressionNone)
+	require.Equal(t, conf.compressThreshold, 10)
 }
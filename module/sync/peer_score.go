@@ -0,0 +1,183 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sync
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	latencyEWMAWeight   = 0.2              // Weight of the newest latency sample in the moving average
+	penaltyTimeout      = 1.0              // Penalty added when a request to the peer times out
+	penaltyInvalidBlock = 2.0              // Penalty added when a block from the peer fails verification
+	penaltyDecay        = 0.9              // Penalty is multiplied by this for each valid block from the peer
+	penaltyHalfLife     = 30 * time.Second // Penalty halves every this duration, so a penalized peer recovers
+	minPenalty          = 0.01             // Penalty below this is taken as no penalty
+	backoffTimeouts     = 3                // Consecutive timeouts before the peer is backed off
+	backoffBase         = 5 * time.Second  // Back-off of the first offence, doubled for each further one
+	backoffMax          = 2 * time.Minute  // Max back-off duration
+	defaultPeerLatency  = 1 * time.Second  // Latency assumed when no peer has responded yet
+	maxBackoffShift     = 10               // Limit of the doubling to avoid overflow
+	minPeerLatency      = time.Millisecond // Lower bound of latency, keeps the pending requests meaningful
+)
+
+// peerScore Response quality of a peer, lower cost means a better peer
+type peerScore struct {
+	latency      time.Duration // Moving average of the response latency, 0 if never responded
+	timeouts     int           // Consecutive timeouts
+	invalids     int           // Consecutive blocks failing verification
+	penalty      float64       // Decaying fault score of timeouts and invalid blocks
+	penaltyAt    time.Time     // The time the penalty was last decayed
+	backoffUntil time.Time     // The peer is not selected before this time
+}
+
+// peerScores Track the response latency, timeouts and invalid blocks of each peer,
+// only accessed by the scheduler routine
+type peerScores struct {
+	scores map[string]*peerScore
+}
+
+func newPeerScores() *peerScores {
+	return &peerScores{scores: make(map[string]*peerScore)}
+}
+
+func (ps *peerScores) get(peer string) *peerScore {
+	score, exist := ps.scores[peer]
+	if !exist {
+		score = &peerScore{}
+		ps.scores[peer] = score
+	}
+	return score
+}
+
+// onResponse Record the latency of a block response from the peer
+func (ps *peerScores) onResponse(peer string, latency time.Duration) {
+	score := ps.get(peer)
+	score.timeouts = 0
+	if score.latency == 0 {
+		score.latency = latency
+		return
+	}
+	score.latency = time.Duration(latencyEWMAWeight*float64(latency) + (1-latencyEWMAWeight)*float64(score.latency))
+}
+
+// onTimeout Record a request timeout, returns the back-off duration if the peer is backed off
+func (ps *peerScores) onTimeout(peer string, now time.Time) time.Duration {
+	score := ps.get(peer)
+	score.timeouts++
+	score.penalty = score.decayPenalty(now) + penaltyTimeout
+	if score.timeouts < backoffTimeouts {
+		return 0
+	}
+	return score.backoff(now, score.timeouts-backoffTimeouts)
+}
+
+// onInvalidBlock Record a block failing verification, the peer is backed off at once
+func (ps *peerScores) onInvalidBlock(peer string, now time.Time) time.Duration {
+	score := ps.get(peer)
+	score.invalids++
+	score.penalty = score.decayPenalty(now) + penaltyInvalidBlock
+	return score.backoff(now, score.invalids-1)
+}
+
+// onValidBlock Record a block from the peer which is committed
+func (ps *peerScores) onValidBlock(peer string) {
+	score := ps.get(peer)
+	score.invalids = 0
+	score.penalty *= penaltyDecay
+}
+
+// decayPenalty Halve the penalty for each penaltyHalfLife elapsed since the last decay,
+// returns the decayed penalty
+func (s *peerScore) decayPenalty(now time.Time) float64 {
+	if s.penalty > 0 && now.After(s.penaltyAt) {
+		s.penalty *= math.Pow(0.5, float64(now.Sub(s.penaltyAt))/float64(penaltyHalfLife))
+		if s.penalty < minPenalty {
+			s.penalty = 0
+		}
+	}
+	s.penaltyAt = now
+	return s.penalty
+}
+
+func (s *peerScore) backoff(now time.Time, shift int) time.Duration {
+	if shift > maxBackoffShift {
+		shift = maxBackoffShift
+	}
+	duration := backoffBase << uint(shift)
+	if duration > backoffMax {
+		duration = backoffMax
+	}
+	s.backoffUntil = now.Add(duration)
+	return duration
+}
+
+// prune Drop the scores of the peers which are gone, once they are neither backed off nor penalized
+func (ps *peerScores) prune(peers map[string]uint64, now time.Time) {
+	for peer, score := range ps.scores {
+		if _, exist := peers[peer]; exist {
+			continue
+		}
+		if !now.Before(score.backoffUntil) && score.decayPenalty(now) == 0 {
+			delete(ps.scores, peer)
+		}
+	}
+}
+
+func (ps *peerScores) isBackedOff(peer string, now time.Time) bool {
+	score, exist := ps.scores[peer]
+	return exist && now.Before(score.backoffUntil)
+}
+
+// averageLatency The average latency of the peers which have responded, assumed for peers without samples
+// so that new peers get a fair chance
+func (ps *peerScores) averageLatency() time.Duration {
+	var (
+		total time.Duration
+		num   int64
+	)
+	for _, score := range ps.scores {
+		if score.latency > 0 {
+			total += score.latency
+			num++
+		}
+	}
+	if num == 0 {
+		return defaultPeerLatency
+	}
+	return total / time.Duration(num)
+}
+
+// cost Expected cost of requesting from the peer: the time to serve the pending requests plus the new one,
+// enlarged by the fault penalty decayed to now
+func (ps *peerScores) cost(peer string, pendingReqs int, defaultLatency time.Duration, now time.Time) float64 {
+	latency, penalty := defaultLatency, 0.0
+	if score, exist := ps.scores[peer]; exist {
+		if score.latency > 0 {
+			latency = score.latency
+		}
+		penalty = score.decayPenalty(now)
+	}
+	if latency < minPeerLatency {
+		latency = minPeerLatency
+	}
+	return latency.Seconds() * float64(1+pendingReqs) * (1 + penalty)
+}
+
+func (ps *peerScores) String() string {
+	backedOff := 0
+	now := time.Now()
+	for _, score := range ps.scores {
+		if now.Before(score.backoffUntil) {
+			backedOff++
+		}
+	}
+	return fmt.Sprintf("scored peers: %d, backed off peers: %d", len(ps.scores), backedOff)
+}
@@ -35,7 +35,11 @@ type scheduler struct {
 	pendingBlocks     map[uint64]string     // Which the block data of the specified height is being fetched from the node
 	receivedBlocks    map[uint64]string     // Block data has been received from the node
 	lastRequest       time.Time             // The last time which block request was sent
+	scores            *peerScores           // Latency and reputation of the peers, used to select peers
+	compression       string                // Compression accepted in the block responses, none if empty
+	maxBatchBytes     int                   // Max decompressed size of the block responses, sent with the compression
 	pendingRecvHeight uint64                // The next block to be processed, all smaller blocks have been processed
+	onPeersChanged    func(uint64, uint64)  // Called with the max and the median height of the peers after each event, may be nil
 
 	maxPendingBlocks uint64 // The maximum number of blocks allowed to be processed simultaneously
 	// (including: New, Pending, Received);
@@ -71,11 +75,15 @@ func newScheduler(sender syncSender, ledger protocol.LedgerCache,
 		pendingBlocks:     make(map[uint64]string),
 		pendingTime:       make(map[uint64]time.Time),
 		receivedBlocks:    make(map[uint64]string),
+		scores:            newPeerScores(),
 		pendingRecvHeight: currHeight + 1,
 	}
 }
 
 func (sch *scheduler) handler(event queue.Item) (queue.Item, error) {
+	if sch.onPeersChanged != nil {
+		defer func() { sch.onPeersChanged(sch.maxHeight(), sch.medianHeight()) }()
+	}
 	switch msg := event.(type) {
 	case *NodeStatusMsg:
 		sch.log.Debug("receive [NodeStatusMsg] msg, start handle...")
@@ -163,6 +171,9 @@ func (sch *scheduler) handleLivinessMsg() {
 	if exist && time.Since(reqTime) > sch.peerReqTimeout {
 		id := sch.pendingBlocks[sch.pendingRecvHeight]
 		sch.log.Debugf("block request [height: %d] time out from node[%s]", sch.pendingRecvHeight, id)
+		if backoff := sch.scores.onTimeout(id, time.Now()); backoff > 0 {
+			sch.log.Infof("node[%s] times out repeatedly, back off %v", id, backoff)
+		}
 		if currBlk := sch.ledger.GetLastCommittedBlock(); currBlk != nil &&
 			currBlk.Header.BlockHeight < sch.pendingRecvHeight {
 			sch.blockStates[sch.pendingRecvHeight] = newBlock
@@ -171,6 +182,7 @@ func (sch *scheduler) handleLivinessMsg() {
 		delete(sch.pendingTime, sch.pendingRecvHeight)
 		delete(sch.pendingBlocks, sch.pendingRecvHeight)
 	}
+	sch.scores.prune(sch.peers, time.Now())
 }
 
 func (sch *scheduler) handleScheduleMsg() (queue.Item, error) {
@@ -201,6 +213,10 @@ func (sch *scheduler) handleScheduleMsg() (queue.Item, error) {
 	if bz, err = proto.Marshal(&bsr); err != nil {
 		return nil, err
 	}
+	if sch.compression != "" && sch.compression != compressionNone {
+		bz = appendAcceptCompression(bz, sch.compression)
+		bz = appendMaxBatchBytes(bz, sch.maxBatchBytes)
+	}
 
 	sch.lastRequest = time.Now()
 	for i := pendingHeight; i <= sch.peers[peer] && i < sch.BatchesizeInEachReq+pendingHeight; i++ {
@@ -240,6 +256,20 @@ func (sch *scheduler) maxHeight() uint64 {
 	return max
 }
 
+// medianHeight The median height of the peers, the lower one of the two middle heights if the number of the peers
+// is even, so that a single peer reporting a wrong height does not move it
+func (sch *scheduler) medianHeight() uint64 {
+	if len(sch.peers) == 0 {
+		return 0
+	}
+	heights := make([]uint64, 0, len(sch.peers))
+	for _, height := range sch.peers {
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights[(len(heights)-1)/2]
+}
+
 func (sch *scheduler) isNeedSync() bool {
 	currHeight, err := sch.ledger.CurrentHeight()
 	if err != nil {
@@ -251,26 +281,39 @@ func (sch *scheduler) isNeedSync() bool {
 	return currHeight+1 < max || (currHeight+1 == max && time.Since(sch.lastRequest) > sch.reqTimeThreshold)
 }
 
+// selectPeer Select the peer with the lowest expected cost among the peers which have the block,
+// the cost grows with the response latency, pending requests, timeouts and invalid blocks of the peer.
+// Backed off peers are skipped unless all the peers are backed off. Ties are broken by lexical ID.
 func (sch *scheduler) selectPeer(pendingHeight uint64) string {
 	peers := sch.getHeight(pendingHeight)
 	if len(peers) == 0 {
 		return ""
 	}
 
-	pendingReqInPeers := make(map[int][]string)
-	for i := 0; i < len(peers); i++ {
-		reqNum := sch.getPendingReqInPeer(peers[i])
-		pendingReqInPeers[reqNum] = append(pendingReqInPeers[reqNum], peers[i])
+	now := time.Now()
+	available := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		if !sch.scores.isBackedOff(peer, now) {
+			available = append(available, peer)
+		}
+	}
+	if len(available) == 0 {
+		available = peers
 	}
-	min := math.MaxInt64
-	for num := range pendingReqInPeers {
-		if min > num {
-			min = num
+	sort.Strings(available)
+
+	var (
+		selected       string
+		minCost        = math.MaxFloat64
+		defaultLatency = sch.scores.averageLatency()
+	)
+	for _, peer := range available {
+		if cost := sch.scores.cost(peer, sch.getPendingReqInPeer(peer), defaultLatency, now); cost < minCost {
+			minCost = cost
+			selected = peer
 		}
 	}
-	peers = pendingReqInPeers[min]
-	sort.Strings(peers)
-	return peers[0]
+	return selected
 }
 
 func (sch *scheduler) getHeight(pendingHeight uint64) []string {
@@ -334,6 +377,7 @@ func (sch *scheduler) handleProcessedBlockResp(msg *ProcessedBlockResp) (queue.I
 		" [%s], pendingHeight: %d", msg.height, msg.status, msg.from, sch.pendingRecvHeight)
 	delete(sch.receivedBlocks, msg.height)
 	if msg.status == ok || msg.status == hasProcessed {
+		sch.scores.onValidBlock(msg.from)
 		delete(sch.blockStates, msg.height)
 		if msg.height >= sch.pendingRecvHeight {
 			sch.pendingRecvHeight = msg.height + 1
@@ -341,6 +385,9 @@ func (sch *scheduler) handleProcessedBlockResp(msg *ProcessedBlockResp) (queue.I
 		}
 	}
 	if msg.status == validateFailed {
+		backoff := sch.scores.onInvalidBlock(msg.from, time.Now())
+		sch.log.Warnf("block [height: %d] from node [%s] failed verification, back off %v", msg.height, msg.from,
+			backoff)
 		sch.blockStates[msg.height] = newBlock
 		delete(sch.peers, msg.from)
 	}
@@ -357,8 +404,8 @@ func (sch *scheduler) handleProcessedBlockResp(msg *ProcessedBlockResp) (queue.I
 
 func (sch *scheduler) getServiceState() string {
 	return fmt.Sprintf("pendingRecvHeight: %d, peers num: %d, blockStates num: %d, "+
-		"pendingBlocks num: %d, receivedBlocks num: %d", sch.pendingRecvHeight, len(sch.peers), len(sch.blockStates),
-		len(sch.pendingBlocks), len(sch.receivedBlocks))
+		"pendingBlocks num: %d, receivedBlocks num: %d, %s", sch.pendingRecvHeight, len(sch.peers), len(sch.blockStates),
+		len(sch.pendingBlocks), len(sch.receivedBlocks), sch.scores)
 }
 
 func (sch *scheduler) isPeerArchivedTooHeight(localHeight, peerArchivedHeight uint64) bool {
@@ -368,6 +415,7 @@ func (sch *scheduler) isPeerArchivedTooHeight(localHeight, peerArchivedHeight ui
 func (sch *scheduler) updateSchedulerBySyncBlockBatch(msgFrom string, o interface{}, size int) bool {
 	var height uint64
 	var hash []byte
+	var firstReqTime time.Time
 	needToProcess := false
 	for i := 0; i < size; i++ {
 		switch ty := o.(type) {
@@ -381,6 +429,10 @@ func (sch *scheduler) updateSchedulerBySyncBlockBatch(msgFrom string, o interfac
 			sch.log.Errorf("received unrecognized block type: [%t]", ty)
 			continue
 		}
+		if reqTime, exist := sch.pendingTime[height]; exist && sch.pendingBlocks[height] == msgFrom &&
+			(firstReqTime.IsZero() || reqTime.Before(firstReqTime)) {
+			firstReqTime = reqTime
+		}
 		delete(sch.pendingBlocks, height)
 		delete(sch.pendingTime, height)
 		if state, exist := sch.blockStates[height]; exist {
@@ -396,5 +448,9 @@ func (sch *scheduler) updateSchedulerBySyncBlockBatch(msgFrom string, o interfac
 			}
 		}
 	}
+	// the blocks of a batch are requested at the same time, take the latency of the batch once
+	if !firstReqTime.IsZero() {
+		sch.scores.onResponse(msgFrom, time.Since(firstReqTime))
+	}
 	return needToProcess
 }
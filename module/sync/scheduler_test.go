@@ -115,6 +115,26 @@ func TestIsNeedSync(t *testing.T) {
 	require.True(t, sch.isNeedSync())
 }
 
+func TestMedianHeight(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockLedger := newMockLedgerCache(ctrl, &commonPb.Block{Header: &commonPb.BlockHeader{BlockHeight: 100}})
+	sch := newScheduler(NewMockSender(), mockLedger, 100, time.Second, time.Second*3, 2, &test.GoLogger{})
+
+	// 1. no peers
+	require.EqualValues(t, 0, sch.medianHeight())
+
+	// 2. the lower one of the two middle heights
+	sch.peers["node1"] = 1000
+	sch.peers["node2"] = 90
+	require.EqualValues(t, 90, sch.medianHeight())
+
+	// 3. a single peer far ahead does not move the median
+	sch.peers["node3"] = 110
+	require.EqualValues(t, 110, sch.medianHeight())
+	require.EqualValues(t, 1000, sch.maxHeight())
+}
+
 func TestSchedulerMsg(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -297,3 +317,100 @@ func TestAddPendingBlocksAndUpdatePendingHeight(t *testing.T) {
 	sch.addPendingBlocksAndUpdatePendingHeight(256)
 	require.EqualValues(t, 128, len(sch.blockStates))
 }
+
+func TestSelectPeer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockLedger := newMockLedgerCache(ctrl, &commonPb.Block{Header: &commonPb.BlockHeader{BlockHeight: 10}})
+	sch := newScheduler(NewMockSender(), mockLedger, 100, time.Second, time.Second*3, 1, &test.GoLogger{})
+	sch.peers["node1"] = 100
+	sch.peers["node2"] = 100
+	sch.peers["node3"] = 5
+
+	// 1. no scores, the lexical smallest peer which has the block
+	require.EqualValues(t, "node1", sch.selectPeer(11))
+	require.EqualValues(t, "", sch.selectPeer(101))
+
+	// 2. the faster peer is preferred
+	sch.scores.onResponse("node1", 500*time.Millisecond)
+	sch.scores.onResponse("node2", 50*time.Millisecond)
+	require.EqualValues(t, "node2", sch.selectPeer(11))
+
+	// 3. the pending requests of the faster peer are taken into account
+	for height := uint64(11); height < 21; height++ {
+		sch.pendingBlocks[height] = "node2"
+	}
+	require.EqualValues(t, "node1", sch.selectPeer(21))
+	sch.pendingBlocks = make(map[uint64]string)
+
+	// 4. the peer sending invalid blocks is backed off
+	sch.pendingRecvHeight = 11
+	_, err := sch.handler(&ProcessedBlockResp{height: 11, status: validateFailed, from: "node2"})
+	require.NoError(t, err)
+	sch.peers["node2"] = 100
+	require.True(t, sch.scores.isBackedOff("node2", time.Now()))
+	require.EqualValues(t, "node1", sch.selectPeer(11))
+
+	// 5. all the peers are backed off, still select one of them
+	for i := 0; i < backoffTimeouts; i++ {
+		sch.scores.onTimeout("node1", time.Now())
+	}
+	require.True(t, sch.scores.isBackedOff("node1", time.Now()))
+	require.NotEqual(t, "", sch.selectPeer(11))
+}
+
+func TestPeerScoresLatency(t *testing.T) {
+	scores := newPeerScores()
+	require.EqualValues(t, defaultPeerLatency, scores.averageLatency())
+
+	// 1. response latency is averaged
+	scores.onResponse("node1", time.Second)
+	scores.onResponse("node1", 2*time.Second)
+	require.EqualValues(t, 1200*time.Millisecond, scores.get("node1").latency)
+
+	// 2. a response resets the consecutive timeouts
+	scores.onTimeout("node1", time.Now())
+	scores.onTimeout("node1", time.Now())
+	scores.onResponse("node1", time.Second)
+	require.EqualValues(t, 0, scores.get("node1").timeouts)
+	require.False(t, scores.isBackedOff("node1", time.Now()))
+
+	// 3. the back-off doubles and is bounded
+	now := time.Now()
+	for i := 0; i < backoffTimeouts; i++ {
+		scores.onTimeout("node2", now)
+	}
+	require.EqualValues(t, 2*backoffBase, scores.onTimeout("node2", now))
+	for i := 0; i < 2*maxBackoffShift; i++ {
+		scores.onTimeout("node2", now)
+	}
+	require.EqualValues(t, backoffMax, scores.onTimeout("node2", now))
+}
+
+func TestPeerScoresDecayAndPrune(t *testing.T) {
+	scores := newPeerScores()
+	now := time.Now()
+
+	// 1. the penalty decays over time without any valid block from the peer
+	scores.onInvalidBlock("node1", now)
+	require.InDelta(t, penaltyInvalidBlock, scores.get("node1").penalty, 1e-9)
+	require.InDelta(t, penaltyInvalidBlock/2, scores.get("node1").decayPenalty(now.Add(penaltyHalfLife)), 1e-9)
+	fresh := scores.cost("node2", 0, time.Second, now.Add(penaltyHalfLife))
+	require.InDelta(t, fresh*2, scores.cost("node1", 0, time.Second, now.Add(penaltyHalfLife)), 1e-9)
+	require.InDelta(t, fresh, scores.cost("node1", 0, time.Second, now.Add(20*penaltyHalfLife)), 1e-9)
+
+	// 2. the scores of the gone peers are dropped once they are neither backed off nor penalized
+	scores.onResponse("node2", time.Second)
+	scores.onTimeout("node3", now)
+	peers := map[string]uint64{"node3": 10}
+	scores.prune(peers, now)
+	require.Len(t, scores.scores, 2)
+	_, exist := scores.scores["node2"]
+	require.False(t, exist)
+
+	delete(peers, "node3")
+	scores.prune(peers, now)
+	require.Len(t, scores.scores, 2, "the penalized peers are kept")
+	scores.prune(peers, now.Add(20*penaltyHalfLife+backoffMax))
+	require.Len(t, scores.scores, 0)
+}
@@ -0,0 +1,183 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sync
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+
+	syncPb "chainmaker.org/chainmaker/pb-go/v2/sync"
+	"github.com/gogo/protobuf/proto"
+)
+
+const (
+	compressionNone = "none"
+	compressionGzip = "gzip"
+
+	// syncMsgBlockSyncRespGzip Type of the SyncMsg whose payload is a gzip compressed SyncBlockBatch.
+	// It is only sent to the nodes which accept gzip in their block request, so older nodes never receive it
+	syncMsgBlockSyncRespGzip syncPb.SyncMsg_MsgType = 100
+
+	// extFieldAcceptCompression Field number of the compressions accepted by the requester, appended to the
+	// BlockSyncReq as an unknown field, which is skipped by the older nodes when unmarshalling
+	extFieldAcceptCompression = 1000
+
+	// extFieldMaxBatchBytes Field number of the max size of a compressed response accepted by the requester,
+	// appended to the BlockSyncReq together with the accepted compressions
+	extFieldMaxBatchBytes = 1001
+
+	// decompressMargin Allowance over the negotiated max batch bytes for the encoding overhead of a SyncBlockBatch
+	decompressMargin = 64 * 1024
+)
+
+var errExtFieldMalformed = errors.New("malformed extension field")
+
+// appendAcceptCompression Append the compressions accepted by the requester to the marshalled BlockSyncReq
+func appendAcceptCompression(req []byte, compressions ...string) []byte {
+	return appendExtField(req, extFieldAcceptCompression, []byte(strings.Join(compressions, ",")))
+}
+
+// readAcceptCompression Read the compressions accepted by the requester from the marshalled BlockSyncReq,
+// requests of older nodes have none
+func readAcceptCompression(req []byte) ([]string, error) {
+	value, err := readExtField(req, extFieldAcceptCompression)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	return strings.Split(string(value), ","), nil
+}
+
+// appendMaxBatchBytes Append the max size of a decompressed response accepted by the requester
+func appendMaxBatchBytes(req []byte, maxBatchBytes int) []byte {
+	return appendExtField(req, extFieldMaxBatchBytes, proto.EncodeVarint(uint64(maxBatchBytes)))
+}
+
+// readMaxBatchBytes Read the max size of a decompressed response accepted by the requester, 0 if there is none
+func readMaxBatchBytes(req []byte) (int, error) {
+	value, err := readExtField(req, extFieldMaxBatchBytes)
+	if err != nil || value == nil {
+		return 0, err
+	}
+	maxBatchBytes, n := proto.DecodeVarint(value)
+	if n == 0 || n != len(value) || maxBatchBytes > math.MaxInt32 {
+		return 0, errExtFieldMalformed
+	}
+	return int(maxBatchBytes), nil
+}
+
+// negotiateMaxBatchBytes Select the max batch bytes of the response, the smaller one of the local and the requested
+func negotiateMaxBatchBytes(local, requested int) int {
+	if requested > 0 && requested < local {
+		return requested
+	}
+	return local
+}
+
+// maxDecompressedSize Upper bound of a decompressed SyncBlockBatch, guards against compression bombs.
+// Batches larger than this are never compressed by the responder, see BlockChainSyncServer.sendBatch
+func maxDecompressedSize(maxBatchBytes int) int {
+	return maxBatchBytes + decompressMargin
+}
+
+// appendExtField Append a bytes field to the marshalled message, the field is unknown to the message definition
+// and skipped by the nodes which do not read it
+func appendExtField(msg []byte, field uint64, value []byte) []byte {
+	msg = append(msg, proto.EncodeVarint(field<<3|proto.WireBytes)...)
+	msg = append(msg, proto.EncodeVarint(uint64(len(value)))...)
+	return append(msg, value...)
+}
+
+// readExtField Read the bytes field appended by appendExtField, nil if the message has no such field
+func readExtField(msg []byte, field uint64) ([]byte, error) {
+	for len(msg) > 0 {
+		tag, n := proto.DecodeVarint(msg)
+		if n == 0 {
+			return nil, errExtFieldMalformed
+		}
+		msg = msg[n:]
+		wireType := tag & 0x7
+
+		var size uint64
+		switch wireType {
+		case proto.WireVarint:
+			if _, n = proto.DecodeVarint(msg); n == 0 {
+				return nil, errExtFieldMalformed
+			}
+			size = uint64(n)
+		case proto.WireFixed64:
+			size = 8
+		case proto.WireFixed32:
+			size = 4
+		case proto.WireBytes:
+			length, n := proto.DecodeVarint(msg)
+			if n == 0 || uint64(len(msg)-n) < length {
+				return nil, errExtFieldMalformed
+			}
+			if tag>>3 == field {
+				return msg[n : uint64(n)+length], nil
+			}
+			size = uint64(n) + length
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d", wireType)
+		}
+		if uint64(len(msg)) < size {
+			return nil, errExtFieldMalformed
+		}
+		msg = msg[size:]
+	}
+	return nil, nil
+}
+
+// negotiateCompression Select the compression of the response, none if the requester accepts no compression
+// which is enabled locally
+func negotiateCompression(local string, accepted []string) string {
+	if local == "" || local == compressionNone {
+		return compressionNone
+	}
+	for _, c := range accepted {
+		if c == local {
+			return local
+		}
+	}
+	return compressionNone
+}
+
+func gzipCompress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gzipDecompress Decompress the data, fails if the decompressed size exceeds limit
+func gzipDecompress(data []byte, limit int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	bz, err := ioutil.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(bz) > limit {
+		return nil, fmt.Errorf("decompressed size exceeds %d bytes", limit)
+	}
+	return bz, nil
+}
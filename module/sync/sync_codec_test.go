@@ -0,0 +1,82 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sync
+
+import (
+	"bytes"
+	"testing"
+
+	syncPb "chainmaker.org/chainmaker/pb-go/v2/sync"
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptCompression(t *testing.T) {
+	req := &syncPb.BlockSyncReq{BlockHeight: 100, BatchSize: 10, WithRwset: true}
+	bz, err := proto.Marshal(req)
+	require.NoError(t, err)
+
+	// requests of older nodes accept no compression
+	accepted, err := readAcceptCompression(bz)
+	require.NoError(t, err)
+	require.Empty(t, accepted)
+	require.Equal(t, compressionNone, negotiateCompression(compressionGzip, accepted))
+
+	bz = appendAcceptCompression(bz, compressionGzip)
+	accepted, err = readAcceptCompression(bz)
+	require.NoError(t, err)
+	require.Equal(t, []string{compressionGzip}, accepted)
+	require.Equal(t, compressionGzip, negotiateCompression(compressionGzip, accepted))
+	require.Equal(t, compressionNone, negotiateCompression(compressionNone, accepted))
+
+	// older nodes skip the extension field
+	var got syncPb.BlockSyncReq
+	require.NoError(t, proto.Unmarshal(bz, &got))
+	require.Equal(t, req.BlockHeight, got.BlockHeight)
+	require.Equal(t, req.BatchSize, got.BatchSize)
+	require.Equal(t, req.WithRwset, got.WithRwset)
+
+	_, err = readAcceptCompression(bz[:len(bz)-1])
+	require.Error(t, err)
+}
+
+func TestMaxBatchBytes(t *testing.T) {
+	bz, err := proto.Marshal(&syncPb.BlockSyncReq{BlockHeight: 100, BatchSize: 10})
+	require.NoError(t, err)
+
+	requested, err := readMaxBatchBytes(bz)
+	require.NoError(t, err)
+	require.Equal(t, 0, requested)
+	require.Equal(t, 4096, negotiateMaxBatchBytes(4096, requested))
+
+	bz = appendMaxBatchBytes(appendAcceptCompression(bz, compressionGzip), 1024)
+	requested, err = readMaxBatchBytes(bz)
+	require.NoError(t, err)
+	require.Equal(t, 1024, requested)
+	require.Equal(t, 1024, negotiateMaxBatchBytes(4096, requested))
+	require.Equal(t, 512, negotiateMaxBatchBytes(512, requested))
+	require.Equal(t, 1024+decompressMargin, maxDecompressedSize(requested))
+}
+
+func TestGzip(t *testing.T) {
+	data := bytes.Repeat([]byte("block"), 1024)
+	compressed, err := gzipCompress(data)
+	require.NoError(t, err)
+	require.Less(t, len(compressed), len(data))
+
+	decompressed, err := gzipDecompress(compressed, len(data))
+	require.NoError(t, err)
+	require.Equal(t, data, decompressed)
+
+	// the decompressed size is bounded
+	_, err = gzipDecompress(compressed, len(data)-1)
+	require.Error(t, err)
+
+	_, err = gzipDecompress(data, len(data))
+	require.Error(t, err)
+}
@@ -0,0 +1,43 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sync
+
+import (
+	"sync/atomic"
+)
+
+// SyncState The block sync state of the chain
+type SyncState struct {
+	Running           bool   `json:"running"`
+	LocalHeight       uint64 `json:"local_height"`
+	PeersMaxHeight    uint64 `json:"peers_max_height"`    // The max height reported by the connected peers
+	PeersMedianHeight uint64 `json:"peers_median_height"` // The median height reported by the connected peers
+	CatchingUp        bool   `json:"catching_up"`         // The node is more than one block behind the peers
+}
+
+// SyncStateProvider Implemented by the sync service which reports its state
+type SyncStateProvider interface {
+	GetSyncState() *SyncState
+}
+
+var _ SyncStateProvider = (*BlockChainSyncServer)(nil)
+
+// GetSyncState Returns the block sync state, the node is catching up if it is more than one block behind
+// the median height of the peers, the last block may be in consensus. The median is used so that a single peer
+// reporting a wrong height does not make the node catching up
+func (sync *BlockChainSyncServer) GetSyncState() *SyncState {
+	state := &SyncState{
+		Running:           atomic.LoadInt32(&sync.start) == 1,
+		PeersMaxHeight:    atomic.LoadUint64(&sync.peersMaxHeight),
+		PeersMedianHeight: atomic.LoadUint64(&sync.peersMedianHeight),
+	}
+	if blk := sync.ledgerCache.GetLastCommittedBlock(); blk != nil {
+		state.LocalHeight = blk.Header.BlockHeight
+	}
+	state.CatchingUp = state.LocalHeight+1 < state.PeersMedianHeight
+	return state
+}
@@ -12,6 +12,7 @@ import (
 	"chainmaker.org/chainmaker-go/module/txfilter/filtercommon"
 	bn "chainmaker.org/chainmaker/common/v2/birdsnest"
 	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/config"
 	"chainmaker.org/chainmaker/protocol/v2"
 )
 
@@ -22,6 +23,9 @@ type TxFilter struct {
 	store protocol.BlockchainStore
 	exitC chan struct{}
 	l     sync.RWMutex
+
+	config *commonPb.BirdsNestConfig
+	filtercommon.LookupCounter
 }
 
 func (f *TxFilter) ValidateRule(txId string, ruleType ...commonPb.RuleType) error {
@@ -53,17 +57,22 @@ func New(config *commonPb.BirdsNestConfig, log protocol.Logger, store protocol.B
 		}
 	}
 	txFilter := &TxFilter{
-		log:   log,
-		bn:    birdsNest,
-		exitC: exitC,
+		log:    log,
+		bn:     birdsNest,
+		store:  store,
+		exitC:  exitC,
+		config: config,
 	}
+	// Start before chasing, so the snapshots serialized during a long chase let a restart resume from them
+	birdsNest.Start()
 	err = filtercommon.ChaseBlockHeight(store, txFilter, log)
 	if err != nil {
+		// stop the goroutines started above
+		txFilter.Close()
 		return nil, err
 	}
 	log.Infof("bird's nest filter init success, size: %v, max keys: %v, cost: %v",
 		config.Length, config.Cuckoo.MaxNumKeys, time.Since(initLasts))
-	birdsNest.Start()
 	return txFilter, nil
 }
 
@@ -155,8 +164,10 @@ func (f *TxFilter) AddsAndSetHeight(txIds []string, height uint64) error {
 
 // IsExists Check whether TxId exists in the transaction filter
 func (f *TxFilter) IsExists(txId string, ruleType ...commonPb.RuleType) (exists bool, err error) {
+	f.IncLookup()
 	key, err := bn.ToTimestampKey(txId)
 	if err != nil {
+		f.IncStoreFallback()
 		exists, err = f.store.TxExists(txId)
 		if err != nil {
 			f.log.Errorf("filter check exists, query from db fail, normal txid: %v, error:%v", txId, err)
@@ -173,18 +184,49 @@ func (f *TxFilter) IsExists(txId string, ruleType ...commonPb.RuleType) (exists
 	}
 	if contains {
 		// False positive treatment
+		f.IncStoreFallback()
 		exists, err = f.store.TxExists(txId)
 		if err != nil {
 			f.log.Errorf("filter check exists, query from db fail, txid: %v, error:%v", txId, err)
 			return false, err
 		}
 		if !exists {
+			f.IncFalsePositive()
 			return false, nil
 		}
 	}
 	return contains, nil
 }
 
+// Stats get the statistics of the filter, implements filtercommon.StatsProvider
+func (f *TxFilter) Stats() *filtercommon.Stats {
+	stats := &filtercommon.Stats{
+		Type:        config.TxFilterType_BirdsNest.String(),
+		Height:      f.GetHeight(),
+		LookupStats: f.LookupStats(),
+	}
+	// index 3 total keys, index 4 total space occupied by cuckoo, see addsPrintInfo
+	if info := f.bn.Info(); len(info) > 4 {
+		stats.Keys = info[3]
+		stats.Bytes = info[4]
+	}
+	if f.config != nil && f.config.Cuckoo != nil {
+		stats.Capacity = uint64(f.config.Length) * uint64(f.config.Cuckoo.MaxNumKeys)
+		stats.FillRatio = filtercommon.FillRatio(stats.Keys, stats.Capacity)
+		stats.EstimatedFalsePositiveRate = filtercommon.CuckooFalsePositiveRate(f.config.Length,
+			f.config.Cuckoo.TagsPerBucket, f.config.Cuckoo.BitsPerItem, stats.FillRatio)
+	}
+	return stats
+}
+
+// Checkpoint serialize the bird's nest synchronously, implements filtercommon.Checkpointer so that an
+// interrupted chase resumes from the checkpoint height
+func (f *TxFilter) Checkpoint() error {
+	f.l.Lock()
+	defer f.l.Unlock()
+	return f.bn.Serialize()
+}
+
 // Close transaction filter
 func (f *TxFilter) Close() {
 	close(f.exitC)
@@ -6,13 +6,16 @@ SPDX-License-Identifier: Apache-2.0
 package defau1t
 
 import (
+	"chainmaker.org/chainmaker-go/module/txfilter/filtercommon"
 	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/config"
 	"chainmaker.org/chainmaker/protocol/v2"
 )
 
 // TxFilter protocol.BlockchainStore transaction filter
 type TxFilter struct {
-	store protocol.BlockchainStore
+	store   protocol.BlockchainStore
+	lookups *filtercommon.LookupCounter
 }
 
 func (f TxFilter) ValidateRule(_ string, _ ...common.RuleType) error {
@@ -21,7 +24,7 @@ func (f TxFilter) ValidateRule(_ string, _ ...common.RuleType) error {
 
 // New transaction filter init
 func New(store protocol.BlockchainStore) *TxFilter {
-	return &TxFilter{store: store}
+	return &TxFilter{store: store, lookups: &filtercommon.LookupCounter{}}
 }
 
 // GetHeight get height from transaction filter
@@ -39,6 +42,8 @@ func (f TxFilter) SetHeight(_ uint64) {
 
 // IsExistsAndReturnHeight is exists and return height
 func (f TxFilter) IsExistsAndReturnHeight(txId string, _ ...common.RuleType) (bool, uint64, error) {
+	f.lookups.IncLookup()
+	f.lookups.IncStoreFallback()
 	return f.store.TxExistsInFullDB(txId)
 }
 
@@ -59,9 +64,21 @@ func (f TxFilter) AddsAndSetHeight(_ []string, _ uint64) error {
 
 // IsExists Check whether TxId exists in the transaction filter
 func (f TxFilter) IsExists(txId string, _ ...common.RuleType) (bool, error) {
+	f.lookups.IncLookup()
+	f.lookups.IncStoreFallback()
 	return f.store.TxExists(txId)
 }
 
+// Stats get the statistics of the filter, every lookup is answered by the store,
+// implements filtercommon.StatsProvider
+func (f TxFilter) Stats() *filtercommon.Stats {
+	return &filtercommon.Stats{
+		Type:        config.TxFilterType_None.String(),
+		Height:      f.GetHeight(),
+		LookupStats: f.lookups.LookupStats(),
+	}
+}
+
 // Close transaction filter
 func (f TxFilter) Close() {
 }
@@ -9,6 +9,7 @@ import (
 	"reflect"
 	"testing"
 
+	"chainmaker.org/chainmaker-go/module/txfilter/filtercommon"
 	"chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/protocol/v2"
 	"chainmaker.org/chainmaker/protocol/v2/mock"
@@ -32,7 +33,8 @@ func TestInit(t *testing.T) {
 				store: store,
 			},
 			want: &TxFilter{
-				store: store,
+				store:   store,
+				lookups: &filtercommon.LookupCounter{},
 			},
 		},
 	}
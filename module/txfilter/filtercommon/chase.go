@@ -0,0 +1,272 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package filtercommon
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"chainmaker.org/chainmaker-go/module/extconf"
+	"chainmaker.org/chainmaker/common/v2/monitor"
+	"chainmaker.org/chainmaker/localconf/v2"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"chainmaker.org/chainmaker/utils/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	chaseConfigKey = "tx_filter.chase"
+
+	// subsystemTxFilter prometheus subsystem of the transaction filters
+	subsystemTxFilter = "txfilter"
+
+	defaultChaseWindowPerWorker  = 64
+	defaultChaseCheckpointBlocks = 100000
+	defaultChaseLogInterval      = 10
+)
+
+var (
+	chaseMetricOnce   sync.Once
+	metricChaseHeight *prometheus.GaugeVec
+	metricChaseTarget *prometheus.GaugeVec
+)
+
+// ChaseConfig block chase config of the transaction filters, read from tx_filter.chase of chainmaker.yml
+type ChaseConfig struct {
+	// Number of goroutines reading blocks, default is the number of CPUs
+	Workers int `mapstructure:"workers"`
+	// Max number of blocks read ahead of the filter height, default is 64 per worker
+	Window int `mapstructure:"window"`
+	// Persist the filter every this number of blocks if it is a Checkpointer
+	CheckpointInterval uint64 `mapstructure:"checkpoint_interval"`
+	// Progress log interval in seconds
+	LogInterval int `mapstructure:"log_interval"`
+}
+
+// Checkpointer filters which can persist their content and height on demand,
+// so that an interrupted chase resumes from the last checkpoint on the next start
+type Checkpointer interface {
+	Checkpoint() error
+}
+
+// BlockTimeAdder filters which evict tx ids by time, the ids of a block are added with the block
+// timestamp, so that the blocks added by a chase are not taken as fresh
+type BlockTimeAdder interface {
+	AddsAndSetHeightWithTimestamp(txIds []string, height uint64, timestamp int64) error
+}
+
+// AddsAndSetHeight add the tx ids of a block and set height, the block timestamp is passed on
+// if the filter is a BlockTimeAdder
+func AddsAndSetHeight(filter protocol.TxFilter, txIds []string, height uint64, timestamp int64) error {
+	if adder, ok := filter.(BlockTimeAdder); ok {
+		return adder.AddsAndSetHeightWithTimestamp(txIds, height, timestamp)
+	}
+	return filter.AddsAndSetHeight(txIds, height)
+}
+
+// LoadChaseConfig load chase config, defaults are used if the config is absent
+func LoadChaseConfig() *ChaseConfig {
+	conf := &ChaseConfig{}
+	if err := extconf.Unmarshal(chaseConfigKey, conf); err != nil {
+		conf = &ChaseConfig{}
+	}
+	if conf.Workers <= 0 {
+		conf.Workers = runtime.NumCPU()
+	}
+	if conf.Window < conf.Workers {
+		conf.Window = conf.Workers * defaultChaseWindowPerWorker
+	}
+	if conf.CheckpointInterval == 0 {
+		conf.CheckpointInterval = defaultChaseCheckpointBlocks
+	}
+	if conf.LogInterval <= 0 {
+		conf.LogInterval = defaultChaseLogInterval
+	}
+	return conf
+}
+
+// chaseResult tx ids of one block read by a worker
+type chaseResult struct {
+	height    uint64
+	timestamp int64
+	ids       []string
+	err       error
+}
+
+// ChaseBlockHeight Chase high block
+//
+// Blocks after the filter height are read and converted to tx ids by ChaseConfig.Workers goroutines,
+// while the caller goroutine adds them to the filter strictly in height order, so the filter height is
+// always consistent with its content. Filters implementing Checkpointer are persisted periodically.
+func ChaseBlockHeight(store protocol.BlockchainStore, filter protocol.TxFilter, log protocol.Logger) error {
+	return ChaseBlockHeightWithConfig(store, filter, log, LoadChaseConfig())
+}
+
+// ChaseBlockHeightWithConfig Chase high block with the given config
+func ChaseBlockHeightWithConfig(store protocol.BlockchainStore, filter protocol.TxFilter, log protocol.Logger,
+	conf *ChaseConfig) error {
+	cost := time.Now()
+	lastBlock, err := store.GetLastBlock()
+	if err != nil {
+		log.Errorf("query last block from db fail, error: %v", err)
+		return err
+	}
+	from := filter.GetHeight() + 1
+	to := lastBlock.Header.BlockHeight
+	chainId := lastBlock.Header.ChainId
+	log.Infof("chase block start,filter height: %v, block height: %v, workers: %v", filter.GetHeight(),
+		to, conf.Workers)
+	if from > to {
+		return nil
+	}
+
+	initChaseMetrics()
+	setChaseMetric(metricChaseTarget, chainId, to)
+
+	var (
+		done     = make(chan struct{})
+		inflight = make(chan struct{}, conf.Window)
+		jobs     = make(chan uint64, conf.Window)
+		results  = make(chan *chaseResult, conf.Window)
+		wg       sync.WaitGroup
+	)
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+
+	// producer, at most conf.Window blocks are read ahead of the committed height
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(jobs)
+		for height := from; height <= to; height++ {
+			select {
+			case inflight <- struct{}{}:
+			case <-done:
+				return
+			}
+			jobs <- height
+		}
+	}()
+
+	for i := 0; i < conf.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for height := range jobs {
+				result := readChaseBlock(store, lastBlock, height)
+				select {
+				case results <- result:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	// ordered committer
+	var (
+		pending      = make(map[uint64]*chaseResult, conf.Window)
+		next         = from
+		lastLog      = time.Now()
+		lastLogH     = from - 1
+		checkpointer Checkpointer
+	)
+	checkpointer, _ = filter.(Checkpointer)
+	for next <= to {
+		result := <-results
+		if result.err != nil {
+			log.Errorf("query block from db fail, height: %v, error: %v", result.height, result.err)
+			return result.err
+		}
+		pending[result.height] = result
+
+		for block, ok := pending[next]; ok; block, ok = pending[next] {
+			if err = AddsAndSetHeight(filter, block.ids, next, block.timestamp); err != nil {
+				log.Errorf("chase block add fail, height: %v, keys: %v, error: %v", next, len(block.ids), err)
+				return err
+			}
+			delete(pending, next)
+			<-inflight
+
+			if checkpointer != nil && next%conf.CheckpointInterval == 0 {
+				if err = checkpointer.Checkpoint(); err != nil {
+					log.Warnf("chase block checkpoint fail, height: %v, error: %v", next, err)
+				}
+			}
+			next++
+		}
+
+		if elapsed := time.Since(lastLog); elapsed >= time.Duration(conf.LogInterval)*time.Second {
+			committed := next - 1
+			speed := float64(committed-lastLogH) / elapsed.Seconds()
+			remaining := time.Duration(0)
+			if speed > 0 {
+				remaining = time.Duration(float64(to-committed)/speed) * time.Second
+			}
+			log.Infof("chasing block, height: %d, block height: %d, speed: %.0f blocks/s, remaining: %v",
+				committed, to, speed, remaining)
+			setChaseMetric(metricChaseHeight, chainId, committed)
+			lastLog = time.Now()
+			lastLogH = committed
+		}
+	}
+	setChaseMetric(metricChaseHeight, chainId, to)
+
+	if checkpointer != nil {
+		if err = checkpointer.Checkpoint(); err != nil {
+			log.Warnf("chase block checkpoint fail, height: %v, error: %v", to, err)
+		}
+	}
+	log.Infof("chase block finish, height: %d, block height: %d, cost: %d", filter.GetHeight(),
+		to, time.Since(cost))
+
+	return nil
+}
+
+// readChaseBlock read the block at height and get its tx ids
+func readChaseBlock(store protocol.BlockchainStore, lastBlock *common.Block, height uint64) *chaseResult {
+	var (
+		block *common.Block
+		err   error
+	)
+	if height == lastBlock.Header.BlockHeight {
+		block = lastBlock
+	} else if block, err = store.GetBlock(height); err != nil {
+		return &chaseResult{height: height, err: err}
+	}
+	if block == nil {
+		return &chaseResult{height: height, err: errBlockNotFound(height)}
+	}
+	return &chaseResult{height: height, timestamp: block.Header.BlockTimestamp, ids: utils.GetTxIds(block.Txs)}
+}
+
+func errBlockNotFound(height uint64) error {
+	return fmt.Errorf("block not found, height: %d", height)
+}
+
+func initChaseMetrics() {
+	if !localconf.ChainMakerConfig.MonitorConfig.Enabled {
+		return
+	}
+	chaseMetricOnce.Do(func() {
+		metricChaseHeight = monitor.NewGaugeVec(subsystemTxFilter, "chase_height",
+			"The block height the tx filter has chased to.", "chainId")
+		metricChaseTarget = monitor.NewGaugeVec(subsystemTxFilter, "chase_target_height",
+			"The block height the tx filter is chasing to.", "chainId")
+	})
+}
+
+func setChaseMetric(gauge *prometheus.GaugeVec, chainId string, height uint64) {
+	if gauge == nil {
+		return
+	}
+	gauge.WithLabelValues(chainId).Set(float64(height))
+}
@@ -0,0 +1,126 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package filtercommon
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2/mock"
+	"chainmaker.org/chainmaker/protocol/v2/test"
+	"github.com/golang/mock/gomock"
+)
+
+// recordFilter records the order of the added heights
+type recordFilter struct {
+	height      uint64
+	heights     []uint64
+	ids         map[string]bool
+	checkpoints []uint64
+}
+
+func (f *recordFilter) GetHeight() uint64                                 { return f.height }
+func (f *recordFilter) SetHeight(height uint64)                           { f.height = height }
+func (f *recordFilter) Add(txId string) error                             { return f.Adds([]string{txId}) }
+func (f *recordFilter) ValidateRule(_ string, _ ...common.RuleType) error { return nil }
+func (f *recordFilter) IsExists(txId string, _ ...common.RuleType) (bool, error) {
+	return f.ids[txId], nil
+}
+func (f *recordFilter) Close() {}
+
+func (f *recordFilter) IsExistsAndReturnHeight(txId string, _ ...common.RuleType) (bool, uint64, error) {
+	return f.ids[txId], f.height, nil
+}
+
+func (f *recordFilter) Adds(txIds []string) error {
+	for _, txId := range txIds {
+		f.ids[txId] = true
+	}
+	return nil
+}
+
+func (f *recordFilter) AddsAndSetHeight(txIds []string, height uint64) error {
+	f.heights = append(f.heights, height)
+	f.height = height
+	return f.Adds(txIds)
+}
+
+func (f *recordFilter) Checkpoint() error {
+	f.checkpoints = append(f.checkpoints, f.height)
+	return nil
+}
+
+func newChaseBlock(height uint64) *common.Block {
+	return &common.Block{
+		Header: &common.BlockHeader{ChainId: "chain1", BlockHeight: height},
+		Txs:    []*common.Transaction{{Payload: &common.Payload{TxId: fmt.Sprintf("tx%d", height)}}},
+	}
+}
+
+func newChaseStore(t *testing.T, lastHeight uint64, failHeight uint64) *mock.MockBlockchainStore {
+	ctl := gomock.NewController(t)
+	store := mock.NewMockBlockchainStore(ctl)
+	store.EXPECT().GetLastBlock().Return(newChaseBlock(lastHeight), nil).AnyTimes()
+	store.EXPECT().GetBlock(gomock.Any()).DoAndReturn(func(height uint64) (*common.Block, error) {
+		if height == failHeight {
+			return nil, errors.New("read block fail")
+		}
+		return newChaseBlock(height), nil
+	}).AnyTimes()
+	return store
+}
+
+func TestChaseBlockHeight(t *testing.T) {
+	var (
+		log    = &test.GoLogger{}
+		store  = newChaseStore(t, 100, 0)
+		filter = &recordFilter{height: 10, ids: make(map[string]bool)}
+		conf   = &ChaseConfig{Workers: 4, Window: 8, CheckpointInterval: 30, LogInterval: 10}
+	)
+
+	if err := ChaseBlockHeightWithConfig(store, filter, log, conf); err != nil {
+		t.Fatal(err)
+	}
+	if filter.GetHeight() != 100 || len(filter.heights) != 90 {
+		t.Fatalf("height = %v, added blocks = %v, want 100, 90", filter.GetHeight(), len(filter.heights))
+	}
+	for i, height := range filter.heights {
+		if height != uint64(i)+11 {
+			t.Fatalf("block %v added at position %v, want in height order", height, i)
+		}
+	}
+	if ok, _ := filter.IsExists("tx100"); !ok {
+		t.Errorf("IsExists(tx100) = false, want true")
+	}
+	want := []uint64{30, 60, 90, 100}
+	if fmt.Sprint(filter.checkpoints) != fmt.Sprint(want) {
+		t.Errorf("checkpoints = %v, want %v", filter.checkpoints, want)
+	}
+}
+
+func TestChaseBlockHeight_Fail(t *testing.T) {
+	var (
+		log    = &test.GoLogger{}
+		store  = newChaseStore(t, 100, 50)
+		filter = &recordFilter{ids: make(map[string]bool)}
+		conf   = &ChaseConfig{Workers: 4, Window: 8, CheckpointInterval: 1000, LogInterval: 10}
+	)
+
+	if err := ChaseBlockHeightWithConfig(store, filter, log, conf); err == nil {
+		t.Fatal("ChaseBlockHeightWithConfig() error = nil, want read block fail")
+	}
+	// only blocks before the failed one are added, in order, so a restart resumes from the filter height
+	if filter.GetHeight() >= 50 {
+		t.Errorf("height = %v, want below 50", filter.GetHeight())
+	}
+	for i, height := range filter.heights {
+		if height != uint64(i)+1 {
+			t.Fatalf("block %v added at position %v, want in height order", height, i)
+		}
+	}
+}
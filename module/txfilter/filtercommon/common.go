@@ -8,51 +8,14 @@ package filtercommon
 import (
 	"errors"
 	"fmt"
-	"time"
 
 	"chainmaker.org/chainmaker/localconf/v2"
 	"chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/pb-go/v2/config"
 	"chainmaker.org/chainmaker/protocol/v2"
-	"chainmaker.org/chainmaker/utils/v2"
 	"github.com/gogo/protobuf/proto"
 )
 
-// ChaseBlockHeight Chase high block
-func ChaseBlockHeight(store protocol.BlockchainStore, filter protocol.TxFilter, log protocol.Logger) error {
-	cost := time.Now()
-	lastBlock, err := store.GetLastBlock()
-	if err != nil {
-		log.Errorf("query last block from db fail, error: %v", err)
-		return err
-	}
-	log.Infof("chase block start,filter height: %v, block height: %v", filter.GetHeight(),
-		lastBlock.Header.BlockHeight)
-	for height := filter.GetHeight() + 1; height <= lastBlock.Header.BlockHeight; height++ {
-		var block *common.Block
-		if height != lastBlock.Header.BlockHeight {
-			block, err = store.GetBlock(height)
-			if err != nil {
-				log.Errorf("query block from db fail, height: %v, error: %v", height, err)
-				return err
-			}
-		} else {
-			block = lastBlock
-		}
-		ids := utils.GetTxIds(block.Txs)
-		err = filter.AddsAndSetHeight(ids, block.Header.BlockHeight)
-		if err != nil {
-			log.Errorf("chase block add fail, height: %v, keys: %v, error: %v", block.Header.BlockHeight, len(ids), err)
-			return err
-		}
-		log.Infof("chasing block, height: %d", block.Header.BlockHeight)
-	}
-	log.Infof("chase block finish, height: %d, block height: %d, cost: %d", filter.GetHeight(),
-		lastBlock.Header.BlockHeight, time.Since(cost))
-
-	return nil
-}
-
 func GetConf(chainId string) (*config.TxFilterConfig, error) {
 	return ToPbConfig(localconf.ChainMakerConfig.TxFilter, chainId)
 }
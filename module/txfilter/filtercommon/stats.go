@@ -0,0 +1,228 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package filtercommon
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"chainmaker.org/chainmaker/localconf/v2"
+	"chainmaker.org/chainmaker/protocol/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricNamespace prometheus namespace of the node metrics
+const metricNamespace = "chainmaker"
+
+// Stats runtime statistics of a transaction filter
+type Stats struct {
+	// Filter type, the name of config.TxFilterType
+	Type   string `json:"type"`
+	Height uint64 `json:"height"`
+	// Number of keys held by the filter
+	Keys uint64 `json:"keys"`
+	// Max number of keys the filter can hold, 0 means unlimited
+	Capacity uint64 `json:"capacity"`
+	// Keys / Capacity, 0 if the capacity is unlimited
+	FillRatio float64 `json:"fill_ratio"`
+	// Estimated probability that a new tx id is reported as contained by the filter
+	EstimatedFalsePositiveRate float64 `json:"estimated_false_positive_rate"`
+	// Memory occupied by the filter in bytes, 0 if unknown
+	Bytes  uint64        `json:"bytes"`
+	Shards []*ShardStats `json:"shards,omitempty"`
+
+	LookupStats
+}
+
+// ShardStats statistics of one shard of a sharding filter
+type ShardStats struct {
+	Index     int     `json:"index"`
+	Keys      uint64  `json:"keys"`
+	Capacity  uint64  `json:"capacity"`
+	FillRatio float64 `json:"fill_ratio"`
+	Bytes     uint64  `json:"bytes"`
+}
+
+// LookupStats lookup counters of a transaction filter since start
+type LookupStats struct {
+	// Number of IsExists calls
+	Lookups uint64 `json:"lookups"`
+	// Number of lookups answered by the store, because the filter hit, the id is not supported by the filter
+	// or the id may have been evicted
+	StoreFallbacks uint64 `json:"store_fallbacks"`
+	// Number of filter hits which the store reported as not existing
+	FalsePositives uint64 `json:"false_positives"`
+}
+
+// StatsProvider filters which report runtime statistics
+type StatsProvider interface {
+	Stats() *Stats
+}
+
+// LookupCounter concurrent safe LookupStats counters, embedded by the filters, a nil counter counts nothing
+type LookupCounter struct {
+	lookups        uint64
+	storeFallbacks uint64
+	falsePositives uint64
+}
+
+// IncLookup count a lookup
+func (c *LookupCounter) IncLookup() {
+	if c == nil {
+		return
+	}
+	atomic.AddUint64(&c.lookups, 1)
+}
+
+// IncStoreFallback count a lookup answered by the store
+func (c *LookupCounter) IncStoreFallback() {
+	if c == nil {
+		return
+	}
+	atomic.AddUint64(&c.storeFallbacks, 1)
+}
+
+// IncFalsePositive count a filter hit which does not exist in the store
+func (c *LookupCounter) IncFalsePositive() {
+	if c == nil {
+		return
+	}
+	atomic.AddUint64(&c.falsePositives, 1)
+}
+
+// LookupStats get the current counters
+func (c *LookupCounter) LookupStats() LookupStats {
+	if c == nil {
+		return LookupStats{}
+	}
+	return LookupStats{
+		Lookups:        atomic.LoadUint64(&c.lookups),
+		StoreFallbacks: atomic.LoadUint64(&c.storeFallbacks),
+		FalsePositives: atomic.LoadUint64(&c.falsePositives),
+	}
+}
+
+// FillRatio keys / capacity, 0 if the capacity is unlimited
+func FillRatio(keys, capacity uint64) float64 {
+	if capacity == 0 {
+		return 0
+	}
+	return float64(keys) / float64(capacity)
+}
+
+// CuckooFalsePositiveRate estimate the false positive rate of a bird's nest made of cuckoos cuckoo filters,
+// each with tagsPerBucket tags of bitsPerItem bits per bucket, filled to fillRatio.
+// A lookup checks 2 buckets of every cuckoo, so one cuckoo gives about 2*b*fill/2^f, and the nest hits if any does.
+func CuckooFalsePositiveRate(cuckoos, tagsPerBucket, bitsPerItem uint32, fillRatio float64) float64 {
+	if cuckoos == 0 || bitsPerItem == 0 || fillRatio <= 0 {
+		return 0
+	}
+	single := math.Min(1, 2*float64(tagsPerBucket)*fillRatio/math.Pow(2, float64(bitsPerItem)))
+	return 1 - math.Pow(1-single, float64(cuckoos))
+}
+
+// GetStats get the statistics of filter, only the height is reported if the filter is not a StatsProvider
+func GetStats(filter protocol.TxFilter) *Stats {
+	if provider, ok := filter.(StatsProvider); ok {
+		return provider.Stats()
+	}
+	return &Stats{Height: filter.GetHeight()}
+}
+
+var (
+	statsCollectorOnce sync.Once
+	statsFilters       sync.Map
+)
+
+// RegisterStats export the statistics of the filter of chainId as prometheus metrics,
+// a filter registered before replaces the old one
+func RegisterStats(chainId string, filter protocol.TxFilter) {
+	if !localconf.ChainMakerConfig.MonitorConfig.Enabled {
+		return
+	}
+	statsCollectorOnce.Do(func() {
+		prometheus.MustRegister(newStatsCollector())
+	})
+	statsFilters.Store(chainId, filter)
+}
+
+// UnregisterStats stop exporting the statistics of the filter of chainId
+func UnregisterStats(chainId string) {
+	statsFilters.Delete(chainId)
+}
+
+// statsCollector collect the statistics of the registered filters on scrape
+type statsCollector struct {
+	keys           *prometheus.Desc
+	capacity       *prometheus.Desc
+	fillRatio      *prometheus.Desc
+	fpRate         *prometheus.Desc
+	bytes          *prometheus.Desc
+	shardKeys      *prometheus.Desc
+	shardFillRatio *prometheus.Desc
+	lookups        *prometheus.Desc
+	storeFallbacks *prometheus.Desc
+	falsePositives *prometheus.Desc
+}
+
+func newStatsCollector() *statsCollector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricNamespace, subsystemTxFilter, name), help,
+			append([]string{"chainId", "type"}, labels...), nil)
+	}
+	return &statsCollector{
+		keys:           desc("keys", "The number of keys held by the tx filter."),
+		capacity:       desc("capacity", "The max number of keys the tx filter can hold, 0 means unlimited."),
+		fillRatio:      desc("fill_ratio", "The ratio of keys to capacity of the tx filter."),
+		fpRate:         desc("estimated_false_positive_rate", "The estimated false positive rate of the tx filter."),
+		bytes:          desc("bytes", "The memory occupied by the tx filter in bytes."),
+		shardKeys:      desc("shard_keys", "The number of keys held by a shard of the tx filter.", "shard"),
+		shardFillRatio: desc("shard_fill_ratio", "The ratio of keys to capacity of a shard of the tx filter.", "shard"),
+		lookups:        desc("lookups_total", "Total number of lookups of the tx filter."),
+		storeFallbacks: desc("store_fallbacks_total", "Total number of tx filter lookups answered by the store."),
+		falsePositives: desc("false_positives_total", "Total number of tx filter hits not existing in the store."),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.keys, c.capacity, c.fillRatio, c.fpRate, c.bytes, c.shardKeys,
+		c.shardFillRatio, c.lookups, c.storeFallbacks, c.falsePositives} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	statsFilters.Range(func(key, value interface{}) bool {
+		chainId, _ := key.(string)
+		stats := GetStats(value.(protocol.TxFilter))
+		gauge := func(d *prometheus.Desc, v float64, labels ...string) {
+			ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v,
+				append([]string{chainId, stats.Type}, labels...)...)
+		}
+		counter := func(d *prometheus.Desc, v uint64) {
+			ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, float64(v), chainId, stats.Type)
+		}
+
+		gauge(c.keys, float64(stats.Keys))
+		gauge(c.capacity, float64(stats.Capacity))
+		gauge(c.fillRatio, stats.FillRatio)
+		gauge(c.fpRate, stats.EstimatedFalsePositiveRate)
+		gauge(c.bytes, float64(stats.Bytes))
+		for _, shard := range stats.Shards {
+			index := strconv.Itoa(shard.Index)
+			gauge(c.shardKeys, float64(shard.Keys), index)
+			gauge(c.shardFillRatio, shard.FillRatio, index)
+		}
+		counter(c.lookups, stats.Lookups)
+		counter(c.storeFallbacks, stats.StoreFallbacks)
+		counter(c.falsePositives, stats.FalsePositives)
+		return true
+	})
+}
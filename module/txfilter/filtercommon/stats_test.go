@@ -0,0 +1,55 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package filtercommon
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCuckooFalsePositiveRate(t *testing.T) {
+	tests := []struct {
+		name      string
+		cuckoos   uint32
+		fillRatio float64
+		want      float64
+	}{
+		{name: "empty", cuckoos: 10, fillRatio: 0, want: 0},
+		{name: "one cuckoo full", cuckoos: 1, fillRatio: 1, want: 2 * 4 / math.Pow(2, 12)},
+		{name: "one cuckoo half", cuckoos: 1, fillRatio: 0.5, want: 4 / math.Pow(2, 12)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CuckooFalsePositiveRate(tt.cuckoos, 4, 12, tt.fillRatio)
+			if math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("CuckooFalsePositiveRate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// more cuckoos are checked by a lookup, the rate grows
+	if CuckooFalsePositiveRate(10, 4, 12, 0.5) <= CuckooFalsePositiveRate(1, 4, 12, 0.5) {
+		t.Errorf("CuckooFalsePositiveRate() does not grow with the number of cuckoos")
+	}
+}
+
+func TestLookupCounter(t *testing.T) {
+	var nilCounter *LookupCounter
+	nilCounter.IncLookup()
+	if stats := nilCounter.LookupStats(); stats.Lookups != 0 {
+		t.Errorf("nil counter lookups = %v, want 0", stats.Lookups)
+	}
+
+	counter := &LookupCounter{}
+	counter.IncLookup()
+	counter.IncLookup()
+	counter.IncStoreFallback()
+	counter.IncFalsePositive()
+	want := LookupStats{Lookups: 2, StoreFallbacks: 1, FalsePositives: 1}
+	if got := counter.LookupStats(); got != want {
+		t.Errorf("LookupStats() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,52 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package mapimpl
+
+import (
+	"chainmaker.org/chainmaker-go/module/extconf"
+)
+
+const (
+	configKey = "tx_filter.map"
+
+	defaultSnapshotInterval = 1000
+)
+
+// Config map filter config, read from tx_filter.map of chainmaker.yml
+type Config struct {
+	// Tx ids of blocks older than this number of blocks are evicted, 0 means never
+	ExpireBlocks uint64 `mapstructure:"expire_blocks"`
+	// Tx ids of blocks whose timestamp is older than this number of seconds are evicted, 0 means never
+	ExpireTime int64 `mapstructure:"expire_time"`
+	// Oldest blocks are evicted when the filter holds more tx ids than this, 0 means unlimited
+	MaxKeys int `mapstructure:"max_keys"`
+	// Snapshot persistence, disabled if the path is empty
+	Snapshot SnapshotConfig `mapstructure:"snapshot"`
+}
+
+// SnapshotConfig map filter snapshot config
+type SnapshotConfig struct {
+	// Snapshot directory, a sub directory is created for each chain
+	Path string `mapstructure:"path"`
+	// Write a snapshot every this number of blocks
+	Interval uint64 `mapstructure:"interval"`
+}
+
+// LoadConfig load map filter config from chainmaker.yml
+func LoadConfig() (*Config, error) {
+	config := &Config{
+		Snapshot: SnapshotConfig{
+			Interval: defaultSnapshotInterval,
+		},
+	}
+	if err := extconf.Unmarshal(configKey, config); err != nil {
+		return nil, err
+	}
+	if config.Snapshot.Interval == 0 {
+		config.Snapshot.Interval = defaultSnapshotInterval
+	}
+	return config, nil
+}
@@ -0,0 +1,182 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package mapimpl
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"chainmaker.org/chainmaker/protocol/v2"
+)
+
+const (
+	snapshotFilePrefix = "snapshot_"
+	snapshotTmpSuffix  = ".tmp"
+	// number of snapshot files kept on disk
+	snapshotKeep = 2
+)
+
+// snapshot the persisted filter content, covering blocks up to Height
+type snapshot struct {
+	Height  uint64
+	Evicted bool
+	Blocks  []*blockTxIds
+}
+
+// snapshotter write and read the map filter snapshots of one chain
+type snapshotter struct {
+	// lastHeight is accessed atomically and kept first for the 64-bit alignment,
+	// it is read by the committer and written by the chase checkpoints
+	lastHeight uint64
+	config     SnapshotConfig
+	dir        string
+	log        protocol.Logger
+	saving     int32
+	mu         sync.Mutex
+}
+
+func newSnapshotter(config SnapshotConfig, chainId string, log protocol.Logger) *snapshotter {
+	return &snapshotter{
+		config: config,
+		dir:    filepath.Join(config.Path, chainId),
+		log:    log,
+	}
+}
+
+// due whether a snapshot should be written at height
+func (s *snapshotter) due(height uint64) bool {
+	return height >= s.getLastHeight()+s.config.Interval && atomic.LoadInt32(&s.saving) == 0
+}
+
+// saveAsync write the snapshot in background, at most one write is in progress
+func (s *snapshotter) saveAsync(snap *snapshot) {
+	if !atomic.CompareAndSwapInt32(&s.saving, 0, 1) {
+		return
+	}
+	s.setLastHeight(snap.Height)
+	go func() {
+		defer atomic.StoreInt32(&s.saving, 0)
+		if err := s.save(snap); err != nil {
+			s.log.Warnf("map filter snapshot fail, height: %v, error: %v", snap.Height, err)
+		}
+	}()
+}
+
+// getLastHeight the height of the latest snapshot written or in progress
+func (s *snapshotter) getLastHeight() uint64 {
+	return atomic.LoadUint64(&s.lastHeight)
+}
+
+func (s *snapshotter) setLastHeight(height uint64) {
+	atomic.StoreUint64(&s.lastHeight, height)
+}
+
+// save write the snapshot to a temporary file and rename it, so a crash never leaves a partial snapshot
+func (s *snapshotter) save(snap *snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	name := filepath.Join(s.dir, fmt.Sprintf("%s%020d", snapshotFilePrefix, snap.Height))
+	tmp := name + snapshotTmpSuffix
+
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if err = gob.NewEncoder(file).Encode(snap); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, name); err != nil {
+		return err
+	}
+
+	s.log.Infof("map filter snapshot saved, height: %v, blocks: %v", snap.Height, len(snap.Blocks))
+	s.cleanup()
+	return nil
+}
+
+// load read the latest snapshot, returns nil if there is none
+func (s *snapshotter) load() (*snapshot, error) {
+	heights, err := s.list()
+	if err != nil || len(heights) == 0 {
+		return nil, err
+	}
+
+	latest := heights[len(heights)-1]
+	file, err := os.Open(filepath.Join(s.dir, fmt.Sprintf("%s%020d", snapshotFilePrefix, latest)))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	snap := &snapshot{}
+	if err = gob.NewDecoder(file).Decode(snap); err != nil {
+		return nil, err
+	}
+	if snap.Height != latest {
+		return nil, fmt.Errorf("snapshot height %d mismatch file height %d", snap.Height, latest)
+	}
+	return snap, nil
+}
+
+// list the heights of the snapshot files in ascending order
+func (s *snapshotter) list() ([]uint64, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	heights := make([]uint64, 0, len(infos))
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, snapshotFilePrefix) || strings.HasSuffix(name, snapshotTmpSuffix) {
+			continue
+		}
+		height, err := strconv.ParseUint(strings.TrimPrefix(name, snapshotFilePrefix), 10, 64)
+		if err != nil {
+			continue
+		}
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights, nil
+}
+
+// cleanup remove all but the latest snapshotKeep snapshots
+func (s *snapshotter) cleanup() {
+	heights, err := s.list()
+	if err != nil || len(heights) <= snapshotKeep {
+		return
+	}
+	for _, height := range heights[:len(heights)-snapshotKeep] {
+		name := filepath.Join(s.dir, fmt.Sprintf("%s%020d", snapshotFilePrefix, height))
+		if err = os.Remove(name); err != nil {
+			s.log.Warnf("remove map filter snapshot fail, file: %v, error: %v", name, err)
+		}
+	}
+}
@@ -7,74 +7,319 @@ package mapimpl
 
 import (
 	"sync"
+	"time"
 
+	"chainmaker.org/chainmaker-go/module/txfilter/filtercommon"
 	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/config"
+	"chainmaker.org/chainmaker/protocol/v2"
 )
 
-// TxFilter sync.Map transaction filter
+// TxFilter map transaction filter
+//
+// Tx ids are kept together with the height of the block which contains them, so that ids older than the
+// configured block/time window or beyond the key capacity can be evicted block by block. Ids which are
+// not in the filter any more are looked up in the store, so eviction never makes a duplicate tx pass.
 type TxFilter struct {
 	height uint64
-	m      sync.Map
+	l      sync.RWMutex
+	ids    map[string]uint64
+	blocks []*blockTxIds
+	count  int
+	// evicted is true once any id left the filter, or the filter was restored from a snapshot
+	// which does not cover the whole chain
+	evicted bool
+
+	config *Config
+	log    protocol.Logger
+	store  protocol.BlockchainStore
+
+	snapshotter *snapshotter
+	filtercommon.LookupCounter
+}
+
+// blockTxIds tx ids added at one block height
+type blockTxIds struct {
+	Height uint64
+	// Timestamp the block timestamp in seconds, or the time the ids were added if it is unknown
+	Timestamp int64
+	TxIds     []string
 }
 
 func (f *TxFilter) ValidateRule(_ string, _ ...common.RuleType) error {
 	return nil
 }
 
-// New transaction filter init
+// New transaction filter init, the filter is unbounded and not persisted
 func New() *TxFilter {
-	return &TxFilter{m: sync.Map{}}
+	return &TxFilter{
+		ids:    make(map[string]uint64),
+		config: &Config{},
+	}
+}
+
+// NewWithConfig transaction filter init, the filter is restored from the latest snapshot if there is one,
+// then chases the blocks after the snapshot height
+func NewWithConfig(config *Config, log protocol.Logger, store protocol.BlockchainStore) (*TxFilter, error) {
+	initLasts := time.Now()
+	f := &TxFilter{
+		ids:    make(map[string]uint64),
+		config: config,
+		log:    log,
+		store:  store,
+	}
+
+	if config.Snapshot.Path != "" {
+		lastBlock, err := store.GetLastBlock()
+		if err != nil {
+			log.Errorf("query last block from db fail, error: %v", err)
+			return nil, err
+		}
+		f.snapshotter = newSnapshotter(config.Snapshot, lastBlock.Header.ChainId, log)
+		if err = f.restore(); err != nil {
+			// the snapshot is only an optimization, rebuild from blocks
+			log.Warnf("restore map filter from snapshot fail, chase from genesis, error: %v", err)
+			f.reset()
+		} else if f.GetHeight() > lastBlock.Header.BlockHeight {
+			log.Warnf("map filter snapshot height %v is higher than block height %v, chase from genesis",
+				f.GetHeight(), lastBlock.Header.BlockHeight)
+			f.reset()
+		}
+	}
+
+	if err := filtercommon.ChaseBlockHeight(store, f, log); err != nil {
+		return nil, err
+	}
+
+	log.Infof("map filter init success, height: %v, keys: %v, cost: %v", f.GetHeight(), f.Len(),
+		time.Since(initLasts))
+	return f, nil
 }
 
 // GetHeight get height from transaction filter
 func (f *TxFilter) GetHeight() uint64 {
+	f.l.RLock()
+	defer f.l.RUnlock()
 	return f.height
 }
 
 // SetHeight set height from transaction filter
 func (f *TxFilter) SetHeight(height uint64) {
+	f.l.Lock()
+	defer f.l.Unlock()
 	f.height = height
 }
 
+// Len the number of tx ids in the filter
+func (f *TxFilter) Len() int {
+	f.l.RLock()
+	defer f.l.RUnlock()
+	return f.count
+}
+
 // IsExistsAndReturnHeight is exists and return height
 func (f *TxFilter) IsExistsAndReturnHeight(txId string, _ ...common.RuleType) (bool, uint64, error) {
 	exists, err := f.IsExists(txId)
 	if err != nil {
 		return false, 0, err
 	}
-	return exists, f.height, nil
+	return exists, f.GetHeight(), nil
 }
 
 // Add txId to transaction filter
 func (f *TxFilter) Add(txId string) error {
-	f.m.Store(txId, struct{}{})
-	return nil
+	return f.Adds([]string{txId})
 }
 
-// Adds batch Add txId
+// Adds batch Add txId, the ids belong to the current height
 func (f *TxFilter) Adds(txIds []string) error {
-	for _, txId := range txIds {
-		go f.m.Store(txId, struct{}{})
+	if len(txIds) == 0 {
+		return nil
 	}
+	f.l.Lock()
+	defer f.l.Unlock()
+	f.adds(txIds, f.height, time.Now().Unix())
+	f.evict()
 	return nil
 }
 
-// AddsAndSetHeight batch add tx id and set height
-func (f *TxFilter) AddsAndSetHeight(txId []string, height uint64) error {
-	err := f.Adds(txId)
-	if err != nil {
-		return err
-	}
-	f.SetHeight(height)
+// AddsAndSetHeight batch add tx id and set height, the ids are taken as added now
+func (f *TxFilter) AddsAndSetHeight(txIds []string, height uint64) error {
+	return f.AddsAndSetHeightWithTimestamp(txIds, height, time.Now().Unix())
+}
+
+// AddsAndSetHeightWithTimestamp batch add the tx ids of the block at height and set height,
+// implements filtercommon.BlockTimeAdder so that the time window is based on the block timestamp
+func (f *TxFilter) AddsAndSetHeightWithTimestamp(txIds []string, height uint64, timestamp int64) error {
+	f.l.Lock()
+	f.adds(txIds, height, timestamp)
+	f.height = height
+	f.evict()
+	f.l.Unlock()
+
+	f.trySnapshot(height)
 	return nil
 }
 
-// IsExists Check whether TxId exists in the transaction filter
+// IsExists Check whether TxId exists in the transaction filter,
+// falls back to the store if the id may have been evicted
 func (f *TxFilter) IsExists(txId string, _ ...common.RuleType) (bool, error) {
-	_, ok := f.m.Load(txId)
-	return ok, nil
+	f.IncLookup()
+	f.l.RLock()
+	_, ok := f.ids[txId]
+	evicted := f.evicted
+	f.l.RUnlock()
+
+	if ok || !evicted || f.store == nil {
+		return ok, nil
+	}
+	f.IncStoreFallback()
+	return f.store.TxExists(txId)
+}
+
+// Stats get the statistics of the filter, implements filtercommon.StatsProvider
+func (f *TxFilter) Stats() *filtercommon.Stats {
+	f.l.RLock()
+	stats := &filtercommon.Stats{
+		Type:     config.TxFilterType_Map.String(),
+		Height:   f.height,
+		Keys:     uint64(f.count),
+		Capacity: uint64(f.config.MaxKeys),
+	}
+	f.l.RUnlock()
+	stats.FillRatio = filtercommon.FillRatio(stats.Keys, stats.Capacity)
+	stats.LookupStats = f.LookupStats()
+	return stats
 }
 
-// Close transaction filter
+// Close transaction filter, a last snapshot is written if persistence is enabled
 func (f *TxFilter) Close() {
+	if f.snapshotter == nil {
+		return
+	}
+	height, snap := f.snapshotData()
+	if err := f.snapshotter.save(snap); err != nil {
+		f.log.Warnf("map filter snapshot fail on close, height: %v, error: %v", height, err)
+	}
+}
+
+// Checkpoint write a snapshot synchronously, implements filtercommon.Checkpointer so that an interrupted
+// chase resumes from the checkpoint height
+func (f *TxFilter) Checkpoint() error {
+	if f.snapshotter == nil {
+		return nil
+	}
+	height, snap := f.snapshotData()
+	if height <= f.snapshotter.getLastHeight() {
+		return nil
+	}
+	if err := f.snapshotter.save(snap); err != nil {
+		return err
+	}
+	f.snapshotter.setLastHeight(height)
+	return nil
+}
+
+func (f *TxFilter) adds(txIds []string, height uint64, timestamp int64) {
+	if len(txIds) == 0 {
+		return
+	}
+
+	var last *blockTxIds
+	if n := len(f.blocks); n > 0 && f.blocks[n-1].Height == height {
+		last = f.blocks[n-1]
+	} else {
+		last = &blockTxIds{Height: height, Timestamp: timestamp}
+		f.blocks = append(f.blocks, last)
+	}
+
+	for _, txId := range txIds {
+		if _, ok := f.ids[txId]; ok {
+			continue
+		}
+		f.ids[txId] = height
+		last.TxIds = append(last.TxIds, txId)
+		f.count++
+	}
+}
+
+// evict remove the oldest blocks which are out of the block/time window or beyond the key capacity,
+// the block at the current height is always kept
+func (f *TxFilter) evict() {
+	now := time.Now().Unix()
+	for len(f.blocks) > 1 {
+		oldest := f.blocks[0]
+		expired := (f.config.ExpireBlocks > 0 && f.height-oldest.Height >= f.config.ExpireBlocks) ||
+			(f.config.ExpireTime > 0 && now-oldest.Timestamp >= f.config.ExpireTime) ||
+			(f.config.MaxKeys > 0 && f.count > f.config.MaxKeys)
+		if !expired {
+			return
+		}
+
+		for _, txId := range oldest.TxIds {
+			if h, ok := f.ids[txId]; ok && h == oldest.Height {
+				delete(f.ids, txId)
+				f.count--
+			}
+		}
+		f.blocks[0] = nil
+		f.blocks = f.blocks[1:]
+		f.evicted = true
+	}
+}
+
+func (f *TxFilter) reset() {
+	f.l.Lock()
+	defer f.l.Unlock()
+	f.height = 0
+	f.ids = make(map[string]uint64)
+	f.blocks = nil
+	f.count = 0
+	f.evicted = false
+}
+
+// restore load the latest snapshot
+func (f *TxFilter) restore() error {
+	snap, err := f.snapshotter.load()
+	if err != nil || snap == nil {
+		return err
+	}
+
+	f.l.Lock()
+	defer f.l.Unlock()
+	for _, b := range snap.Blocks {
+		f.blocks = append(f.blocks, b)
+		for _, txId := range b.TxIds {
+			f.ids[txId] = b.Height
+			f.count++
+		}
+	}
+	f.height = snap.Height
+	f.evicted = snap.Evicted
+	f.evict()
+	f.snapshotter.setLastHeight(snap.Height)
+
+	f.log.Infof("map filter restored from snapshot, height: %v, keys: %v", snap.Height, f.count)
+	return nil
+}
+
+// snapshotData copy the data to persist, the block tx id slices are shared since they are append only
+// before the block is finished
+func (f *TxFilter) snapshotData() (uint64, *snapshot) {
+	f.l.RLock()
+	defer f.l.RUnlock()
+	blocks := make([]*blockTxIds, len(f.blocks))
+	for i, b := range f.blocks {
+		blocks[i] = &blockTxIds{Height: b.Height, Timestamp: b.Timestamp, TxIds: b.TxIds[:len(b.TxIds):len(b.TxIds)]}
+	}
+	return f.height, &snapshot{Height: f.height, Evicted: f.evicted, Blocks: blocks}
+}
+
+// trySnapshot write a snapshot in background every Snapshot.Interval blocks
+func (f *TxFilter) trySnapshot(height uint64) {
+	if f.snapshotter == nil || !f.snapshotter.due(height) {
+		return
+	}
+	_, snap := f.snapshotData()
+	f.snapshotter.saveAsync(snap)
 }
@@ -6,11 +6,13 @@ SPDX-License-Identifier: Apache-2.0
 package mapimpl
 
 import (
+	"fmt"
 	"reflect"
-	"sync"
 	"testing"
+	"time"
 
 	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/protocol/v2/test"
 )
 
 func TestInit(t *testing.T) {
@@ -20,7 +22,7 @@ func TestInit(t *testing.T) {
 	}{
 		{
 			name: "test0",
-			want: &TxFilter{m: sync.Map{}},
+			want: &TxFilter{ids: map[string]uint64{}, config: &Config{}},
 		},
 	}
 	for _, tt := range tests {
@@ -169,7 +171,8 @@ func TestTxFilter_Add(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			f := &TxFilter{
 				height: tt.fields.height,
-				m:      sync.Map{},
+				ids:    make(map[string]uint64),
+				config: &Config{},
 			}
 			if err := f.Add(tt.args.txId); (err != nil) != tt.wantErr {
 				t.Errorf("Add() error = %v, wantErr %v", err, tt.wantErr)
@@ -212,7 +215,8 @@ func TestTxFilter_Adds(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			f := &TxFilter{
 				height: tt.fields.height,
-				m:      sync.Map{},
+				ids:    make(map[string]uint64),
+				config: &Config{},
 			}
 			if err := f.Adds(tt.args.txIds); (err != nil) != tt.wantErr {
 				t.Errorf("Adds() error = %v, wantErr %v", err, tt.wantErr)
@@ -248,7 +252,8 @@ func TestTxFilter_IsExists(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			f := &TxFilter{
 				height: tt.fields.height,
-				m:      sync.Map{},
+				ids:    make(map[string]uint64),
+				config: &Config{},
 			}
 			got, err := f.IsExists(tt.args.txId, tt.args.in1...)
 			if (err != nil) != tt.wantErr {
@@ -286,3 +291,82 @@ func TestTxFilter_Close(t *testing.T) {
 		})
 	}
 }
+
+func TestTxFilter_Evict(t *testing.T) {
+	f := New()
+	f.config = &Config{ExpireBlocks: 2}
+	for height := uint64(1); height <= 4; height++ {
+		if err := f.AddsAndSetHeight([]string{fmt.Sprintf("tx%d", height)}, height); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for height, want := range map[int]bool{1: false, 2: false, 3: true, 4: true} {
+		if got, _ := f.IsExists(fmt.Sprintf("tx%d", height)); got != want {
+			t.Errorf("IsExists(tx%d) = %v, want %v", height, got, want)
+		}
+	}
+
+	f = New()
+	f.config = &Config{MaxKeys: 3}
+	if err := f.AddsAndSetHeight([]string{"a", "b"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.AddsAndSetHeight([]string{"c", "d"}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if f.Len() != 2 || !f.evicted {
+		t.Errorf("Len() = %v, evicted = %v, want 2, true", f.Len(), f.evicted)
+	}
+}
+
+func TestTxFilter_EvictByBlockTime(t *testing.T) {
+	f := New()
+	f.config = &Config{ExpireTime: 3600}
+	// blocks of a chase carry their own timestamps, the old ones are not taken as fresh
+	now := time.Now().Unix()
+	for height, timestamp := range []int64{now - 7200, now - 7100, now - 60, now} {
+		if err := f.AddsAndSetHeightWithTimestamp([]string{fmt.Sprintf("tx%d", height+1)}, uint64(height+1),
+			timestamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for height, want := range map[int]bool{1: false, 2: false, 3: true, 4: true} {
+		if got, _ := f.IsExists(fmt.Sprintf("tx%d", height)); got != want {
+			t.Errorf("IsExists(tx%d) = %v, want %v", height, got, want)
+		}
+	}
+}
+
+func TestTxFilter_Snapshot(t *testing.T) {
+	config := SnapshotConfig{Path: t.TempDir(), Interval: 1}
+	f := New()
+	f.log = &test.GoLogger{}
+	f.snapshotter = newSnapshotter(config, "chain1", f.log)
+	for height := uint64(1); height <= 3; height++ {
+		if err := f.AddsAndSetHeight([]string{fmt.Sprintf("tx%d", height)}, height); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+
+	restored := New()
+	restored.log = &test.GoLogger{}
+	restored.snapshotter = newSnapshotter(config, "chain1", restored.log)
+	if err := restored.restore(); err != nil {
+		t.Fatal(err)
+	}
+	if restored.GetHeight() != 3 || restored.Len() != 3 {
+		t.Errorf("restored height = %v, keys = %v, want 3, 3", restored.GetHeight(), restored.Len())
+	}
+	if ok, _ := restored.IsExists("tx2"); !ok {
+		t.Errorf("restored IsExists(tx2) = false, want true")
+	}
+
+	heights, err := restored.snapshotter.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(heights) > snapshotKeep {
+		t.Errorf("snapshot files = %v, want at most %v", len(heights), snapshotKeep)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	bn "chainmaker.org/chainmaker/common/v2/birdsnest"
 	sbn "chainmaker.org/chainmaker/common/v2/shardingbirdsnest"
 	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/config"
 	"chainmaker.org/chainmaker/protocol/v2"
 )
 
@@ -30,6 +31,9 @@ type TxFilter struct {
 	store protocol.BlockchainStore
 	exitC chan struct{}
 	l     sync.RWMutex
+
+	config *common.ShardingBirdsNestConfig
+	filtercommon.LookupCounter
 }
 
 func (f *TxFilter) ValidateRule(txId string, ruleType ...common.RuleType) error {
@@ -62,16 +66,19 @@ func New(config *common.ShardingBirdsNestConfig, log protocol.Logger, store prot
 		}
 	}
 	txFilter := &TxFilter{
-		log:   log,
-		bn:    shardingBirdsNest,
-		exitC: exitC,
-		store: store,
+		log:    log,
+		bn:     shardingBirdsNest,
+		exitC:  exitC,
+		store:  store,
+		config: config,
 	}
 	shardingBirdsNest.Start()
 
 	// Chase block height
 	err = filtercommon.ChaseBlockHeight(store, txFilter, log)
 	if err != nil {
+		// stop the goroutines started above
+		txFilter.Close()
 		return nil, err
 	}
 	log.Infof("shading filter init success, sharding: %v, birdsnest: %v max keys: %v, cost: %v", config.Length,
@@ -180,9 +187,11 @@ func (f *TxFilter) AddsAndSetHeight(txIds []string, height uint64) error {
 // IsExists Check whether TxId exists in the transaction filter
 func (f *TxFilter) IsExists(txId string, ruleType ...common.RuleType) (bool, error) {
 	start := time.Now()
+	f.IncLookup()
 	key, err := bn.ToTimestampKey(txId)
 	if err != nil {
 		var exists bool
+		f.IncStoreFallback()
 		exists, err = f.store.TxExists(txId)
 		if err != nil {
 			f.log.Errorf("filter check exists, query from db fail, normal txid: %v, error:%v", txId, err)
@@ -199,11 +208,15 @@ func (f *TxFilter) IsExists(txId string, ruleType ...common.RuleType) (bool, err
 	}
 
 	if contains {
+		f.IncStoreFallback()
 		exists, err := f.store.TxExists(txId)
 		if err != nil {
 			f.log.Errorf("filter check exists, query from db fail, txid: %v, error: %v", txId, err)
 			return false, err
 		}
+		if !exists {
+			f.IncFalsePositive()
+		}
 		// true or false positive
 		f.log.DebugDynamic(filtercommon.LoggingFixLengthFunc("filter check exists, %v positive txid: %v, "+
 			"cost: %v", exists, txId, time.Since(start)))
@@ -215,6 +228,51 @@ func (f *TxFilter) IsExists(txId string, ruleType ...common.RuleType) (bool, err
 	return contains, nil
 }
 
+// Stats get the statistics of the filter and its shards, implements filtercommon.StatsProvider
+func (f *TxFilter) Stats() *filtercommon.Stats {
+	stats := &filtercommon.Stats{
+		Type:        config.TxFilterType_ShardingBirdsNest.String(),
+		Height:      f.GetHeight(),
+		LookupStats: f.LookupStats(),
+	}
+	var (
+		shardCapacity uint64
+		cuckoo        *common.CuckooConfig
+	)
+	if f.config != nil && f.config.Birdsnest != nil && f.config.Birdsnest.Cuckoo != nil {
+		cuckoo = f.config.Birdsnest.Cuckoo
+		shardCapacity = uint64(f.config.Birdsnest.Length) * uint64(cuckoo.MaxNumKeys)
+	}
+	// index 3 total keys, index 4 total space occupied by cuckoo of every shard
+	for i, info := range f.bn.Infos() {
+		shard := &filtercommon.ShardStats{Index: i, Capacity: shardCapacity}
+		if len(info) > 4 {
+			shard.Keys = info[3]
+			shard.Bytes = info[4]
+		}
+		shard.FillRatio = filtercommon.FillRatio(shard.Keys, shard.Capacity)
+		stats.Shards = append(stats.Shards, shard)
+		stats.Keys += shard.Keys
+		stats.Bytes += shard.Bytes
+		stats.Capacity += shard.Capacity
+	}
+	stats.FillRatio = filtercommon.FillRatio(stats.Keys, stats.Capacity)
+	if cuckoo != nil {
+		// a key is only looked up in its own shard, so the shards share the rate of the average fill
+		stats.EstimatedFalsePositiveRate = filtercommon.CuckooFalsePositiveRate(f.config.Birdsnest.Length,
+			cuckoo.TagsPerBucket, cuckoo.BitsPerItem, stats.FillRatio)
+	}
+	return stats
+}
+
+// Checkpoint serialize the sharding bird's nest synchronously, implements filtercommon.Checkpointer so that an
+// interrupted chase resumes from the checkpoint height
+func (f *TxFilter) Checkpoint() error {
+	f.l.Lock()
+	defer f.l.Unlock()
+	return f.bn.Serialize()
+}
+
 // Close transaction filter
 func (f *TxFilter) Close() {
 	close(f.exitC)
@@ -263,6 +263,26 @@ func TestTxFilter_Close(t *testing.T) {
 	}
 }
 
+func TestTxFilter_Checkpoint(t *testing.T) {
+	nest, err := sbn.NewShardingBirdsNest(GetTestDefaultConfig(TestDir, 1), make(chan struct{}), bn.LruStrategy,
+		sbn.NewModuloSA(10), bn.TestLogger{T: t})
+	if err != nil {
+		t.Fatalf("init error %v", err)
+	}
+	f := &TxFilter{
+		log:   TestLogger{T: t},
+		bn:    nest,
+		store: mock.NewMockBlockchainStore(gomock.NewController(t)),
+		exitC: make(chan struct{}),
+	}
+	if err = f.AddsAndSetHeight([]string{utils.GetTimestampTxId()}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Checkpoint(); err != nil {
+		t.Errorf("Checkpoint() error = %v", err)
+	}
+}
+
 func TestTxFilter_GetHeight(t *testing.T) {
 	ctrl := gomock.NewController(t)
 
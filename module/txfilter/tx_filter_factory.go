@@ -44,7 +44,12 @@ func (cf *txFilterFactory) NewTxFilter(conf *config.TxFilterConfig, log protocol
 	case config.TxFilterType_BirdsNest:
 		return birdnest.New(conf.BirdsNest, log, store)
 	case config.TxFilterType_Map:
-		return mapimpl.New(), nil
+		mapConf, err := mapimpl.LoadConfig()
+		if err != nil {
+			log.Warnf("load map txfilter conf fail, use unbounded map without snapshot, error: %v", err)
+			mapConf = &mapimpl.Config{}
+		}
+		return mapimpl.NewWithConfig(mapConf, log, store)
 	case config.TxFilterType_ShardingBirdsNest:
 		return shardingbirdsnest.New(conf.ShardingBirdsNest, log, store)
 	default:
@@ -106,7 +106,11 @@ func Test_txFilterFactory_NewTxFilter(t *testing.T) {
 				store: store,
 			},
 			want: func() protocol.TxFilter {
-				txFilter := mapimpl.New()
+				txFilter, err := mapimpl.NewWithConfig(&mapimpl.Config{}, log, store)
+				if err != nil {
+					t.Log(err)
+					return nil
+				}
 				return txFilter
 			}(),
 			wantErr: false,
@@ -158,7 +162,7 @@ func Test_txFilterFactory_NewTxFilter(t *testing.T) {
 				return
 			}
 
-			if tt.name == "test2" || tt.name == "test4" {
+			if tt.name == "test2" || tt.name == "test3" || tt.name == "test4" {
 				if !reflect.DeepEqual(got.GetHeight(), tt.want.GetHeight()) {
 					t.Errorf("NewTxFilter() got = %v, want %v", got, tt.want)
 				}
@@ -8,19 +8,28 @@ package archive
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
-	"gorm.io/gorm"
 
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db"
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db/fs"
 	"chainmaker.org/chainmaker-go/tools/cmc/archive/db/mysql"
-	"chainmaker.org/chainmaker-go/tools/cmc/archive/model"
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db/sqlite"
 	"chainmaker.org/chainmaker-go/tools/cmc/util"
+	"chainmaker.org/chainmaker/pb-go/v2/store"
 )
 
 const (
-	defaultDbType                 = "mysql"
+	// off-chain storage types
+	dbTypeMysql  = "mysql"
+	dbTypeSqlite = "sqlite"
+	dbTypeFs     = "fs"
+
+	defaultDbType                 = dbTypeMysql
 	configBlockArchiveErrorString = "config block do not need archive"
 )
 
@@ -36,6 +45,13 @@ var (
 	blocks                  uint64
 	secretKey               string
 	restoreStartBlockHeight uint64
+	verifyEndBlockHeight    uint64
+	repair                  bool
+	repairSdkConfPath       string
+	retainBlocks            uint64
+	retainDays              uint64
+	daemonInterval          time.Duration
+	metricsAddr             string
 )
 
 const (
@@ -44,9 +60,9 @@ const (
 	flagChainId     = "chain-id"
 
 	//// Archive flags
-	// Off-chain database type. eg. mysql,mongodb,pgsql
+	// Off-chain storage type. eg. mysql,sqlite,fs
 	flagDbType = "type"
-	// Off-chain database destination. eg. user:password:localhost:port
+	// Off-chain storage destination. eg. user:password:localhost:port for mysql, a directory for sqlite and fs
 	flagDbDest = "dest"
 	// 1.Archive target block height, stop archiving (include this block) after reaching this height.
 	// 2.Archive target date, archive all blocks before this date.
@@ -55,8 +71,22 @@ const (
 	flagBlocks = "blocks"
 	// Secret Key for calc Hmac
 	flagSecretKey = "secret-key"
-	// block height of restore
+	// block height of restore, or the first block height of verify
 	flagStartBlockHeight = "start-block-height"
+	// the last block height of verify
+	flagEndBlockHeight = "end-block-height"
+	// Re-fetch the damaged blocks found by verify
+	flagRepair = "repair"
+	// sdk config file path of the node to re-fetch the damaged blocks from
+	flagRepairSdkConfPath = "repair-sdk-conf-path"
+	// Number of the latest blocks kept on-chain by the daemon
+	flagRetainBlocks = "retain-blocks"
+	// Days of the latest blocks kept on-chain by the daemon
+	flagRetainDays = "retain-days"
+	// Interval between the archiving rounds of the daemon
+	flagInterval = "interval"
+	// Listen address of the prometheus metrics of the daemon
+	flagMetricsAddr = "metrics-addr"
 )
 
 func NewArchiveCMD() *cobra.Command {
@@ -69,6 +99,8 @@ func NewArchiveCMD() *cobra.Command {
 	cmd.AddCommand(newDumpCMD())
 	cmd.AddCommand(newRestoreCMD())
 	cmd.AddCommand(newQueryOffChainCMD())
+	cmd.AddCommand(newVerifyCMD())
+	cmd.AddCommand(newDaemonCMD())
 
 	return cmd
 }
@@ -80,37 +112,64 @@ func init() {
 
 	flags.StringVar(&chainId, flagChainId, "", "Chain ID")
 	flags.StringVar(&sdkConfPath, flagSdkConfPath, "", "specify sdk config path")
-	flags.StringVar(&dbType, flagDbType, "mysql", "Database type. eg. mysql")
-	flags.StringVar(&dbDest, flagDbDest, "", "Database destination. eg. user:password:localhost:port")
+	flags.StringVar(&dbType, flagDbType, defaultDbType, "Off-chain storage type. eg. mysql, sqlite, fs")
+	flags.StringVar(&dbDest, flagDbDest, "", "Off-chain storage destination."+
+		" eg. user:password:localhost:port (mysql) or a directory (sqlite, fs)")
 	flags.StringVar(&target, flagTarget, "", "Height or Date of the target block for this archive task."+
 		" eg."+
 		" 100 (block height) or \"2006-01-02 15:04:05\" (date)")
 	flags.Uint64Var(&blocks, flagBlocks, 1000, "Number of blocks to be archived this time")
 	flags.StringVar(&secretKey, flagSecretKey, "", "Secret Key for calc Hmac")
-	flags.Uint64Var(&restoreStartBlockHeight, flagStartBlockHeight, 0, "Restore starting block height")
+	flags.Uint64Var(&restoreStartBlockHeight, flagStartBlockHeight, 0, "Restore or verify starting block height")
+	flags.Uint64Var(&verifyEndBlockHeight, flagEndBlockHeight, 0,
+		"Verify ending block height, default is the archived block height off-chain")
+	flags.BoolVar(&repair, flagRepair, false, "Re-fetch the damaged blocks found by verify from a node")
+	flags.StringVar(&repairSdkConfPath, flagRepairSdkConfPath, "",
+		"sdk config path of the node which still has the damaged blocks, default is --sdk-conf-path")
+	flags.Uint64Var(&retainBlocks, flagRetainBlocks, 0, "Number of the latest blocks kept on-chain by the daemon")
+	flags.Uint64Var(&retainDays, flagRetainDays, 0, "Days of the latest blocks kept on-chain by the daemon")
+	flags.DurationVar(&daemonInterval, flagInterval, time.Minute, "Interval between the archiving rounds of the daemon")
+	flags.StringVar(&metricsAddr, flagMetricsAddr, "",
+		"Listen address of the prometheus metrics of the daemon, eg. :9100, disabled if empty")
 }
 
-// initDb Connecting database, migrate tables.
-func initDb() (*gorm.DB, error) {
-	// parse params
-	dbName := model.DbName(chainId)
-	dbDestSlice := strings.Split(dbDest, ":")
-	if len(dbDestSlice) != 4 {
-		return nil, errors.New("invalid database destination")
+// initDb Open the off-chain storage selected by --type, the tables or files are created if not exist.
+func initDb() (db.Store, error) {
+	switch dbType {
+	case dbTypeMysql:
+		dbDestSlice := strings.Split(dbDest, ":")
+		if len(dbDestSlice) != 4 {
+			return nil, errors.New("invalid database destination")
+		}
+		return mysql.NewStore(dbDestSlice[0], dbDestSlice[1], dbDestSlice[2], dbDestSlice[3], chainId)
+	case dbTypeSqlite:
+		return sqlite.NewStore(dbDest, chainId)
+	case dbTypeFs:
+		return fs.NewStore(dbDest, chainId)
+	default:
+		return nil, fmt.Errorf("unsupport database type %s", dbType)
 	}
+}
 
-	// initialize database
-	db, err := mysql.InitDb(dbDestSlice[0], dbDestSlice[1], dbDestSlice[2], dbDestSlice[3], dbName, true)
+// newBlockInfo build the off-chain block info of the block fetched from the chain
+func newBlockInfo(blkWithRWSet *store.BlockWithRWSet, isArchived bool) (*db.BlockInfo, error) {
+	blkWithRWSetBytes, err := blkWithRWSet.Marshal()
 	if err != nil {
 		return nil, err
 	}
 
-	// migrate sysinfo table
-	err = db.AutoMigrate(&model.Sysinfo{})
+	sum, err := hmac(chainId, blkWithRWSet.Block.Header.BlockHeight, blkWithRWSetBytes, secretKey)
 	if err != nil {
 		return nil, err
 	}
-	return db, nil
+
+	return &db.BlockInfo{
+		ChainId:        chainId,
+		BlockHeight:    blkWithRWSet.Block.Header.BlockHeight,
+		BlockWithRWSet: blkWithRWSetBytes,
+		Hmac:           sum,
+		IsArchived:     isArchived,
+	}, nil
 }
 
 // hmac SM3(Fchain_id+Fblock_height+Fblock_with_rwset+key)
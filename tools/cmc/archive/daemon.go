@@ -0,0 +1,314 @@
+// Copyright (C) BABEC. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db"
+	"chainmaker.org/chainmaker-go/tools/cmc/util"
+	sdk "chainmaker.org/chainmaker/sdk-go/v2"
+)
+
+const (
+	metricsNamespace = "cmc"
+	metricsSubsystem = "archive"
+)
+
+func newDaemonCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "dump blockchain data continuously",
+		Long: "follow the chain tip and dump the blocks out of the retention window (--retain-blocks or " +
+			"--retain-days) to off-chain storage every --interval, until SIGINT or SIGTERM",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDaemonCMD()
+		},
+	}
+
+	util.AttachAndRequiredFlags(cmd, flags, []string{
+		flagSdkConfPath, flagChainId, flagDbType, flagDbDest, flagSecretKey,
+	})
+	util.AttachFlags(cmd, flags, []string{
+		flagRetainBlocks, flagRetainDays, flagInterval, flagBlocks, flagMetricsAddr,
+	})
+
+	return cmd
+}
+
+// runDaemonCMD `daemon` command implementation
+func runDaemonCMD() error {
+	if retainBlocks == 0 && retainDays == 0 {
+		return fmt.Errorf("required --%s or --%s", flagRetainBlocks, flagRetainDays)
+	}
+	if daemonInterval <= 0 {
+		return fmt.Errorf("invalid --%s %s", flagInterval, daemonInterval)
+	}
+
+	//// 1.Chain Client
+	cc, err := util.CreateChainClient(sdkConfPath, chainId, "", "", "", "", "")
+	if err != nil {
+		return err
+	}
+	defer cc.Stop()
+
+	//// 2.Metrics
+	metrics := newDaemonMetrics()
+	if metricsAddr != "" {
+		server, err := startMetricsServer(metrics)
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+	}
+
+	//// 3.Database
+	archiveDb, err := initDb()
+	if err != nil {
+		return err
+	}
+	defer archiveDb.Close()
+	locker := archiveDb.NewLocker("cmc")
+	locker.Lock()
+	defer locker.UnLock()
+
+	//// 4.Archive Rounds
+	// the batch in progress is finished after the exit signal, so the archived block heights stay consistent
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go handleExitSignal(cancel)
+
+	log.Printf("archive daemon of chain %s started, retain blocks: %d, retain days: %d, interval: %s\n",
+		chainId, retainBlocks, retainDays, daemonInterval)
+	for {
+		if err := runDaemonRound(ctx, cc, archiveDb, metrics); err != nil {
+			metrics.errors.Inc()
+			log.Printf("Warning: archive round failed, %s\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("archive daemon of chain %s stopped\n", chainId)
+			return nil
+		case <-time.After(daemonInterval):
+		}
+	}
+}
+
+// runDaemonRound archive the blocks out of the retention window, at most --blocks blocks per round
+func runDaemonRound(ctx context.Context, cc *sdk.ChainClient, archiveDb db.Store, metrics *daemonMetrics) error {
+	archivedBlkHeightOnChain, err := cc.GetArchivedBlockHeight()
+	if err != nil {
+		return err
+	}
+	archivedBlkHeightOffChain, err := reconcileArchivedHeight(archiveDb, archivedBlkHeightOnChain)
+	if err != nil {
+		return err
+	}
+	metrics.archivedHeightOnChain.Set(float64(archivedBlkHeightOnChain))
+	metrics.archivedHeightOffChain.Set(float64(archivedBlkHeightOffChain))
+	if archivedBlkHeightOffChain != archivedBlkHeightOnChain {
+		return errors.New("required archived block height off-chain == archived block height on-chain")
+	}
+
+	currentBlkHeightOnChain, err := cc.GetCurrentBlockHeight()
+	if err != nil {
+		return err
+	}
+	targetBlkHeight, err := calcRetentionTarget(currentBlkHeightOnChain)
+	if err != nil {
+		return err
+	}
+	metrics.currentHeight.Set(float64(currentBlkHeightOnChain))
+	metrics.targetHeight.Set(float64(targetBlkHeight))
+
+	if targetBlkHeight <= archivedBlkHeightOnChain {
+		return nil
+	}
+	if blocks > 0 && targetBlkHeight-archivedBlkHeightOnChain > blocks {
+		targetBlkHeight = archivedBlkHeightOnChain + blocks
+	}
+	return archiveToHeight(ctx, cc, archiveDb, archivedBlkHeightOnChain, targetBlkHeight, metrics)
+}
+
+// calcRetentionTarget returns the highest block height out of the retention window, the smaller one if both
+// --retain-blocks and --retain-days are set
+func calcRetentionTarget(currentBlkHeight uint64) (uint64, error) {
+	var targetBlkHeight = currentBlkHeight
+	if retainBlocks > 0 {
+		if currentBlkHeight <= retainBlocks {
+			return 0, nil
+		}
+		targetBlkHeight = currentBlkHeight - retainBlocks
+	}
+
+	if retainDays > 0 {
+		height, err := calcTargetHeightByTime(time.Now().AddDate(0, 0, -int(retainDays)))
+		if errors.Is(err, errNoBlocksAtTime) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if height < targetBlkHeight {
+			targetBlkHeight = height
+		}
+	}
+	return targetBlkHeight, nil
+}
+
+// archiveToHeight archive the blocks after archivedBlkHeight up to targetBlkHeight (include) in batches,
+// it returns between the batches once ctx is done
+func archiveToHeight(ctx context.Context, cc archiveClient, archiveDb db.Store, archivedBlkHeight,
+	targetBlkHeight uint64, metrics *daemonMetrics) error {
+	var batchStartBlkHeight = archivedBlkHeight + 1
+	if archivedBlkHeight == 0 {
+		batchStartBlkHeight = 0
+	}
+	var batchEndBlkHeight = batchStartBlkHeight + blocksPerBatch
+	if batchEndBlkHeight > targetBlkHeight+1 {
+		batchEndBlkHeight = targetBlkHeight + 1
+	}
+
+	for batchStartBlkHeight <= targetBlkHeight {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		start := time.Now()
+		err := runBatch(cc, archiveDb, batchStartBlkHeight, batchEndBlkHeight)
+		switch {
+		case err == nil:
+			metrics.observeBatch(batchEndBlkHeight-batchStartBlkHeight, batchEndBlkHeight-1, time.Since(start))
+			batchStartBlkHeight = batchEndBlkHeight
+			batchEndBlkHeight = batchStartBlkHeight + blocksPerBatch
+			if batchEndBlkHeight > targetBlkHeight+1 {
+				batchEndBlkHeight = targetBlkHeight + 1
+			}
+		case !strings.Contains(err.Error(), configBlockArchiveErrorString):
+			return err
+		case batchEndBlkHeight <= targetBlkHeight:
+			// the last block of the batch is a config block, archive it with the next block
+			batchEndBlkHeight++
+		default:
+			// the target block is a config block, archive it in the next round
+			return nil
+		}
+	}
+	return nil
+}
+
+// handleExitSignal cancel the daemon on SIGINT or SIGTERM
+func handleExitSignal(cancel context.CancelFunc) {
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGTERM, os.Interrupt, syscall.SIGINT)
+	defer signal.Stop(signalChan)
+
+	<-signalChan
+	log.Println("stopping archive daemon, waiting for the batch in progress ...")
+	cancel()
+}
+
+// daemonMetrics The prometheus metrics of the daemon, labeled by the chain id
+type daemonMetrics struct {
+	registry *prometheus.Registry
+
+	currentHeight          prometheus.Gauge
+	targetHeight           prometheus.Gauge
+	archivedHeightOnChain  prometheus.Gauge
+	archivedHeightOffChain prometheus.Gauge
+	lastBatchTime          prometheus.Gauge
+	archivedBlocks         prometheus.Counter
+	errors                 prometheus.Counter
+	batchDuration          prometheus.Histogram
+}
+
+func newDaemonMetrics() *daemonMetrics {
+	newGauge := func(name, help string) prometheus.Gauge {
+		return prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   metricsSubsystem,
+			Name:        name,
+			Help:        help,
+			ConstLabels: prometheus.Labels{"chain_id": chainId},
+		})
+	}
+	newCounter := func(name, help string) prometheus.Counter {
+		return prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   metricsSubsystem,
+			Name:        name,
+			Help:        help,
+			ConstLabels: prometheus.Labels{"chain_id": chainId},
+		})
+	}
+
+	m := &daemonMetrics{
+		registry:               prometheus.NewRegistry(),
+		currentHeight:          newGauge("current_block_height", "current block height on-chain"),
+		targetHeight:           newGauge("target_block_height", "highest block height out of the retention window"),
+		archivedHeightOnChain:  newGauge("archived_block_height_on_chain", "archived block height on-chain"),
+		archivedHeightOffChain: newGauge("archived_block_height_off_chain", "archived block height off-chain"),
+		lastBatchTime:          newGauge("last_batch_timestamp_seconds", "unix time of the last archived batch"),
+		archivedBlocks:         newCounter("archived_blocks_total", "number of blocks archived by the daemon"),
+		errors:                 newCounter("round_errors_total", "number of the failed archive rounds"),
+		batchDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   metricsNamespace,
+			Subsystem:   metricsSubsystem,
+			Name:        "batch_duration_seconds",
+			Help:        "time to archive a batch of blocks",
+			ConstLabels: prometheus.Labels{"chain_id": chainId},
+			Buckets:     prometheus.ExponentialBuckets(0.1, 2, 10),
+		}),
+	}
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.currentHeight, m.targetHeight, m.archivedHeightOnChain, m.archivedHeightOffChain,
+		m.lastBatchTime, m.archivedBlocks, m.errors, m.batchDuration,
+	)
+	return m
+}
+
+func (m *daemonMetrics) observeBatch(archivedBlocks, archivedBlkHeight uint64, elapsed time.Duration) {
+	m.archivedBlocks.Add(float64(archivedBlocks))
+	m.archivedHeightOnChain.Set(float64(archivedBlkHeight))
+	m.archivedHeightOffChain.Set(float64(archivedBlkHeight))
+	m.lastBatchTime.SetToCurrentTime()
+	m.batchDuration.Observe(elapsed.Seconds())
+}
+
+// startMetricsServer serve /metrics on --metrics-addr
+func startMetricsServer(metrics *daemonMetrics) (*http.Server, error) {
+	conn, err := net.Listen("tcp", metricsAddr)
+	if err != nil {
+		return nil, fmt.Errorf("TCP listen failed, %s", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(conn); err != nil && err != http.ErrServerClosed {
+			log.Printf("metrics http serve failed, %s\n", err)
+		}
+	}()
+	log.Printf("metrics http server listen on %s\n", metricsAddr)
+	return server, nil
+}
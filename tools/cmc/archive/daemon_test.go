@@ -0,0 +1,162 @@
+// Copyright (C) BABEC. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package archive
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+)
+
+const testArchiveHeightKey = "BLOCK_HEIGHT"
+
+// fakeArchiveClient The chain of the batches, the archive of a config block is rejected as the node does
+type fakeArchiveClient struct {
+	fakeBlockFetcher
+	configBlocks   map[uint64]bool
+	archivedHeight uint64
+	// onArchived is called after a block is archived on-chain
+	onArchived func(height uint64)
+}
+
+// newFakeArchiveClient the client of a chain of n blocks, none of them is archived
+func newFakeArchiveClient(t *testing.T, n uint64) *fakeArchiveClient {
+	fetcher := make(fakeBlockFetcher)
+	for _, blkWithRWSet := range newTestChain(t, n) {
+		fetcher[blkWithRWSet.Block.Header.BlockHeight] = blkWithRWSet
+	}
+	return &fakeArchiveClient{fakeBlockFetcher: fetcher, configBlocks: make(map[uint64]bool)}
+}
+
+func (c *fakeArchiveClient) CreateArchiveBlockPayload(targetBlockHeight uint64) (*common.Payload, error) {
+	return &common.Payload{ChainId: chainId, TxType: common.TxType_ARCHIVE, Parameters: []*common.KeyValuePair{
+		{Key: testArchiveHeightKey, Value: []byte(strconv.FormatUint(targetBlockHeight, 10))},
+	}}, nil
+}
+
+func (c *fakeArchiveClient) SignArchivePayload(payload *common.Payload) (*common.Payload, error) {
+	return payload, nil
+}
+
+func (c *fakeArchiveClient) SendArchiveBlockRequest(payload *common.Payload, timeout int64) (
+	*common.TxResponse, error) {
+	height, err := strconv.ParseUint(string(payload.Parameters[0].Value), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if c.configBlocks[height] {
+		return &common.TxResponse{Code: common.TxStatusCode_INTERNAL_ERROR,
+			Message: configBlockArchiveErrorString}, nil
+	}
+	c.archivedHeight = height
+	if c.onArchived != nil {
+		c.onArchived(height)
+	}
+	return &common.TxResponse{Code: common.TxStatusCode_SUCCESS}, nil
+}
+
+// requireArchivedHeight check the archived block height on-chain and off-chain
+func requireArchivedHeight(t *testing.T, cc *fakeArchiveClient, archiveDb db.Store, height uint64) {
+	require.Equal(t, height, cc.archivedHeight)
+	archivedBlkHeight, err := archiveDb.GetArchivedBlockHeight()
+	require.NoError(t, err)
+	require.Equal(t, height, archivedBlkHeight)
+}
+
+func TestCalcRetentionTargetByBlocks(t *testing.T) {
+	retainBlocks, retainDays = 100, 0
+	defer func() { retainBlocks = 0 }()
+
+	height, err := calcRetentionTarget(50)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, height)
+
+	height, err = calcRetentionTarget(1000)
+	require.NoError(t, err)
+	require.EqualValues(t, 900, height)
+}
+
+func TestArchiveToHeightCanceled(t *testing.T) {
+	archiveDb := newTestFsStore(t)
+	cc := newFakeArchiveClient(t, 3*blocksPerBatch)
+	metrics := newDaemonMetrics()
+
+	// canceled during the first batch, which is completed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cc.onArchived = func(uint64) { cancel() }
+	require.NoError(t, archiveToHeight(ctx, cc, archiveDb, 0, 3*blocksPerBatch-1, metrics))
+	requireArchivedHeight(t, cc, archiveDb, blocksPerBatch-1)
+	_, err := archiveDb.GetBlockInfo(blocksPerBatch)
+	require.Equal(t, db.ErrBlockNotFound, err)
+
+	// the next round continues from the archived block height
+	cc.onArchived = nil
+	require.NoError(t, archiveToHeight(context.Background(), cc, archiveDb, blocksPerBatch-1,
+		3*blocksPerBatch-1, metrics))
+	requireArchivedHeight(t, cc, archiveDb, 3*blocksPerBatch-1)
+	for height := uint64(0); height < 3*blocksPerBatch; height++ {
+		bInfo, err := archiveDb.GetBlockInfo(height)
+		require.NoError(t, err)
+		require.True(t, bInfo.IsArchived)
+	}
+}
+
+func TestArchiveToHeightConfigBlock(t *testing.T) {
+	archiveDb := newTestFsStore(t)
+	cc := newFakeArchiveClient(t, 3*blocksPerBatch)
+	metrics := newDaemonMetrics()
+
+	// the last block of the first batch is a config block, the batch is extended to the next block. The
+	// target block is a config block too, it is left to the next round
+	cc.configBlocks[blocksPerBatch-1] = true
+	cc.configBlocks[2*blocksPerBatch] = true
+	require.NoError(t, archiveToHeight(context.Background(), cc, archiveDb, 0, 2*blocksPerBatch, metrics))
+	requireArchivedHeight(t, cc, archiveDb, blocksPerBatch)
+
+	// the next round archives the config block with the block after it
+	require.NoError(t, archiveToHeight(context.Background(), cc, archiveDb, blocksPerBatch,
+		2*blocksPerBatch+1, metrics))
+	requireArchivedHeight(t, cc, archiveDb, 2*blocksPerBatch+1)
+}
+
+func TestReconcileArchivedHeight(t *testing.T) {
+	archiveDb := newTestFsStore(t)
+	cc := newFakeArchiveClient(t, 10)
+
+	height, err := reconcileArchivedHeight(archiveDb, 0)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, height)
+
+	// the batch is interrupted after archiving on-chain, before the archived block height off-chain is updated
+	require.NoError(t, storeBlocks(cc, archiveDb, 0, 5))
+	require.NoError(t, archiveBlockOnChain(cc, 4))
+	height, err = reconcileArchivedHeight(archiveDb, cc.archivedHeight)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, height)
+	requireArchivedHeight(t, cc, archiveDb, 4)
+
+	// the archived block height off-chain is kept if the one on-chain is not ahead
+	height, err = reconcileArchivedHeight(archiveDb, 3)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, height)
+
+	// the blocks archived on-chain must be stored off-chain and not restored
+	_, err = reconcileArchivedHeight(archiveDb, 6)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "block[5] archived on-chain is not stored off-chain"), err.Error())
+	putTestBlockInfos(t, archiveDb, 4, newTestBlockInfo(t, cc.fakeBlockFetcher[5], false),
+		newTestBlockInfo(t, cc.fakeBlockFetcher[6], true))
+	_, err = reconcileArchivedHeight(archiveDb, 6)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "block[5] archived on-chain is restored off-chain"), err.Error())
+	requireArchivedHeight(t, cc, archiveDb, 4)
+}
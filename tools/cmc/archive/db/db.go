@@ -0,0 +1,54 @@
+// Copyright (C) BABEC. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package db defines the off-chain storage of the archived blocks, which is implemented by the backends
+// in the sub packages and selected by `cmc archive --type`.
+package db
+
+import (
+	"errors"
+)
+
+// ErrBlockNotFound the block is not in the off-chain storage
+var ErrBlockNotFound = errors.New("block not found in off-chain storage")
+
+// BlockInfo A block stored off-chain
+type BlockInfo struct {
+	ChainId        string
+	BlockHeight    uint64
+	BlockWithRWSet []byte // marshaled store.BlockWithRWSet
+	Hmac           string
+	IsArchived     bool // false after the block is restored to the chain
+}
+
+// Locker Excludes the other cmc processes from the storage, the lock is held by a lease which is refreshed
+// until UnLock, so it is released if the holder dies
+type Locker interface {
+	Lock()
+	UnLock()
+}
+
+// Tx The writes of a dump or restore batch, none of them is visible until Commit
+type Tx interface {
+	// PutBlockInfo inserts the block, or overwrites the block of the same height
+	PutBlockInfo(info *BlockInfo) error
+	// UpdateArchivedBlockHeight records the archived block height off-chain
+	UpdateArchivedBlockHeight(height uint64) error
+	Commit() error
+	// Rollback discards the writes, it does nothing after Commit
+	Rollback() error
+}
+
+// Store The off-chain storage of the archived blocks of one chain
+type Store interface {
+	// GetBlockInfo returns the block of height whether it is archived or restored, ErrBlockNotFound if
+	// it is not stored
+	GetBlockInfo(height uint64) (*BlockInfo, error)
+	// GetArchivedBlockHeight returns the archived block height recorded off-chain, 0 if nothing is archived
+	GetArchivedBlockHeight() (uint64, error)
+	Begin() (Tx, error)
+	// NewLocker returns the lock of the storage held by holder
+	NewLocker(holder string) Locker
+	Close() error
+}
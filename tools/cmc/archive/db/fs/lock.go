@@ -0,0 +1,98 @@
+// Copyright (C) BABEC. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fs
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db"
+)
+
+const DefaultLockLeaseAge = 10 * time.Second
+
+var _ db.Locker = (*fileLocker)(nil)
+
+// fileLocker The lock is held by creating the lock file, its modify time is the lease which is refreshed
+// by the holder, so the lock file left by a dead holder expires
+type fileLocker struct {
+	path     string
+	stopCh   chan struct{}
+	holder   string
+	leaseAge time.Duration
+}
+
+// NewFileLocker returns the lock held by creating the file at path
+func NewFileLocker(path, holder string, lease time.Duration) db.Locker {
+	return &fileLocker{
+		path:     path,
+		stopCh:   make(chan struct{}),
+		holder:   holder,
+		leaseAge: lease,
+	}
+}
+
+func (locker *fileLocker) Lock() {
+	for {
+		locker.cleanExpired()
+
+		f, err := os.OpenFile(locker.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			_, err = f.WriteString(locker.holder)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				break
+			}
+			_ = os.Remove(locker.path)
+		}
+		log.Printf("%s\ntry lock %s, wait %f seconds ...", err, locker.path, locker.leaseAge.Seconds())
+		time.Sleep(locker.leaseAge)
+	}
+
+	locker.startLease()
+}
+
+func (locker *fileLocker) UnLock() {
+	locker.stopLease()
+	if err := os.Remove(locker.path); err != nil {
+		log.Printf("remove lock file err: %s\n", err)
+	}
+}
+
+func (locker *fileLocker) cleanExpired() {
+	info, err := os.Stat(locker.path)
+	if err != nil {
+		return
+	}
+	if time.Since(info.ModTime()) > locker.leaseAge {
+		_ = os.Remove(locker.path)
+	}
+}
+
+func (locker *fileLocker) startLease() {
+	go func() {
+		// Refresh the lease when time elapses 3/4 of the locker.leaseAge
+		ticker := time.NewTicker(locker.leaseAge * 3 / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				now := time.Now()
+				if err := os.Chtimes(locker.path, now, now); err != nil {
+					log.Printf("refreash lease err: %s\n", err)
+				}
+			case <-locker.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (locker *fileLocker) stopLease() {
+	close(locker.stopCh)
+}
@@ -0,0 +1,309 @@
+// Copyright (C) BABEC. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package fs stores the archived blocks in the local file system.
+//
+// The blocks of a committed batch are written to one segment file which is named by the sha256 of its
+// content, so a segment is never modified once written. The index of the blocks is an append-only log
+// of json lines, each line is a committed batch, which is replayed when the store is opened. The line
+// torn by a crash is dropped, so a batch is either committed as a whole or not at all.
+package fs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db"
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/model"
+)
+
+const (
+	segmentsDir   = "segments"
+	segmentSuffix = ".seg"
+	indexFileName = "index.log"
+	lockFileName  = "LOCK"
+)
+
+var _ db.Store = (*store)(nil)
+
+var errTxDone = errors.New("transaction has already been committed or rolled back")
+
+// indexEntry Where the block is stored and its metadata
+type indexEntry struct {
+	BlockHeight uint64 `json:"height"`
+	ChainId     string `json:"chain_id"`
+	Segment     string `json:"segment"` // sha256 of the segment in hex, the name of the segment file
+	Offset      int64  `json:"offset"`
+	Length      int64  `json:"length"`
+	Sha256      string `json:"sha256"` // sha256 of the block in hex, checked when the block is read
+	Hmac        string `json:"hmac"`
+	IsArchived  bool   `json:"archived"`
+}
+
+// indexRecord A committed batch, one line of the index log
+type indexRecord struct {
+	Blocks         []*indexEntry `json:"blocks,omitempty"`
+	ArchivedHeight *uint64       `json:"archived_height,omitempty"`
+}
+
+type store struct {
+	dir string
+
+	mu             sync.RWMutex
+	index          map[uint64]*indexEntry
+	archivedHeight uint64
+	indexFile      *os.File // opened for appending
+}
+
+// NewStore Open the store of the chain under the directory dest, it is created if not exists
+func NewStore(dest, chainId string) (db.Store, error) {
+	dir := filepath.Join(dest, model.DbName(chainId))
+	if err := os.MkdirAll(filepath.Join(dir, segmentsDir), 0700); err != nil {
+		return nil, err
+	}
+
+	s := &store{
+		dir:   dir,
+		index: make(map[uint64]*indexEntry),
+	}
+	if err := s.loadIndex(); err != nil {
+		return nil, err
+	}
+	indexFile, err := os.OpenFile(s.indexPath(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s.indexFile = indexFile
+	return s, nil
+}
+
+func (s *store) indexPath() string {
+	return filepath.Join(s.dir, indexFileName)
+}
+
+func (s *store) segmentPath(segment string) string {
+	return filepath.Join(s.dir, segmentsDir, segment+segmentSuffix)
+}
+
+// loadIndex replay the index log, the torn line at the end is truncated
+func (s *store) loadIndex() error {
+	f, err := os.OpenFile(s.indexPath(), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var (
+		reader   = bufio.NewReader(f)
+		validLen int64
+	)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				log.Printf("drop the torn record at the end of %s\n", s.indexPath())
+				return f.Truncate(validLen)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var record indexRecord
+		if err = json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("invalid record at offset %d of %s, %s", validLen, s.indexPath(), err)
+		}
+		s.apply(&record)
+		validLen += int64(len(line))
+	}
+}
+
+func (s *store) apply(record *indexRecord) {
+	for _, entry := range record.Blocks {
+		s.index[entry.BlockHeight] = entry
+	}
+	if record.ArchivedHeight != nil {
+		s.archivedHeight = *record.ArchivedHeight
+	}
+}
+
+func (s *store) GetBlockInfo(height uint64) (*db.BlockInfo, error) {
+	s.mu.RLock()
+	entry, exists := s.index[height]
+	s.mu.RUnlock()
+	if !exists {
+		return nil, db.ErrBlockNotFound
+	}
+
+	f, err := os.Open(s.segmentPath(entry.Segment))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	blkWithRWSet := make([]byte, entry.Length)
+	if _, err = f.ReadAt(blkWithRWSet, entry.Offset); err != nil {
+		return nil, fmt.Errorf("read block[%d] from segment %s failed, %s", height, entry.Segment, err)
+	}
+	if sum := sha256.Sum256(blkWithRWSet); hex.EncodeToString(sum[:]) != entry.Sha256 {
+		return nil, fmt.Errorf("block[%d] in segment %s is corrupted", height, entry.Segment)
+	}
+
+	return &db.BlockInfo{
+		ChainId:        entry.ChainId,
+		BlockHeight:    entry.BlockHeight,
+		BlockWithRWSet: blkWithRWSet,
+		Hmac:           entry.Hmac,
+		IsArchived:     entry.IsArchived,
+	}, nil
+}
+
+func (s *store) GetArchivedBlockHeight() (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.archivedHeight, nil
+}
+
+func (s *store) Begin() (db.Tx, error) {
+	return &storeTx{s: s}, nil
+}
+
+func (s *store) NewLocker(holder string) db.Locker {
+	return NewFileLocker(filepath.Join(s.dir, lockFileName), holder, DefaultLockLeaseAge)
+}
+
+func (s *store) Close() error {
+	return s.indexFile.Close()
+}
+
+// commit write the new blocks to a segment, then append the record to the index log
+func (s *store) commit(blocks []*db.BlockInfo, archivedHeight *uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		record  = &indexRecord{ArchivedHeight: archivedHeight}
+		segment bytes.Buffer
+		written []*indexEntry // the entries in the new segment
+	)
+	for _, info := range blocks {
+		sum := sha256.Sum256(info.BlockWithRWSet)
+		entry := &indexEntry{
+			BlockHeight: info.BlockHeight,
+			ChainId:     info.ChainId,
+			Length:      int64(len(info.BlockWithRWSet)),
+			Sha256:      hex.EncodeToString(sum[:]),
+			Hmac:        info.Hmac,
+			IsArchived:  info.IsArchived,
+		}
+		// the block is not changed, e.g. only archived or restored, keep it where it is
+		if old, exists := s.index[info.BlockHeight]; exists && old.Sha256 == entry.Sha256 {
+			entry.Segment, entry.Offset = old.Segment, old.Offset
+		} else {
+			entry.Offset = int64(segment.Len())
+			segment.Write(info.BlockWithRWSet)
+			written = append(written, entry)
+		}
+		record.Blocks = append(record.Blocks, entry)
+	}
+
+	if segment.Len() > 0 {
+		name, err := s.writeSegment(segment.Bytes())
+		if err != nil {
+			return err
+		}
+		for _, entry := range written {
+			entry.Segment = name
+		}
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err = s.indexFile.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err = s.indexFile.Sync(); err != nil {
+		return err
+	}
+	s.apply(record)
+	return nil
+}
+
+// writeSegment write the segment file named by the sha256 of content, returns the name
+func (s *store) writeSegment(content []byte) (string, error) {
+	sum := sha256.Sum256(content)
+	name := hex.EncodeToString(sum[:])
+	path := s.segmentPath(name)
+	if _, err := os.Stat(path); err == nil {
+		return name, nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), name+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return "", err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+	return name, os.Rename(tmp.Name(), path)
+}
+
+// storeTx The writes are kept in memory until Commit
+type storeTx struct {
+	s              *store
+	blocks         []*db.BlockInfo
+	archivedHeight *uint64
+	done           bool
+}
+
+func (t *storeTx) PutBlockInfo(info *db.BlockInfo) error {
+	if t.done {
+		return errTxDone
+	}
+	t.blocks = append(t.blocks, info)
+	return nil
+}
+
+func (t *storeTx) UpdateArchivedBlockHeight(height uint64) error {
+	if t.done {
+		return errTxDone
+	}
+	t.archivedHeight = &height
+	return nil
+}
+
+func (t *storeTx) Commit() error {
+	if t.done {
+		return errTxDone
+	}
+	t.done = true
+	return t.s.commit(t.blocks, t.archivedHeight)
+}
+
+func (t *storeTx) Rollback() error {
+	t.done = true
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright (C) BABEC. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db"
+)
+
+func newTestBlockInfo(height uint64, data string) *db.BlockInfo {
+	return &db.BlockInfo{
+		ChainId:        "chain1",
+		BlockHeight:    height,
+		BlockWithRWSet: []byte(data),
+		Hmac:           "hmac-" + data,
+		IsArchived:     true,
+	}
+}
+
+func TestStore(t *testing.T) {
+	dest, err := ioutil.TempDir("", "archive-fs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dest)
+
+	s, err := NewStore(dest, "chain1")
+	require.NoError(t, err)
+	height, err := s.GetArchivedBlockHeight()
+	require.NoError(t, err)
+	require.EqualValues(t, 0, height)
+	_, err = s.GetBlockInfo(1)
+	require.Equal(t, db.ErrBlockNotFound, err)
+
+	// 1. the rolled back writes are not visible
+	tx, err := s.Begin()
+	require.NoError(t, err)
+	require.NoError(t, tx.PutBlockInfo(newTestBlockInfo(1, "block1")))
+	require.NoError(t, tx.Rollback())
+	_, err = s.GetBlockInfo(1)
+	require.Equal(t, db.ErrBlockNotFound, err)
+
+	// 2. commit a batch
+	tx, err = s.Begin()
+	require.NoError(t, err)
+	require.NoError(t, tx.PutBlockInfo(newTestBlockInfo(1, "block1")))
+	require.NoError(t, tx.PutBlockInfo(newTestBlockInfo(2, "block2")))
+	require.NoError(t, tx.UpdateArchivedBlockHeight(2))
+	require.NoError(t, tx.Commit())
+	require.Error(t, tx.Commit())
+	require.NoError(t, tx.Rollback())
+
+	info, err := s.GetBlockInfo(2)
+	require.NoError(t, err)
+	require.Equal(t, newTestBlockInfo(2, "block2"), info)
+	height, err = s.GetArchivedBlockHeight()
+	require.NoError(t, err)
+	require.EqualValues(t, 2, height)
+
+	// 3. restore a block, only the index changes
+	tx, err = s.Begin()
+	require.NoError(t, err)
+	info.IsArchived = false
+	require.NoError(t, tx.PutBlockInfo(info))
+	require.NoError(t, tx.UpdateArchivedBlockHeight(1))
+	require.NoError(t, tx.Commit())
+	segments, err := ioutil.ReadDir(filepath.Join(dest, "cm_archived_chain_chain1", segmentsDir))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(segments))
+	require.NoError(t, s.Close())
+
+	// 4. reopen, the torn record at the end of the index is dropped
+	indexPath := filepath.Join(dest, "cm_archived_chain_chain1", indexFileName)
+	f, err := os.OpenFile(indexPath, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"archived_height":`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = NewStore(dest, "chain1")
+	require.NoError(t, err)
+	defer s.Close()
+	height, err = s.GetArchivedBlockHeight()
+	require.NoError(t, err)
+	require.EqualValues(t, 1, height)
+	info, err = s.GetBlockInfo(2)
+	require.NoError(t, err)
+	require.False(t, info.IsArchived)
+	info, err = s.GetBlockInfo(1)
+	require.NoError(t, err)
+	require.Equal(t, newTestBlockInfo(1, "block1"), info)
+
+	// 5. the corrupted segment is detected
+	segmentPath := filepath.Join(dest, "cm_archived_chain_chain1", segmentsDir, segments[0].Name())
+	require.NoError(t, ioutil.WriteFile(segmentPath, []byte("block1BLOCK2"), 0600))
+	_, err = s.GetBlockInfo(2)
+	require.Error(t, err)
+}
+
+func TestFileLocker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive-fs-lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, lockFileName)
+
+	// the lock file left by a dead holder expires
+	require.NoError(t, ioutil.WriteFile(path, []byte("dead"), 0600))
+	past := time.Now().Add(-time.Minute)
+	require.NoError(t, os.Chtimes(path, past, past))
+
+	locker := NewFileLocker(path, "cmc", time.Second)
+	locker.Lock()
+	holder, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "cmc", string(holder))
+	locker.UnLock()
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
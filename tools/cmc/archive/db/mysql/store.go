@@ -0,0 +1,125 @@
+// Copyright (C) BABEC. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db"
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/model"
+)
+
+var _ db.Store = (*store)(nil)
+
+// store The archived blocks in the block info tables sharded by height, the database is named by chain id
+type store struct {
+	db *gorm.DB
+}
+
+// NewStore Connect the mysql server, create the database of the chain and migrate the tables
+func NewStore(user, password, host, port, chainId string) (db.Store, error) {
+	gormDb, err := InitDb(user, password, host, port, model.DbName(chainId), true)
+	if err != nil {
+		return nil, err
+	}
+
+	// migrate sysinfo table
+	if err = gormDb.AutoMigrate(&model.Sysinfo{}); err != nil {
+		return nil, err
+	}
+	return &store{db: gormDb}, nil
+}
+
+func (s *store) GetBlockInfo(height uint64) (*db.BlockInfo, error) {
+	tableName := model.BlockInfoTableNameByBlockHeight(height)
+	if !s.db.Migrator().HasTable(tableName) {
+		return nil, db.ErrBlockNotFound
+	}
+
+	var bInfo model.BlockInfo
+	err := s.db.Table(tableName).Where("Fblock_height = ?", height).First(&bInfo).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, db.ErrBlockNotFound
+		}
+		return nil, err
+	}
+	return &db.BlockInfo{
+		ChainId:        bInfo.ChainID,
+		BlockHeight:    bInfo.BlockHeight,
+		BlockWithRWSet: bInfo.BlockWithRWSet,
+		Hmac:           bInfo.Hmac,
+		IsArchived:     bInfo.IsArchived,
+	}, nil
+}
+
+func (s *store) GetArchivedBlockHeight() (uint64, error) {
+	return model.GetArchivedBlockHeight(s.db)
+}
+
+func (s *store) Begin() (db.Tx, error) {
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &storeTx{db: s.db, tx: tx}, nil
+}
+
+func (s *store) NewLocker(holder string) db.Locker {
+	return NewDbLocker(s.db, holder, DefaultLockLeaseAge)
+}
+
+func (s *store) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+type storeTx struct {
+	db *gorm.DB // creates the block info tables, DDL can not be rolled back anyway
+	tx *gorm.DB
+}
+
+func (t *storeTx) PutBlockInfo(info *db.BlockInfo) error {
+	tableName := model.BlockInfoTableNameByBlockHeight(info.BlockHeight)
+	if err := model.CreateBlockInfoTableIfNotExists(t.db, tableName); err != nil {
+		return err
+	}
+
+	var bInfo model.BlockInfo
+	err := t.tx.Table(tableName).Where("Fblock_height = ?", info.BlockHeight).First(&bInfo).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	bInfo.ChainID = info.ChainId
+	bInfo.BlockHeight = info.BlockHeight
+	bInfo.BlockWithRWSet = info.BlockWithRWSet
+	bInfo.Hmac = info.Hmac
+	bInfo.IsArchived = info.IsArchived
+	if err != nil { // not found
+		return t.tx.Table(tableName).Create(&bInfo).Error
+	}
+	return t.tx.Table(tableName).Save(&bInfo).Error
+}
+
+func (t *storeTx) UpdateArchivedBlockHeight(height uint64) error {
+	return model.UpdateArchivedBlockHeight(t.tx, height)
+}
+
+func (t *storeTx) Commit() error {
+	return t.tx.Commit().Error
+}
+
+func (t *storeTx) Rollback() error {
+	if err := t.tx.Rollback().Error; err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+//go:build cgo
+// +build cgo
+
+// Copyright (C) BABEC. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package sqlite stores the archived blocks in a sqlite database file, one file per chain.
+package sqlite
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db"
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db/fs"
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/model"
+)
+
+const (
+	dbFileSuffix   = ".db"
+	lockFileSuffix = ".lock"
+)
+
+var _ db.Store = (*store)(nil)
+
+// blockInfo The table of the archived blocks, sqlite does not need the sharding of mysql
+type blockInfo struct {
+	ID             int64  `gorm:"primaryKey"`
+	ChainId        string `gorm:"not null"`
+	BlockHeight    uint64 `gorm:"not null;uniqueIndex"`
+	BlockWithRWSet []byte `gorm:"not null"`
+	Hmac           string `gorm:"not null"`
+	IsArchived     bool   `gorm:"not null"`
+}
+
+// sysinfo The key values of the archive, e.g. the archived block height
+type sysinfo struct {
+	K string `gorm:"primaryKey"`
+	V string `gorm:"not null"`
+}
+
+type store struct {
+	db   *gorm.DB
+	path string
+}
+
+// NewStore Open the database file of the chain under the directory dest, it is created if not exists
+func NewStore(dest, chainId string) (db.Store, error) {
+	if err := os.MkdirAll(dest, 0700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dest, model.DbName(chainId)+dbFileSuffix)
+	gormDb, err := gorm.Open(sqlite.Open(path), &gorm.Config{
+		Logger:                 logger.Default.LogMode(logger.Silent),
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = gormDb.AutoMigrate(&blockInfo{}, &sysinfo{}); err != nil {
+		return nil, err
+	}
+	return &store{db: gormDb, path: path}, nil
+}
+
+func (s *store) GetBlockInfo(height uint64) (*db.BlockInfo, error) {
+	var bInfo blockInfo
+	err := s.db.Where("block_height = ?", height).First(&bInfo).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, db.ErrBlockNotFound
+		}
+		return nil, err
+	}
+	return &db.BlockInfo{
+		ChainId:        bInfo.ChainId,
+		BlockHeight:    bInfo.BlockHeight,
+		BlockWithRWSet: bInfo.BlockWithRWSet,
+		Hmac:           bInfo.Hmac,
+		IsArchived:     bInfo.IsArchived,
+	}, nil
+}
+
+func (s *store) GetArchivedBlockHeight() (uint64, error) {
+	var info sysinfo
+	err := s.db.First(&info, "k = ?", model.KArchivedblockheight).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return strconv.ParseUint(info.V, 10, 64)
+}
+
+func (s *store) Begin() (db.Tx, error) {
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &storeTx{tx: tx}, nil
+}
+
+// NewLocker sqlite only locks the database file while writing, so a lock file excludes the other cmc
+// processes during the whole dump or restore
+func (s *store) NewLocker(holder string) db.Locker {
+	return fs.NewFileLocker(s.path+lockFileSuffix, holder, fs.DefaultLockLeaseAge)
+}
+
+func (s *store) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+type storeTx struct {
+	tx   *gorm.DB
+	done bool
+}
+
+func (t *storeTx) PutBlockInfo(info *db.BlockInfo) error {
+	return t.tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "block_height"}},
+		UpdateAll: true,
+	}).Create(&blockInfo{
+		ChainId:        info.ChainId,
+		BlockHeight:    info.BlockHeight,
+		BlockWithRWSet: info.BlockWithRWSet,
+		Hmac:           info.Hmac,
+		IsArchived:     info.IsArchived,
+	}).Error
+}
+
+func (t *storeTx) UpdateArchivedBlockHeight(height uint64) error {
+	return t.tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "k"}},
+		UpdateAll: true,
+	}).Create(&sysinfo{
+		K: model.KArchivedblockheight,
+		V: strconv.FormatUint(height, 10),
+	}).Error
+}
+
+func (t *storeTx) Commit() error {
+	t.done = true
+	return t.tx.Commit().Error
+}
+
+func (t *storeTx) Rollback() error {
+	if t.done {
+		return nil
+	}
+	t.done = true
+	return t.tx.Rollback().Error
+}
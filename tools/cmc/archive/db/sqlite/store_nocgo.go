@@ -0,0 +1,19 @@
+//go:build !cgo
+// +build !cgo
+
+// Copyright (C) BABEC. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlite
+
+import (
+	"errors"
+
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db"
+)
+
+// NewStore The sqlite driver requires cgo, build cmc with CGO_ENABLED=1 to use the sqlite backend
+func NewStore(dest, chainId string) (db.Store, error) {
+	return nil, errors.New("sqlite backend is not supported, cmc is built with CGO_ENABLED=0")
+}
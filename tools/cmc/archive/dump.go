@@ -14,13 +14,10 @@ import (
 
 	"github.com/gosuri/uiprogress"
 	"github.com/spf13/cobra"
-	"gorm.io/gorm"
 
-	"chainmaker.org/chainmaker-go/tools/cmc/archive/db/mysql"
-	"chainmaker.org/chainmaker-go/tools/cmc/archive/model"
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db"
 	"chainmaker.org/chainmaker-go/tools/cmc/util"
 	"chainmaker.org/chainmaker/pb-go/v2/common"
-	sdk "chainmaker.org/chainmaker/sdk-go/v2"
 )
 
 const (
@@ -30,16 +27,22 @@ const (
 	archiveBlockRequestTimeout = 20 // 20s
 )
 
+var errNoBlocksAtTime = errors.New("no blocks")
+
+// archiveClient The chain client calls of a batch, *sdk.ChainClient in use
+type archiveClient interface {
+	blockFetcher
+	CreateArchiveBlockPayload(targetBlockHeight uint64) (*common.Payload, error)
+	SignArchivePayload(payload *common.Payload) (*common.Payload, error)
+	SendArchiveBlockRequest(payload *common.Payload, timeout int64) (*common.TxResponse, error)
+}
+
 func newDumpCMD() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "dump",
 		Short: "dump blockchain data",
 		Long:  "dump blockchain data to off-chain storage and delete on-chain data",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if dbType != defaultDbType {
-				return fmt.Errorf("unsupport database type %s", dbType)
-			}
-
 			// try target is block height
 			if height, err := strconv.ParseUint(target, 10, 64); err == nil {
 				return runDumpByHeightCMD(height)
@@ -79,11 +82,12 @@ func runDumpByHeightCMD(targetBlkHeight uint64) error {
 	defer cc.Stop()
 
 	//// 2.Database
-	db, err := initDb()
+	archiveDb, err := initDb()
 	if err != nil {
 		return err
 	}
-	locker := mysql.NewDbLocker(db, "cmc", mysql.DefaultLockLeaseAge)
+	defer archiveDb.Close()
+	locker := archiveDb.NewLocker("cmc")
 	locker.Lock()
 	defer locker.UnLock()
 
@@ -92,7 +96,7 @@ func runDumpByHeightCMD(targetBlkHeight uint64) error {
 	if err != nil {
 		return err
 	}
-	archivedBlkHeightOffChain, err := model.GetArchivedBlockHeight(db)
+	archivedBlkHeightOffChain, err := reconcileArchivedHeight(archiveDb, archivedBlkHeightOnChain)
 	if err != nil {
 		return err
 	}
@@ -124,7 +128,7 @@ func runDumpByHeightCMD(targetBlkHeight uint64) error {
 	}
 	for processedBlocks := uint64(0); targetBlkHeight >= batchEndBlkHeight && processedBlocks < blocks; processedBlocks++ {
 		if batchEndBlkHeight-batchStartBlkHeight >= blocksPerBatch {
-			if err := runBatch(cc, db, batchStartBlkHeight, batchEndBlkHeight); err == nil {
+			if err := runBatch(cc, archiveDb, batchStartBlkHeight, batchEndBlkHeight); err == nil {
 				batchStartBlkHeight = batchEndBlkHeight
 			} else if !strings.Contains(err.Error(), configBlockArchiveErrorString) {
 				fmt.Printf("Warning: %s\n", err)
@@ -136,7 +140,7 @@ func runDumpByHeightCMD(targetBlkHeight uint64) error {
 		bar.Incr()
 	}
 	// do the rest of blocks
-	return runBatch(cc, db, batchStartBlkHeight, batchEndBlkHeight)
+	return runBatch(cc, archiveDb, batchStartBlkHeight, batchEndBlkHeight)
 }
 
 // validateDump basic params validation
@@ -161,52 +165,65 @@ func validateDump(archivedBlkHeightOnChain, archivedBlkHeightOffChain, currentBl
 
 // runBatch Run a batch job
 // NOTE: Include startBlk, exclude endBlk
-func runBatch(cc *sdk.ChainClient, db *gorm.DB, startBlk, endBlk uint64) error {
-	// check if create table
-	for blk := startBlk; blk < endBlk; blk++ {
-		// blk is first row of new table, create new table
-		if blk%model.RowsPerBlockInfoTable() == 0 {
-			err := model.CreateBlockInfoTableIfNotExists(db, model.BlockInfoTableNameByBlockHeight(blk))
-			if err != nil {
-				return err
-			}
-		}
+//
+// The blocks are committed off-chain before they are archived on-chain, and the archived block height
+// off-chain is updated after, so the archived block height on-chain is never ahead of the blocks stored
+// off-chain whenever the batch is interrupted, see reconcileArchivedHeight.
+func runBatch(cc archiveClient, archiveDb db.Store, startBlk, endBlk uint64) error {
+	//// 1.Store blocks off-chain
+	if err := storeBlocks(cc, archiveDb, startBlk, endBlk); err != nil {
+		return err
+	}
+
+	//// 2.Archive blocks on-chain
+	if err := archiveBlockOnChain(cc, endBlk-1); err != nil {
+		return err
 	}
 
+	//// 3.Update archived block height off-chain
+	tx, err := archiveDb.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = tx.UpdateArchivedBlockHeight(endBlk - 1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// storeBlocks get the blocks from the chain and store them off-chain in one tx
+// NOTE: Include startBlk, exclude endBlk
+func storeBlocks(cc archiveClient, archiveDb db.Store, startBlk, endBlk uint64) error {
 	// start db tx
-	tx := db.Begin()
-	if tx.Error != nil {
-		return tx.Error
+	tx, err := archiveDb.Begin()
+	if err != nil {
+		return err
 	}
 	defer tx.Rollback()
 
 	// get & store blocks
 	for blk := startBlk; blk < endBlk; blk++ {
-		var bInfo model.BlockInfo
-		err := db.Table(model.BlockInfoTableNameByBlockHeight(blk)).Where("Fblock_height = ?", blk).First(&bInfo).Error
-		if err == nil { // this block info was already in database, just update Fis_archived to 1
+		bInfo, err := archiveDb.GetBlockInfo(blk)
+		if err == nil { // this block info was already in database, just mark it archived
 			if !bInfo.IsArchived {
 				bInfo.IsArchived = true
-				tx.Table(model.BlockInfoTableNameByBlockHeight(blk)).Save(&bInfo)
+				if err = tx.PutBlockInfo(bInfo); err != nil {
+					return err
+				}
 			}
-		} else if err == gorm.ErrRecordNotFound {
+		} else if errors.Is(err, db.ErrBlockNotFound) {
 			blkWithRWSet, err := cc.GetFullBlockByHeight(blk)
 			if err != nil {
 				return err
 			}
 
-			blkWithRWSetBytes, err := blkWithRWSet.Marshal()
+			bInfo, err = newBlockInfo(blkWithRWSet, true)
 			if err != nil {
 				return err
 			}
 
-			sum, err := hmac(chainId, blkWithRWSet.Block.Header.BlockHeight, blkWithRWSetBytes, secretKey)
-			if err != nil {
-				return err
-			}
-
-			err = model.InsertBlockInfo(tx, chainId, blkWithRWSet.Block.Header.BlockHeight, blkWithRWSetBytes, sum)
-			if err != nil {
+			if err = tx.PutBlockInfo(bInfo); err != nil {
 				return err
 			}
 		} else {
@@ -214,23 +231,53 @@ func runBatch(cc *sdk.ChainClient, db *gorm.DB, startBlk, endBlk uint64) error {
 		}
 	}
 
-	// archive blocks on-chain
-	err := archiveBlockOnChain(cc, endBlk-1)
+	return tx.Commit()
+}
+
+// reconcileArchivedHeight catch up the archived block height off-chain with the one on-chain, which is
+// ahead if the last batch was interrupted after archiving on-chain. The blocks between them must have been
+// stored off-chain by the batch, the archived block height off-chain is returned.
+func reconcileArchivedHeight(archiveDb db.Store, archivedBlkHeightOnChain uint64) (uint64, error) {
+	archivedBlkHeightOffChain, err := archiveDb.GetArchivedBlockHeight()
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if archivedBlkHeightOnChain <= archivedBlkHeightOffChain {
+		return archivedBlkHeightOffChain, nil
 	}
 
-	// update archived block height off-chain
-	err = model.UpdateArchivedBlockHeight(tx, endBlk-1)
-	if err != nil {
-		return err
+	startBlk := archivedBlkHeightOffChain + 1
+	if archivedBlkHeightOffChain == 0 {
+		startBlk = 0
+	}
+	for blk := startBlk; blk <= archivedBlkHeightOnChain; blk++ {
+		bInfo, err := archiveDb.GetBlockInfo(blk)
+		if err != nil {
+			return 0, fmt.Errorf("block[%d] archived on-chain is not stored off-chain, %s", blk, err)
+		}
+		if !bInfo.IsArchived {
+			return 0, fmt.Errorf("block[%d] archived on-chain is restored off-chain", blk)
+		}
 	}
 
-	return tx.Commit().Error
+	tx, err := archiveDb.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if err = tx.UpdateArchivedBlockHeight(archivedBlkHeightOnChain); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	fmt.Printf("archived block height off-chain %d is caught up with on-chain %d\n",
+		archivedBlkHeightOffChain, archivedBlkHeightOnChain)
+	return archivedBlkHeightOnChain, nil
 }
 
 // archiveBlockOnChain Build & Sign & Send a ArchiveBlockRequest
-func archiveBlockOnChain(cc *sdk.ChainClient, height uint64) error {
+func archiveBlockOnChain(cc archiveClient, height uint64) error {
 	var (
 		err                error
 		payload            *common.Payload
@@ -256,6 +303,8 @@ func archiveBlockOnChain(cc *sdk.ChainClient, height uint64) error {
 	return util.CheckProposalRequestResp(resp, false)
 }
 
+// calcTargetHeightByTime returns the last block height before t, errNoBlocksAtTime if the genesis block is
+// after t
 func calcTargetHeightByTime(t time.Time) (uint64, error) {
 	targetTs := t.Unix()
 	cc, err := util.CreateChainClient(sdkConfPath, chainId, "", "", "", "", "")
@@ -277,7 +326,7 @@ func calcTargetHeightByTime(t time.Time) (uint64, error) {
 		return 0, err
 	}
 	if genesisHeader.BlockTimestamp >= targetTs {
-		return 0, fmt.Errorf("no blocks at %s", t)
+		return 0, fmt.Errorf("%w at %s", errNoBlocksAtTime, t)
 	}
 
 	targetBlkHeight, err := util.SearchU64(lastBlock.Block.Header.BlockHeight, func(i uint64) (bool, error) {
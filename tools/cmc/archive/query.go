@@ -13,9 +13,8 @@ import (
 
 	"github.com/hokaccha/go-prettyjson"
 	"github.com/spf13/cobra"
-	"gorm.io/gorm"
 
-	"chainmaker.org/chainmaker-go/tools/cmc/archive/model"
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db"
 	"chainmaker.org/chainmaker-go/tools/cmc/types"
 	"chainmaker.org/chainmaker-go/tools/cmc/util"
 	"chainmaker.org/chainmaker/pb-go/v2/common"
@@ -53,10 +52,11 @@ func newQueryTxOffChainCMD() *cobra.Command {
 			defer cc.Stop()
 
 			//// 2.Database
-			db, err := initDb()
+			archiveDb, err := initDb()
 			if err != nil {
 				return err
 			}
+			defer archiveDb.Close()
 
 			//// 3.Query tx off-chain.
 			var txInfo *common.TransactionInfo
@@ -66,21 +66,12 @@ func newQueryTxOffChainCMD() *cobra.Command {
 				return err
 			}
 
-			var bInfo model.BlockInfo
-			err = db.Table(model.BlockInfoTableNameByBlockHeight(blkHeight)).
-				Where("Fblock_height=? AND Fis_archived=1", blkHeight).
-				Find(&bInfo).Error
+			blkWithRWSet, err := getArchivedBlock(archiveDb, blkHeight)
 			if err != nil {
 				return err
 			}
 
-			var blkWithRWSet store.BlockWithRWSet
-			err = blkWithRWSet.Unmarshal(bInfo.BlockWithRWSet)
-			if err != nil {
-				return err
-			}
-
-			if blkWithRWSet.Block != nil {
+			if blkWithRWSet != nil && blkWithRWSet.Block != nil {
 				for idx, tx := range blkWithRWSet.Block.Txs {
 					if tx.Payload.TxId == args[0] {
 						txInfo = &common.TransactionInfo{
@@ -131,31 +122,23 @@ func newQueryBlockByHeightOffChainCMD() *cobra.Command {
 				return err
 			}
 			//// 1.Database
-			db, err := initDb()
+			archiveDb, err := initDb()
 			if err != nil {
 				return err
 			}
+			defer archiveDb.Close()
 
 			//// 2.Query block off-chain.
 			var output []byte
-			var bInfo model.BlockInfo
-			err = db.Table(model.BlockInfoTableNameByBlockHeight(height)).
-				Where("Fblock_height=? AND Fis_archived=1", height).
-				First(&bInfo).Error
+			blkWithRWSetOffChain, err := getArchivedBlock(archiveDb, height)
 			if err != nil {
-				if errors.Is(err, gorm.ErrRecordNotFound) {
-					output, _ = prettyjson.Marshal(map[string]string{"err": "block not found in off-chain storage"})
-				} else {
-					return err
-				}
+				return err
+			}
+			if blkWithRWSetOffChain == nil {
+				output, _ = prettyjson.Marshal(map[string]string{"err": "block not found in off-chain storage"})
 			} else {
-				var blkWithRWSetOffChain store.BlockWithRWSet
-				err = blkWithRWSetOffChain.Unmarshal(bInfo.BlockWithRWSet)
-				if err != nil {
-					return err
-				}
 				var blkWithRWSet = &types.BlockWithRWSet{
-					BlockWithRWSet: &blkWithRWSetOffChain,
+					BlockWithRWSet: blkWithRWSetOffChain,
 					Block: &types.Block{
 						Block: blkWithRWSetOffChain.Block,
 						Header: &types.BlockHeader{
@@ -197,10 +180,11 @@ func newQueryBlockByHashOffChainCMD() *cobra.Command {
 			defer cc.Stop()
 
 			//// 2.Database
-			db, err := initDb()
+			archiveDb, err := initDb()
 			if err != nil {
 				return err
 			}
+			defer archiveDb.Close()
 
 			//// 3.Query block off-chain.
 			height, err := cc.GetBlockHeightByHash(args[0])
@@ -209,24 +193,15 @@ func newQueryBlockByHashOffChainCMD() *cobra.Command {
 			}
 
 			var output []byte
-			var bInfo model.BlockInfo
-			err = db.Table(model.BlockInfoTableNameByBlockHeight(height)).
-				Where("Fblock_height=? AND Fis_archived=1", height).
-				First(&bInfo).Error
+			blkWithRWSetOffChain, err := getArchivedBlock(archiveDb, height)
 			if err != nil {
-				if errors.Is(err, gorm.ErrRecordNotFound) {
-					output, _ = prettyjson.Marshal(map[string]string{"err": "block not found in off-chain storage"})
-				} else {
-					return err
-				}
+				return err
+			}
+			if blkWithRWSetOffChain == nil {
+				output, _ = prettyjson.Marshal(map[string]string{"err": "block not found in off-chain storage"})
 			} else {
-				var blkWithRWSetOffChain store.BlockWithRWSet
-				err = blkWithRWSetOffChain.Unmarshal(bInfo.BlockWithRWSet)
-				if err != nil {
-					return err
-				}
 				var blkWithRWSet = &types.BlockWithRWSet{
-					BlockWithRWSet: &blkWithRWSetOffChain,
+					BlockWithRWSet: blkWithRWSetOffChain,
 					Block: &types.Block{
 						Block: blkWithRWSetOffChain.Block,
 						Header: &types.BlockHeader{
@@ -268,10 +243,11 @@ func newQueryBlockByTxIdOffChainCMD() *cobra.Command {
 			defer cc.Stop()
 
 			//// 2.Database
-			db, err := initDb()
+			archiveDb, err := initDb()
 			if err != nil {
 				return err
 			}
+			defer archiveDb.Close()
 
 			//// 3.Query block off-chain.
 			height, err := cc.GetBlockHeightByTxId(args[0])
@@ -280,24 +256,15 @@ func newQueryBlockByTxIdOffChainCMD() *cobra.Command {
 			}
 
 			var output []byte
-			var bInfo model.BlockInfo
-			err = db.Table(model.BlockInfoTableNameByBlockHeight(height)).
-				Where("Fblock_height=? AND Fis_archived=1", height).
-				First(&bInfo).Error
+			blkWithRWSetOffChain, err := getArchivedBlock(archiveDb, height)
 			if err != nil {
-				if errors.Is(err, gorm.ErrRecordNotFound) {
-					output, _ = prettyjson.Marshal(map[string]string{"err": "block not found in off-chain storage"})
-				} else {
-					return err
-				}
+				return err
+			}
+			if blkWithRWSetOffChain == nil {
+				output, _ = prettyjson.Marshal(map[string]string{"err": "block not found in off-chain storage"})
 			} else {
-				var blkWithRWSetOffChain store.BlockWithRWSet
-				err = blkWithRWSetOffChain.Unmarshal(bInfo.BlockWithRWSet)
-				if err != nil {
-					return err
-				}
 				var blkWithRWSet = &types.BlockWithRWSet{
-					BlockWithRWSet: &blkWithRWSetOffChain,
+					BlockWithRWSet: blkWithRWSetOffChain,
 					Block: &types.Block{
 						Block: blkWithRWSetOffChain.Block,
 						Header: &types.BlockHeader{
@@ -332,13 +299,14 @@ func newQueryArchivedHeightOffChainCMD() *cobra.Command {
 		Args:  cobra.ExactArgs(0),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			//// 1.Database
-			db, err := initDb()
+			archiveDb, err := initDb()
 			if err != nil {
 				return err
 			}
+			defer archiveDb.Close()
 
 			//// 2.Query archived block height off-chain.
-			archivedBlkHeightOffChain, err := model.GetArchivedBlockHeight(db)
+			archivedBlkHeightOffChain, err := archiveDb.GetArchivedBlockHeight()
 			if err != nil {
 				return err
 			}
@@ -357,3 +325,23 @@ func newQueryArchivedHeightOffChainCMD() *cobra.Command {
 	})
 	return cmd
 }
+
+// getArchivedBlock returns the block archived off-chain, nil if it is not archived
+func getArchivedBlock(archiveDb db.Store, height uint64) (*store.BlockWithRWSet, error) {
+	bInfo, err := archiveDb.GetBlockInfo(height)
+	if err != nil {
+		if errors.Is(err, db.ErrBlockNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !bInfo.IsArchived {
+		return nil, nil
+	}
+
+	var blkWithRWSet store.BlockWithRWSet
+	if err = blkWithRWSet.Unmarshal(bInfo.BlockWithRWSet); err != nil {
+		return nil, err
+	}
+	return &blkWithRWSet, nil
+}
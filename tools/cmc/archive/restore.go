@@ -11,10 +11,8 @@ import (
 
 	"github.com/gosuri/uiprogress"
 	"github.com/spf13/cobra"
-	"gorm.io/gorm"
 
-	"chainmaker.org/chainmaker-go/tools/cmc/archive/db/mysql"
-	"chainmaker.org/chainmaker-go/tools/cmc/archive/model"
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db"
 	"chainmaker.org/chainmaker-go/tools/cmc/util"
 	"chainmaker.org/chainmaker/pb-go/v2/common"
 	"chainmaker.org/chainmaker/pb-go/v2/store"
@@ -32,10 +30,6 @@ func newRestoreCMD() *cobra.Command {
 		Short: "restore blockchain data",
 		Long:  "restore blockchain data from off-chain storage",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if dbType != defaultDbType {
-				return fmt.Errorf("unsupport database type %s", dbType)
-			}
-
 			return runRestoreCMD()
 		},
 	}
@@ -56,11 +50,12 @@ func runRestoreCMD() error {
 	defer cc.Stop()
 
 	//// 2.Database
-	db, err := initDb()
+	archiveDb, err := initDb()
 	if err != nil {
 		return err
 	}
-	locker := mysql.NewDbLocker(db, "cmc", mysql.DefaultLockLeaseAge)
+	defer archiveDb.Close()
+	locker := archiveDb.NewLocker("cmc")
 	locker.Lock()
 	defer locker.UnLock()
 
@@ -88,7 +83,7 @@ func runRestoreCMD() error {
 	progress.Start()
 	defer progress.Stop()
 	for height := int64(archivedBlkHeightOnChain); height >= int64(restoreStartBlockHeight); height-- {
-		if err := restoreBlock(cc, db, uint64(height)); err != nil {
+		if err := restoreBlock(cc, archiveDb, uint64(height)); err != nil {
 			return err
 		}
 
@@ -106,15 +101,14 @@ func validateRestore(archivedBlkHeightOnChain, restoreStartBlkHeight uint64) err
 	return nil
 }
 
-func restoreBlock(cc *sdk.ChainClient, db *gorm.DB, height uint64) error {
-	tx := db.Begin()
-	if tx.Error != nil {
-		return tx.Error
+func restoreBlock(cc *sdk.ChainClient, archiveDb db.Store, height uint64) error {
+	tx, err := archiveDb.Begin()
+	if err != nil {
+		return err
 	}
 	defer tx.Rollback()
 
-	var bInfo model.BlockInfo
-	err := tx.Table(model.BlockInfoTableNameByBlockHeight(height)).Where("Fblock_height = ?", height).First(&bInfo).Error
+	bInfo, err := archiveDb.GetBlockInfo(height)
 	if err != nil {
 		return err
 	}
@@ -129,7 +123,7 @@ func restoreBlock(cc *sdk.ChainClient, db *gorm.DB, height uint64) error {
 	}
 
 	bInfo.IsArchived = false
-	err = tx.Table(model.BlockInfoTableNameByBlockHeight(height)).Save(bInfo).Error
+	err = tx.PutBlockInfo(bInfo)
 	if err != nil {
 		return err
 	}
@@ -139,7 +133,7 @@ func restoreBlock(cc *sdk.ChainClient, db *gorm.DB, height uint64) error {
 		archivedBlkHeight = height - 1
 	}
 
-	err = model.UpdateArchivedBlockHeight(tx, archivedBlkHeight)
+	err = tx.UpdateArchivedBlockHeight(archivedBlkHeight)
 	if err != nil {
 		return err
 	}
@@ -157,7 +151,7 @@ func restoreBlock(cc *sdk.ChainClient, db *gorm.DB, height uint64) error {
 		}
 	}
 
-	return tx.Commit().Error
+	return tx.Commit()
 }
 
 func restoreBlockOnChain(cc *sdk.ChainClient, fullBlock []byte) error {
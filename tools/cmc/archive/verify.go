@@ -0,0 +1,331 @@
+// Copyright (C) BABEC. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/gosuri/uiprogress"
+	"github.com/hokaccha/go-prettyjson"
+	"github.com/spf13/cobra"
+
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db"
+	"chainmaker.org/chainmaker-go/tools/cmc/util"
+	"chainmaker.org/chainmaker/common/v2/crypto/hash"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/store"
+	sdk "chainmaker.org/chainmaker/sdk-go/v2"
+	"chainmaker.org/chainmaker/utils/v2"
+)
+
+// blockFetcher Fetches the blocks to repair from a node, *sdk.ChainClient in use
+type blockFetcher interface {
+	GetFullBlockByHeight(blockHeight uint64) (*store.BlockWithRWSet, error)
+}
+
+// damagedRange Consecutive damaged blocks found by verify, Reasons are of each block in order
+type damagedRange struct {
+	StartHeight uint64   `json:"start_height"`
+	EndHeight   uint64   `json:"end_height"`
+	Reasons     []string `json:"reasons"`
+	Repaired    bool     `json:"repaired"`
+	RepairError string   `json:"repair_error,omitempty"`
+}
+
+// verifyReport The result of verify, printed as json
+type verifyReport struct {
+	StartHeight    uint64          `json:"start_height"`
+	EndHeight      uint64          `json:"end_height"`
+	ArchivedHeight uint64          `json:"archived_height"`
+	DamagedBlocks  int             `json:"damaged_blocks"`
+	DamagedRanges  []*damagedRange `json:"damaged_ranges"`
+}
+
+func (r *verifyReport) addDamaged(height uint64, reason string) {
+	r.DamagedBlocks++
+	if n := len(r.DamagedRanges); n > 0 && r.DamagedRanges[n-1].EndHeight+1 == height {
+		r.DamagedRanges[n-1].EndHeight = height
+		r.DamagedRanges[n-1].Reasons = append(r.DamagedRanges[n-1].Reasons, reason)
+		return
+	}
+	r.DamagedRanges = append(r.DamagedRanges, &damagedRange{
+		StartHeight: height,
+		EndHeight:   height,
+		Reasons:     []string{reason},
+	})
+}
+
+func newVerifyCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "verify off-chain blockchain data",
+		Long: "verify the HMAC, block hash, tx root and pre block hash of the off-chain blocks, " +
+			"find the missing blocks, and re-fetch the damaged blocks from a node with --repair",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVerifyCMD()
+		},
+	}
+
+	util.AttachAndRequiredFlags(cmd, flags, []string{
+		flagSdkConfPath, flagChainId, flagDbType, flagDbDest, flagSecretKey,
+	})
+	util.AttachFlags(cmd, flags, []string{
+		flagStartBlockHeight, flagEndBlockHeight, flagRepair, flagRepairSdkConfPath,
+	})
+	return cmd
+}
+
+// runVerifyCMD `verify` command implementation
+func runVerifyCMD() error {
+	//// 1.Chain Client
+	cc, err := util.CreateChainClient(sdkConfPath, chainId, "", "", "", "", "")
+	if err != nil {
+		return err
+	}
+	defer cc.Stop()
+	chainConfig, err := cc.GetChainConfig()
+	if err != nil {
+		return err
+	}
+	hashType := chainConfig.Crypto.Hash
+
+	//// 2.Database
+	archiveDb, err := initDb()
+	if err != nil {
+		return err
+	}
+	defer archiveDb.Close()
+
+	//// 3.Verify Blocks
+	archivedBlkHeight, err := archiveDb.GetArchivedBlockHeight()
+	if err != nil {
+		return err
+	}
+	report := &verifyReport{
+		StartHeight:    restoreStartBlockHeight,
+		EndHeight:      verifyEndBlockHeight,
+		ArchivedHeight: archivedBlkHeight,
+		DamagedRanges:  make([]*damagedRange, 0),
+	}
+	if report.EndHeight == 0 {
+		report.EndHeight = archivedBlkHeight
+	}
+	if report.StartHeight > report.EndHeight {
+		return fmt.Errorf("start block height %d > end block height %d", report.StartHeight, report.EndHeight)
+	}
+	if err = verifyArchivedBlocks(archiveDb, hashType, report); err != nil {
+		return err
+	}
+
+	//// 4.Repair Damaged Blocks
+	if repair && len(report.DamagedRanges) > 0 {
+		if err = repairDamagedRanges(cc, archiveDb, hashType, report); err != nil {
+			return err
+		}
+	}
+
+	output, err := prettyjson.Marshal(report)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(output))
+
+	for _, r := range report.DamagedRanges {
+		if !r.Repaired {
+			return fmt.Errorf("%d damaged blocks found in off-chain storage", report.DamagedBlocks)
+		}
+	}
+	return nil
+}
+
+// verifyArchivedBlocks verify the blocks of the report range, the missing blocks are damaged only if they
+// are below the archived block height
+func verifyArchivedBlocks(archiveDb db.Store, hashType string, report *verifyReport) error {
+	var barCount = report.EndHeight - report.StartHeight + 1
+	progress := uiprogress.New()
+	bar := progress.AddBar(int(barCount)).AppendCompleted().PrependElapsed()
+	bar.PrependFunc(func(b *uiprogress.Bar) string {
+		return fmt.Sprintf("Verifying Blocks (%d/%d)", b.Current(), barCount)
+	})
+	progress.Start()
+	defer progress.Stop()
+
+	// the block before the range is the base of the pre block hash check, skipped if it is damaged
+	var preBlock *common.Block
+	if report.StartHeight > 0 {
+		preBlock, _ = getVerifiedBlock(archiveDb, report.StartHeight-1, hashType)
+	}
+	for height := report.StartHeight; height <= report.EndHeight; height++ {
+		block, err := getVerifiedBlock(archiveDb, height, hashType)
+		switch {
+		case errors.Is(err, db.ErrBlockNotFound):
+			if height <= report.ArchivedHeight {
+				report.addDamaged(height, "block is missing")
+			}
+		case err != nil:
+			report.addDamaged(height, err.Error())
+		case preBlock != nil && !bytes.Equal(block.Header.PreBlockHash, preBlock.Header.BlockHash):
+			report.addDamaged(height, fmt.Sprintf("pre block hash %x does not match the hash %x of block[%d]",
+				block.Header.PreBlockHash, preBlock.Header.BlockHash, height-1))
+		}
+		if err != nil {
+			block = nil
+		}
+		preBlock = block
+		bar.Incr()
+	}
+	return nil
+}
+
+// getVerifiedBlock get the block of height from the off-chain storage and verify it
+func getVerifiedBlock(archiveDb db.Store, height uint64, hashType string) (*common.Block, error) {
+	bInfo, err := archiveDb.GetBlockInfo(height)
+	if err != nil {
+		return nil, err
+	}
+
+	sum, err := hmac(chainId, height, bInfo.BlockWithRWSet, secretKey)
+	if err != nil {
+		return nil, err
+	}
+	if sum != bInfo.Hmac {
+		return nil, fmt.Errorf("invalid HMAC signature, recalculate: %s from_db: %s", sum, bInfo.Hmac)
+	}
+
+	var blkWithRWSet store.BlockWithRWSet
+	if err = blkWithRWSet.Unmarshal(bInfo.BlockWithRWSet); err != nil {
+		return nil, fmt.Errorf("unmarshal block failed, %s", err)
+	}
+	if err = verifyBlock(&blkWithRWSet, height, hashType); err != nil {
+		return nil, err
+	}
+	return blkWithRWSet.Block, nil
+}
+
+// verifyBlock verify the block hash, and the tx root with the read-write sets
+func verifyBlock(blkWithRWSet *store.BlockWithRWSet, height uint64, hashType string) error {
+	block := blkWithRWSet.Block
+	if block == nil || block.Header == nil {
+		return errors.New("block is empty")
+	}
+	if block.Header.BlockHeight != height {
+		return fmt.Errorf("block height is %d", block.Header.BlockHeight)
+	}
+
+	rwSets := make(map[string]*common.TxRWSet, len(blkWithRWSet.TxRWSets))
+	for _, rwSet := range blkWithRWSet.TxRWSets {
+		rwSets[rwSet.TxId] = rwSet
+	}
+	txHashes := make([][]byte, len(block.Txs))
+	for i, tx := range block.Txs {
+		if tx.Result == nil {
+			return fmt.Errorf("result of tx[%s] is nil", tx.Payload.TxId)
+		}
+		rwSet, ok := rwSets[tx.Payload.TxId]
+		if !ok {
+			rwSet = &common.TxRWSet{TxId: tx.Payload.TxId}
+		}
+		rwSetHash, err := utils.CalcRWSetHash(hashType, rwSet)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(rwSetHash, tx.Result.RwSetHash) {
+			return fmt.Errorf("rwset hash of tx[%s] expect %x, got %x", tx.Payload.TxId, tx.Result.RwSetHash,
+				rwSetHash)
+		}
+		if txHashes[i], err = utils.CalcTxHash(hashType, tx); err != nil {
+			return err
+		}
+	}
+	txRoot, err := hash.GetMerkleRoot(hashType, txHashes)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(txRoot, block.Header.TxRoot) {
+		return fmt.Errorf("tx root expect %x, got %x", block.Header.TxRoot, txRoot)
+	}
+
+	blockHash, err := utils.CalcBlockHash(hashType, block)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(blockHash, block.Header.BlockHash) {
+		return fmt.Errorf("block hash expect %x, got %x", block.Header.BlockHash, blockHash)
+	}
+	return nil
+}
+
+// repairDamagedRanges re-fetch the damaged ranges from the node of --repair-sdk-conf-path, which must still
+// have the blocks, and overwrite them in the off-chain storage
+func repairDamagedRanges(cc *sdk.ChainClient, archiveDb db.Store, hashType string, report *verifyReport) error {
+	if repairSdkConfPath != "" && repairSdkConfPath != sdkConfPath {
+		repairCc, err := util.CreateChainClient(repairSdkConfPath, chainId, "", "", "", "", "")
+		if err != nil {
+			return err
+		}
+		defer repairCc.Stop()
+		cc = repairCc
+	}
+
+	locker := archiveDb.NewLocker("cmc")
+	locker.Lock()
+	defer locker.UnLock()
+
+	for _, r := range report.DamagedRanges {
+		if err := repairDamagedRange(cc, archiveDb, hashType, r); err != nil {
+			r.RepairError = err.Error()
+			continue
+		}
+		r.Repaired = true
+	}
+	return nil
+}
+
+// repairDamagedRange re-fetch the blocks of the range, they are written only if all of them are verified
+func repairDamagedRange(cc blockFetcher, archiveDb db.Store, hashType string, r *damagedRange) error {
+	archivedBlkHeight, err := archiveDb.GetArchivedBlockHeight()
+	if err != nil {
+		return err
+	}
+	tx, err := archiveDb.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var preBlock *common.Block
+	if r.StartHeight > 0 {
+		preBlock, _ = getVerifiedBlock(archiveDb, r.StartHeight-1, hashType)
+	}
+	for height := r.StartHeight; height <= r.EndHeight; height++ {
+		blkWithRWSet, err := cc.GetFullBlockByHeight(height)
+		if err != nil {
+			return fmt.Errorf("get block[%d] failed, %s", height, err)
+		}
+		if err = verifyBlock(blkWithRWSet, height, hashType); err != nil {
+			return fmt.Errorf("block[%d] from the node is invalid, %s", height, err)
+		}
+		if preBlock != nil && !bytes.Equal(blkWithRWSet.Block.Header.PreBlockHash, preBlock.Header.BlockHash) {
+			return fmt.Errorf("block[%d] from the node does not link to block[%d]", height, height-1)
+		}
+		preBlock = blkWithRWSet.Block
+
+		// keep the block restored if it is, the missing block is archived if it is below the archived height
+		isArchived := height <= archivedBlkHeight
+		if old, err := archiveDb.GetBlockInfo(height); err == nil {
+			isArchived = old.IsArchived
+		}
+		bInfo, err := newBlockInfo(blkWithRWSet, isArchived)
+		if err != nil {
+			return err
+		}
+		if err = tx.PutBlockInfo(bInfo); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,237 @@
+// Copyright (C) BABEC. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package archive
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db"
+	"chainmaker.org/chainmaker-go/tools/cmc/archive/db/fs"
+	"chainmaker.org/chainmaker/common/v2/crypto"
+	"chainmaker.org/chainmaker/common/v2/crypto/hash"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/store"
+	"chainmaker.org/chainmaker/utils/v2"
+)
+
+const testHashType = crypto.CRYPTO_ALGO_SHA256
+
+// newTestFsStore open a fs store of chain1 in a temp directory, the flags of the hmac are set until the
+// test ends
+func newTestFsStore(t *testing.T) db.Store {
+	chainId, secretKey = "chain1", "secret"
+	dest, err := ioutil.TempDir("", "archive-test")
+	require.NoError(t, err)
+	archiveDb, err := fs.NewStore(dest, chainId)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		archiveDb.Close()
+		os.RemoveAll(dest)
+		chainId, secretKey = "", ""
+	})
+	return archiveDb
+}
+
+// newTestBlock build a valid block of one tx
+func newTestBlock(t *testing.T, height uint64, preBlockHash []byte) *store.BlockWithRWSet {
+	tx := &common.Transaction{
+		Payload: &common.Payload{ChainId: chainId, TxId: fmt.Sprintf("tx%d", height)},
+		Result:  &common.Result{},
+	}
+	rwSet := &common.TxRWSet{TxId: tx.Payload.TxId}
+	var err error
+	tx.Result.RwSetHash, err = utils.CalcRWSetHash(testHashType, rwSet)
+	require.NoError(t, err)
+	txHash, err := utils.CalcTxHash(testHashType, tx)
+	require.NoError(t, err)
+
+	block := &common.Block{
+		Header: &common.BlockHeader{ChainId: chainId, BlockHeight: height, PreBlockHash: preBlockHash},
+		Txs:    []*common.Transaction{tx},
+	}
+	block.Header.TxRoot, err = hash.GetMerkleRoot(testHashType, [][]byte{txHash})
+	require.NoError(t, err)
+	rehashTestBlock(t, block)
+	return &store.BlockWithRWSet{Block: block, TxRWSets: []*common.TxRWSet{rwSet}}
+}
+
+// newTestChain build the linked blocks of height [0, n)
+func newTestChain(t *testing.T, n uint64) []*store.BlockWithRWSet {
+	blocks := make([]*store.BlockWithRWSet, 0, n)
+	var preBlockHash []byte
+	for height := uint64(0); height < n; height++ {
+		blkWithRWSet := newTestBlock(t, height, preBlockHash)
+		blocks = append(blocks, blkWithRWSet)
+		preBlockHash = blkWithRWSet.Block.Header.BlockHash
+	}
+	return blocks
+}
+
+// rehashTestBlock recalculate the block hash after the header is modified
+func rehashTestBlock(t *testing.T, block *common.Block) {
+	blockHash, err := utils.CalcBlockHash(testHashType, block)
+	require.NoError(t, err)
+	block.Header.BlockHash = blockHash
+}
+
+func newTestBlockInfo(t *testing.T, blkWithRWSet *store.BlockWithRWSet, isArchived bool) *db.BlockInfo {
+	bInfo, err := newBlockInfo(blkWithRWSet, isArchived)
+	require.NoError(t, err)
+	return bInfo
+}
+
+// putTestBlockInfos store the blocks and the archived block height in one batch
+func putTestBlockInfos(t *testing.T, archiveDb db.Store, archivedHeight uint64, infos ...*db.BlockInfo) {
+	tx, err := archiveDb.Begin()
+	require.NoError(t, err)
+	for _, info := range infos {
+		require.NoError(t, tx.PutBlockInfo(info))
+	}
+	require.NoError(t, tx.UpdateArchivedBlockHeight(archivedHeight))
+	require.NoError(t, tx.Commit())
+}
+
+// fakeBlockFetcher The node of the repair, it returns the blocks of the map
+type fakeBlockFetcher map[uint64]*store.BlockWithRWSet
+
+func (f fakeBlockFetcher) GetFullBlockByHeight(blockHeight uint64) (*store.BlockWithRWSet, error) {
+	if blkWithRWSet, ok := f[blockHeight]; ok {
+		return blkWithRWSet, nil
+	}
+	return nil, fmt.Errorf("block[%d] is archived", blockHeight)
+}
+
+func TestVerifyReportAddDamaged(t *testing.T) {
+	report := &verifyReport{}
+	report.addDamaged(3, "block is missing")
+	report.addDamaged(4, "invalid HMAC signature")
+	report.addDamaged(7, "block is missing")
+
+	require.Equal(t, 3, report.DamagedBlocks)
+	require.Equal(t, 2, len(report.DamagedRanges))
+	require.EqualValues(t, 3, report.DamagedRanges[0].StartHeight)
+	require.EqualValues(t, 4, report.DamagedRanges[0].EndHeight)
+	require.Equal(t, []string{"block is missing", "invalid HMAC signature"}, report.DamagedRanges[0].Reasons)
+	require.EqualValues(t, 7, report.DamagedRanges[1].StartHeight)
+	require.EqualValues(t, 7, report.DamagedRanges[1].EndHeight)
+}
+
+func TestVerifyArchivedBlocks(t *testing.T) {
+	archiveDb := newTestFsStore(t)
+	blocks := newTestChain(t, 9)
+	// block[6] is a valid block which does not link to block[5], the blocks after it link to it
+	blocks[6] = newTestBlock(t, 6, []byte("fork"))
+	blocks[7] = newTestBlock(t, 7, blocks[6].Block.Header.BlockHash)
+	blocks[8] = newTestBlock(t, 8, blocks[7].Block.Header.BlockHash)
+
+	var infos []*db.BlockInfo
+	for height, blkWithRWSet := range blocks {
+		switch height {
+		case 2:
+			// tampered after the hmac is calculated
+			bInfo := newTestBlockInfo(t, blkWithRWSet, true)
+			blkWithRWSet.Block.Header.BlockTimestamp = 1
+			tampered := newTestBlockInfo(t, blkWithRWSet, true)
+			tampered.Hmac = bInfo.Hmac
+			infos = append(infos, tampered)
+		case 4:
+			// missing
+		case 8:
+			// the tx root does not match the txs, the hmac and the block hash are recalculated
+			blkWithRWSet.Block.Header.TxRoot = []byte("root")
+			rehashTestBlock(t, blkWithRWSet.Block)
+			infos = append(infos, newTestBlockInfo(t, blkWithRWSet, true))
+		default:
+			infos = append(infos, newTestBlockInfo(t, blkWithRWSet, true))
+		}
+	}
+	putTestBlockInfos(t, archiveDb, 8, infos...)
+
+	// block[9] above the archived block height is not stored yet, it is not damaged
+	report := &verifyReport{StartHeight: 0, EndHeight: 9, ArchivedHeight: 8}
+	require.NoError(t, verifyArchivedBlocks(archiveDb, testHashType, report))
+	require.Equal(t, 4, report.DamagedBlocks)
+	require.Equal(t, 4, len(report.DamagedRanges))
+	for i, expect := range []struct {
+		height uint64
+		reason string
+	}{
+		{2, "invalid HMAC signature"},
+		{4, "block is missing"},
+		{6, "pre block hash"},
+		{8, "tx root expect"},
+	} {
+		r := report.DamagedRanges[i]
+		require.Equal(t, expect.height, r.StartHeight)
+		require.Equal(t, expect.height, r.EndHeight)
+		require.True(t, strings.HasPrefix(r.Reasons[0], expect.reason), r.Reasons[0])
+	}
+
+	// the range starts after the damaged block, block[3] is checked without the link to it
+	report = &verifyReport{StartHeight: 3, EndHeight: 3, ArchivedHeight: 8}
+	require.NoError(t, verifyArchivedBlocks(archiveDb, testHashType, report))
+	require.Equal(t, 0, report.DamagedBlocks)
+}
+
+func TestRepairDamagedRange(t *testing.T) {
+	archiveDb := newTestFsStore(t)
+	blocks := newTestChain(t, 5)
+
+	// block[2] is restored and tampered, block[3] is missing
+	tampered := newTestBlockInfo(t, blocks[2], false)
+	tampered.BlockWithRWSet[len(tampered.BlockWithRWSet)-1] ^= 0xff
+	putTestBlockInfos(t, archiveDb, 4, newTestBlockInfo(t, blocks[0], true),
+		newTestBlockInfo(t, blocks[1], true), tampered, newTestBlockInfo(t, blocks[4], true))
+	r := &damagedRange{StartHeight: 2, EndHeight: 3}
+
+	// 1. nothing is written if a block of the node is invalid
+	invalid := newTestBlock(t, 3, blocks[2].Block.Header.BlockHash)
+	invalid.Block.Header.BlockHash = []byte("hash")
+	err := repairDamagedRange(fakeBlockFetcher{2: blocks[2], 3: invalid}, archiveDb, testHashType, r)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "block[3] from the node is invalid"), err.Error())
+	_, err = archiveDb.GetBlockInfo(3)
+	require.Equal(t, db.ErrBlockNotFound, err)
+	_, err = getVerifiedBlock(archiveDb, 2, testHashType)
+	require.Error(t, err)
+
+	// 2. nor if a block of the node does not link to the block before it
+	unlinked := newTestBlock(t, 3, []byte("fork"))
+	err = repairDamagedRange(fakeBlockFetcher{2: blocks[2], 3: unlinked}, archiveDb, testHashType, r)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "does not link to block[2]"), err.Error())
+	_, err = archiveDb.GetBlockInfo(3)
+	require.Equal(t, db.ErrBlockNotFound, err)
+
+	// 3. nor if the node does not have the block
+	err = repairDamagedRange(fakeBlockFetcher{2: blocks[2]}, archiveDb, testHashType, r)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "get block[3] failed"), err.Error())
+
+	// 4. the range is repaired, the restored block is kept restored
+	require.NoError(t, repairDamagedRange(fakeBlockFetcher{2: blocks[2], 3: blocks[3]}, archiveDb,
+		testHashType, r))
+	for height := uint64(2); height <= 3; height++ {
+		block, err := getVerifiedBlock(archiveDb, height, testHashType)
+		require.NoError(t, err)
+		require.Equal(t, blocks[height].Block.Header.BlockHash, block.Header.BlockHash)
+	}
+	bInfo, err := archiveDb.GetBlockInfo(2)
+	require.NoError(t, err)
+	require.False(t, bInfo.IsArchived)
+	bInfo, err = archiveDb.GetBlockInfo(3)
+	require.NoError(t, err)
+	require.True(t, bInfo.IsArchived)
+
+	report := &verifyReport{StartHeight: 0, EndHeight: 4, ArchivedHeight: 4}
+	require.NoError(t, verifyArchivedBlocks(archiveDb, testHashType, report))
+	require.Equal(t, 0, report.DamagedBlocks)
+}
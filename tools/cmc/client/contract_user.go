@@ -54,6 +54,8 @@ func userContractCMD() *cobra.Command {
 	userContractCmd.AddCommand(createUserContractCMD())
 	userContractCmd.AddCommand(invokeContractTimesCMD())
 	userContractCmd.AddCommand(invokeUserContractCMD())
+	userContractCmd.AddCommand(estimateGasUserContractCMD())
+	userContractCmd.AddCommand(traceUserContractCMD())
 	userContractCmd.AddCommand(upgradeUserContractCMD())
 	userContractCmd.AddCommand(freezeUserContractCMD())
 	userContractCmd.AddCommand(unfreezeUserContractCMD())
@@ -416,54 +418,9 @@ func invokeUserContract() error {
 		return err
 	}
 
-	var kvs []*common.KeyValuePair
-	var evmMethod *ethabi.Method
-
-	if abiFilePath != "" { // abi file path 非空 意味着调用的是EVM合约
-		abiBytes, err := ioutil.ReadFile(abiFilePath)
-		if err != nil {
-			return err
-		}
-
-		contractAbi, err := ethabi.JSON(bytes.NewReader(abiBytes))
-		if err != nil {
-			return err
-		}
-
-		m, exist := contractAbi.Methods[method]
-		if !exist {
-			return fmt.Errorf("method '%s' not found", method)
-		}
-		evmMethod = &m
-
-		inputData, err := util.Pack(evmMethod, params)
-		if err != nil {
-			return err
-		}
-
-		inputDataHexStr := hex.EncodeToString(inputData)
-		method = inputDataHexStr[0:8]
-
-		kvs = []*common.KeyValuePair{
-			{
-				Key:   "data",
-				Value: []byte(inputDataHexStr),
-			},
-		}
-
-		if !ethcmn.IsHexAddress(contractName) {
-			contractName = util.CalcEvmContractName(contractName)
-		}
-		fmt.Printf("EVM contract name in hex: %s\n", contractName)
-	} else {
-		if params != "" {
-			kvsMap := make(map[string]string)
-			err := json.Unmarshal([]byte(params), &kvsMap)
-			if err != nil {
-				return err
-			}
-			kvs = util.ConvertParameters(kvsMap)
-		}
+	kvs, evmMethod, err := userContractParams()
+	if err != nil {
+		return err
 	}
 
 	var limit *common.Limit
@@ -487,29 +444,41 @@ func invokeContractTimes() error {
 	}
 	defer client.Stop()
 
+	kvs, evmMethod, err := userContractParams()
+	if err != nil {
+		return err
+	}
+
+	DispatchTimes(client, contractName, method, kvs, evmMethod)
+	return nil
+}
+
+// userContractParams build the parameters of the user contract method from the flags,
+// the method and the contract name of an EVM contract are converted to the hex forms
+func userContractParams() ([]*common.KeyValuePair, *ethabi.Method, error) {
 	var kvs []*common.KeyValuePair
 	var evmMethod *ethabi.Method
 
 	if abiFilePath != "" { // abi file path 非空 意味着调用的是EVM合约
 		abiBytes, err := ioutil.ReadFile(abiFilePath)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
 		contractAbi, err := ethabi.JSON(bytes.NewReader(abiBytes))
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
 		m, exist := contractAbi.Methods[method]
 		if !exist {
-			return fmt.Errorf("method '%s' not found", method)
+			return nil, nil, fmt.Errorf("method '%s' not found", method)
 		}
 		evmMethod = &m
 
 		inputData, err := util.Pack(evmMethod, params)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
 		inputDataHexStr := hex.EncodeToString(inputData)
@@ -531,14 +500,12 @@ func invokeContractTimes() error {
 			kvsMap := make(map[string]string)
 			err := json.Unmarshal([]byte(params), &kvsMap)
 			if err != nil {
-				return err
+				return nil, nil, err
 			}
 			kvs = util.ConvertParameters(kvsMap)
 		}
 	}
-
-	DispatchTimes(client, contractName, method, kvs, evmMethod)
-	return nil
+	return kvs, evmMethod, nil
 }
 
 func getUserContract() error {
@@ -0,0 +1,139 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"chainmaker.org/chainmaker-go/tools/cmc/util"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	sdk "chainmaker.org/chainmaker/sdk-go/v2"
+	"github.com/hokaccha/go-prettyjson"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// estimateGasMethod CHAIN_QUERY method answered by the node with the dry run result of an invoke tx
+	estimateGasMethod = "ESTIMATE_GAS"
+	// traceTxMethod CHAIN_QUERY method answered by the node with the debug trace of an invoke tx
+	traceTxMethod = "TRACE_TX"
+	// dryRunPayloadKey parameter key of the marshaled payload of the invoke tx
+	dryRunPayloadKey = "payload"
+)
+
+func estimateGasUserContractCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "estimate-gas",
+		Short: "estimate gas of invoking user contract",
+		Long: "estimate gas of invoking user contract, the invoke tx is executed by the node against the latest " +
+			"state without being committed, the gas used, the result and the read write set are printed",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return dryRunUserContract(estimateGasMethod)
+		},
+	}
+
+	attachFlags(cmd, []string{
+		flagUserSignKeyFilePath, flagUserSignCrtFilePath, flagUserTlsKeyFilePath, flagUserTlsCrtFilePath,
+		flagSdkConfPath, flagOrgId, flagChainId, flagEnableCertHash, flagContractName, flagMethod, flagParams,
+		flagAbiFilePath, flagGasLimit,
+	})
+
+	cmd.MarkFlagRequired(flagSdkConfPath)
+	cmd.MarkFlagRequired(flagContractName)
+	cmd.MarkFlagRequired(flagMethod)
+
+	return cmd
+}
+
+func traceUserContractCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trace",
+		Short: "trace invoking user contract",
+		Long: "trace invoking user contract, the invoke tx is executed by the node against the latest state " +
+			"without being committed, every state get/put/del, cross-contract call and event is printed " +
+			"in execution order",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return dryRunUserContract(traceTxMethod)
+		},
+	}
+
+	attachFlags(cmd, []string{
+		flagUserSignKeyFilePath, flagUserSignCrtFilePath, flagUserTlsKeyFilePath, flagUserTlsCrtFilePath,
+		flagSdkConfPath, flagOrgId, flagChainId, flagEnableCertHash, flagContractName, flagMethod, flagParams,
+		flagAbiFilePath, flagGasLimit,
+	})
+
+	cmd.MarkFlagRequired(flagSdkConfPath)
+	cmd.MarkFlagRequired(flagContractName)
+	cmd.MarkFlagRequired(flagMethod)
+
+	return cmd
+}
+
+// dryRunUserContract send the invoke tx built from the flags to the node as the payload of the CHAIN_QUERY method,
+// the node executes it without committing
+func dryRunUserContract(queryMethod string) error {
+	cc, err := sdk.NewChainClient(
+		sdk.WithConfPath(sdkConfPath),
+		sdk.WithChainClientChainId(chainId),
+		sdk.WithChainClientOrgId(orgId),
+		sdk.WithUserCrtFilePath(userTlsCrtFilePath),
+		sdk.WithUserKeyFilePath(userTlsKeyFilePath),
+		sdk.WithUserSignCrtFilePath(userSignCrtFilePath),
+		sdk.WithUserSignKeyFilePath(userSignKeyFilePath),
+	)
+	if err != nil {
+		return err
+	}
+	defer cc.Stop()
+	if err := util.DealChainClientCertHash(cc, enableCertHash); err != nil {
+		return err
+	}
+
+	kvs, _, err := userContractParams()
+	if err != nil {
+		return err
+	}
+
+	// the gas estimation charges the gas only if the limit is set, the trace never charges it
+	var limit *common.Limit
+	if gasLimit > 0 {
+		limit = &common.Limit{GasLimit: gasLimit}
+	}
+	payload := &common.Payload{
+		ChainId:      chainId,
+		TxType:       common.TxType_INVOKE_CONTRACT,
+		Timestamp:    time.Now().Unix(),
+		ContractName: contractName,
+		Method:       method,
+		Parameters:   kvs,
+		Limit:        limit,
+	}
+	payloadBytes, err := payload.Marshal()
+	if err != nil {
+		return err
+	}
+
+	resp, err := cc.QuerySystemContract(syscontract.SystemContract_CHAIN_QUERY.String(), queryMethod,
+		[]*common.KeyValuePair{{Key: dryRunPayloadKey, Value: payloadBytes}}, -1)
+	if err != nil {
+		return err
+	}
+	if err = util.CheckProposalRequestResp(resp, true); err != nil {
+		return err
+	}
+
+	output, err := prettyjson.Format(resp.ContractResult.Result)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(output))
+	return nil
+}
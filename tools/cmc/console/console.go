@@ -34,11 +34,16 @@ func NewConsoleCMD(rootCmd *cobra.Command) *cobra.Command {
 			rootCmd.RemoveCommand(cmd)
 			// add exit console command.
 			rootCmd.AddCommand(exitCmd)
+			// suggest the contract names, org ids etc. from the chain
+			annotateCommands(rootCmd)
 			fmt.Printf("Welcome to cmc console!\nPlease use `exit` or `Ctrl-D` to exit this program.\n")
 			defer fmt.Println("Bye!")
+			sess := newSession()
+			defer sess.close()
 			console := &CobraPrompt{
 				RootCmd:                rootCmd,
-				DynamicSuggestionsFunc: handleDynamicSuggestions,
+				DynamicSuggestionsFunc: sess.handleDynamicSuggestions,
+				ExecutedFunc:           sess.record,
 				GoPromptOptions: []prompt.Option{
 					prompt.OptionTitle("Interactive ChainMaker Client"),
 					prompt.OptionPrefix(">>> "),
@@ -53,10 +58,3 @@ func NewConsoleCMD(rootCmd *cobra.Command) *cobra.Command {
 
 	return cmd
 }
-
-func handleDynamicSuggestions(annotation string, _ *prompt.Document) []prompt.Suggest {
-	switch annotation {
-	default:
-		return []prompt.Suggest{}
-	}
-}
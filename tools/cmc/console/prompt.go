@@ -33,6 +33,9 @@ type CobraPrompt struct {
 	// DynamicSuggestionsFunc will be executed if an command has CallbackAnnotation as an annotation. If it's included
 	// the value will be provided to the DynamicSuggestionsFunc function.
 	DynamicSuggestionsFunc func(annotation string, document *prompt.Document) []prompt.Suggest
+
+	// ExecutedFunc will be executed with the arguments of every executed command line.
+	ExecutedFunc func(args []string)
 }
 
 // Run will automatically generate suggestions for all cobra commands and flags defined by RootCmd
@@ -43,6 +46,9 @@ func (co CobraPrompt) Run() {
 			promptArgs, _ := shlex.Split(in)
 			os.Args = append([]string{os.Args[0]}, promptArgs...)
 			co.RootCmd.Execute()
+			if co.ExecutedFunc != nil {
+				co.ExecutedFunc(promptArgs)
+			}
 		},
 		func(d prompt.Document) []prompt.Suggest {
 			return findSuggestions(&co, &d)
@@ -86,9 +92,69 @@ func findSuggestions(co *CobraPrompt, d *prompt.Document) []prompt.Suggest {
 		}
 	}
 
+	// the value of a flag is being typed, only its values are suggested
+	if flag, textPrefix, ok := findValueFlag(command, d); ok {
+		return findFlagValueSuggestions(co, flag, textPrefix, d)
+	}
+
 	annotation := command.Annotations[CallbackAnnotation]
 	if co.DynamicSuggestionsFunc != nil && annotation != "" {
 		suggestions = append(suggestions, co.DynamicSuggestionsFunc(annotation, d)...)
 	}
 	return prompt.FilterHasPrefix(suggestions, d.GetWordBeforeCursor(), true)
 }
+
+// findValueFlag returns the flag whose value is being typed before the cursor, in the form of `--name value`
+// or `--name=value`, textPrefix is "--name=" for the latter form
+func findValueFlag(command *cobra.Command, d *prompt.Document) (flag *pflag.Flag, textPrefix string, ok bool) {
+	word := d.GetWordBeforeCursor()
+	if strings.HasPrefix(word, "--") {
+		i := strings.Index(word, "=")
+		if i < 0 {
+			return nil, "", false
+		}
+		flag = lookupFlag(command, word[2:i])
+		return flag, word[:i+1], flag != nil
+	}
+
+	args := strings.Fields(d.TextBeforeCursor())
+	if word != "" {
+		args = args[:len(args)-1]
+	}
+	if len(args) == 0 {
+		return nil, "", false
+	}
+	last := args[len(args)-1]
+	if !strings.HasPrefix(last, "--") || strings.Contains(last, "=") {
+		return nil, "", false
+	}
+	flag = lookupFlag(command, last[2:])
+	// the flag without an option value e.g. the bool flag, does not take the next argument
+	if flag == nil || flag.NoOptDefVal != "" {
+		return nil, "", false
+	}
+	return flag, "", true
+}
+
+func lookupFlag(command *cobra.Command, name string) *pflag.Flag {
+	if flag := command.LocalFlags().Lookup(name); flag != nil {
+		return flag
+	}
+	return command.InheritedFlags().Lookup(name)
+}
+
+// findFlagValueSuggestions will be the suggestions of the DynamicSuggestionsFunc if the flag has
+// CallbackAnnotation as an annotation.
+func findFlagValueSuggestions(co *CobraPrompt, flag *pflag.Flag, textPrefix string,
+	d *prompt.Document) []prompt.Suggest {
+	annotation := flag.Annotations[CallbackAnnotation]
+	if co.DynamicSuggestionsFunc == nil || len(annotation) == 0 {
+		return []prompt.Suggest{}
+	}
+
+	suggestions := co.DynamicSuggestionsFunc(annotation[0], d)
+	for i := range suggestions {
+		suggestions[i].Text = textPrefix + suggestions[i].Text
+	}
+	return prompt.FilterHasPrefix(suggestions, d.GetWordBeforeCursor(), true)
+}
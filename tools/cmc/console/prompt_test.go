@@ -72,3 +72,37 @@ func TestFindSuggestions(t *testing.T) {
 		assert.Equal(t, "--verbose", suggestions[0].Text, "Should find verbose flag")
 	}
 }
+
+func TestFindFlagValueSuggestions(t *testing.T) {
+	getThingCmd.Flags().String("name", "", "The name")
+	_ = getThingCmd.Flags().SetAnnotation("name", CallbackAnnotation, []string{"names"})
+	cp := &CobraPrompt{
+		RootCmd: rootCmd,
+		DynamicSuggestionsFunc: func(annotation string, _ *prompt.Document) []prompt.Suggest {
+			if annotation != "names" {
+				return []prompt.Suggest{}
+			}
+			return []prompt.Suggest{{Text: "alice"}, {Text: "bob"}}
+		},
+	}
+
+	buf := prompt.NewBuffer()
+	buf.InsertText("get thing --name ", false, true)
+	suggestions := findSuggestions(cp, buf.Document())
+	assert.Len(t, suggestions, 2, "Should find 2 names")
+
+	buf.InsertText("b", false, true)
+	suggestions = findSuggestions(cp, buf.Document())
+	hasLen := assert.Len(t, suggestions, 1, "Should find the name with prefix b")
+	if hasLen {
+		assert.Equal(t, "bob", suggestions[0].Text, "Should find bob")
+	}
+
+	buf = prompt.NewBuffer()
+	buf.InsertText("get thing --name=a", false, true)
+	suggestions = findSuggestions(cp, buf.Document())
+	hasLen = assert.Len(t, suggestions, 1, "Should find the name with prefix a")
+	if hasLen {
+		assert.Equal(t, "--name=alice", suggestions[0].Text, "Should find alice after =")
+	}
+}
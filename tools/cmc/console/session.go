@@ -0,0 +1,318 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+	ethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/google/shlex"
+
+	sdk "chainmaker.org/chainmaker/sdk-go/v2"
+)
+
+const (
+	// the suggestions queried from the chain are refreshed after the ttl
+	suggestionsCacheTTL = time.Minute
+	// number of the tx ids used in the session kept for suggestions
+	maxHistoryTxIds = 20
+
+	flagSdkConfPath = "sdk-conf-path"
+	flagChainId     = "chain-id"
+	flagAbiFilePath = "abi-file-path"
+	flagContract    = "contract-name"
+	flagMethod      = "method"
+	flagParams      = "params"
+	flagTxId        = "tx-id"
+)
+
+var errSessionClosed = errors.New("the console session is closed")
+
+// session The state of a console session shared by the dynamic suggestions, i.e. the chain clients, the
+// cached suggestions, and what is learned from the executed command lines
+type session struct {
+	mu sync.Mutex
+	// chain clients by the sdk config path and chain id
+	clients map[string]*sdk.ChainClient
+	cache   map[string]*cachedSuggestions
+	// the session is closed, the clients created by the running loads are stopped
+	closed bool
+
+	// the sdk config path and chain id of the last executed command line, used if the line being typed
+	// has none
+	lastSdkConfPath string
+	lastChainId     string
+	// the invoked contract name -> method -> param keys
+	invoked map[string]map[string][]string
+	txIds   []string
+	// the loaded EVM ABIs by file path, reloaded if the file is modified
+	abis map[string]*loadedAbi
+}
+
+type loadedAbi struct {
+	abi     *ethabi.ABI
+	modTime time.Time
+}
+
+type cachedSuggestions struct {
+	suggestions []prompt.Suggest
+	expireAt    time.Time
+	loading     bool // a load is running in the background
+}
+
+// chainTarget the sdk config path and chain id of a chain client
+type chainTarget struct {
+	sdkConfPath string
+	chainId     string
+}
+
+func (t chainTarget) key() string {
+	return t.sdkConfPath + "#" + t.chainId
+}
+
+func newSession() *session {
+	return &session{
+		clients: make(map[string]*sdk.ChainClient),
+		cache:   make(map[string]*cachedSuggestions),
+		invoked: make(map[string]map[string][]string),
+		abis:    make(map[string]*loadedAbi),
+	}
+}
+
+// close stop the chain clients of the session
+func (s *session) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, cc := range s.clients {
+		_ = cc.Stop()
+	}
+	s.clients = make(map[string]*sdk.ChainClient)
+	s.closed = true
+}
+
+// cached returns the cached suggestions of key, empty if they are not loaded yet. They are loaded in the
+// background if not cached or expired, so the completer never waits for the node, the expired suggestions are
+// returned until the load is done. The failed load is cached as no suggestions too, so an unreachable node is not
+// dialed on every key stroke.
+func (s *session) cached(key string, load func() ([]prompt.Suggest, error)) []prompt.Suggest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, exists := s.cache[key]
+	if !exists {
+		entry = &cachedSuggestions{suggestions: []prompt.Suggest{}}
+		s.cache[key] = entry
+	}
+	if !entry.loading && !time.Now().Before(entry.expireAt) {
+		entry.loading = true
+		go s.load(entry, load)
+	}
+	return entry.suggestions
+}
+
+func (s *session) load(entry *cachedSuggestions, load func() ([]prompt.Suggest, error)) {
+	suggestions, err := load()
+	if err != nil || suggestions == nil {
+		suggestions = []prompt.Suggest{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry.suggestions, entry.expireAt, entry.loading = suggestions, time.Now().Add(suggestionsCacheTTL), false
+}
+
+// chainCached returns the cached suggestions queried from the chain of the line being typed, the chain client
+// is created and queried in the background by cached
+func (s *session) chainCached(args []string, name string,
+	query func(cc *sdk.ChainClient) ([]prompt.Suggest, error)) []prompt.Suggest {
+	target := s.chainTarget(args)
+	if target.sdkConfPath == "" {
+		return []prompt.Suggest{}
+	}
+	return s.cached(target.key()+"#"+name, func() ([]prompt.Suggest, error) {
+		cc, err := s.chainClient(target)
+		if err != nil {
+			return nil, err
+		}
+		return query(cc)
+	})
+}
+
+// chainTarget returns the sdk config path and chain id of the line being typed, or of the last executed
+// command line
+func (s *session) chainTarget(args []string) chainTarget {
+	target := chainTarget{sdkConfPath: flagValue(args, flagSdkConfPath), chainId: flagValue(args, flagChainId)}
+	if target.sdkConfPath == "" {
+		s.mu.Lock()
+		target = chainTarget{sdkConfPath: s.lastSdkConfPath, chainId: s.lastChainId}
+		s.mu.Unlock()
+	}
+	return target
+}
+
+// chainClient returns the client of the target, it is created if not exists. The lock is not held while
+// connecting the node, the client created by a concurrent call is kept if any
+func (s *session) chainClient(target chainTarget) (*sdk.ChainClient, error) {
+	key := target.key()
+	s.mu.Lock()
+	cc, exists := s.clients[key]
+	s.mu.Unlock()
+	if exists {
+		return cc, nil
+	}
+
+	// the cert hash is not enabled, which may send a tx, the client only queries
+	opts := []sdk.ChainClientOption{sdk.WithConfPath(target.sdkConfPath)}
+	if target.chainId != "" {
+		opts = append(opts, sdk.WithChainClientChainId(target.chainId))
+	}
+	cc, err := sdk.NewChainClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		_ = cc.Stop()
+		return nil, errSessionClosed
+	}
+	if existing, exists := s.clients[key]; exists {
+		_ = cc.Stop()
+		return existing, nil
+	}
+	s.clients[key] = cc
+	return cc, nil
+}
+
+// record learn from the arguments of an executed command line
+func (s *session) record(args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sdkConfPath := flagValue(args, flagSdkConfPath); sdkConfPath != "" {
+		s.lastSdkConfPath, s.lastChainId = sdkConfPath, flagValue(args, flagChainId)
+	}
+
+	if txId := flagValue(args, flagTxId); txId != "" {
+		s.addTxId(txId)
+	}
+
+	contractName, method := flagValue(args, flagContract), flagValue(args, flagMethod)
+	if contractName == "" || method == "" {
+		return
+	}
+	methods, exists := s.invoked[contractName]
+	if !exists {
+		methods = make(map[string][]string)
+		s.invoked[contractName] = methods
+	}
+	keys := methods[method]
+	// the params of a non EVM contract are a json object, the keys are suggested for the next invoke
+	var kvs map[string]interface{}
+	if err := json.Unmarshal([]byte(flagValue(args, flagParams)), &kvs); err == nil {
+		for k := range kvs {
+			keys = appendIfMissing(keys, k)
+		}
+		sort.Strings(keys)
+	}
+	methods[method] = keys
+}
+
+func (s *session) addTxId(txId string) {
+	for i, id := range s.txIds {
+		if id == txId {
+			s.txIds = append(s.txIds[:i], s.txIds[i+1:]...)
+			break
+		}
+	}
+	s.txIds = append([]string{txId}, s.txIds...)
+	if len(s.txIds) > maxHistoryTxIds {
+		s.txIds = s.txIds[:maxHistoryTxIds]
+	}
+}
+
+// invokedMethods returns the invoked methods of the contract and their param keys
+func (s *session) invokedMethods(contractName string) map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	methods := make(map[string][]string, len(s.invoked[contractName]))
+	for method, keys := range s.invoked[contractName] {
+		methods[method] = append([]string(nil), keys...)
+	}
+	return methods
+}
+
+// loadAbi returns the EVM ABI of the file, nil if it is invalid
+func (s *session) loadAbi(abiFilePath string) *ethabi.ABI {
+	if abiFilePath == "" {
+		return nil
+	}
+	info, err := os.Stat(abiFilePath)
+	if err != nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if loaded, exists := s.abis[abiFilePath]; exists && loaded.modTime.Equal(info.ModTime()) {
+		return loaded.abi
+	}
+	abiBytes, err := ioutil.ReadFile(abiFilePath)
+	if err != nil {
+		return nil
+	}
+	contractAbi, err := ethabi.JSON(bytes.NewReader(abiBytes))
+	if err != nil {
+		return nil
+	}
+	s.abis[abiFilePath] = &loadedAbi{abi: &contractAbi, modTime: info.ModTime()}
+	return &contractAbi
+}
+
+func (s *session) historyTxIds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.txIds...)
+}
+
+// lineArgs split the line being typed, the unterminated quote is allowed
+func lineArgs(d *prompt.Document) []string {
+	if args, err := shlex.Split(d.CurrentLine()); err == nil {
+		return args
+	}
+	return strings.Fields(d.CurrentLine())
+}
+
+// flagValue returns the value of the flag in args, in the form of `--name value` or `--name=value`
+func flagValue(args []string, name string) string {
+	for i, arg := range args {
+		if arg == "--"+name && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(arg, "--"+name+"=") {
+			return strings.TrimPrefix(arg, "--"+name+"=")
+		}
+	}
+	return ""
+}
+
+func appendIfMissing(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,85 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package console
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionRecord(t *testing.T) {
+	s := newSession()
+	s.record([]string{"client", "contract", "user", "invoke", "--contract-name=fact", "--method", "save",
+		"--params", `{"file_name":"name007","file_hash":"ab3456df5799b87c77e7f88"}`,
+		"--sdk-conf-path", "./testdata/sdk_config.yml"})
+	s.record([]string{"client", "contract", "user", "get", "--contract-name=fact", "--method", "save",
+		"--params", `{"time":"6543234"}`})
+	s.record([]string{"query", "tx", "--tx-id", "tx1"})
+	s.record([]string{"query", "tx", "--tx-id", "tx2"})
+	s.record([]string{"query", "tx", "--tx-id", "tx1"})
+
+	assert.Equal(t, "./testdata/sdk_config.yml", s.lastSdkConfPath)
+	assert.Equal(t, map[string][]string{"save": {"file_hash", "file_name", "time"}}, s.invokedMethods("fact"))
+	assert.Equal(t, []string{"tx1", "tx2"}, s.historyTxIds())
+}
+
+func TestSessionCached(t *testing.T) {
+	s := newSession()
+	release := make(chan struct{})
+	var loads int32
+	load := func() ([]prompt.Suggest, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return []prompt.Suggest{{Text: "fact"}}, nil
+	}
+	loaded := func() bool {
+		return len(s.cached("contracts", load)) == 1
+	}
+
+	// 1. not cached, the load runs in the background and does not block the completer
+	assert.Empty(t, s.cached("contracts", load))
+	// 2. the load is running, it is not started again
+	assert.Empty(t, s.cached("contracts", load))
+	close(release)
+	assert.Eventually(t, loaded, time.Second, time.Millisecond)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&loads))
+
+	// 3. expired, the expired suggestions are returned while reloading
+	s.mu.Lock()
+	s.cache["contracts"].expireAt = time.Now()
+	s.mu.Unlock()
+	assert.Equal(t, []prompt.Suggest{{Text: "fact"}}, s.cached("contracts", load))
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&loads) == 2
+	}, time.Second, time.Millisecond)
+
+	// 4. the failed load is cached as no suggestions
+	fail := func() ([]prompt.Suggest, error) {
+		atomic.AddInt32(&loads, 1)
+		return nil, errors.New("connection refused")
+	}
+	assert.Empty(t, s.cached("orgs", fail))
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&loads) == 3
+	}, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return !s.cache["orgs"].loading
+	}, time.Second, time.Millisecond)
+	assert.Empty(t, s.cached("orgs", fail))
+	assert.EqualValues(t, 3, atomic.LoadInt32(&loads))
+
+	// 5. no sdk config path, nothing is loaded
+	assert.Empty(t, s.chainCached([]string{"query", "tx"}, "txs", nil))
+	assert.Len(t, s.cache, 2)
+}
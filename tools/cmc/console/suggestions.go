@@ -0,0 +1,288 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package console
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+	ethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/spf13/cobra"
+
+	sdk "chainmaker.org/chainmaker/sdk-go/v2"
+)
+
+// The annotations of the dynamic suggestions
+const (
+	annotationContractName = "contract-name"
+	annotationMethod       = "method"
+	annotationParams       = "params"
+	annotationOrgId        = "org-id"
+	annotationNodeId       = "node-id"
+	annotationTxId         = "tx-id"
+	annotationBlockHeight  = "block-height"
+)
+
+// number of the latest blocks whose heights and tx ids are suggested
+const recentBlocks = 10
+
+// flagAnnotations The flags whose values are suggested, by flag name
+var flagAnnotations = map[string]string{
+	"contract-name":     annotationContractName,
+	"method":            annotationMethod,
+	"params":            annotationParams,
+	"org-id":            annotationOrgId,
+	"node-org-id":       annotationOrgId,
+	"trust-root-org-id": annotationOrgId,
+	"admin-org-ids":     annotationOrgId,
+	"node-id":           annotationNodeId,
+	"node-id-old":       annotationNodeId,
+	"tx-id":             annotationTxId,
+	"block-height":      annotationBlockHeight,
+}
+
+// commandAnnotations The commands whose arguments are suggested, by command path without the root
+var commandAnnotations = map[string]string{
+	"query tx":                    annotationTxId,
+	"query trace-tx":              annotationTxId,
+	"query block-by-txid":         annotationTxId,
+	"query block-by-height":       annotationBlockHeight,
+	"archive query tx":            annotationTxId,
+	"archive query block-by-txid": annotationTxId,
+}
+
+// annotateCommands set the CallbackAnnotation of the commands and flags under root which have dynamic
+// suggestions
+func annotateCommands(root *cobra.Command) {
+	var annotate func(cmd *cobra.Command)
+	annotate = func(cmd *cobra.Command) {
+		path := strings.TrimPrefix(cmd.CommandPath(), root.Name()+" ")
+		if annotation, exists := commandAnnotations[path]; exists {
+			if cmd.Annotations == nil {
+				cmd.Annotations = make(map[string]string)
+			}
+			cmd.Annotations[CallbackAnnotation] = annotation
+		}
+		for name, annotation := range flagAnnotations {
+			if cmd.Flags().Lookup(name) != nil {
+				_ = cmd.Flags().SetAnnotation(name, CallbackAnnotation, []string{annotation})
+			}
+		}
+		for _, sub := range cmd.Commands() {
+			annotate(sub)
+		}
+	}
+	annotate(root)
+}
+
+// handleDynamicSuggestions query the suggestions of annotation from the chain of the line being typed, or
+// from what is learned in the session
+func (s *session) handleDynamicSuggestions(annotation string, d *prompt.Document) []prompt.Suggest {
+	args := lineArgs(d)
+	switch annotation {
+	case annotationContractName:
+		return s.contractNameSuggestions(args)
+	case annotationMethod:
+		return s.methodSuggestions(args)
+	case annotationParams:
+		return s.paramsSuggestions(args)
+	case annotationOrgId:
+		return s.orgIdSuggestions(args)
+	case annotationNodeId:
+		return s.nodeIdSuggestions(args)
+	case annotationTxId:
+		return s.txIdSuggestions(args)
+	case annotationBlockHeight:
+		return s.blockHeightSuggestions(args)
+	default:
+		return []prompt.Suggest{}
+	}
+}
+
+func (s *session) contractNameSuggestions(args []string) []prompt.Suggest {
+	return s.chainCached(args, "contracts", func(cc *sdk.ChainClient) ([]prompt.Suggest, error) {
+		contracts, err := cc.GetContractList()
+		if err != nil {
+			return nil, err
+		}
+		suggestions := make([]prompt.Suggest, 0, len(contracts))
+		for _, contract := range contracts {
+			suggestions = append(suggestions, prompt.Suggest{
+				Text:        contract.Name,
+				Description: fmt.Sprintf("%s %s", contract.RuntimeType, contract.Version),
+			})
+		}
+		return suggestions, nil
+	})
+}
+
+// methodSuggestions the methods of the EVM ABI of --abi-file-path, and the methods invoked in the session
+func (s *session) methodSuggestions(args []string) []prompt.Suggest {
+	var suggestions []prompt.Suggest
+	if contractAbi := s.loadAbi(flagValue(args, flagAbiFilePath)); contractAbi != nil {
+		for _, method := range sortedAbiMethods(contractAbi) {
+			suggestions = append(suggestions, prompt.Suggest{Text: method.Name, Description: method.Sig})
+		}
+	}
+
+	methods := s.invokedMethods(flagValue(args, flagContract))
+	names := make([]string, 0, len(methods))
+	for method := range methods {
+		names = append(names, method)
+	}
+	sort.Strings(names)
+	for _, method := range names {
+		suggestions = append(suggestions, prompt.Suggest{Text: method, Description: "invoked in this session"})
+	}
+	return suggestions
+}
+
+// paramsSuggestions the params template of --method, in the form of the EVM ABI inputs, or of the keys
+// invoked in the session
+func (s *session) paramsSuggestions(args []string) []prompt.Suggest {
+	method := flagValue(args, flagMethod)
+	if method == "" {
+		return []prompt.Suggest{}
+	}
+
+	if contractAbi := s.loadAbi(flagValue(args, flagAbiFilePath)); contractAbi != nil {
+		m, exists := contractAbi.Methods[method]
+		if !exists {
+			return []prompt.Suggest{}
+		}
+		inputs := make([]string, 0, len(m.Inputs))
+		for _, input := range m.Inputs {
+			inputs = append(inputs, fmt.Sprintf(`{"%s":""}`, input.Type.String()))
+		}
+		return []prompt.Suggest{{Text: "'[" + strings.Join(inputs, ",") + "]'", Description: m.Sig}}
+	}
+
+	keys, exists := s.invokedMethods(flagValue(args, flagContract))[method]
+	if !exists || len(keys) == 0 {
+		return []prompt.Suggest{}
+	}
+	kvs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, fmt.Sprintf(`"%s":""`, k))
+	}
+	return []prompt.Suggest{{Text: "'{" + strings.Join(kvs, ",") + "}'", Description: "invoked in this session"}}
+}
+
+// orgIdSuggestions the orgs of the trust roots and the consensus nodes of the chain config
+func (s *session) orgIdSuggestions(args []string) []prompt.Suggest {
+	return s.chainCached(args, "orgs", func(cc *sdk.ChainClient) ([]prompt.Suggest, error) {
+		chainConfig, err := cc.GetChainConfig()
+		if err != nil {
+			return nil, err
+		}
+		var orgIds []string
+		for _, root := range chainConfig.TrustRoots {
+			orgIds = appendIfMissing(orgIds, root.OrgId)
+		}
+		for _, node := range chainConfig.Consensus.Nodes {
+			orgIds = appendIfMissing(orgIds, node.OrgId)
+		}
+		suggestions := make([]prompt.Suggest, 0, len(orgIds))
+		for _, orgId := range orgIds {
+			suggestions = append(suggestions, prompt.Suggest{Text: orgId, Description: "org of the chain config"})
+		}
+		return suggestions, nil
+	})
+}
+
+// nodeIdSuggestions the consensus nodes of the chain config
+func (s *session) nodeIdSuggestions(args []string) []prompt.Suggest {
+	return s.chainCached(args, "nodes", func(cc *sdk.ChainClient) ([]prompt.Suggest, error) {
+		chainConfig, err := cc.GetChainConfig()
+		if err != nil {
+			return nil, err
+		}
+		var suggestions []prompt.Suggest
+		for _, node := range chainConfig.Consensus.Nodes {
+			for _, nodeId := range node.NodeId {
+				suggestions = append(suggestions, prompt.Suggest{Text: nodeId, Description: node.OrgId})
+			}
+		}
+		return suggestions, nil
+	})
+}
+
+// txIdSuggestions the tx ids used in the session, and the txs of the recent blocks
+func (s *session) txIdSuggestions(args []string) []prompt.Suggest {
+	var suggestions []prompt.Suggest
+	for _, txId := range s.historyTxIds() {
+		suggestions = append(suggestions, prompt.Suggest{Text: txId, Description: "used in this session"})
+	}
+
+	return append(suggestions, s.chainCached(args, "txs", func(cc *sdk.ChainClient) ([]prompt.Suggest, error) {
+		var txs []prompt.Suggest
+		err := visitRecentBlocks(cc, func(height uint64, txIds []string, _ int64) {
+			for _, txId := range txIds {
+				txs = append(txs, prompt.Suggest{Text: txId, Description: fmt.Sprintf("block %d", height)})
+			}
+		})
+		return txs, err
+	})...)
+}
+
+// blockHeightSuggestions the heights of the recent blocks
+func (s *session) blockHeightSuggestions(args []string) []prompt.Suggest {
+	return s.chainCached(args, "blocks", func(cc *sdk.ChainClient) ([]prompt.Suggest, error) {
+		var blocks []prompt.Suggest
+		err := visitRecentBlocks(cc, func(height uint64, txIds []string, timestamp int64) {
+			blocks = append(blocks, prompt.Suggest{
+				Text: strconv.FormatUint(height, 10),
+				Description: fmt.Sprintf("%d txs, %s", len(txIds),
+					time.Unix(timestamp, 0).Format("2006-01-02 15:04:05")),
+			})
+		})
+		return blocks, err
+	})
+}
+
+// visitRecentBlocks visit the latest blocks from the last one
+func visitRecentBlocks(cc *sdk.ChainClient, visit func(height uint64, txIds []string, timestamp int64)) error {
+	lastBlock, err := cc.GetLastBlock(false)
+	if err != nil {
+		return err
+	}
+
+	block := lastBlock.Block
+	for i := 0; i < recentBlocks; i++ {
+		txIds := make([]string, 0, len(block.Txs))
+		for _, tx := range block.Txs {
+			txIds = append(txIds, tx.Payload.TxId)
+		}
+		visit(block.Header.BlockHeight, txIds, block.Header.BlockTimestamp)
+
+		if block.Header.BlockHeight == 0 {
+			return nil
+		}
+		blockInfo, err := cc.GetBlockByHeight(block.Header.BlockHeight-1, false)
+		if err != nil {
+			return err
+		}
+		block = blockInfo.Block
+	}
+	return nil
+}
+
+// sortedAbiMethods returns the methods of the ABI sorted by name
+func sortedAbiMethods(contractAbi *ethabi.ABI) []ethabi.Method {
+	methods := make([]ethabi.Method, 0, len(contractAbi.Methods))
+	for _, method := range contractAbi.Methods {
+		methods = append(methods, method)
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].Name < methods[j].Name
+	})
+	return methods
+}
@@ -218,6 +218,7 @@ func ParallelCMD() *cobra.Command {
 	cmd.AddCommand(queryCMD())
 	cmd.AddCommand(createContractCMD())
 	cmd.AddCommand(upgradeContractCMD())
+	cmd.AddCommand(scenarioCMD())
 
 	return cmd
 }
@@ -865,6 +866,24 @@ func sendRequest(sk3 crypto.PrivateKey, client apiPb.RpcNodeClient, msg *Invoker
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Duration(time.Duration(requestTimeout)*time.Second)))
 	defer cancel()
 
+	req, err := signRequest(sk3, orgId, userCrtPath, payload, endorsers)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.SendRequest(ctx, req)
+	if err != nil {
+		if statusErr, ok := status.FromError(err); ok && statusErr.Code() == codes.DeadlineExceeded {
+			return nil, fmt.Errorf("client.call err: deadline\n")
+		}
+		return nil, fmt.Errorf("client.call err: %v\n", err)
+	}
+	return result, nil
+}
+
+// signRequest build the TxRequest of the payload signed by sk3
+func signRequest(sk3 crypto.PrivateKey, orgId, userCrtPath string, payload *commonPb.Payload,
+	endorsers []*commonPb.EndorsementEntry) (*commonPb.TxRequest, error) {
 	// 构造Sender
 	var sender *acPb.Member
 	if authType == sdk.Public {
@@ -938,13 +957,5 @@ func sendRequest(sk3 crypto.PrivateKey, client apiPb.RpcNodeClient, msg *Invoker
 	}
 
 	req.Sender.Signature = signBytes
-
-	result, err := client.SendRequest(ctx, req)
-	if err != nil {
-		if statusErr, ok := status.FromError(err); ok && statusErr.Code() == codes.DeadlineExceeded {
-			return nil, fmt.Errorf("client.call err: deadline\n")
-		}
-		return nil, fmt.Errorf("client.call err: %v\n", err)
-	}
-	return result, nil
+	return req, nil
 }
@@ -0,0 +1,412 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package parallel
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// operation types of the scenario
+const (
+	operationInvoke = "invoke"
+	operationQuery  = "query"
+)
+
+// parameter generators of the scenario
+const (
+	generatorConst        = "const"
+	generatorSequence     = "sequence"
+	generatorRandomInt    = "random_int"
+	generatorRandomString = "random_string"
+	generatorChoice       = "choice"
+)
+
+const randomStringLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// Scenario A load test described by a yaml file, the operations are sent open-loop at the arrival rates of
+// the phases, i.e. a request is not delayed by the responses of the previous ones
+type Scenario struct {
+	Name string `mapstructure:"name"`
+	// the requests in flight are limited, the arrival is dropped if all of them are busy
+	MaxInFlight int `mapstructure:"max_in_flight"`
+	// how long to wait for the confirmations of the invokes after the last phase
+	ConfirmTimeout time.Duration `mapstructure:"confirm_timeout"`
+
+	Phases     []*ScenarioPhase     `mapstructure:"phases"`
+	Operations []*ScenarioOperation `mapstructure:"operations"`
+}
+
+// ScenarioPhase The arrival rate (requests per second) ramps linearly from Rate to TargetRate in Duration,
+// the rate is constant if TargetRate is 0
+type ScenarioPhase struct {
+	Name       string        `mapstructure:"name"`
+	Duration   time.Duration `mapstructure:"duration"`
+	Rate       float64       `mapstructure:"rate"`
+	TargetRate float64       `mapstructure:"target_rate"`
+}
+
+// ScenarioOperation An invoke or query of a contract method, picked by Weight among the operations
+type ScenarioOperation struct {
+	Name     string            `mapstructure:"name"`
+	Type     string            `mapstructure:"type"`
+	Weight   int               `mapstructure:"weight"`
+	Contract string            `mapstructure:"contract"`
+	Method   string            `mapstructure:"method"`
+	AbiPath  string            `mapstructure:"abi_path"` // the EVM contract abi, only for invoke
+	Params   []*ParamGenerator `mapstructure:"params"`
+}
+
+// ParamGenerator Generates the value of a parameter for every request
+type ParamGenerator struct {
+	seq int64 // first for the 64-bit alignment of atomic
+
+	Key       string `mapstructure:"key"`
+	Generator string `mapstructure:"generator"`
+	// the value of const, or the prefix of sequence and random_string
+	Value   string   `mapstructure:"value"`
+	Min     int64    `mapstructure:"min"`
+	Max     int64    `mapstructure:"max"`
+	Length  int      `mapstructure:"length"`
+	Choices []string `mapstructure:"choices"`
+}
+
+// LoadScenario read and validate the scenario yaml file, the contract name of the operations default to
+// defaultContract
+func LoadScenario(path, defaultContract string, defaultMaxInFlight int) (*Scenario, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	scenario := &Scenario{}
+	if err := v.Unmarshal(scenario); err != nil {
+		return nil, err
+	}
+
+	if scenario.MaxInFlight <= 0 {
+		scenario.MaxInFlight = defaultMaxInFlight
+	}
+	if scenario.ConfirmTimeout <= 0 {
+		scenario.ConfirmTimeout = 30 * time.Second
+	}
+	for _, op := range scenario.Operations {
+		if op.Contract == "" {
+			op.Contract = defaultContract
+		}
+	}
+	if err := scenario.validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario %s, %s", path, err)
+	}
+	return scenario, nil
+}
+
+func (s *Scenario) validate() error {
+	if len(s.Phases) == 0 {
+		return errors.New("no phases")
+	}
+	for i, phase := range s.Phases {
+		if phase.Name == "" {
+			phase.Name = fmt.Sprintf("phase%d", i)
+		}
+		if phase.Duration <= 0 {
+			return fmt.Errorf("duration of phase %s must be positive", phase.Name)
+		}
+		if phase.Rate < 0 || phase.TargetRate < 0 || phase.Rate+phase.TargetRate == 0 {
+			return fmt.Errorf("rate of phase %s must be positive", phase.Name)
+		}
+	}
+
+	if len(s.Operations) == 0 {
+		return errors.New("no operations")
+	}
+	names := make(map[string]struct{}, len(s.Operations))
+	for i, op := range s.Operations {
+		if op.Name == "" {
+			op.Name = fmt.Sprintf("%s_%s", op.Type, op.Method)
+		}
+		if _, exists := names[op.Name]; exists {
+			return fmt.Errorf("duplicate operation %s", op.Name)
+		}
+		names[op.Name] = struct{}{}
+
+		if op.Type != operationInvoke && op.Type != operationQuery {
+			return fmt.Errorf("type of operation[%d] must be %s or %s", i, operationInvoke, operationQuery)
+		}
+		if op.Weight <= 0 {
+			return fmt.Errorf("weight of operation %s must be positive", op.Name)
+		}
+		if op.Contract == "" || op.Method == "" {
+			return fmt.Errorf("contract and method of operation %s are required", op.Name)
+		}
+		for _, p := range op.Params {
+			if err := p.validate(); err != nil {
+				return fmt.Errorf("param %s of operation %s, %s", p.Key, op.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// arrivalAt returns the offset of the k-th (from 1) arrival in the phase, false if it is after the phase.
+// As the rate ramps linearly, the arrivals until t are rate*t + (targetRate-rate)*t*t/(2*duration).
+func (p *ScenarioPhase) arrivalAt(k int) (time.Duration, bool) {
+	d, r0, r1 := p.Duration.Seconds(), p.Rate, p.TargetRate
+	if r1 == 0 {
+		r1 = r0
+	}
+	if float64(k) > (r0+r1)/2*d {
+		return 0, false
+	}
+
+	var t float64
+	if a := (r1 - r0) / (2 * d); a == 0 {
+		t = float64(k) / r0
+	} else {
+		t = (-r0 + math.Sqrt(math.Max(0, r0*r0+4*a*float64(k)))) / (2 * a)
+	}
+	return time.Duration(t * float64(time.Second)), true
+}
+
+// pickOperation pick an operation by the weights, n is random in [0, sum of the weights)
+func (s *Scenario) pickOperation(n int) *ScenarioOperation {
+	for _, op := range s.Operations {
+		if n < op.Weight {
+			return op
+		}
+		n -= op.Weight
+	}
+	return s.Operations[len(s.Operations)-1]
+}
+
+func (s *Scenario) totalWeight() int {
+	var total int
+	for _, op := range s.Operations {
+		total += op.Weight
+	}
+	return total
+}
+
+func (p *ParamGenerator) validate() error {
+	if p.Key == "" {
+		return errors.New("key is required")
+	}
+	switch p.Generator {
+	case "", generatorConst, generatorSequence:
+	case generatorRandomInt:
+		if p.Max < p.Min {
+			return errors.New("max < min")
+		}
+	case generatorRandomString:
+		if p.Length <= 0 {
+			return errors.New("length must be positive")
+		}
+	case generatorChoice:
+		if len(p.Choices) == 0 {
+			return errors.New("choices are required")
+		}
+	default:
+		return fmt.Errorf("unknown generator %s", p.Generator)
+	}
+	return nil
+}
+
+// generate the value of the parameter, r must not be shared by goroutines
+func (p *ParamGenerator) generate(r *rand.Rand) string {
+	switch p.Generator {
+	case generatorSequence:
+		return p.Value + strconv.FormatInt(atomic.AddInt64(&p.seq, 1), 10)
+	case generatorRandomInt:
+		return strconv.FormatInt(p.Min+r.Int63n(p.Max-p.Min+1), 10)
+	case generatorRandomString:
+		b := make([]byte, p.Length)
+		for i := range b {
+			b[i] = randomStringLetters[r.Intn(len(randomStringLetters))]
+		}
+		return p.Value + string(b)
+	case generatorChoice:
+		return p.Choices[r.Intn(len(p.Choices))]
+	default:
+		return p.Value
+	}
+}
+
+// LatencyReport The latencies in milliseconds
+type LatencyReport struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// newLatencyReport returns the report of the samples, the samples are sorted
+func newLatencyReport(samples []time.Duration) *LatencyReport {
+	report := &LatencyReport{}
+	if len(samples) == 0 {
+		return report
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	var sum time.Duration
+	for _, sample := range samples {
+		sum += sample
+	}
+	// nearest-rank percentile
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p / 100 * float64(len(samples))))
+		if rank < 1 {
+			rank = 1
+		}
+		return toMillis(samples[rank-1])
+	}
+	report.Min = toMillis(samples[0])
+	report.Avg = toMillis(sum / time.Duration(len(samples)))
+	report.P50 = percentile(50)
+	report.P95 = percentile(95)
+	report.P99 = percentile(99)
+	report.Max = toMillis(samples[len(samples)-1])
+	return report
+}
+
+func toMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// OperationReport The results of an operation, the errors are counted by TxStatusCode, or RPC_ERROR if the
+// request is not responded
+type OperationReport struct {
+	Name    string         `json:"name"`
+	Type    string         `json:"type"`
+	Count   int            `json:"count"`
+	Success int            `json:"success"`
+	Failed  int            `json:"failed"`
+	Latency *LatencyReport `json:"latency"`
+	Errors  map[string]int `json:"errors"`
+
+	// the invokes responded with SUCCESS are confirmed by the tx subscription
+	Confirmed      int            `json:"confirmed,omitempty"`
+	Unconfirmed    int            `json:"unconfirmed,omitempty"`
+	ConfirmedTPS   float64        `json:"confirmed_tps,omitempty"`
+	ConfirmLatency *LatencyReport `json:"confirm_latency,omitempty"`
+	// the results of the confirmed txs which are not SUCCESS
+	ConfirmErrors map[string]int `json:"confirm_errors,omitempty"`
+}
+
+// PhaseReport The arrivals of a phase
+type PhaseReport struct {
+	Name       string  `json:"name"`
+	Duration   float64 `json:"duration"`
+	Rate       float64 `json:"rate"`
+	TargetRate float64 `json:"target_rate,omitempty"`
+	Scheduled  int     `json:"scheduled"`
+	Dropped    int     `json:"dropped"`
+}
+
+// ScenarioReport The machine-readable result of a scenario run
+type ScenarioReport struct {
+	Scenario     string             `json:"scenario"`
+	StartTime    string             `json:"start_time"`
+	EndTime      string             `json:"end_time"`
+	Elapsed      float64            `json:"elapsed"`
+	Count        int                `json:"count"`
+	Success      int                `json:"success"`
+	Failed       int                `json:"failed"`
+	Dropped      int                `json:"dropped"`
+	TPS          float64            `json:"tps"`
+	Confirmed    int                `json:"confirmed"`
+	ConfirmedTPS float64            `json:"confirmed_tps"`
+	Latency      *LatencyReport     `json:"latency"`
+	Phases       []*PhaseReport     `json:"phases"`
+	Operations   []*OperationReport `json:"operations"`
+}
+
+// operationStats collects the results of an operation
+type operationStats struct {
+	mu sync.Mutex
+
+	count          int
+	success        int
+	latencies      []time.Duration
+	errors         map[string]int
+	confirmed      int
+	confirmations  []time.Duration
+	confirmErrors  map[string]int
+	lastConfirmed  time.Time
+	firstScheduled time.Time
+}
+
+func newOperationStats() *operationStats {
+	return &operationStats{
+		errors:        make(map[string]int),
+		confirmErrors: make(map[string]int),
+	}
+}
+
+// addResult record a response, errCode is empty if it is success
+func (s *operationStats) addResult(scheduled time.Time, latency time.Duration, errCode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.firstScheduled.IsZero() || scheduled.Before(s.firstScheduled) {
+		s.firstScheduled = scheduled
+	}
+	s.count++
+	s.latencies = append(s.latencies, latency)
+	if errCode == "" {
+		s.success++
+		return
+	}
+	s.errors[errCode]++
+}
+
+// addConfirmation record a tx seen by the subscription, errCode is empty if its result is success
+func (s *operationStats) addConfirmation(confirmedAt time.Time, latency time.Duration, errCode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.confirmed++
+	s.confirmations = append(s.confirmations, latency)
+	if confirmedAt.After(s.lastConfirmed) {
+		s.lastConfirmed = confirmedAt
+	}
+	if errCode != "" {
+		s.confirmErrors[errCode]++
+	}
+}
+
+func (s *operationStats) report(op *ScenarioOperation) *OperationReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := &OperationReport{
+		Name:    op.Name,
+		Type:    op.Type,
+		Count:   s.count,
+		Success: s.success,
+		Failed:  s.count - s.success,
+		Latency: newLatencyReport(append([]time.Duration(nil), s.latencies...)),
+		Errors:  s.errors,
+	}
+	if op.Type == operationInvoke {
+		report.Confirmed = s.confirmed
+		report.Unconfirmed = s.success - s.confirmed
+		report.ConfirmLatency = newLatencyReport(append([]time.Duration(nil), s.confirmations...))
+		report.ConfirmErrors = s.confirmErrors
+		if s.confirmed > 0 {
+			report.ConfirmedTPS = float64(s.confirmed) / s.lastConfirmed.Sub(s.firstScheduled).Seconds()
+		}
+	}
+	return report
+}
@@ -0,0 +1,423 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package parallel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"chainmaker.org/chainmaker/common/v2/bytehelper"
+	apiPb "chainmaker.org/chainmaker/pb-go/v2/api"
+	commonPb "chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	sdk "chainmaker.org/chainmaker/sdk-go/v2"
+	"chainmaker.org/chainmaker/utils/v2"
+	"github.com/spf13/cobra"
+)
+
+const (
+	scenarioStr = "scenario"
+
+	// the error of the request which is not responded
+	errCodeRPC = "RPC_ERROR"
+	// the error of the request which can not be built, e.g. the params do not match the abi
+	errCodeInvalidRequest = "INVALID_REQUEST"
+
+	timeFormat = "2006-01-02 15:04:05.000"
+)
+
+var (
+	scenarioFile string
+	reportFile   string
+)
+
+func scenarioCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   scenarioStr,
+		Short: "Scenario",
+		Long: "Run the weighted invokes and queries of a scenario yaml file at the open-loop arrival rates " +
+			"of its phases, and report the latencies, the confirmed tps and the errors in json",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runScenario()
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&scenarioFile, "scenario-file", "f", "", "specify scenario yaml file")
+	flags.StringVarP(&reportFile, "report-file", "o", "", "specify json report file, print to stdout if empty")
+	_ = cmd.MarkFlagRequired("scenario-file")
+
+	return cmd
+}
+
+type scenarioJob struct {
+	op        *ScenarioOperation
+	scheduled time.Time
+}
+
+// pendingTx An invoke responded with SUCCESS, waiting for its tx from the subscription
+type pendingTx struct {
+	stats     *operationStats
+	scheduled time.Time
+}
+
+type scenarioRunner struct {
+	scenario *Scenario
+	// the connections to the nodes, the requests are sent round-robin
+	nodes  []*Thread
+	stats  map[string]*operationStats // by operation name
+	phases []*PhaseReport
+
+	pending      sync.Map // tx id -> *pendingTx
+	pendingCount int64
+}
+
+func runScenario() error {
+	scenario, err := LoadScenario(scenarioFile, contractName, threadNum)
+	if err != nil {
+		return err
+	}
+
+	runner := &scenarioRunner{
+		scenario: scenario,
+		stats:    make(map[string]*operationStats, len(scenario.Operations)),
+	}
+	for _, op := range scenario.Operations {
+		runner.stats[op.Name] = newOperationStats()
+	}
+	for i := 0; i < nodeNum; i++ {
+		node := &Thread{id: i}
+		if err = node.Init(); err != nil {
+			return err
+		}
+		defer node.Stop()
+		runner.nodes = append(runner.nodes, node)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err = runner.subscribe(ctx); err != nil {
+		return err
+	}
+
+	//// run the phases
+	startTime := time.Now()
+	jobs := make(chan *scenarioJob, scenario.MaxInFlight)
+	var wg sync.WaitGroup
+	for i := 0; i < scenario.MaxInFlight; i++ {
+		wg.Add(1)
+		go func(node *Thread, seed int64) {
+			defer wg.Done()
+			random := rand.New(rand.NewSource(seed))
+			for job := range jobs {
+				runner.handle(node, random, job)
+			}
+		}(runner.nodes[i%len(runner.nodes)], startTime.UnixNano()+int64(i))
+	}
+	go runner.printProgress(ctx, startTime)
+
+	runner.dispatch(startTime, jobs)
+	close(jobs)
+	wg.Wait()
+	sendEndTime := time.Now()
+
+	//// wait for the confirmations
+	deadline := sendEndTime.Add(scenario.ConfirmTimeout)
+	for atomic.LoadInt64(&runner.pendingCount) > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	cancel()
+
+	return writeScenarioReport(runner.report(startTime, sendEndTime, time.Now()))
+}
+
+// dispatch send the jobs at the arrival times of the phases, the phases are run one by one
+func (r *scenarioRunner) dispatch(startTime time.Time, jobs chan<- *scenarioJob) {
+	random := rand.New(rand.NewSource(startTime.UnixNano()))
+	totalWeight := r.scenario.totalWeight()
+
+	phaseStartTime := startTime
+	for _, phase := range r.scenario.Phases {
+		report := &PhaseReport{
+			Name:       phase.Name,
+			Duration:   phase.Duration.Seconds(),
+			Rate:       phase.Rate,
+			TargetRate: phase.TargetRate,
+		}
+		r.phases = append(r.phases, report)
+		fmt.Printf("phase %s started\n", phase.Name)
+
+		for k := 1; ; k++ {
+			offset, ok := phase.arrivalAt(k)
+			if !ok {
+				break
+			}
+			scheduled := phaseStartTime.Add(offset)
+			if wait := time.Until(scheduled); wait > 0 {
+				time.Sleep(wait)
+			}
+
+			report.Scheduled++
+			select {
+			case jobs <- &scenarioJob{op: r.scenario.pickOperation(random.Intn(totalWeight)), scheduled: scheduled}:
+			default:
+				// open-loop, the arrival is not delayed by the busy requests
+				report.Dropped++
+			}
+		}
+
+		phaseStartTime = phaseStartTime.Add(phase.Duration)
+		if wait := time.Until(phaseStartTime); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+}
+
+// handle send the request of the job, the latency is measured from the arrival time, so the time queued
+// behind the busy requests is included
+func (r *scenarioRunner) handle(node *Thread, random *rand.Rand, job *scenarioJob) {
+	op, stats := job.op, r.stats[job.op.Name]
+
+	payload, err := buildScenarioPayload(op, random)
+	if err != nil {
+		stats.addResult(job.scheduled, time.Since(job.scheduled), errCodeInvalidRequest)
+		if recordLog {
+			log.Errorf("build request of operation %s failed, %s", op.Name, err)
+		}
+		return
+	}
+
+	// the tx may be received before the response
+	if op.Type == operationInvoke {
+		r.pending.Store(payload.TxId, &pendingTx{stats: stats, scheduled: job.scheduled})
+		atomic.AddInt64(&r.pendingCount, 1)
+	}
+
+	var orgId, userCrtPath string
+	if authType == sdk.PermissionedWithKey {
+		orgId = orgIDs[node.index]
+	} else if authType != sdk.Public {
+		orgId, userCrtPath = orgIDs[node.index], userCrtPaths[node.index]
+	}
+	resp, err := sendRequest(node.sk3, node.client, &InvokerMsg{txType: payload.TxType, txId: payload.TxId,
+		chainId: chainId}, orgId, userCrtPath, payload, nil)
+	latency := time.Since(job.scheduled)
+
+	var errCode string
+	if err != nil {
+		errCode = errCodeRPC
+	} else if resp.Code != commonPb.TxStatusCode_SUCCESS {
+		errCode = resp.Code.String()
+	}
+	stats.addResult(job.scheduled, latency, errCode)
+
+	if errCode != "" {
+		if op.Type == operationInvoke {
+			if _, loaded := r.pending.LoadAndDelete(payload.TxId); loaded {
+				atomic.AddInt64(&r.pendingCount, -1)
+			}
+		}
+		if recordLog {
+			log.Errorf("operation: %s, nodeId: %d, txId: %s, err: %s, resp: %+v", op.Name, node.index,
+				payload.TxId, err, resp)
+		}
+	}
+}
+
+// buildScenarioPayload build the payload of the operation with the generated params
+func buildScenarioPayload(op *ScenarioOperation, random *rand.Rand) (*commonPb.Payload, error) {
+	pairs := make([]*commonPb.KeyValuePair, 0, len(op.Params))
+	for _, p := range op.Params {
+		pairs = append(pairs, &commonPb.KeyValuePair{
+			Key:   p.Key,
+			Value: []byte(p.generate(random)),
+		})
+	}
+
+	if op.Type == operationQuery {
+		payload, err := constructQueryPayload(chainId, op.Contract, op.Method, pairs, gasLimit)
+		if err != nil {
+			return nil, err
+		}
+		payload.TxId = utils.GetTimestampTxId()
+		payload.Timestamp = time.Now().Unix()
+		return payload, nil
+	}
+
+	method := op.Method
+	if op.AbiPath != "" {
+		var err error
+		method, pairs, err = makePairs(op.Method, op.AbiPath, pairs, commonPb.RuntimeType_EVM,
+			abiCache.Read(op.AbiPath))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return constructInvokePayload(chainId, op.Contract, method, pairs, gasLimit)
+}
+
+// subscribe the txs of the invoked contracts from the first node, an invoke is confirmed when its tx is
+// received
+func (r *scenarioRunner) subscribe(ctx context.Context) error {
+	contracts := make(map[string]struct{})
+	for _, op := range r.scenario.Operations {
+		if op.Type == operationInvoke {
+			contracts[op.Contract] = struct{}{}
+		}
+	}
+
+	node := r.nodes[0]
+	var orgId, userCrtPath string
+	if authType == sdk.PermissionedWithKey {
+		orgId = orgIDs[node.index]
+	} else if authType != sdk.Public {
+		orgId, userCrtPath = orgIDs[node.index], userCrtPaths[node.index]
+	}
+	for contract := range contracts {
+		payload := &commonPb.Payload{
+			ChainId:      chainId,
+			TxType:       commonPb.TxType_SUBSCRIBE,
+			TxId:         utils.GetTimestampTxId(),
+			Timestamp:    time.Now().Unix(),
+			ContractName: syscontract.SystemContract_SUBSCRIBE_MANAGE.String(),
+			Method:       syscontract.SubscribeFunction_SUBSCRIBE_TX.String(),
+			Parameters: []*commonPb.KeyValuePair{
+				{Key: syscontract.SubscribeTx_START_BLOCK.String(), Value: bytehelper.Int64ToBytes(-1)},
+				{Key: syscontract.SubscribeTx_END_BLOCK.String(), Value: bytehelper.Int64ToBytes(-1)},
+				{Key: syscontract.SubscribeTx_CONTRACT_NAME.String(), Value: []byte(contract)},
+			},
+		}
+		req, err := signRequest(node.sk3, orgId, userCrtPath, payload, nil)
+		if err != nil {
+			return err
+		}
+		stream, err := node.client.Subscribe(ctx, req)
+		if err != nil {
+			return fmt.Errorf("subscribe txs of contract %s failed, %s", contract, err)
+		}
+		go r.receive(ctx, contract, stream)
+	}
+	return nil
+}
+
+func (r *scenarioRunner) receive(ctx context.Context, contract string, stream apiPb.RpcNode_SubscribeClient) {
+	for {
+		result, err := stream.Recv()
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Printf("Warning: subscription of contract %s is closed, %s\n", contract, err)
+			}
+			return
+		}
+		confirmedAt := time.Now()
+
+		tx := &commonPb.Transaction{}
+		if err = tx.Unmarshal(result.Data); err != nil || tx.Payload == nil {
+			continue
+		}
+		v, loaded := r.pending.LoadAndDelete(tx.Payload.TxId)
+		if !loaded {
+			continue
+		}
+		atomic.AddInt64(&r.pendingCount, -1)
+
+		p := v.(*pendingTx)
+		var errCode string
+		if tx.Result != nil && tx.Result.Code != commonPb.TxStatusCode_SUCCESS {
+			errCode = tx.Result.Code.String()
+		}
+		p.stats.addConfirmation(confirmedAt, confirmedAt.Sub(p.scheduled), errCode)
+	}
+}
+
+// printProgress print the counts every --printTime seconds
+func (r *scenarioRunner) printProgress(ctx context.Context, startTime time.Time) {
+	ticker := time.NewTicker(time.Duration(printTime) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var count, success, confirmed int
+			for _, stats := range r.stats {
+				stats.mu.Lock()
+				count, success, confirmed = count+stats.count, success+stats.success, confirmed+stats.confirmed
+				stats.mu.Unlock()
+			}
+			fmt.Printf("elapsed: %.1fs, count: %d, success: %d, confirmed: %d, pending: %d\n",
+				time.Since(startTime).Seconds(), count, success, confirmed, atomic.LoadInt64(&r.pendingCount))
+		}
+	}
+}
+
+// report build the report, the tps is of the responses until sendEndTime, and the confirmed tps is of the
+// txs received until the last one
+func (r *scenarioRunner) report(startTime, sendEndTime, endTime time.Time) *ScenarioReport {
+	report := &ScenarioReport{
+		Scenario:  r.scenario.Name,
+		StartTime: startTime.Format(timeFormat),
+		EndTime:   endTime.Format(timeFormat),
+		Elapsed:   endTime.Sub(startTime).Seconds(),
+		Phases:    r.phases,
+	}
+
+	var (
+		latencies     []time.Duration
+		lastConfirmed time.Time
+	)
+	for _, op := range r.scenario.Operations {
+		stats := r.stats[op.Name]
+		opReport := stats.report(op)
+		report.Operations = append(report.Operations, opReport)
+		report.Count += opReport.Count
+		report.Success += opReport.Success
+		report.Failed += opReport.Failed
+		report.Confirmed += opReport.Confirmed
+
+		stats.mu.Lock()
+		latencies = append(latencies, stats.latencies...)
+		if stats.lastConfirmed.After(lastConfirmed) {
+			lastConfirmed = stats.lastConfirmed
+		}
+		stats.mu.Unlock()
+	}
+	for _, phase := range r.phases {
+		report.Dropped += phase.Dropped
+	}
+
+	report.Latency = newLatencyReport(latencies)
+	if elapsed := sendEndTime.Sub(startTime).Seconds(); elapsed > 0 {
+		report.TPS = float64(report.Success) / elapsed
+	}
+	if report.Confirmed > 0 {
+		report.ConfirmedTPS = float64(report.Confirmed) / lastConfirmed.Sub(startTime).Seconds()
+	}
+	return report
+}
+
+func writeScenarioReport(report *ScenarioReport) error {
+	bytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if reportFile == "" {
+		fmt.Println(string(bytes))
+		return nil
+	}
+	if err = ioutil.WriteFile(reportFile, bytes, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("report is written to %s\n", reportFile)
+	return nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package parallel
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArrivalAtConstantRate(t *testing.T) {
+	phase := &ScenarioPhase{Name: "steady", Duration: 10 * time.Second, Rate: 100}
+
+	offset, ok := phase.arrivalAt(1)
+	assert.True(t, ok)
+	assert.Equal(t, 10*time.Millisecond, offset)
+
+	offset, ok = phase.arrivalAt(1000)
+	assert.True(t, ok)
+	assert.Equal(t, 10*time.Second, offset)
+
+	_, ok = phase.arrivalAt(1001)
+	assert.False(t, ok)
+}
+
+func TestArrivalAtRamp(t *testing.T) {
+	// 0 -> 200 tps in 10s, 1000 arrivals in total, 250 of them in the first half
+	phase := &ScenarioPhase{Name: "ramp", Duration: 10 * time.Second, Rate: 0, TargetRate: 200}
+
+	offset, ok := phase.arrivalAt(250)
+	assert.True(t, ok)
+	assert.InDelta(t, float64(5*time.Second), float64(offset), float64(time.Millisecond))
+
+	offset, ok = phase.arrivalAt(1000)
+	assert.True(t, ok)
+	assert.InDelta(t, float64(10*time.Second), float64(offset), float64(time.Millisecond))
+
+	_, ok = phase.arrivalAt(1001)
+	assert.False(t, ok)
+
+	var last time.Duration
+	for k := 1; k <= 1000; k++ {
+		offset, _ = phase.arrivalAt(k)
+		assert.True(t, offset >= last)
+		last = offset
+	}
+}
+
+func TestPickOperation(t *testing.T) {
+	scenario := &Scenario{Operations: []*ScenarioOperation{
+		{Name: "save", Weight: 3},
+		{Name: "get", Weight: 1},
+	}}
+	assert.Equal(t, 4, scenario.totalWeight())
+	assert.Equal(t, "save", scenario.pickOperation(0).Name)
+	assert.Equal(t, "save", scenario.pickOperation(2).Name)
+	assert.Equal(t, "get", scenario.pickOperation(3).Name)
+}
+
+func TestNewLatencyReport(t *testing.T) {
+	var samples []time.Duration
+	for i := 100; i >= 1; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	report := newLatencyReport(samples)
+	assert.Equal(t, 1.0, report.Min)
+	assert.Equal(t, 50.5, report.Avg)
+	assert.Equal(t, 50.0, report.P50)
+	assert.Equal(t, 95.0, report.P95)
+	assert.Equal(t, 99.0, report.P99)
+	assert.Equal(t, 100.0, report.Max)
+
+	assert.Equal(t, &LatencyReport{}, newLatencyReport(nil))
+}
+
+func TestParamGenerator(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	seq := &ParamGenerator{Key: "file_name", Generator: generatorSequence, Value: "name"}
+	assert.Equal(t, "name1", seq.generate(r))
+	assert.Equal(t, "name2", seq.generate(r))
+
+	randomInt := &ParamGenerator{Key: "amount", Generator: generatorRandomInt, Min: 5, Max: 7}
+	for i := 0; i < 100; i++ {
+		assert.Contains(t, []string{"5", "6", "7"}, randomInt.generate(r))
+	}
+
+	randomString := &ParamGenerator{Key: "file_hash", Generator: generatorRandomString, Value: "h", Length: 8}
+	assert.Len(t, randomString.generate(r), 9)
+
+	choice := &ParamGenerator{Key: "to", Generator: generatorChoice, Choices: []string{"a", "b"}}
+	assert.Contains(t, []string{"a", "b"}, choice.generate(r))
+
+	assert.Equal(t, "v", (&ParamGenerator{Key: "k", Value: "v"}).generate(r))
+
+	assert.Error(t, (&ParamGenerator{Key: "k", Generator: generatorRandomInt, Min: 2, Max: 1}).validate())
+	assert.Error(t, (&ParamGenerator{Key: "k", Generator: "unknown"}).validate())
+	assert.Error(t, (&ParamGenerator{Generator: generatorConst}).validate())
+}
@@ -36,6 +36,8 @@ func NewQueryOnChainCMD() *cobra.Command {
 	cmd.AddCommand(newQueryBlockByHashOnChainCMD())
 	cmd.AddCommand(newQueryBlockByTxIdOnChainCMD())
 	cmd.AddCommand(newQueryArchivedHeightOnChainCMD())
+	cmd.AddCommand(newQueryTxFilterStatsCMD())
+	cmd.AddCommand(newQueryTraceTxCMD())
 
 	return cmd
 }
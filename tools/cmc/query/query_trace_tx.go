@@ -0,0 +1,80 @@
+// Copyright (C) BABEC. All rights reserved.
+// Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package query
+
+import (
+	"fmt"
+
+	"chainmaker.org/chainmaker-go/tools/cmc/util"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	sdk "chainmaker.org/chainmaker/sdk-go/v2"
+	"github.com/hokaccha/go-prettyjson"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// queryTraceTxMethod CHAIN_QUERY method answered by the node with the debug trace of a tx
+	queryTraceTxMethod = "TRACE_TX"
+	// queryTraceTxIdKey parameter key of the id of the committed tx to replay
+	queryTraceTxIdKey = "tx_id"
+)
+
+func newQueryTraceTxCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trace-tx [txid]",
+		Short: "replay an on-chain tx with the debug trace",
+		Long: "replay an on-chain tx against the state its block was executed on, and print every state " +
+			"get/put/del, cross-contract call and event with the gas used at it in execution order, " +
+			"together with the result committed in the block. Nothing is committed, the key history of the " +
+			"node must be enabled",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runQueryTraceTxCMD(args[0])
+		},
+	}
+
+	util.AttachAndRequiredFlags(cmd, flags, []string{
+		flagSdkConfPath, flagChainId,
+	})
+	util.AttachFlags(cmd, flags, []string{
+		flagEnableCertHash,
+	})
+	return cmd
+}
+
+// runQueryTraceTxCMD `query trace-tx` command implementation
+func runQueryTraceTxCMD(txId string) error {
+	//// 1.Chain Client
+	cc, err := sdk.NewChainClient(
+		sdk.WithConfPath(sdkConfPath),
+		sdk.WithChainClientChainId(chainId),
+	)
+	if err != nil {
+		return err
+	}
+	defer cc.Stop()
+	if err := util.DealChainClientCertHash(cc, enableCertHash); err != nil {
+		return err
+	}
+
+	//// 2.Replay the tx with the trace
+	resp, err := cc.QuerySystemContract(syscontract.SystemContract_CHAIN_QUERY.String(), queryTraceTxMethod,
+		[]*common.KeyValuePair{{Key: queryTraceTxIdKey, Value: []byte(txId)}}, -1)
+	if err != nil {
+		return err
+	}
+	if err = util.CheckProposalRequestResp(resp, true); err != nil {
+		return err
+	}
+
+	output, err := prettyjson.Format(resp.ContractResult.Result)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(output))
+	return nil
+}
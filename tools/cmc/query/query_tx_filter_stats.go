@@ -0,0 +1,73 @@
+// Copyright (C) BABEC. All rights reserved.
+// Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package query
+
+import (
+	"fmt"
+
+	"chainmaker.org/chainmaker-go/tools/cmc/util"
+	"chainmaker.org/chainmaker/pb-go/v2/syscontract"
+	sdk "chainmaker.org/chainmaker/sdk-go/v2"
+	"github.com/hokaccha/go-prettyjson"
+	"github.com/spf13/cobra"
+)
+
+// queryTxFilterStatsMethod CHAIN_QUERY method answered by the node with the statistics of its tx filter
+const queryTxFilterStatsMethod = "GET_TX_FILTER_STATS"
+
+func newQueryTxFilterStatsCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tx-filter-stats",
+		Short: "query tx filter statistics of a node",
+		Long: "query tx filter statistics of a node, e.g. keys, fill ratio, estimated false positive rate and " +
+			"store fallbacks. The node is picked from the sdk config, keep only one node in it to inspect a given node",
+		Args: cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runQueryTxFilterStatsCMD()
+		},
+	}
+
+	util.AttachAndRequiredFlags(cmd, flags, []string{
+		flagSdkConfPath, flagChainId,
+	})
+	util.AttachFlags(cmd, flags, []string{
+		flagEnableCertHash,
+	})
+	return cmd
+}
+
+// runQueryTxFilterStatsCMD `query tx-filter-stats` command implementation
+func runQueryTxFilterStatsCMD() error {
+	//// 1.Chain Client
+	cc, err := sdk.NewChainClient(
+		sdk.WithConfPath(sdkConfPath),
+		sdk.WithChainClientChainId(chainId),
+	)
+	if err != nil {
+		return err
+	}
+	defer cc.Stop()
+	if err := util.DealChainClientCertHash(cc, enableCertHash); err != nil {
+		return err
+	}
+
+	//// 2.Query tx filter stats
+	resp, err := cc.QuerySystemContract(syscontract.SystemContract_CHAIN_QUERY.String(),
+		queryTxFilterStatsMethod, nil, -1)
+	if err != nil {
+		return err
+	}
+	if err = util.CheckProposalRequestResp(resp, true); err != nil {
+		return err
+	}
+
+	output, err := prettyjson.Format(resp.ContractResult.Result)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(output))
+	return nil
+}